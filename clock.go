@@ -0,0 +1,55 @@
+package goll
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// maxTimeFuncStep is the max difference allowed between
+// two consecutive calls to a custom TimeFunc when validating it.
+const maxTimeFuncStep = time.Minute
+
+// monotonicTimeFunc wraps the given time source so that the time
+// passed since the construction is measured on the monotonic clock
+// instead of the wall clock.
+//
+// The base time is captured once and the returned times are obtained
+// by adding the elapsed time to it, so that they keep mapping
+// to the same milliseconds domain while being immune to wall clock steps.
+//
+// Time sources without a monotonic reading, like the ones
+// used in tests, are followed as they are.
+func monotonicTimeFunc(timeFunc func() time.Time) func() time.Time {
+	base := timeFunc()
+
+	return func() time.Time {
+		return base.Add(timeFunc().Sub(base))
+	}
+}
+
+// validateTimeFunc performs a cheap sanity check on a custom time source
+// by calling it twice, so that a broken one is reported at construction
+// instead of silently corrupting the windows.
+func validateTimeFunc(timeFunc func() time.Time) error {
+	if timeFunc == nil {
+		return nil
+	}
+
+	first := timeFunc()
+	second := timeFunc()
+
+	if first.IsZero() || second.IsZero() {
+		return errors.New("TimeFunc should not return a zero time")
+	}
+	if first.UnixMilli() <= 0 {
+		return fmt.Errorf("TimeFunc should return times after the Unix epoch (given: %v)", first)
+	}
+	if second.Before(first) {
+		return fmt.Errorf("TimeFunc should return non-decreasing times (given: %v after %v)", second, first)
+	}
+	if second.Sub(first) > maxTimeFuncStep {
+		return fmt.Errorf("TimeFunc should return consecutive times within %v (given: %v after %v)", maxTimeFuncStep, second, first)
+	}
+	return nil
+}
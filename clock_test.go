@@ -0,0 +1,134 @@
+package goll
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMonotonicTimeFunc(t *testing.T) {
+	// the base time is anchored to the wall clock
+	before := time.Now()
+	clock := monotonicTimeFunc(time.Now)
+	first := clock()
+	assert.False(t, first.Before(before))
+	assert.True(t, first.Sub(before) < time.Second)
+
+	// and keeps moving forward
+	time.Sleep(2 * time.Millisecond)
+	second := clock()
+	assert.True(t, second.After(first))
+
+	// time sources without a monotonic reading are followed as they are
+	current := time.UnixMilli(1000000)
+	clock = monotonicTimeFunc(func() time.Time {
+		return current
+	})
+	current = time.UnixMilli(1005000)
+	assert.Equal(t, int64(1005000), clock().UnixMilli())
+	current = time.UnixMilli(999000)
+	assert.Equal(t, int64(999000), clock().UnixMilli())
+}
+
+func TestMonotonicClockWithTimeFunc(t *testing.T) {
+	ti := buildInstance(t, func(config *Config) {
+		config.UseMonotonicClock = true
+	})
+
+	applySingleWindowLoadDistribution(t, ti, defaultTestTenantKey)
+	ti.AssertWindowStatus(
+		t, defaultTestTenantKey, 72,
+		"1008000:14", "1005000:15", "1004000:8", "1002000:20",
+		"1001000:10", "1000000:5",
+	)
+
+	cti := buildCompositeInstance(t, func(config *CompositeConfig) {
+		config.UseMonotonicClock = true
+	})
+	cti.TimeTravel(1500)
+	assert.True(t, submitNoError(cti.Instance.Submit(defaultTestTenantKey, 5)).Accepted)
+	assert.Equal(t, uint64(1001000), cti.Instance.Limiters[0].getTenant(defaultTestTenantKey).WindowQueue.Front().(*windowSegment).StartTime)
+
+	_, err := NewComposite(&CompositeConfig{
+		Limiters: []Config{
+			{
+				MaxLoad:           defaultMaxLoad,
+				WindowSize:        defaultWindowSize,
+				UseMonotonicClock: true,
+			},
+		},
+	})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "cannot specify UseMonotonicClock on a composed limiter")
+}
+
+func TestValidateTimeFunc(t *testing.T) {
+	assert.Nil(t, validateTimeFunc(nil))
+	assert.Nil(t, validateTimeFunc(time.Now))
+
+	fixed := func() time.Time {
+		return time.UnixMilli(1000000)
+	}
+	assert.Nil(t, validateTimeFunc(fixed))
+
+	err := validateTimeFunc(func() time.Time {
+		return time.Time{}
+	})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "zero time")
+
+	err = validateTimeFunc(func() time.Time {
+		return time.UnixMilli(0)
+	})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "after the Unix epoch")
+
+	calls := int64(0)
+	err = validateTimeFunc(func() time.Time {
+		calls++
+		return time.UnixMilli(2000000 - calls*1000)
+	})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "non-decreasing")
+
+	calls = 0
+	err = validateTimeFunc(func() time.Time {
+		calls++
+		return time.UnixMilli(calls * 3600000)
+	})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "within")
+	assert.Equal(t, int64(2), calls)
+}
+
+func TestNewWithBrokenTimeFunc(t *testing.T) {
+	broken := func() time.Time {
+		return time.Time{}
+	}
+
+	_, err := New(&Config{
+		MaxLoad:    100,
+		WindowSize: 10 * time.Second,
+		TimeFunc:   broken,
+	})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "TimeFunc")
+
+	_, err = NewComposite(&CompositeConfig{
+		Limiters: []Config{
+			{MaxLoad: 100, WindowSize: 10 * time.Second},
+		},
+		TimeFunc: broken,
+	})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "TimeFunc")
+
+	_, err = NewTokenBucket(&TokenBucketConfig{
+		Capacity:   100,
+		RefillRate: 10,
+		TimeFunc:   broken,
+	})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "TimeFunc")
+}
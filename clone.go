@@ -0,0 +1,61 @@
+package goll
+
+import (
+	"math/rand"
+	"time"
+)
+
+// CloneEmpty returns a new limiter with the same configuration
+// of the current one but without any tenant state.
+//
+// The clone shares the time functions, the Logger, the CostFunc,
+// the TenantKeyValidator and the ParentKeyFunc, but it is never synchronized via SyncAdapter
+// so that the two instances don't fight over the same keys,
+// and the OnAccept/OnReject/OnOverload hooks are not called.
+func (instance *loadLimiterDefaultImpl) CloneEmpty() StandaloneLoadLimiter {
+	instance.Lock.RLock()
+	config := *instance.Config
+	instance.Lock.RUnlock()
+
+	// the clone has no SyncAdapter to write back to.
+	config.AsyncWriteBack = false
+
+	out := loadLimiterDefaultImpl{
+		Config:     &config,
+		TenantData: make(map[string]*loadLimiterDefaultImplTenantData),
+		TimeFunc:   instance.TimeFunc,
+		SleepFunc:  instance.SleepFunc,
+		Logger:     instance.Logger,
+
+		TenantKeyValidator: instance.TenantKeyValidator,
+		ParentKeyFunc:      instance.ParentKeyFunc,
+		CostFunc:           instance.CostFunc,
+	}
+
+	if config.RetryInJitterFactor > 0 {
+		out.jitterRand = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+
+	if config.TenantIdleTTL > 0 {
+		out.startIdleTenantsSweeper()
+	}
+
+	return &out
+}
+
+// CloneEmpty returns a new limiter with the same configuration
+// of the current one but without any bucket.
+func (instance *tokenBucketLimiterImpl) CloneEmpty() StandaloneLoadLimiter {
+	instance.Lock.Lock()
+	config := *instance.Config
+	instance.Lock.Unlock()
+
+	return &tokenBucketLimiterImpl{
+		Config:     &config,
+		TenantData: make(map[string]*tokenBucketTenantData),
+		TimeFunc:   instance.TimeFunc,
+		SleepFunc:  instance.SleepFunc,
+		Logger:     instance.Logger,
+		CostFunc:   instance.CostFunc,
+	}
+}
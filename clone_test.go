@@ -0,0 +1,57 @@
+package goll
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCloneEmpty(t *testing.T) {
+	adapter := testSyncAdapter{}
+	adapter.Clear()
+
+	accepted := 0
+	ti := buildInstance(t, func(config *Config) {
+		config.OverstepPenaltyFactor = 0.2
+		config.SyncAdapter = &adapter
+		config.OnAccept = func(tenantKey string, load uint64) {
+			accepted++
+		}
+	})
+
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 80)).Accepted)
+	assert.Nil(t, ti.Instance.SetMaxLoad(120))
+	adapter.Clear()
+
+	clone := ti.Instance.CloneEmpty().(*loadLimiterDefaultImpl)
+
+	// the clone starts from an empty state with the same configuration
+	assert.Equal(t, []string{}, clone.ListTenants())
+	assert.Equal(t, ti.Instance.EffectiveConfig(), clone.EffectiveConfig())
+
+	assert.True(t, submitNoError(clone.Submit(defaultTestTenantKey, 120)).Accepted)
+	assert.False(t, submitNoError(clone.Submit(defaultTestTenantKey, 1)).Accepted)
+
+	// the clone follows the same time
+	ti.TimeTravel(10000)
+	assert.True(t, submitNoError(clone.Submit(defaultTestTenantKey, 1)).Accepted)
+
+	// the clone is not synchronized and does not call the hooks
+	assert.Equal(t, 0, len(adapter.collector))
+	assert.Equal(t, 1, accepted)
+
+	// changes to the clone do not affect the original
+	assert.Nil(t, clone.SetMaxLoad(50))
+	assert.Equal(t, uint64(120), ti.Instance.EffectiveConfig().MaxLoad)
+	ti.AssertWindowStatus(t, defaultTestTenantKey, 80, "1000000:80")
+}
+
+func TestTokenBucketCloneEmpty(t *testing.T) {
+	ti := buildTokenBucketInstance(t, nil)
+
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 100)).Accepted)
+
+	clone := ti.Instance.CloneEmpty()
+	assert.True(t, submitNoError(clone.Submit(defaultTestTenantKey, 100)).Accepted)
+	assert.False(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 1)).Accepted)
+}
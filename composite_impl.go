@@ -1,7 +1,9 @@
 package goll
 
 import (
+	"context"
 	"fmt"
+	"math"
 	"sync"
 	"time"
 )
@@ -16,11 +18,63 @@ type compositeLoadLimiterDefaultImpl struct {
 	// the limiter data in a clustered environment.
 	SyncAdapter SyncAdapter
 
+	// SyncAdapterSelector optionally picks the SyncAdapter for each tenant.
+	SyncAdapterSelector func(tenantKey string) SyncAdapter
+
+	// StrictSync makes synchronization errors blocking.
+	StrictSync bool
+
+	// OnSyncMetrics optionally receives the timings of every synchronization.
+	OnSyncMetrics func(tenantKey string, lockWait time.Duration, fetch time.Duration, write time.Duration)
+
+	// SyncHealthCheckKey is the key used by Ping.
+	SyncHealthCheckKey string
+
+	// VerifyWrites makes every write to the remote store verified with a fetch.
+	VerifyWrites bool
+
+	// TenantKeyValidator optionally checks the tenant keys of the load requests.
+	TenantKeyValidator func(tenantKey string) error
+
+	// Hooks are notified of every accepted or rejected load.
+	Hooks submitHooks
+
 	TimeFunc  func() time.Time
 	SleepFunc func(d time.Duration)
+
+	// closed is set when the limiter gets closed.
+	closed bool
+}
+
+type compositeLoadLimiterEffectiveConfig struct {
+	// Global holds, for each composed limiter,
+	// whether it is shared by all the tenants.
+	Global []bool
+
+	// Labels holds, for each composed limiter,
+	// the labels it is restricted to, nil if it applies to every load.
+	Labels [][]string
+
+	// Mode determines how the decisions of the composed limiters are combined.
+	Mode CompositeMode
+
+	// lock acquisition retries, 0 if not required
+	SyncLockTimeout       time.Duration
+	SyncLockRetryInterval time.Duration
 }
 
-type compositeLoadLimiterEffectiveConfig struct{}
+// globalTenantKey is the fixed key used by the Global composed limiters
+// to hold the state shared by all the tenants.
+const globalTenantKey = "\x00global"
+
+// limiterTenantKey returns the key used by the composed limiter
+// at the given index to hold the state of the given tenant.
+func (instance *compositeLoadLimiterDefaultImpl) limiterTenantKey(index int, tenantKey string) string {
+	if instance.Config.Global[index] {
+		return globalTenantKey
+	}
+	return tenantKey
+}
 
 func (instance *compositeLoadLimiterDefaultImpl) currentTime() time.Time {
 	// hook time provider here to allow easier testing
@@ -29,9 +83,19 @@ func (instance *compositeLoadLimiterDefaultImpl) currentTime() time.Time {
 
 func (instance *compositeLoadLimiterDefaultImpl) sleep(d time.Duration) {
 	// hook time provider here to allow easier testing
+	if instance.SleepFunc == nil {
+		time.Sleep(d)
+		return
+	}
 	instance.SleepFunc(d)
 }
 
+// sleepCtx works like sleep but returns early
+// with the context error if the context gets cancelled while waiting.
+func (instance *compositeLoadLimiterDefaultImpl) sleepCtx(ctx context.Context, d time.Duration) error {
+	return sleepWithContext(ctx, d, instance.SleepFunc)
+}
+
 // Probe checks if the given load would be allowed right now.
 // it is a readonly method that does not modify the current window data.
 func (instance *compositeLoadLimiterDefaultImpl) Probe(tenantKey string, load uint64) (bool, error) {
@@ -41,19 +105,28 @@ func (instance *compositeLoadLimiterDefaultImpl) Probe(tenantKey string, load ui
 	instance.Lock.Lock()
 	defer instance.Lock.Unlock()
 
-	outResult := true
+	if instance.closed {
+		return false, ErrLimiterClosed
+	}
+	if err := instance.validateTenantKey(tenantKey); err != nil {
+		return false, err
+	}
+
+	anyMode := instance.Config.Mode == CompositeModeAny
+	outResult := !anyMode
 	var outErr error
 
 	err := instance.withSyncTransaction(func() {
 		// a composite Probe will return true
-		// if all combined limiters do.
-		for _, limiter := range instance.Limiters {
-			req := limiter.buildLoadRequest(t, tenantKey, load)
+		// if all combined limiters do,
+		// or if any of them does in CompositeModeAny.
+		for i, limiter := range instance.Limiters {
+			req := limiter.buildLoadRequest(t, instance.limiterTenantKey(i, tenantKey), load)
 
 			r := limiter.probe(req)
 
-			if !r {
-				outResult = false
+			if r == anyMode {
+				outResult = r
 				break
 			}
 		}
@@ -89,27 +162,62 @@ func (instance *compositeLoadLimiterDefaultImpl) Probe(tenantKey string, load ui
 // if at least one of the rejection responses had a valid RetryIn field
 // the output will have a RetryIn corresponding to the highest
 // RetryIn of all reject responses.
+//
+// In CompositeModeAny the load is instead committed to the first instance
+// accepting it, see submitAny.
 func (instance *compositeLoadLimiterDefaultImpl) Submit(tenantKey string, load uint64) (SubmitResult, error) {
+	res, transition, err := instance.submitLocked(tenantKey, nil, load)
+	if err == nil {
+		instance.Hooks.notify(tenantKey, load, res, transition)
+	}
+	return res, err
+}
 
+// submitLocked handles a submission evaluated against the composed limiters
+// applying to the given labels, see appliesTo.
+func (instance *compositeLoadLimiterDefaultImpl) submitLocked(tenantKey string, labels []string, load uint64) (SubmitResult, overloadTransition, error) {
 	// lock the composite instance for thread safety.
 	instance.Lock.Lock()
 	defer instance.Lock.Unlock()
 
+	if instance.closed {
+		return SubmitResult{}, overloadUnchanged, ErrLimiterClosed
+	}
+	if err := instance.validateTenantKey(tenantKey); err != nil {
+		return SubmitResult{}, overloadUnchanged, err
+	}
+
 	var result SubmitResult
+	var transition overloadTransition
 
-	err := instance.withSyncTransaction(func() {
-		result = instance.submit(tenantKey, load)
+	txResult, err := instance.runSyncTransaction(func() {
+		wasOverBefore := instance.isOverloaded(tenantKey)
+		result = instance.submit(tenantKey, labels, load)
+		transition = overloadTransitionOf(wasOverBefore, instance.isOverloaded(tenantKey))
 	}, syncTxOptions{
 		TenantKey: tenantKey,
 		ReadOnly:  false,
 	})
 
-	return result, err
+	if err != nil {
+		return SubmitResult{}, overloadUnchanged, err
+	}
+
+	result.SyncWarnings = txResult.Warnings
+
+	return result, transition, nil
 }
 
-func (instance *compositeLoadLimiterDefaultImpl) submit(tenantKey string, load uint64) SubmitResult {
+func (instance *compositeLoadLimiterDefaultImpl) submit(tenantKey string, labels []string, load uint64) SubmitResult {
+	if instance.Config.Mode == CompositeModeAny {
+		return instance.submitAny(tenantKey, labels, load)
+	}
+
 	allAccepted := true
+	applied := 0
+	permanentlyRejected := false
 	highestWaitTime := time.Duration(0)
+	var rejectedBy []int
 
 	t := instance.currentTime()
 
@@ -120,8 +228,12 @@ func (instance *compositeLoadLimiterDefaultImpl) submit(tenantKey string, load u
 	requestMaps := make(map[int]*submitRequest)
 
 	for i, limiter := range instance.Limiters {
+		if !instance.appliesTo(i, labels) {
+			continue
+		}
+		applied++
 
-		sr := limiter.buildLoadRequest(t, tenantKey, load)
+		sr := limiter.buildLoadRequest(t, instance.limiterTenantKey(i, tenantKey), load)
 		requestMaps[i] = sr
 
 		// first all the instances are probed
@@ -129,10 +241,15 @@ func (instance *compositeLoadLimiterDefaultImpl) submit(tenantKey string, load u
 
 		if !probeResult {
 			allAccepted = false
+			rejectedBy = append(rejectedBy, i)
 
 			// rejectLoad is called on all the rejecting instances
 			rejectionResult := limiter.rejectLoad(sr)
 
+			if rejectionResult.PermanentlyRejected {
+				permanentlyRejected = true
+			}
+
 			// if at least one of the rejection responses had a valid RetryIn field
 			// the output will have a RetryIn corresponding to the highest
 			// RetryIn of all reject responses.
@@ -147,20 +264,93 @@ func (instance *compositeLoadLimiterDefaultImpl) submit(tenantKey string, load u
 		// only if all the instances returned true,
 		// acceptLoad is called on every instance.
 		for i, limiter := range instance.Limiters {
-			req := requestMaps[i]
-			limiter.acceptLoad(req)
+			if req, ok := requestMaps[i]; ok {
+				limiter.acceptLoad(req)
+			}
+		}
+	} else if len(rejectedBy) < applied {
+		// some of the instances would have accepted the load:
+		// track the rejecting ones as the bottleneck.
+		for _, i := range rejectedBy {
+			requestMaps[i].TenantData.BottleneckCount++
 		}
 	}
 
 	res := SubmitResult{
-		Accepted:         allAccepted,
-		RetryInAvailable: (!allAccepted && highestWaitTime > 0),
-		RetryIn:          highestWaitTime,
+		Accepted:            allAccepted,
+		RetryInAvailable:    (!allAccepted && !permanentlyRejected && highestWaitTime > 0),
+		PermanentlyRejected: permanentlyRejected,
+		RejectedBy:          rejectedBy,
+	}
+	if res.RetryInAvailable {
+		res.RetryIn = highestWaitTime
 	}
 
 	return res
 }
 
+// submitAny handles a submission in CompositeModeAny.
+//
+// the instances are probed in order and the load is committed
+// only to the first one accepting it, leaving the others untouched.
+//
+// only if all the instances rejected the load
+// rejectLoad is called on every instance
+// and the output will have a RetryIn corresponding to the lowest
+// RetryIn of all reject responses.
+func (instance *compositeLoadLimiterDefaultImpl) submitAny(tenantKey string, labels []string, load uint64) SubmitResult {
+	t := instance.currentTime()
+
+	requestMaps := make(map[int]*submitRequest)
+
+	for i, limiter := range instance.Limiters {
+		if !instance.appliesTo(i, labels) {
+			continue
+		}
+		sr := limiter.buildLoadRequest(t, instance.limiterTenantKey(i, tenantKey), load)
+		requestMaps[i] = sr
+
+		if limiter.probe(sr) {
+			limiter.acceptLoad(sr)
+			return SubmitResult{
+				Accepted: true,
+			}
+		}
+	}
+
+	// the load would never fit only if it is over the MaxLoad of every instance
+	permanentlyRejected := true
+	lowestWaitTime := time.Duration(0)
+	retryInAvailable := false
+	rejectedBy := make([]int, 0, len(instance.Limiters))
+
+	for i, limiter := range instance.Limiters {
+		if _, ok := requestMaps[i]; !ok {
+			continue
+		}
+		rejectedBy = append(rejectedBy, i)
+
+		rejectionResult := limiter.rejectLoad(requestMaps[i])
+
+		if !rejectionResult.PermanentlyRejected {
+			permanentlyRejected = false
+		}
+		if rejectionResult.RetryInAvailable &&
+			(!retryInAvailable || rejectionResult.RetryIn < lowestWaitTime) {
+			lowestWaitTime = rejectionResult.RetryIn
+			retryInAvailable = true
+		}
+	}
+
+	return SubmitResult{
+		Accepted:            false,
+		RetryInAvailable:    retryInAvailable,
+		RetryIn:             lowestWaitTime,
+		PermanentlyRejected: permanentlyRejected,
+		RejectedBy:          rejectedBy,
+	}
+}
+
 // SubmitUntil asks for the given load to be accepted and,
 // in case of rejection, automatically handles retries and delays.
 // In case of acceptance a nil value is returned.
@@ -172,7 +362,7 @@ func (instance *compositeLoadLimiterDefaultImpl) submit(tenantKey string, load u
 // gollLoadRequestSubmissionTimeout / goll.LoadRequestRejected
 // types if you need additional info.
 func (instance *compositeLoadLimiterDefaultImpl) SubmitUntil(tenantKey string, load uint64, timeout time.Duration) error {
-	return instance.submitUntil(tenantKey, load, timeout).Error
+	return instance.submitUntil(context.Background(), tenantKey, load, timeout).Error
 }
 
 // SubmitUntil asks for the given load to be accepted and,
@@ -189,10 +379,46 @@ func (instance *compositeLoadLimiterDefaultImpl) SubmitUntil(tenantKey string, l
 // gollLoadRequestSubmissionTimeout / goll.LoadRequestRejected
 // types if you need additional info.
 func (instance *compositeLoadLimiterDefaultImpl) SubmitUntilWithDetails(tenantKey string, load uint64, timeout time.Duration) SubmitUntilResult {
-	return instance.submitUntil(tenantKey, load, timeout)
+	return instance.submitUntil(context.Background(), tenantKey, load, timeout)
+}
+
+// SubmitUntilCtx works like SubmitUntilWithDetails
+// but stops waiting as soon as the given context is cancelled.
+//
+// In case of cancellation the Error field of the output object
+// wraps the context error and can be checked with errors.Is
+// against context.Canceled or context.DeadlineExceeded.
+func (instance *compositeLoadLimiterDefaultImpl) SubmitUntilCtx(ctx context.Context, tenantKey string, load uint64, timeout time.Duration) SubmitUntilResult {
+	return instance.submitUntil(ctx, tenantKey, load, timeout)
+}
+
+// SubmitUntilWithOptions works like SubmitUntilWithDetails
+// but accepts additional options, like a maximum number of attempts
+// to be made regardless of the timeout.
+//
+// When the attempts are exhausted the Error field of the output object
+// is a LoadRequestTimeout with AttemptsExhausted set to true.
+func (instance *compositeLoadLimiterDefaultImpl) SubmitUntilWithOptions(tenantKey string, load uint64, options SubmitUntilOptions) SubmitUntilResult {
+	return instance.submitUntilWithOptions(context.Background(), tenantKey, load, options)
+}
+
+// SubmitUntilWithBackoff works like SubmitUntilWithDetails
+// but waits before each retry for the time computed by the given BackoffFunc.
+// The timeout is still honored.
+func (instance *compositeLoadLimiterDefaultImpl) SubmitUntilWithBackoff(tenantKey string, load uint64, timeout time.Duration, backoff BackoffFunc) SubmitUntilResult {
+	return instance.submitUntilWithOptions(context.Background(), tenantKey, load, SubmitUntilOptions{
+		Timeout: timeout,
+		Backoff: backoff,
+	})
+}
+
+func (instance *compositeLoadLimiterDefaultImpl) submitUntil(ctx context.Context, tenantKey string, load uint64, timeout time.Duration) SubmitUntilResult {
+	return instance.submitUntilWithOptions(ctx, tenantKey, load, SubmitUntilOptions{
+		Timeout: timeout,
+	})
 }
 
-func (instance *compositeLoadLimiterDefaultImpl) submitUntil(tenantKey string, load uint64, timeout time.Duration) SubmitUntilResult {
+func (instance *compositeLoadLimiterDefaultImpl) submitUntilWithOptions(ctx context.Context, tenantKey string, load uint64, options SubmitUntilOptions) SubmitUntilResult {
 
 	// save the original request time to compute the timeout treshold
 	t := instance.currentTime()
@@ -205,7 +431,7 @@ func (instance *compositeLoadLimiterDefaultImpl) submitUntil(tenantKey string, l
 
 	// a negative timeout is not allowed
 	// and will be rejected immediately
-	if timeout < 0 {
+	if options.Timeout < 0 {
 		instance.Logger.Warning("submit of task failed because of invalid timeout")
 		out.Error = &LoadRequestRejected{
 			Reason: "invalid timeout",
@@ -214,7 +440,7 @@ func (instance *compositeLoadLimiterDefaultImpl) submitUntil(tenantKey string, l
 	}
 
 	// compute the timeout treshold
-	timeoutAt := t.Add(timeout)
+	timeoutAt := t.Add(options.Timeout)
 
 	for {
 		out.AttemptsNumber++
@@ -244,25 +470,40 @@ func (instance *compositeLoadLimiterDefaultImpl) submitUntil(tenantKey string, l
 			break
 		}
 
+		// the maximum number of attempts was made,
+		// there's no point in waiting for another one.
+		if options.MaxAttempts > 0 && out.AttemptsNumber >= options.MaxAttempts {
+			instance.Logger.Warning("submit of task failed and attempts were exhausted")
+			out.Error = &LoadRequestTimeout{
+				WaitedFor:         out.WaitedFor,
+				AttemptsNumber:    out.AttemptsNumber,
+				AttemptsExhausted: true,
+			}
+			break
+		}
+
 		// We got a RetryIn from the rejection.
 		// If the current time plus the required wait time
 		// would go over the timeout treshold there's no point in waiting,
 		// we fail with a LoadRequestTimeout error
 		// without waiting.
-		if instance.currentTime().Add(submitResult.RetryIn).After(timeoutAt) {
+		waitFor := options.retryWait(out.AttemptsNumber, submitResult.RetryIn)
+		if instance.currentTime().Add(waitFor).After(timeoutAt) {
 			instance.Logger.Warning("submit of task failed and retrying timed out")
 			out.Error = &LoadRequestTimeout{
-				WaitedFor:      out.WaitedFor,
-				AttemptsNumber: out.AttemptsNumber,
+				WaitedFor:       out.WaitedFor,
+				AttemptsNumber:  out.AttemptsNumber,
+				WouldHaveWaited: waitFor,
 			}
 			break
 		}
 
-		// sleep for the exact required amount of time.
-		waitFor := submitResult.RetryIn
+		// sleep for the required amount of time.
 		instance.Logger.Debug(fmt.Sprintf("submit of task was rejected, waiting %v ms and retrying", waitFor.Milliseconds()))
-		instance.sleep(waitFor)
-		out.WaitedFor += waitFor
+		if interrupted := waitForRetry(ctx, instance.currentTime, instance.sleepCtx, waitFor, &out); interrupted {
+			instance.Logger.Warning("submit of task was interrupted while waiting")
+			break
+		}
 
 		instance.Logger.Debug("submit of task will now be reattempted")
 	}
@@ -277,6 +518,10 @@ func (instance *compositeLoadLimiterDefaultImpl) submitUntil(tenantKey string, l
 // composite limiter itself and statistics for all the single composed
 // limiters will be returned.
 func (instance *compositeLoadLimiterDefaultImpl) Stats(tenantKey string) (CompositeRuntimeStatistics, error) {
+	if err := instance.validateTenantKey(tenantKey); err != nil {
+		return CompositeRuntimeStatistics{}, err
+	}
+
 	instance.Lock.Lock()
 	defer instance.Lock.Unlock()
 
@@ -285,15 +530,13 @@ func (instance *compositeLoadLimiterDefaultImpl) Stats(tenantKey string) (Compos
 
 	err := instance.withSyncTransaction(func() {
 
-		out = CompositeRuntimeStatistics{}
-
 		cs, err := instance.compositeStats(tenantKey)
 		if err != nil {
 			outErr = err
 			return
 		}
 
-		out.LimitersStats = cs
+		out = cs
 
 	}, syncTxOptions{
 		TenantKey: tenantKey,
@@ -307,18 +550,544 @@ func (instance *compositeLoadLimiterDefaultImpl) Stats(tenantKey string) (Compos
 	return out, outErr
 }
 
+// EffectiveConfig returns a read-only snapshot of the configuration
+// in use by each composed limiter.
+func (instance *compositeLoadLimiterDefaultImpl) EffectiveConfig() []EffectiveConfig {
+	instance.Lock.Lock()
+	defer instance.Lock.Unlock()
+
+	out := make([]EffectiveConfig, len(instance.Limiters))
+	for i, limiter := range instance.Limiters {
+		out[i] = limiter.EffectiveConfig()
+		out[i].Global = instance.Config.Global[i]
+		out[i].Labels = append([]string(nil), instance.Config.Labels[i]...)
+	}
+
+	return out
+}
+
+// ListTenants returns the keys of all the tenants
+// currently holding some state in any of the composed limiters.
+func (instance *compositeLoadLimiterDefaultImpl) ListTenants() []string {
+	instance.Lock.Lock()
+	defer instance.Lock.Unlock()
+
+	return instance.listTenants()
+}
+
+func (instance *compositeLoadLimiterDefaultImpl) listTenants() []string {
+	seen := make(map[string]bool)
+	out := make([]string, 0)
+
+	for i, limiter := range instance.Limiters {
+		if instance.Config.Global[i] {
+			continue
+		}
+		for _, tenantKey := range limiter.listTenants() {
+			if !seen[tenantKey] {
+				seen[tenantKey] = true
+				out = append(out, tenantKey)
+			}
+		}
+	}
+
+	return out
+}
+
+// EvictTenant removes all the state held for the given tenant
+// from all the composed limiters, returning true if some state existed.
+//
+// A subsequent request for the same tenant starts from a fresh state.
+// The state shared by all the tenants in Global limiters is not affected.
+func (instance *compositeLoadLimiterDefaultImpl) EvictTenant(tenantKey string) bool {
+	if instance.validateTenantKey(tenantKey) != nil {
+		return false
+	}
+
+	instance.Lock.Lock()
+	defer instance.Lock.Unlock()
+
+	existed := false
+	for i, limiter := range instance.Limiters {
+		if instance.Config.Global[i] {
+			continue
+		}
+		if limiter.evictTenant(tenantKey) {
+			existed = true
+		}
+	}
+
+	return existed
+}
+
+// PrewarmTenants allocates the state for the given tenants
+// in all the composed limiters in advance,
+// so that their first requests don't pay for the allocation.
+// Invalid tenant keys are logged and skipped.
+//
+// The state shared by all the tenants in Global limiters is not affected.
+func (instance *compositeLoadLimiterDefaultImpl) PrewarmTenants(tenantKeys ...string) {
+	instance.Lock.Lock()
+	defer instance.Lock.Unlock()
+
+	for _, tenantKey := range tenantKeys {
+		if err := instance.validateTenantKey(tenantKey); err != nil {
+			logWarnw(instance.Logger, "skipping invalid tenant key on prewarm",
+				"tenantKey", tenantKey,
+				"error", err,
+			)
+			continue
+		}
+		for i, limiter := range instance.Limiters {
+			if instance.Config.Global[i] {
+				continue
+			}
+			limiter.getTenant(tenantKey)
+		}
+	}
+}
+
+// Close releases the resources held by the limiter
+// and by all the composed limiters, stopping any background routine.
+//
+// If the SyncAdapter implements io.Closer, it gets closed as well.
+// Further calls to Probe and Submit will return ErrLimiterClosed.
+func (instance *compositeLoadLimiterDefaultImpl) Close() error {
+	instance.Lock.Lock()
+	defer instance.Lock.Unlock()
+
+	if instance.closed {
+		return nil
+	}
+	instance.closed = true
+
+	for i, limiter := range instance.Limiters {
+		if err := limiter.Close(); err != nil {
+			return fmt.Errorf("error closing limiter at index %d: %w", i, err)
+		}
+	}
+
+	return closeSyncAdapter(instance.SyncAdapter)
+}
+
+// ResetTenant clears all the load accumulated by the given tenant
+// in all the composed limiters.
+//
+// It does nothing for a tenant that has no state yet.
+// The load accumulated in Global limiters is not affected.
+func (instance *compositeLoadLimiterDefaultImpl) ResetTenant(tenantKey string) error {
+	instance.Lock.Lock()
+	defer instance.Lock.Unlock()
+
+	if err := instance.validateTenantKey(tenantKey); err != nil {
+		return err
+	}
+
+	if instance.syncAdapterFor(tenantKey) == nil {
+		for i, limiter := range instance.Limiters {
+			if instance.Config.Global[i] {
+				continue
+			}
+			if tenant, exists := limiter.TenantData[tenantKey]; exists {
+				limiter.resetTenant(tenant)
+			}
+		}
+		return nil
+	}
+
+	return instance.withSyncTransaction(func() {
+		for _, limiter := range instance.Limiters {
+			limiter.resetTenant(limiter.getTenant(tenantKey))
+		}
+	}, syncTxOptions{
+		TenantKey: tenantKey,
+		ReadOnly:  false,
+	})
+}
+
+// TruncateAfter removes from the windows of all the composed limiters
+// all the load allocated to segments starting at or after the cutoff time
+// for the given tenant.
+//
+// The load accumulated in Global limiters is not affected
+// because it can't be attributed to a single tenant.
+func (instance *compositeLoadLimiterDefaultImpl) TruncateAfter(tenantKey string, cutoff time.Time) error {
+	t := instance.currentTime()
+
+	instance.Lock.Lock()
+	defer instance.Lock.Unlock()
+
+	if instance.closed {
+		return ErrLimiterClosed
+	}
+	if err := instance.validateTenantKey(tenantKey); err != nil {
+		return err
+	}
+
+	return instance.withSyncTransaction(func() {
+		for i, limiter := range instance.Limiters {
+			if instance.Config.Global[i] {
+				continue
+			}
+			req := limiter.buildLoadRequest(t, tenantKey, 0)
+
+			limiter.truncateAfter(req, uint64(cutoff.UnixMilli()))
+		}
+	}, syncTxOptions{
+		TenantKey: tenantKey,
+		ReadOnly:  false,
+	})
+}
+
+// StatsAll returns runtime statistics for all the tenants
+// currently holding some state in any of the composed limiters, indexed by tenant key.
+//
+// All the statistics are collected with a single lock acquisition.
+// No sync transaction is performed: only the state held by
+// the local instance is considered.
+func (instance *compositeLoadLimiterDefaultImpl) StatsAll() (map[string]CompositeRuntimeStatistics, error) {
+	instance.Lock.Lock()
+	defer instance.Lock.Unlock()
+
+	out := make(map[string]CompositeRuntimeStatistics)
+
+	for i, limiter := range instance.Limiters {
+		if instance.Config.Global[i] {
+			continue
+		}
+		for _, tenantKey := range limiter.listTenants() {
+			if _, done := out[tenantKey]; done {
+				continue
+			}
+
+			cs, err := instance.compositeStats(tenantKey)
+			if err != nil {
+				return nil, err
+			}
+
+			out[tenantKey] = cs
+		}
+	}
+
+	return out, nil
+}
+
+// IsOverloaded returns true if the tenant is currently in overload status
+// for at least one of the composed limiters,
+// or for all of them in CompositeModeAny.
+//
+// Global limiters report the overload status shared by all the tenants.
+func (instance *compositeLoadLimiterDefaultImpl) IsOverloaded(tenantKey string) (bool, error) {
+	if err := instance.validateTenantKey(tenantKey); err != nil {
+		return false, err
+	}
+
+	instance.Lock.Lock()
+	defer instance.Lock.Unlock()
+
+	var out bool
+
+	err := instance.withSyncTransaction(func() {
+		out = instance.isOverloaded(tenantKey)
+	}, syncTxOptions{
+		TenantKey: tenantKey,
+		ReadOnly:  true,
+	})
+
+	return out, err
+}
+
+func (instance *compositeLoadLimiterDefaultImpl) isOverloaded(tenantKey string) bool {
+	// in CompositeModeAny the tenant is overloaded
+	// only when none of the composed limiters can accept loads.
+	anyMode := instance.Config.Mode == CompositeModeAny
+	for i, limiter := range instance.Limiters {
+		if limiter.getTenant(instance.limiterTenantKey(i, tenantKey)).WasOver != anyMode {
+			return !anyMode
+		}
+	}
+	return anyMode
+}
+
+// ProbeReadOnly checks if the given load would be allowed right now
+// like Probe does, but evaluates it against the windows as they are,
+// without rotating them.
+//
+// The tenant state is never changed, so it never causes a write to the SyncAdapter.
+func (instance *compositeLoadLimiterDefaultImpl) ProbeReadOnly(tenantKey string, load uint64) (bool, error) {
+	t := instance.currentTime()
+
+	instance.Lock.Lock()
+	defer instance.Lock.Unlock()
+
+	if instance.closed {
+		return false, ErrLimiterClosed
+	}
+	if err := instance.validateTenantKey(tenantKey); err != nil {
+		return false, err
+	}
+
+	anyMode := instance.Config.Mode == CompositeModeAny
+	out := !anyMode
+
+	err := instance.withSyncTransaction(func() {
+		for i, limiter := range instance.Limiters {
+			if limiter.probeAsIs(t, instance.limiterTenantKey(i, tenantKey), load) == anyMode {
+				out = anyMode
+				return
+			}
+		}
+	}, syncTxOptions{
+		TenantKey: tenantKey,
+		ReadOnly:  true,
+	})
+
+	if err != nil {
+		return false, err
+	}
+
+	return out, nil
+}
+
+// RemainingCapacity returns how much load the tenant could submit right now,
+// that is the minimum remaining capacity across the composed limiters,
+// or the maximum one in CompositeModeAny.
+// it is a readonly method that does not modify the current window data.
+func (instance *compositeLoadLimiterDefaultImpl) RemainingCapacity(tenantKey string) (uint64, error) {
+	t := instance.currentTime()
+
+	instance.Lock.Lock()
+	defer instance.Lock.Unlock()
+
+	if instance.closed {
+		return 0, ErrLimiterClosed
+	}
+	if err := instance.validateTenantKey(tenantKey); err != nil {
+		return 0, err
+	}
+
+	anyMode := instance.Config.Mode == CompositeModeAny
+
+	var out uint64 = math.MaxUint64
+	if anyMode {
+		out = 0
+	}
+
+	err := instance.withSyncTransaction(func() {
+		for i, limiter := range instance.Limiters {
+			remaining := limiter.remainingCapacity(t, instance.limiterTenantKey(i, tenantKey))
+			if (anyMode && remaining > out) || (!anyMode && remaining < out) {
+				out = remaining
+			}
+		}
+	}, syncTxOptions{
+		TenantKey: tenantKey,
+		ReadOnly:  true,
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	return out, nil
+}
+
+// CurrentRate returns the average load rate of the tenant
+// over the window of each composed limiter, in the same order they were given.
+// it is a readonly method that does not modify the current window data.
+func (instance *compositeLoadLimiterDefaultImpl) CurrentRate(tenantKey string) ([]float64, error) {
+	t := instance.currentTime()
+
+	instance.Lock.Lock()
+	defer instance.Lock.Unlock()
+
+	if instance.closed {
+		return nil, ErrLimiterClosed
+	}
+	if err := instance.validateTenantKey(tenantKey); err != nil {
+		return nil, err
+	}
+
+	out := make([]float64, len(instance.Limiters))
+
+	err := instance.withSyncTransaction(func() {
+		for i, limiter := range instance.Limiters {
+			out[i] = limiter.currentRate(t, instance.limiterTenantKey(i, tenantKey))
+		}
+	}, syncTxOptions{
+		TenantKey: tenantKey,
+		ReadOnly:  true,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// WindowBounds returns the time range covered by the current window of the tenant
+// in the composed limiter with the narrowest window.
+// it is a readonly method that does not modify the current window data.
+func (instance *compositeLoadLimiterDefaultImpl) WindowBounds(tenantKey string) (time.Time, time.Time, error) {
+	t := instance.currentTime()
+
+	instance.Lock.Lock()
+	defer instance.Lock.Unlock()
+
+	if instance.closed {
+		return time.Time{}, time.Time{}, ErrLimiterClosed
+	}
+	if err := instance.validateTenantKey(tenantKey); err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+
+	narrowest := 0
+	for i, limiter := range instance.Limiters {
+		if limiter.Config.WindowSize < instance.Limiters[narrowest].Config.WindowSize {
+			narrowest = i
+		}
+	}
+
+	var start, end time.Time
+
+	err := instance.withSyncTransaction(func() {
+		start, end = instance.Limiters[narrowest].windowBounds(t, instance.limiterTenantKey(narrowest, tenantKey))
+	}, syncTxOptions{
+		TenantKey: tenantKey,
+		ReadOnly:  true,
+	})
+
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+
+	return start, end, nil
+}
+
+// CanEverFit returns true if the given load could be accepted
+// for the tenant, at least when the windows are empty.
+//
+// In CompositeModeAll the load should not be greater than the max load
+// of any of the composed limiters, while in CompositeModeAny
+// it is enough for the load to fit in one of them.
+func (instance *compositeLoadLimiterDefaultImpl) CanEverFit(tenantKey string, load uint64) bool {
+	if instance.validateTenantKey(tenantKey) != nil {
+		return false
+	}
+	t := uint64(instance.currentTime().UnixMilli())
+
+	instance.Lock.Lock()
+	defer instance.Lock.Unlock()
+
+	anyMode := instance.Config.Mode == CompositeModeAny
+
+	for i, limiter := range instance.Limiters {
+		fits := limiter.canEverFit(t, instance.limiterTenantKey(i, tenantKey), load)
+		if fits && anyMode {
+			return true
+		}
+		if !fits && !anyMode {
+			return false
+		}
+	}
+
+	return !anyMode
+}
+
+// NextAvailableAt returns the earliest time at which the given load
+// would be accepted, without submitting anything,
+// that is the latest of the times computed by the composed limiters,
+// or the earliest one in CompositeModeAny.
+// The current time is returned if the load would be accepted right now.
+func (instance *compositeLoadLimiterDefaultImpl) NextAvailableAt(tenantKey string, load uint64) (time.Time, error) {
+	t := instance.currentTime()
+
+	instance.Lock.Lock()
+	defer instance.Lock.Unlock()
+
+	if instance.closed {
+		return time.Time{}, ErrLimiterClosed
+	}
+	if err := instance.validateTenantKey(tenantKey); err != nil {
+		return time.Time{}, err
+	}
+
+	anyMode := instance.Config.Mode == CompositeModeAny
+
+	var result time.Duration
+	var resultErr error
+	found := false
+
+	err := instance.withSyncTransaction(func() {
+		for i, limiter := range instance.Limiters {
+			req := limiter.buildLoadRequest(t, instance.limiterTenantKey(i, tenantKey), load)
+
+			var limiterResult time.Duration
+			if !limiter.probe(req) {
+				var err error
+				// the actual time is returned regardless of MaxRetryIn
+				limiterResult, err = limiter.timeToAvailable(req)
+				if err != nil {
+					resultErr = err
+					if anyMode {
+						// another limiter could still accept the load
+						continue
+					}
+					return
+				}
+			}
+
+			if !found || (anyMode && limiterResult < result) || (!anyMode && limiterResult > result) {
+				result = limiterResult
+				found = true
+			}
+		}
+	}, syncTxOptions{
+		TenantKey: tenantKey,
+		ReadOnly:  true,
+	})
+
+	if err != nil {
+		return time.Time{}, err
+	}
+	if !found || (!anyMode && resultErr != nil) {
+		return time.Time{}, resultErr
+	}
+
+	return t.Add(result), nil
+}
+
 // compositeStats aggregates the statistics from the single loadLimiters.
-func (instance *compositeLoadLimiterDefaultImpl) compositeStats(tenantKey string) ([]RuntimeStatistics, error) {
+//
+// Global limiters report the statistics shared by all the tenants.
+func (instance *compositeLoadLimiterDefaultImpl) compositeStats(tenantKey string) (CompositeRuntimeStatistics, error) {
 
 	num := len(instance.Limiters)
-	out := make([]RuntimeStatistics, num)
+	out := CompositeRuntimeStatistics{
+		LimitersStats:    make([]RuntimeStatistics, num),
+		BottleneckCounts: make([]uint64, num),
+	}
 
 	for i, limiter := range instance.Limiters {
-		ls, err := limiter.stats(tenantKey)
+		limiterTenantKey := instance.limiterTenantKey(i, tenantKey)
+		ls, err := limiter.stats(limiterTenantKey)
 		if err != nil {
-			return nil, err
+			return CompositeRuntimeStatistics{}, err
+		}
+		out.LimitersStats[i] = ls
+		out.BottleneckCounts[i] = limiter.getTenant(limiterTenantKey).BottleneckCount
+
+		penalty := ls.WindowPenaltyTotal
+		if penalty > ls.WindowTotal {
+			penalty = ls.WindowTotal
+		}
+		out.WindowLoadTotal = saturatingAdd(out.WindowLoadTotal, ls.WindowTotal-penalty)
+		out.WindowPenaltyTotal = saturatingAdd(out.WindowPenaltyTotal, penalty)
+
+		if ls.Utilization() > out.LimitersStats[out.BindingLimiter].Utilization() {
+			out.BindingLimiter = i
 		}
-		out[i] = ls
 	}
 
 	return out, nil
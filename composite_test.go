@@ -1,6 +1,7 @@
 package goll
 
 import (
+	"context"
 	"testing"
 	"time"
 
@@ -25,6 +26,7 @@ func TestCompositeBasics(t *testing.T) {
 	assert.False(t, rejected.Accepted)
 	assert.True(t, rejected.RetryInAvailable)
 	assert.Equal(t, int64(1000), rejected.RetryIn.Milliseconds())
+	assert.Equal(t, []int{1}, rejected.RejectedBy)
 
 	// submitted 20 in the first segment, now wait
 	stats, err := ti.Instance.Stats(defaultTestTenantKey)
@@ -34,6 +36,11 @@ func TestCompositeBasics(t *testing.T) {
 
 	assert.Equal(t, uint64(20), stats.LimitersStats[1].WindowTotal)
 
+	assert.Equal(t, uint64(100), stats.LimitersStats[0].MaxLoad)
+	assert.Equal(t, float64(20), stats.LimitersStats[0].UtilizationPercent)
+	assert.Equal(t, uint64(20), stats.LimitersStats[1].MaxLoad)
+	assert.Equal(t, float64(100), stats.LimitersStats[1].UtilizationPercent)
+
 	ti.AssertWindowStatus(t, defaultTestTenantKey, []uint64{20, 20}, "0:1000000:20", "1:1000000:20")
 
 	ti.TimeTravel(1000)
@@ -63,7 +70,7 @@ func TestCompositeSubmitUntil(t *testing.T) {
 
 	// load not available, timeout 1ms. We expect to timeout with an ErrLoadRequestTimeout
 	// but WaitedFor should be 0 (should not wait when it would be pointless to)
-	res := ti.Instance.submitUntil(defaultTestTenantKey, 15, 1*time.Millisecond)
+	res := ti.Instance.submitUntil(context.Background(), defaultTestTenantKey, 15, 1*time.Millisecond)
 
 	assert.NotNil(t, res.Error)
 	assert.ErrorIs(t, res.Error, ErrLoadRequestTimeout)
@@ -71,24 +78,71 @@ func TestCompositeSubmitUntil(t *testing.T) {
 	assert.Equal(t, uint64(1), res.AttemptsNumber)
 	assert.Equal(t, time.Duration(0), res.WaitedFor)
 
+	var timeoutErr *LoadRequestTimeout
+	assert.ErrorAs(t, res.Error, &timeoutErr)
+	assert.Equal(t, int64(1000), timeoutErr.WouldHaveWaited.Milliseconds())
+
 	// goto 1019200
 	ti.TimeTravel(200)
 
 	// 10 currently available, asking for 20, 9 in each segment.
 	// to free up 2 segments we have to wait 800 + 1000 ms
-	res = ti.Instance.submitUntil(defaultTestTenantKey, 20, time.Duration(10000)*time.Millisecond)
+	res = ti.Instance.submitUntil(context.Background(), defaultTestTenantKey, 20, time.Duration(10000)*time.Millisecond)
 
 	assert.Nil(t, res.Error)
 	assert.Equal(t, uint64(2), res.AttemptsNumber)
 	assert.Equal(t, int64(1800), res.WaitedFor.Milliseconds())
 }
 
+func TestCompositeSubmitUntilWithMaxAttempts(t *testing.T) {
+	ti := buildDefaultCompositeInstance(t)
+	applyMultiWindowConstantLoadDistribution(t, ti, defaultTestTenantKey, 9)
+
+	// goto 1019200
+	ti.TimeTravel(200)
+
+	res := ti.Instance.SubmitUntilWithOptions(defaultTestTenantKey, 20, SubmitUntilOptions{
+		Timeout:     10 * time.Second,
+		MaxAttempts: 1,
+	})
+
+	assert.ErrorIs(t, res.Error, ErrLoadRequestTimeout)
+	assert.Contains(t, res.Error.Error(), "exhausting 1 attempts")
+	assert.Equal(t, uint64(1), res.AttemptsNumber)
+	assert.Equal(t, time.Duration(0), res.WaitedFor)
+
+	res = ti.Instance.SubmitUntilWithOptions(defaultTestTenantKey, 20, SubmitUntilOptions{
+		Timeout:     10 * time.Second,
+		MaxAttempts: 2,
+	})
+
+	assert.Nil(t, res.Error)
+	assert.Equal(t, uint64(2), res.AttemptsNumber)
+	assert.Equal(t, int64(1800), res.WaitedFor.Milliseconds())
+}
+
+func TestCompositeSubmitUntilWithBackoff(t *testing.T) {
+	ti := buildDefaultCompositeInstance(t)
+	applyMultiWindowConstantLoadDistribution(t, ti, defaultTestTenantKey, 9)
+
+	// goto 1019200
+	ti.TimeTravel(200)
+
+	res := ti.Instance.ForTenant(defaultTestTenantKey).SubmitUntilWithBackoff(20, 10*time.Second, func(attempt uint64, retryIn time.Duration) time.Duration {
+		return retryIn * 2
+	})
+
+	assert.Nil(t, res.Error)
+	assert.Equal(t, uint64(2), res.AttemptsNumber)
+	assert.Equal(t, int64(3600), res.WaitedFor.Milliseconds())
+}
+
 func TestCompositeSubmitUntilExcessiveLoad(t *testing.T) {
 	ti := buildDefaultCompositeInstance(t)
 
 	// passing a negative duration should return a ErrLoadRequestRejected
 	// without even attempting
-	res := ti.Instance.submitUntil(defaultTestTenantKey, 5000000, time.Duration(1)*time.Second)
+	res := ti.Instance.submitUntil(context.Background(), defaultTestTenantKey, 5000000, time.Duration(1)*time.Second)
 
 	assert.NotNil(t, res.Error)
 	assert.ErrorIs(t, res.Error, ErrLoadRequestRejected)
@@ -98,7 +152,7 @@ func TestCompositeSubmitUntilExcessiveLoad(t *testing.T) {
 
 	ti = buildDefaultCompositeInstance(t)
 	applyMultiWindowConstantLoadDistribution(t, ti, defaultTestTenantKey, 8)
-	res = ti.Instance.submitUntil(defaultTestTenantKey, 5000000, time.Duration(1)*time.Second)
+	res = ti.Instance.submitUntil(context.Background(), defaultTestTenantKey, 5000000, time.Duration(1)*time.Second)
 
 	assert.NotNil(t, res.Error)
 	assert.ErrorIs(t, res.Error, ErrLoadRequestRejected)
@@ -112,7 +166,7 @@ func TestCompositeSubmitUntilInvalidTimeout(t *testing.T) {
 
 	// passing a negative duration should return a ErrLoadRequestRejected
 	// without even attempting
-	res := ti.Instance.submitUntil(defaultTestTenantKey, 5, time.Duration(-1)*time.Second)
+	res := ti.Instance.submitUntil(context.Background(), defaultTestTenantKey, 5, time.Duration(-1)*time.Second)
 
 	assert.NotNil(t, res.Error)
 	assert.ErrorIs(t, res.Error, ErrLoadRequestRejected)
@@ -122,7 +176,7 @@ func TestCompositeSubmitUntilInvalidTimeout(t *testing.T) {
 
 	ti = buildDefaultCompositeInstance(t)
 	applyMultiWindowConstantLoadDistribution(t, ti, defaultTestTenantKey, 8)
-	res = ti.Instance.submitUntil(defaultTestTenantKey, 5, time.Duration(-1)*time.Second)
+	res = ti.Instance.submitUntil(context.Background(), defaultTestTenantKey, 5, time.Duration(-1)*time.Second)
 
 	assert.NotNil(t, res.Error)
 	assert.ErrorIs(t, res.Error, ErrLoadRequestRejected)
@@ -130,3 +184,503 @@ func TestCompositeSubmitUntilInvalidTimeout(t *testing.T) {
 	assert.Equal(t, uint64(0), res.AttemptsNumber)
 	assert.Equal(t, time.Duration(0), res.WaitedFor)
 }
+
+func TestCompositeRejectedBy(t *testing.T) {
+	ti := buildDefaultCompositeInstance(t)
+
+	accepted := submitNoError(ti.Instance.Submit(defaultTestTenantKey, 20))
+	assert.True(t, accepted.Accepted)
+	assert.Nil(t, accepted.RejectedBy)
+
+	// only the second limiter is full
+	rejected := submitNoError(ti.Instance.Submit(defaultTestTenantKey, 1))
+	assert.False(t, rejected.Accepted)
+	assert.Equal(t, []int{1}, rejected.RejectedBy)
+
+	// fill the first limiter up to 80 while letting the second one recover
+	for i := 0; i < 3; i++ {
+		ti.TimeTravel(1000)
+		assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 20)).Accepted)
+	}
+
+	// both limiters reject
+	ti.TimeTravel(1000)
+	rejected = submitNoError(ti.Instance.Submit(defaultTestTenantKey, 21))
+	assert.False(t, rejected.Accepted)
+	assert.Equal(t, []int{0, 1}, rejected.RejectedBy)
+
+	// only the first limiter rejects
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 20)).Accepted)
+	ti.TimeTravel(1000)
+	rejected = submitNoError(ti.Instance.Submit(defaultTestTenantKey, 1))
+	assert.False(t, rejected.Accepted)
+	assert.Equal(t, []int{0}, rejected.RejectedBy)
+}
+
+func TestCompositeListTenants(t *testing.T) {
+	ti := buildDefaultCompositeInstance(t)
+
+	assert.Equal(t, []string{}, ti.Instance.ListTenants())
+
+	_, _ = ti.Instance.Submit("first", 1)
+	_, _ = ti.Instance.Probe("second", 1)
+
+	// a tenant known to a single composed limiter is listed once
+	_ = ti.Instance.Limiters[1].getTenant("third")
+
+	assert.ElementsMatch(t, []string{"first", "second", "third"}, ti.Instance.ListTenants())
+}
+
+func TestCompositeEvictTenant(t *testing.T) {
+	ti := buildDefaultCompositeInstance(t)
+
+	assert.False(t, ti.Instance.EvictTenant(defaultTestTenantKey))
+
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 20)).Accepted)
+	assert.True(t, ti.Instance.EvictTenant(defaultTestTenantKey))
+	assert.Equal(t, []string{}, ti.Instance.ListTenants())
+
+	// a tenant known to a single composed limiter is evicted as well
+	_ = ti.Instance.Limiters[1].getTenant("partial")
+	assert.True(t, ti.Instance.EvictTenant("partial"))
+
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 20)).Accepted)
+	ti.AssertWindowStatus(t, defaultTestTenantKey, 20, "0:1000000:20", "1:1000000:20")
+}
+
+func TestCompositePrewarmTenants(t *testing.T) {
+	ti := buildDefaultCompositeInstance(t)
+
+	ti.Instance.PrewarmTenants("first", "second")
+	assert.ElementsMatch(t, []string{"first", "second"}, ti.Instance.ListTenants())
+
+	for _, limiter := range ti.Instance.Limiters {
+		_, exists := limiter.lookupTenant("first")
+		assert.True(t, exists)
+	}
+
+	assert.True(t, submitNoError(ti.Instance.Submit("first", 20)).Accepted)
+	ti.AssertWindowStatus(t, "first", 20, "0:1000000:20", "1:1000000:20")
+}
+
+func TestCompositeSubmitOnClosedLimiter(t *testing.T) {
+	ti := buildDefaultCompositeInstance(t)
+
+	assert.Nil(t, ti.Instance.Close())
+
+	_, err := ti.Instance.Probe(defaultTestTenantKey, 1)
+	assert.ErrorIs(t, err, ErrLimiterClosed)
+
+	_, err = ti.Instance.Submit(defaultTestTenantKey, 1)
+	assert.ErrorIs(t, err, ErrLimiterClosed)
+
+	for _, limiter := range ti.Instance.Limiters {
+		assert.True(t, limiter.closed)
+	}
+}
+
+func TestCompositeResetTenant(t *testing.T) {
+	ti := buildDefaultCompositeInstance(t)
+
+	assert.Nil(t, ti.Instance.ResetTenant(defaultTestTenantKey))
+	assert.Equal(t, []string{}, ti.Instance.ListTenants())
+
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 20)).Accepted)
+	assert.False(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 1)).Accepted)
+
+	assert.Nil(t, ti.Instance.ResetTenant(defaultTestTenantKey))
+	ti.AssertWindowStatus(t, defaultTestTenantKey, 0)
+
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 20)).Accepted)
+	ti.AssertWindowStatus(t, defaultTestTenantKey, 20, "0:1000000:20", "1:1000000:20")
+}
+
+func TestCompositeStatsAll(t *testing.T) {
+	ti := buildDefaultCompositeInstance(t)
+
+	assert.True(t, submitNoError(ti.Instance.Submit("first", 10)).Accepted)
+	assert.True(t, submitNoError(ti.Instance.Submit("second", 5)).Accepted)
+
+	all, err := ti.Instance.StatsAll()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(all))
+
+	assert.Equal(t, uint64(10), all["first"].LimitersStats[0].WindowTotal)
+	assert.Equal(t, uint64(10), all["first"].LimitersStats[1].WindowTotal)
+	assert.Equal(t, float64(50), all["first"].LimitersStats[1].UtilizationPercent)
+	assert.Equal(t, uint64(5), all["second"].LimitersStats[0].WindowTotal)
+	assert.Equal(t, uint64(5), all["second"].LimitersStats[1].WindowTotal)
+}
+
+func TestCompositeIsOverloaded(t *testing.T) {
+	ti := buildDefaultCompositeInstance(t)
+
+	assert.False(t, noErrors(ti.Instance.IsOverloaded(defaultTestTenantKey)).(bool))
+
+	// rejected by the second limiter only
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 20)).Accepted)
+	assert.False(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 1)).Accepted)
+	assert.True(t, noErrors(ti.Instance.IsOverloaded(defaultTestTenantKey)).(bool))
+	assert.False(t, noErrors(ti.Instance.IsOverloaded("other")).(bool))
+}
+
+func TestCompositeProbeReadOnly(t *testing.T) {
+	ti := buildDefaultCompositeInstance(t)
+
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 15)).Accepted)
+	assert.False(t, noErrors(ti.Instance.ProbeReadOnly(defaultTestTenantKey, 6)).(bool))
+
+	// the load slides out of the short window without rotating it
+	ti.TimeTravel(1000)
+	versionsBefore := []uint64{
+		ti.Instance.Limiters[0].getTenant(defaultTestTenantKey).Version,
+		ti.Instance.Limiters[1].getTenant(defaultTestTenantKey).Version,
+	}
+	assert.True(t, noErrors(ti.Instance.ProbeReadOnly(defaultTestTenantKey, 20)).(bool))
+	assert.False(t, noErrors(ti.Instance.ProbeReadOnly(defaultTestTenantKey, 21)).(bool))
+	assert.Equal(t, versionsBefore, []uint64{
+		ti.Instance.Limiters[0].getTenant(defaultTestTenantKey).Version,
+		ti.Instance.Limiters[1].getTenant(defaultTestTenantKey).Version,
+	})
+	assert.Equal(t, uint64(15), ti.Instance.Limiters[1].getTenant(defaultTestTenantKey).WindowTotal)
+
+	// one of the limiters is enough in CompositeModeAny
+	ti = buildCompositeInstance(t, func(config *CompositeConfig) {
+		config.Mode = CompositeModeAny
+	})
+	assert.True(t, noErrors(ti.Instance.ProbeReadOnly(defaultTestTenantKey, 100)).(bool))
+	assert.False(t, noErrors(ti.Instance.ProbeReadOnly(defaultTestTenantKey, 101)).(bool))
+}
+
+func TestCompositeRemainingCapacity(t *testing.T) {
+	ti := buildDefaultCompositeInstance(t)
+
+	// the second limiter is the binding constraint
+	assert.Equal(t, uint64(20), noErrors(ti.Instance.RemainingCapacity(defaultTestTenantKey)))
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 15)).Accepted)
+	assert.Equal(t, uint64(5), noErrors(ti.Instance.RemainingCapacity(defaultTestTenantKey)))
+
+	// the load slides out of the short window but is still held by the first one
+	for i := 0; i < 4; i++ {
+		ti.TimeTravel(1000)
+		assert.Equal(t, uint64(20), noErrors(ti.Instance.RemainingCapacity(defaultTestTenantKey)))
+		assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 20)).Accepted)
+	}
+
+	// until the first limiter becomes the binding constraint
+	ti.TimeTravel(1000)
+	assert.Equal(t, uint64(5), noErrors(ti.Instance.RemainingCapacity(defaultTestTenantKey)))
+}
+
+func TestCompositeCurrentRate(t *testing.T) {
+	ti := buildDefaultCompositeInstance(t)
+
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 15)).Accepted)
+
+	rates, err := ti.Instance.CurrentRate(defaultTestTenantKey)
+	assert.Nil(t, err)
+	assert.Equal(t, []float64{1.5, 15}, rates)
+
+	// the load slides out of the short window first
+	ti.TimeTravel(1000)
+	rates, err = ti.Instance.CurrentRate(defaultTestTenantKey)
+	assert.Nil(t, err)
+	assert.Equal(t, []float64{1.5, 0}, rates)
+}
+
+func TestCompositeWindowBounds(t *testing.T) {
+	ti := buildDefaultCompositeInstance(t)
+
+	// the second limiter has the narrowest window
+	start, end, err := ti.Instance.WindowBounds(defaultTestTenantKey)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(999100), start.UnixMilli())
+	assert.Equal(t, int64(1000100), end.UnixMilli())
+
+	// goto 1000250
+	ti.TimeTravel(250)
+	start, end, err = ti.Instance.WindowBounds(defaultTestTenantKey)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(999300), start.UnixMilli())
+	assert.Equal(t, int64(1000300), end.UnixMilli())
+}
+
+func TestCompositeCanEverFit(t *testing.T) {
+	ti := buildDefaultCompositeInstance(t)
+
+	// every limiter should be able to hold the load
+	assert.True(t, ti.Instance.CanEverFit(defaultTestTenantKey, 20))
+	assert.False(t, ti.Instance.CanEverFit(defaultTestTenantKey, 21))
+	assert.False(t, ti.Instance.CanEverFit("a;b", 1))
+
+	ti = buildCompositeInstance(t, func(config *CompositeConfig) {
+		config.Mode = CompositeModeAny
+	})
+
+	// one of the limiters is enough
+	assert.True(t, ti.Instance.CanEverFit(defaultTestTenantKey, 100))
+	assert.False(t, ti.Instance.CanEverFit(defaultTestTenantKey, 101))
+}
+
+func TestCompositeGlobalLimiter(t *testing.T) {
+	ti := buildCompositeInstance(t, func(config *CompositeConfig) {
+		config.Limiters = []Config{
+			{
+				MaxLoad:           20,
+				WindowSize:        defaultWindowSize,
+				WindowSegmentSize: defaultSegmentSize,
+			},
+			{
+				MaxLoad:           50,
+				WindowSize:        defaultWindowSize,
+				WindowSegmentSize: defaultSegmentSize,
+				Global:            true,
+			},
+		}
+	})
+
+	// each tenant is limited by its own window
+	assert.True(t, submitNoError(ti.Instance.Submit("first", 20)).Accepted)
+	rejected := submitNoError(ti.Instance.Submit("first", 1))
+	assert.False(t, rejected.Accepted)
+	assert.Equal(t, []int{0}, rejected.RejectedBy)
+
+	// the global window is shared by all the tenants
+	assert.True(t, submitNoError(ti.Instance.Submit("second", 20)).Accepted)
+	assert.True(t, noErrors(ti.Instance.Probe("third", 10)).(bool))
+	assert.False(t, noErrors(ti.Instance.Probe("third", 11)).(bool))
+
+	rejected = submitNoError(ti.Instance.Submit("third", 11))
+	assert.False(t, rejected.Accepted)
+	assert.Equal(t, []int{1}, rejected.RejectedBy)
+	assert.True(t, submitNoError(ti.Instance.Submit("third", 10)).Accepted)
+
+	assert.Equal(t, uint64(10), ti.Instance.Limiters[0].getTenant("third").WindowTotal)
+	assert.Equal(t, uint64(50), ti.Instance.Limiters[1].getTenant(globalTenantKey).WindowTotal)
+
+	stats, err := ti.Instance.Stats("first")
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(20), stats.LimitersStats[0].WindowTotal)
+	assert.Equal(t, uint64(50), stats.LimitersStats[1].WindowTotal)
+
+	// the global key is not listed as a tenant
+	assert.ElementsMatch(t, []string{"first", "second", "third"}, ti.Instance.ListTenants())
+	all, err := ti.Instance.StatsAll()
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(all))
+	assert.Equal(t, uint64(50), all["second"].LimitersStats[1].WindowTotal)
+
+	// tenant maintenance does not affect the global window
+	assert.Nil(t, ti.Instance.ResetTenant("first"))
+	assert.True(t, ti.Instance.EvictTenant("second"))
+	assert.Equal(t, uint64(50), ti.Instance.Limiters[1].getTenant(globalTenantKey).WindowTotal)
+	assert.Equal(t, uint64(0), ti.Instance.Limiters[0].getTenant("first").WindowTotal)
+}
+
+func TestCompositeEffectiveConfig(t *testing.T) {
+	ti := buildCompositeInstance(t, func(config *CompositeConfig) {
+		config.Limiters[1].Global = true
+	})
+
+	effective := ti.Instance.EffectiveConfig()
+
+	assert.Equal(t, 2, len(effective))
+	assert.Equal(t, uint64(100), effective[0].MaxLoad)
+	assert.Equal(t, defaultWindowSize, effective[0].WindowSize)
+	assert.Equal(t, uint64(10), effective[0].NumSegments)
+	assert.False(t, effective[0].Global)
+	assert.Equal(t, uint64(20), effective[1].MaxLoad)
+	assert.Equal(t, defaultWindowSize/10, effective[1].WindowSize)
+	assert.Equal(t, defaultSegmentSize/10, effective[1].WindowSegmentSize)
+	assert.True(t, effective[1].Global)
+}
+
+func TestCompositeNamedLimiters(t *testing.T) {
+	ti := buildCompositeInstance(t, func(config *CompositeConfig) {
+		config.Limiters[1].Name = "per-100ms"
+	})
+
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 5)).Accepted)
+
+	stats, err := ti.Instance.Stats(defaultTestTenantKey)
+	assert.Nil(t, err)
+
+	// unnamed limiters are named after their position
+	assert.Equal(t, "limiter[0]", stats.LimitersStats[0].Name)
+	assert.Equal(t, "per-100ms", stats.LimitersStats[1].Name)
+
+	all, err := ti.Instance.StatsAll()
+	assert.Nil(t, err)
+	assert.Equal(t, "per-100ms", all[defaultTestTenantKey].LimitersStats[1].Name)
+
+	effective := ti.Instance.EffectiveConfig()
+	assert.Equal(t, "limiter[0]", effective[0].Name)
+	assert.Equal(t, "per-100ms", effective[1].Name)
+}
+
+func TestCompositePermanentlyRejected(t *testing.T) {
+	ti := buildDefaultCompositeInstance(t)
+
+	// over the MaxLoad of the second limiter only
+	res := submitNoError(ti.Instance.Submit(defaultTestTenantKey, 21))
+	assert.False(t, res.Accepted)
+	assert.True(t, res.PermanentlyRejected)
+	assert.False(t, res.RetryInAvailable)
+	assert.Equal(t, []int{1}, res.RejectedBy)
+
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 20)).Accepted)
+	res = submitNoError(ti.Instance.Submit(defaultTestTenantKey, 1))
+	assert.False(t, res.Accepted)
+	assert.False(t, res.PermanentlyRejected)
+	assert.True(t, res.RetryInAvailable)
+}
+
+func TestCompositeAnyMode(t *testing.T) {
+	ti := buildCompositeInstance(t, func(config *CompositeConfig) {
+		config.Mode = CompositeModeAny
+		config.Limiters = []Config{
+			{
+				MaxLoad:           20,
+				WindowSize:        defaultWindowSize,
+				WindowSegmentSize: defaultSegmentSize,
+			},
+			{
+				MaxLoad:           50,
+				WindowSize:        defaultWindowSize,
+				WindowSegmentSize: defaultSegmentSize,
+			},
+		}
+	})
+
+	// committed to the first limiter only
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 15)).Accepted)
+	ti.AssertWindowStatus(t, defaultTestTenantKey, []uint64{15, 0}, "0:1000000:15")
+
+	// falls back to the second limiter
+	ti.TimeTravel(1000)
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 10)).Accepted)
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 5)).Accepted)
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 35)).Accepted)
+	ti.AssertWindowStatus(t, defaultTestTenantKey, []uint64{20, 45}, "0:1001000:5", "0:1000000:15", "1:1001000:45")
+
+	// the first limiter rejected the last load but the tenant is not overloaded
+	assert.False(t, noErrors(ti.Instance.IsOverloaded(defaultTestTenantKey)).(bool))
+	assert.True(t, noErrors(ti.Instance.Probe(defaultTestTenantKey, 5)).(bool))
+	assert.False(t, noErrors(ti.Instance.Probe(defaultTestTenantKey, 6)).(bool))
+	assert.Equal(t, uint64(5), noErrors(ti.Instance.RemainingCapacity(defaultTestTenantKey)))
+
+	// rejected only when all the limiters reject, with the lowest RetryIn
+	rejected := submitNoError(ti.Instance.Submit(defaultTestTenantKey, 10))
+	assert.False(t, rejected.Accepted)
+	assert.True(t, rejected.RetryInAvailable)
+	assert.Equal(t, 9000*time.Millisecond, rejected.RetryIn)
+	assert.False(t, rejected.PermanentlyRejected)
+	assert.Equal(t, []int{0, 1}, rejected.RejectedBy)
+	assert.True(t, noErrors(ti.Instance.IsOverloaded(defaultTestTenantKey)).(bool))
+
+	// permanently rejected only when over the MaxLoad of all the limiters
+	rejected = submitNoError(ti.Instance.Submit(defaultTestTenantKey, 51))
+	assert.True(t, rejected.PermanentlyRejected)
+	assert.False(t, rejected.RetryInAvailable)
+
+	ti.TimeTravel(9000)
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 10)).Accepted)
+	ti.AssertWindowStatus(t, defaultTestTenantKey, []uint64{15, 45}, "0:1010000:10", "0:1001000:5", "1:1001000:45")
+	assert.False(t, noErrors(ti.Instance.IsOverloaded(defaultTestTenantKey)).(bool))
+}
+
+func TestCompositeBottleneckCounts(t *testing.T) {
+	ti := buildDefaultCompositeInstance(t)
+
+	stats, err := ti.Instance.Stats(defaultTestTenantKey)
+	assert.Nil(t, err)
+	assert.Equal(t, []uint64{0, 0}, stats.BottleneckCounts)
+
+	// only the second limiter is full
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 20)).Accepted)
+	assert.False(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 1)).Accepted)
+	assert.False(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 1)).Accepted)
+
+	// fill the first limiter up to 80 while letting the second one recover
+	for i := 0; i < 3; i++ {
+		ti.TimeTravel(1000)
+		assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 20)).Accepted)
+	}
+
+	// both limiters reject: none of them is the bottleneck
+	ti.TimeTravel(1000)
+	assert.False(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 21)).Accepted)
+
+	// only the first limiter rejects
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 20)).Accepted)
+	ti.TimeTravel(1000)
+	assert.False(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 1)).Accepted)
+
+	stats, err = ti.Instance.Stats(defaultTestTenantKey)
+	assert.Nil(t, err)
+	assert.Equal(t, []uint64{1, 2}, stats.BottleneckCounts)
+	assert.Equal(t, uint64(2), stats.LimitersStats[0].RejectedCount)
+	assert.Equal(t, uint64(3), stats.LimitersStats[1].RejectedCount)
+
+	all, err := ti.Instance.StatsAll()
+	assert.Nil(t, err)
+	assert.Equal(t, []uint64{1, 2}, all[defaultTestTenantKey].BottleneckCounts)
+}
+
+func TestCompositeStatsAggregates(t *testing.T) {
+	ti := buildCompositeInstance(t, func(config *CompositeConfig) {
+		config.Limiters[1].OverstepPenaltyFactor = 0.5
+	})
+
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 10)).Accepted)
+	assert.False(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 15)).Accepted)
+
+	stats, err := ti.Instance.Stats(defaultTestTenantKey)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(20), stats.WindowLoadTotal)
+	assert.Equal(t, uint64(10), stats.WindowPenaltyTotal)
+	assert.Equal(t, 1, stats.BindingLimiter)
+
+	// the short window is cleared, the first limiter becomes the binding one
+	ti.TimeTravel(1000)
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 1)).Accepted)
+
+	stats, err = ti.Instance.Stats(defaultTestTenantKey)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(12), stats.WindowLoadTotal)
+	assert.Equal(t, uint64(0), stats.WindowPenaltyTotal)
+	assert.Equal(t, 0, stats.BindingLimiter)
+}
+
+func TestCompositeNextAvailableAt(t *testing.T) {
+	ti := buildDefaultCompositeInstance(t)
+
+	assert.Equal(t, time.UnixMilli(1000000), noErrors(ti.Instance.NextAvailableAt(defaultTestTenantKey, 20)))
+
+	// fill the first limiter up to 80 while letting the second one recover
+	for i := 0; i < 4; i++ {
+		assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 20)).Accepted)
+		ti.TimeTravel(1000)
+	}
+
+	// goto 1004000, both limiters need to free up some load:
+	// the latest of the two times is returned
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 5)).Accepted)
+	assert.Equal(t, time.UnixMilli(1010000), noErrors(ti.Instance.NextAvailableAt(defaultTestTenantKey, 20)))
+	assert.Equal(t, time.UnixMilli(1004000), noErrors(ti.Instance.NextAvailableAt(defaultTestTenantKey, 15)))
+
+	// the load would never fit in the second limiter
+	_, err := ti.Instance.NextAvailableAt(defaultTestTenantKey, 30)
+	assert.NotNil(t, err)
+
+	// in CompositeModeAny the earliest time is returned
+	ti = buildCompositeInstance(t, func(config *CompositeConfig) {
+		config.Mode = CompositeModeAny
+	})
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 20)).Accepted)
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 80)).Accepted)
+	assert.Equal(t, time.UnixMilli(1000000), noErrors(ti.Instance.NextAvailableAt(defaultTestTenantKey, 10)))
+
+	// the load would never fit in the second limiter but fits in the first one later
+	assert.Equal(t, time.UnixMilli(1010000), noErrors(ti.Instance.NextAvailableAt(defaultTestTenantKey, 30)))
+}
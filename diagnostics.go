@@ -0,0 +1,316 @@
+package goll
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// TenantSnapshot is an opaque, point-in-time capture of the window
+// of a single tenant, obtained via SnapshotTenant.
+//
+// Snapshots are meant for human diagnosis: take two of them at different
+// times and compare them with DiffSnapshots.
+type TenantSnapshot struct {
+	tenantKey  string
+	takenAt    time.Time
+	serialized string
+}
+
+// TenantKey returns the key of the tenant the snapshot was taken for.
+func (s TenantSnapshot) TenantKey() string {
+	return s.tenantKey
+}
+
+// TakenAt returns the limiter time at which the snapshot was taken.
+func (s TenantSnapshot) TakenAt() time.Time {
+	return s.takenAt
+}
+
+// TenantSnapshotDiff holds the changes detected between two snapshots
+// of the same tenant.
+type TenantSnapshotDiff struct {
+	TenantKey string
+
+	// Elapsed is the time passed between the two snapshots.
+	Elapsed time.Duration
+
+	// VersionIncrement is the number of version bumps
+	// (state changes) between the two snapshots.
+	VersionIncrement int64
+
+	// WindowTotalBefore and WindowTotalAfter hold the total active load
+	// at the time of each snapshot.
+	WindowTotalBefore uint64
+	WindowTotalAfter  uint64
+
+	// WindowTotalDelta is the change in total active load.
+	WindowTotalDelta int64
+
+	// WasOverBefore and WasOverAfter hold the overload status
+	// at the time of each snapshot.
+	WasOverBefore bool
+	WasOverAfter  bool
+
+	// SegmentDeltas holds one entry for each segment found in at least one
+	// of the snapshots, ordered from the most recent to the oldest.
+	SegmentDeltas []SegmentDelta
+}
+
+// SegmentDelta describes the change of a single window segment
+// between two snapshots.
+//
+// A segment missing from one of the snapshots (because it was not created yet
+// or because it already slid out of the window) is reported with a zero value.
+type SegmentDelta struct {
+	StartTime uint64
+	Before    uint64
+	After     uint64
+	Delta     int64
+}
+
+// SnapshotTenant captures the current status of the window for the given tenant.
+//
+// Unknown tenants are captured with an empty window
+// and no state is created for them.
+func (instance *loadLimiterDefaultImpl) SnapshotTenant(tenantKey string) (TenantSnapshot, error) {
+	t := instance.currentTime()
+
+	defer instance.lockTenant(tenantKey)()
+
+	if err := instance.validateTenantKey(tenantKey); err != nil {
+		return TenantSnapshot{}, err
+	}
+
+	out := TenantSnapshot{
+		tenantKey: tenantKey,
+		takenAt:   t,
+	}
+
+	tenant := instance.lookupTenantOrEmpty(tenantKey)
+
+	err := instance.withSyncTransaction(func() {
+		out.serialized = instance.serializeStatus(tenantKey, tenant)
+	}, syncTxOptions{
+		TenantKey:  tenantKey,
+		TenantData: tenant,
+		ReadOnly:   true,
+	})
+
+	return out, err
+}
+
+// TenantStateCopy is a deep copy of the window of a single tenant,
+// obtained via CopyTenantState.
+//
+// It is detached from the limiter and can be processed
+// without holding any lock.
+type TenantStateCopy struct {
+	TenantKey string
+
+	// TakenAt is the limiter time at which the copy was taken.
+	TakenAt time.Time
+
+	// Version is the version of the tenant data at the time of the copy.
+	Version uint64
+
+	// WindowTotal holds the total active load in absolute units.
+	WindowTotal uint64
+
+	// WasOver signals that the tenant was in overload status.
+	WasOver bool
+
+	// Segments holds the window segments,
+	// ordered from the most recent to the oldest.
+	Segments []SegmentState
+}
+
+// SegmentState holds the load allocated to a single window segment.
+type SegmentState struct {
+	// StartTime is the segment start time, in milliseconds since the Unix epoch.
+	StartTime uint64
+
+	// Value holds the accepted load
+	// and PenaltyValue the load added as penalty.
+	Value        uint64
+	PenaltyValue uint64
+}
+
+// CopyTenantState returns a consistent deep copy of the window for the given tenant.
+//
+// Unknown tenants are copied with an empty window
+// and no state is created for them.
+func (instance *loadLimiterDefaultImpl) CopyTenantState(tenantKey string) (TenantStateCopy, error) {
+	t := instance.currentTime()
+
+	defer instance.lockTenant(tenantKey)()
+
+	if err := instance.validateTenantKey(tenantKey); err != nil {
+		return TenantStateCopy{}, err
+	}
+
+	out := TenantStateCopy{
+		TenantKey: tenantKey,
+		TakenAt:   t,
+	}
+
+	tenant := instance.lookupTenantOrEmpty(tenantKey)
+
+	err := instance.withSyncTransaction(func() {
+		qLen := tenant.WindowQueue.Len()
+		segments := make([]SegmentState, qLen)
+		for i := 0; i < qLen; i++ {
+			segment := tenant.WindowQueue.At(i).(*windowSegment)
+			segments[i] = SegmentState{
+				StartTime:    segment.StartTime,
+				Value:        segment.Value,
+				PenaltyValue: segment.PenaltyValue,
+			}
+		}
+
+		out.Version = tenant.Version
+		out.WindowTotal = tenant.WindowTotal
+		out.WasOver = tenant.WasOver
+		out.Segments = segments
+	}, syncTxOptions{
+		TenantKey:  tenantKey,
+		TenantData: tenant,
+		ReadOnly:   true,
+	})
+
+	return out, err
+}
+
+// DiffSnapshots compares two snapshots of the same tenant,
+// reporting what changed going from the first to the second one.
+func DiffSnapshots(from TenantSnapshot, to TenantSnapshot) (TenantSnapshotDiff, error) {
+	out := TenantSnapshotDiff{}
+
+	if from.serialized == "" || to.serialized == "" {
+		return out, errors.New("snapshots should be obtained via SnapshotTenant")
+	}
+	if from.tenantKey != to.tenantKey {
+		return out, fmt.Errorf("cannot compare snapshots of different tenants (%v and %v)", from.tenantKey, to.tenantKey)
+	}
+
+	before, err := parseSerializedStatus(from.serialized)
+	if err != nil {
+		return out, fmt.Errorf("could not parse first snapshot: %w", err)
+	}
+	after, err := parseSerializedStatus(to.serialized)
+	if err != nil {
+		return out, fmt.Errorf("could not parse second snapshot: %w", err)
+	}
+
+	out.TenantKey = from.tenantKey
+	out.Elapsed = to.takenAt.Sub(from.takenAt)
+	out.VersionIncrement = int64(after.Version) - int64(before.Version)
+	out.WindowTotalBefore = before.WindowTotal
+	out.WindowTotalAfter = after.WindowTotal
+	out.WindowTotalDelta = int64(after.WindowTotal) - int64(before.WindowTotal)
+	out.WasOverBefore = before.WasOver
+	out.WasOverAfter = after.WasOver
+
+	deltas := make(map[uint64]*SegmentDelta)
+	for _, segment := range before.Segments {
+		deltas[segment.StartTime] = &SegmentDelta{
+			StartTime: segment.StartTime,
+			Before:    segment.total(),
+		}
+	}
+	for _, segment := range after.Segments {
+		delta, exists := deltas[segment.StartTime]
+		if !exists {
+			delta = &SegmentDelta{
+				StartTime: segment.StartTime,
+			}
+			deltas[segment.StartTime] = delta
+		}
+		delta.After = segment.total()
+	}
+
+	out.SegmentDeltas = make([]SegmentDelta, 0, len(deltas))
+	for _, delta := range deltas {
+		delta.Delta = int64(delta.After) - int64(delta.Before)
+		out.SegmentDeltas = append(out.SegmentDeltas, *delta)
+	}
+
+	sort.Slice(out.SegmentDeltas, func(i, j int) bool {
+		return out.SegmentDeltas[i].StartTime > out.SegmentDeltas[j].StartTime
+	})
+
+	return out, nil
+}
+
+// DumpState returns a human-readable report of the whole limiter state,
+// including the effective configuration and the window of every tenant.
+//
+// It is meant to be attached to bug reports and only includes
+// the state held by the local instance.
+func (instance *loadLimiterDefaultImpl) DumpState() string {
+	t := instance.currentTime()
+
+	instance.Lock.Lock()
+	defer instance.Lock.Unlock()
+
+	sb := strings.Builder{}
+	fmt.Fprintf(&sb, "goll load limiter state at %v\n", t.UTC().Format(time.RFC3339Nano))
+	instance.dumpState(&sb, "")
+
+	return sb.String()
+}
+
+func (instance *loadLimiterDefaultImpl) dumpState(sb *strings.Builder, indent string) {
+	fmt.Fprintf(sb, "%sconfig: %+v\n", indent, *instance.Config)
+
+	tenantKeys := instance.listTenants()
+	sort.Strings(tenantKeys)
+
+	fmt.Fprintf(sb, "%stenants: %d\n", indent, len(tenantKeys))
+
+	for _, tenantKey := range tenantKeys {
+		tenant := instance.TenantData[tenantKey]
+
+		fmt.Fprintf(sb, "%s- tenant %q: version=%d windowTotal=%d wasOver=%v\n",
+			indent, tenantKey, tenant.Version, tenant.WindowTotal, tenant.WasOver)
+
+		for _, boost := range tenant.Boosts {
+			fmt.Fprintf(sb, "%s    boost: +%d until %d\n", indent, boost.ExtraLoad, boost.Until)
+		}
+
+		for i := 0; i < tenant.WindowQueue.Len(); i++ {
+			segment := tenant.WindowQueue.At(i).(*windowSegment)
+			if segment.PenaltyValue > 0 {
+				fmt.Fprintf(sb, "%s    segment %d: %d (penalty %d)\n", indent, segment.StartTime, segment.total(), segment.PenaltyValue)
+			} else {
+				fmt.Fprintf(sb, "%s    segment %d: %d\n", indent, segment.StartTime, segment.total())
+			}
+		}
+	}
+}
+
+// DumpState returns a human-readable report of the whole limiter state,
+// including the effective configuration and the windows of every tenant
+// for all the composed limiters.
+//
+// It is meant to be attached to bug reports and only includes
+// the state held by the local instance.
+func (instance *compositeLoadLimiterDefaultImpl) DumpState() string {
+	t := instance.currentTime()
+
+	instance.Lock.Lock()
+	defer instance.Lock.Unlock()
+
+	sb := strings.Builder{}
+	fmt.Fprintf(&sb, "goll composite load limiter state at %v\n", t.UTC().Format(time.RFC3339Nano))
+	fmt.Fprintf(&sb, "limiters: %d\n", len(instance.Limiters))
+
+	for i, limiter := range instance.Limiters {
+		fmt.Fprintf(&sb, "limiter %d:\n", i)
+		limiter.dumpState(&sb, "  ")
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,167 @@
+package goll
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnapshotDiff(t *testing.T) {
+	ti := buildDefaultInstance(t)
+
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 10)).Accepted)
+	ti.TimeTravel(1000)
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 20)).Accepted)
+
+	first, err := ti.Instance.SnapshotTenant(defaultTestTenantKey)
+	assert.Nil(t, err)
+	assert.Equal(t, defaultTestTenantKey, first.TenantKey())
+
+	ti.TimeTravel(500)
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 5)).Accepted)
+	ti.TimeTravel(9000) // goto 1010500, the first segment slides out
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 7)).Accepted)
+
+	second, err := ti.Instance.SnapshotTenant(defaultTestTenantKey)
+	assert.Nil(t, err)
+
+	diff, err := DiffSnapshots(first, second)
+	assert.Nil(t, err)
+
+	assert.Equal(t, defaultTestTenantKey, diff.TenantKey)
+	assert.Equal(t, 9500*time.Millisecond, diff.Elapsed)
+	assert.Equal(t, uint64(30), diff.WindowTotalBefore)
+	assert.Equal(t, uint64(32), diff.WindowTotalAfter)
+	assert.Equal(t, int64(2), diff.WindowTotalDelta)
+	assert.True(t, diff.VersionIncrement > 0)
+	assert.Equal(t, []SegmentDelta{
+		{StartTime: 1010000, Before: 0, After: 7, Delta: 7},
+		{StartTime: 1001000, Before: 20, After: 25, Delta: 5},
+		{StartTime: 1000000, Before: 10, After: 0, Delta: -10},
+	}, diff.SegmentDeltas)
+
+	// diffing the same snapshot yields no changes
+	diff, err = DiffSnapshots(second, second)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), diff.VersionIncrement)
+	assert.Equal(t, int64(0), diff.WindowTotalDelta)
+	for _, delta := range diff.SegmentDeltas {
+		assert.Equal(t, int64(0), delta.Delta)
+	}
+}
+
+func TestSnapshotDiffErrors(t *testing.T) {
+	ti := buildDefaultInstance(t)
+
+	first, err := ti.Instance.SnapshotTenant("first")
+	assert.Nil(t, err)
+	second, err := ti.Instance.SnapshotTenant("second")
+	assert.Nil(t, err)
+
+	_, err = DiffSnapshots(first, second)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "different tenants")
+
+	_, err = DiffSnapshots(TenantSnapshot{}, first)
+	assert.NotNil(t, err)
+}
+
+func TestSnapshotUnknownTenant(t *testing.T) {
+	ti := buildDefaultInstance(t)
+
+	first, err := ti.Instance.SnapshotTenant(defaultTestTenantKey)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{}, ti.Instance.ListTenants())
+
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 10)).Accepted)
+
+	second, err := ti.Instance.SnapshotTenant(defaultTestTenantKey)
+	assert.Nil(t, err)
+
+	diff, err := DiffSnapshots(first, second)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(0), diff.WindowTotalBefore)
+	assert.Equal(t, uint64(10), diff.WindowTotalAfter)
+	assert.Equal(t, []SegmentDelta{
+		{StartTime: 1000000, Before: 0, After: 10, Delta: 10},
+	}, diff.SegmentDeltas)
+}
+
+func TestCopyTenantState(t *testing.T) {
+	ti := buildDefaultInstance(t)
+
+	applySingleWindowLoadDistribution(t, ti, defaultTestTenantKey)
+
+	copied, err := ti.Instance.CopyTenantState(defaultTestTenantKey)
+	assert.Nil(t, err)
+
+	assert.Equal(t, defaultTestTenantKey, copied.TenantKey)
+	assert.Equal(t, int64(1009000), copied.TakenAt.UnixMilli())
+	assert.Equal(t, ti.Instance.getTenant(defaultTestTenantKey).Version, copied.Version)
+	assert.Equal(t, uint64(72), copied.WindowTotal)
+	assert.False(t, copied.WasOver)
+	assert.Equal(t, []SegmentState{
+		{StartTime: 1008000, Value: 14},
+		{StartTime: 1005000, Value: 15},
+		{StartTime: 1004000, Value: 8},
+		{StartTime: 1002000, Value: 20},
+		{StartTime: 1001000, Value: 10},
+		{StartTime: 1000000, Value: 5},
+	}, copied.Segments)
+
+	// the copy is detached from the limiter
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 3)).Accepted)
+	assert.Equal(t, uint64(72), copied.WindowTotal)
+	assert.Equal(t, 6, len(copied.Segments))
+	assert.Equal(t, uint64(14), copied.Segments[0].Value)
+}
+
+func TestCopyUnknownTenantState(t *testing.T) {
+	ti := buildDefaultInstance(t)
+
+	copied, err := ti.Instance.CopyTenantState(defaultTestTenantKey)
+	assert.Nil(t, err)
+
+	assert.Equal(t, defaultTestTenantKey, copied.TenantKey)
+	assert.Equal(t, uint64(0), copied.WindowTotal)
+	assert.False(t, copied.WasOver)
+	assert.Equal(t, []SegmentState{}, copied.Segments)
+	assert.Equal(t, []string{}, ti.Instance.ListTenants())
+}
+
+func TestDumpState(t *testing.T) {
+	ti := buildDefaultInstance(t)
+
+	assert.True(t, submitNoError(ti.Instance.Submit("b", 5)).Accepted)
+	ti.TimeTravel(1000)
+	assert.True(t, submitNoError(ti.Instance.Submit("b", 7)).Accepted)
+	assert.True(t, submitNoError(ti.Instance.Submit("a", 3)).Accepted)
+
+	dump := ti.Instance.DumpState()
+
+	assert.Contains(t, dump, "MaxLoad:100")
+	assert.Contains(t, dump, "tenants: 2\n")
+	assert.Contains(t, dump, "- tenant \"b\": version=5 windowTotal=12 wasOver=false\n"+
+		"    segment 1001000: 7\n"+
+		"    segment 1000000: 5\n")
+	assert.Contains(t, dump, "- tenant \"a\": version=3 windowTotal=3 wasOver=false\n"+
+		"    segment 1001000: 3\n")
+
+	// tenants are sorted
+	assert.True(t, strings.Index(dump, "tenant \"a\"") < strings.Index(dump, "tenant \"b\""))
+}
+
+func TestCompositeDumpState(t *testing.T) {
+	ti := buildDefaultCompositeInstance(t)
+
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 5)).Accepted)
+
+	dump := ti.Instance.DumpState()
+
+	assert.Contains(t, dump, "limiters: 2\n")
+	assert.Contains(t, dump, "limiter 0:\n  config: {Name:limiter[0] MaxLoad:100 ")
+	assert.Contains(t, dump, "limiter 1:\n  config: {Name:limiter[1] MaxLoad:20 ")
+	assert.Equal(t, 2, strings.Count(dump, "  - tenant \"test\": version=3 windowTotal=5 wasOver=false\n      segment 1000000: 5\n"))
+}
@@ -0,0 +1,74 @@
+package goll
+
+import (
+	"errors"
+	"time"
+)
+
+// SetDraining stops admitting new load for the given tenant until the given time,
+// leaving the load already accumulated in the window untouched.
+//
+// Submissions are rejected without penalties, with a RetryIn
+// pointing past the end of the drain. A zero time stops the draining.
+func (instance *loadLimiterDefaultImpl) SetDraining(tenantKey string, until time.Time) error {
+	drainUntil, err := parseDrainEnd(instance.currentTime(), until)
+	if err != nil {
+		return err
+	}
+
+	defer instance.lockTenant(tenantKey)()
+
+	if err := instance.validateTenantKey(tenantKey); err != nil {
+		return err
+	}
+
+	if drainUntil == 0 {
+		if tenant, exists := instance.lookupTenant(tenantKey); exists {
+			tenant.DrainUntil = 0
+		}
+		return nil
+	}
+
+	instance.getTenant(tenantKey).DrainUntil = drainUntil
+	return nil
+}
+
+// SetDrainingAll stops admitting new load for all the tenants until the given time,
+// like SetDraining does for a single tenant. A zero time stops the draining.
+func (instance *loadLimiterDefaultImpl) SetDrainingAll(until time.Time) error {
+	drainUntil, err := parseDrainEnd(instance.currentTime(), until)
+	if err != nil {
+		return err
+	}
+
+	instance.Lock.Lock()
+	defer instance.Lock.Unlock()
+
+	instance.drainUntil = drainUntil
+	return nil
+}
+
+// parseDrainEnd converts the end of a drain to milliseconds,
+// returning 0 for a zero time.
+func parseDrainEnd(t time.Time, until time.Time) (uint64, error) {
+	if until.IsZero() {
+		return 0, nil
+	}
+	if !until.After(t) {
+		return 0, errors.New("drain end should be in the future")
+	}
+	return uint64(until.UnixMilli()), nil
+}
+
+// drainingFor returns how long the tenant of the given request
+// is still draining, or zero if it is not.
+func (instance *loadLimiterDefaultImpl) drainingFor(req *submitRequest) time.Duration {
+	drainUntil := instance.drainUntil
+	if req.TenantData.DrainUntil > drainUntil {
+		drainUntil = req.TenantData.DrainUntil
+	}
+	if drainUntil <= req.RequestedTimestamp {
+		return 0
+	}
+	return time.Duration(drainUntil-req.RequestedTimestamp) * time.Millisecond
+}
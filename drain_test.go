@@ -0,0 +1,105 @@
+package goll
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetDraining(t *testing.T) {
+	ti := buildInstance(t, func(config *Config) {
+		config.OverstepPenaltyFactor = 0.2
+	})
+
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 30)).Accepted)
+
+	assert.Nil(t, ti.Instance.SetDraining(defaultTestTenantKey, time.UnixMilli(1005000)))
+
+	// new load is rejected without penalties, pointing past the drain
+	res := submitNoError(ti.Instance.Submit(defaultTestTenantKey, 10))
+	assert.False(t, res.Accepted)
+	assert.False(t, res.PermanentlyRejected)
+	assert.True(t, res.RetryInAvailable)
+	assert.Equal(t, 5000*time.Millisecond, res.RetryIn)
+	ti.AssertWindowStatus(t, defaultTestTenantKey, 30, "1000000:30")
+
+	overloaded, err := ti.Instance.IsOverloaded(defaultTestTenantKey)
+	assert.Nil(t, err)
+	assert.False(t, overloaded)
+
+	accepted, err := ti.Instance.Probe(defaultTestTenantKey, 1)
+	assert.Nil(t, err)
+	assert.False(t, accepted)
+
+	remaining, err := ti.Instance.RemainingCapacity(defaultTestTenantKey)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(0), remaining)
+
+	availableAt, err := ti.Instance.NextAvailableAt(defaultTestTenantKey, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1005000), availableAt.UnixMilli())
+
+	// other tenants are not affected
+	assert.True(t, submitNoError(ti.Instance.Submit("other", 10)).Accepted)
+
+	// loads that would never fit are still permanently rejected
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 200)).PermanentlyRejected)
+
+	ti.TimeTravel(5000)
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 10)).Accepted)
+	ti.AssertWindowStatus(t, defaultTestTenantKey, 40, "1005000:10", "1000000:30")
+}
+
+func TestSetDrainingKeepsWindowRetryIn(t *testing.T) {
+	ti := buildDefaultInstance(t)
+
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 100)).Accepted)
+	assert.Nil(t, ti.Instance.SetDraining(defaultTestTenantKey, time.UnixMilli(1002000)))
+
+	// the window frees up after the end of the drain
+	res := submitNoError(ti.Instance.Submit(defaultTestTenantKey, 10))
+	assert.False(t, res.Accepted)
+	assert.Equal(t, 10000*time.Millisecond, res.RetryIn)
+}
+
+func TestSetDrainingAll(t *testing.T) {
+	ti := buildDefaultInstance(t)
+
+	assert.Nil(t, ti.Instance.SetDrainingAll(time.UnixMilli(1003000)))
+
+	for _, tenantKey := range []string{"a", "b"} {
+		res := submitNoError(ti.Instance.Submit(tenantKey, 1))
+		assert.False(t, res.Accepted)
+		assert.Equal(t, 3000*time.Millisecond, res.RetryIn)
+	}
+
+	// a zero time stops the draining
+	assert.Nil(t, ti.Instance.SetDrainingAll(time.Time{}))
+	assert.True(t, submitNoError(ti.Instance.Submit("a", 1)).Accepted)
+
+	assert.Nil(t, ti.Instance.SetDraining("a", time.UnixMilli(1003000)))
+	assert.Nil(t, ti.Instance.SetDraining("a", time.Time{}))
+	assert.True(t, submitNoError(ti.Instance.Submit("a", 1)).Accepted)
+
+	assert.NotNil(t, ti.Instance.SetDraining("a", time.UnixMilli(1000000)))
+	assert.NotNil(t, ti.Instance.SetDrainingAll(time.UnixMilli(999000)))
+}
+
+func TestTokenBucketSetDraining(t *testing.T) {
+	ti := buildTokenBucketInstance(t, nil)
+
+	assert.Nil(t, ti.Instance.SetDraining(defaultTestTenantKey, time.UnixMilli(1004000)))
+
+	res := submitNoError(ti.Instance.Submit(defaultTestTenantKey, 10))
+	assert.False(t, res.Accepted)
+	assert.True(t, res.RetryInAvailable)
+	assert.Equal(t, 4000*time.Millisecond, res.RetryIn)
+	assert.True(t, submitNoError(ti.Instance.Submit("other", 10)).Accepted)
+
+	assert.Nil(t, ti.Instance.SetDrainingAll(time.UnixMilli(1002000)))
+	assert.False(t, submitNoError(ti.Instance.Submit("other", 10)).Accepted)
+
+	ti.TimeTravel(4000)
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 10)).Accepted)
+}
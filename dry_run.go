@@ -0,0 +1,101 @@
+package goll
+
+// DryRunResult holds the outcome of a load request evaluated with SubmitDryRun,
+// including the penalties that a real submission would apply.
+type DryRunResult struct {
+	SubmitResult
+
+	// OverstepPenalty holds the penalty that would be applied
+	// because the request is the first one to overstep the limit.
+	OverstepPenalty uint64
+
+	// RequestOverheadPenalty holds the penalty that would be applied
+	// because the request was submitted while already in overload status.
+	RequestOverheadPenalty uint64
+
+	// WindowTotalBefore and WindowTotalAfter hold the total active load
+	// before and after the simulated submission.
+	// Both are measured after sliding out the expired segments,
+	// and WindowTotalAfter includes the effect of penalty capping.
+	WindowTotalBefore uint64
+	WindowTotalAfter  uint64
+}
+
+// SubmitDryRun evaluates the given load exactly like Submit does,
+// reporting the outcome together with the penalties that would be applied.
+//
+// The evaluation runs against a throwaway copy of the tenant data:
+// the window is not modified, the version is not bumped,
+// no state is created for unknown tenants, the last access time is not updated
+// and neither the OnAccept/OnReject nor the OnPenaltyCapped hooks are called.
+// With a SyncAdapter the remote status is still fetched into the local state.
+// When the tenant has a parent the load is evaluated against both,
+// while penalties and window totals refer to the tenant only.
+func (instance *loadLimiterDefaultImpl) SubmitDryRun(tenantKey string, load uint64) (DryRunResult, error) {
+	t := instance.currentTime()
+
+	parentKey, hasParent, unlock := instance.lockTenantAndParent(tenantKey)
+	defer unlock()
+
+	if instance.closed {
+		return DryRunResult{}, ErrLimiterClosed
+	}
+	if err := instance.validateTenantAndParentKeys(tenantKey, parentKey, hasParent); err != nil {
+		return DryRunResult{}, err
+	}
+
+	var res DryRunResult
+
+	_, err := instance.runParentSyncTransaction(func() {
+		req := instance.buildDetachedLoadRequest(t, tenantKey, load)
+
+		accepted := instance.probe(req)
+
+		// the load is charged to the parent too
+		var parentReq *submitRequest
+		parentAccepted := true
+		if hasParent {
+			parentReq = instance.buildDetachedLoadRequest(t, parentKey, load)
+			parentAccepted = instance.probe(parentReq)
+		}
+
+		tenant := req.TenantData
+		wasOver := tenant.WasOver
+		res.WindowTotalBefore = tenant.WindowTotal
+
+		if accepted && parentAccepted {
+			instance.acceptLoad(req)
+			res.SubmitResult = SubmitResult{
+				Accepted: true,
+			}
+		} else {
+			var rejection, parentRejection *SubmitResult
+			if !accepted {
+				rejection = instance.rejectLoad(req)
+			}
+			if !parentAccepted {
+				parentRejection = instance.rejectLoad(parentReq)
+			}
+			res.SubmitResult = combineRejections(rejection, parentRejection)
+
+			// penalties are the only load added on rejection
+			penalty := uint64(0)
+			if tenant.WindowTotal > res.WindowTotalBefore {
+				penalty = tenant.WindowTotal - res.WindowTotalBefore
+			}
+			if wasOver {
+				res.RequestOverheadPenalty = penalty
+			} else {
+				res.OverstepPenalty = penalty
+			}
+		}
+
+		res.WindowTotalAfter = tenant.WindowTotal
+	}, tenantKey, parentKey, hasParent, true)
+
+	if err != nil {
+		return DryRunResult{}, err
+	}
+
+	return res, nil
+}
@@ -0,0 +1,96 @@
+package goll
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubmitDryRun(t *testing.T) {
+	ti := buildInstance(t, func(config *Config) {
+		config.OverstepPenaltyFactor = 0.2
+		config.RequestOverheadPenaltyFactor = 0.5
+	})
+
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 90)).Accepted)
+	version := ti.Instance.getTenant(defaultTestTenantKey).Version
+
+	// an accepted load is reported without penalties
+	res, err := ti.Instance.SubmitDryRun(defaultTestTenantKey, 10)
+	assert.Nil(t, err)
+	assert.True(t, res.Accepted)
+	assert.Equal(t, uint64(90), res.WindowTotalBefore)
+	assert.Equal(t, uint64(100), res.WindowTotalAfter)
+	assert.Equal(t, uint64(0), res.OverstepPenalty)
+	assert.Equal(t, uint64(0), res.RequestOverheadPenalty)
+
+	// the first rejection would apply the overstep penalty
+	res, err = ti.Instance.SubmitDryRun(defaultTestTenantKey, 20)
+	assert.Nil(t, err)
+	assert.False(t, res.Accepted)
+	assert.True(t, res.RetryInAvailable)
+	assert.Equal(t, uint64(20), res.OverstepPenalty)
+	assert.Equal(t, uint64(0), res.RequestOverheadPenalty)
+	assert.Equal(t, uint64(110), res.WindowTotalAfter)
+
+	// nothing was changed
+	ti.AssertWindowStatus(t, defaultTestTenantKey, 90, "1000000:90")
+	assert.Equal(t, version, ti.Instance.getTenant(defaultTestTenantKey).Version)
+	assert.False(t, ti.Instance.getTenant(defaultTestTenantKey).WasOver)
+
+	// once in overload status, the request overhead penalty would be applied instead
+	assert.False(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 20)).Accepted)
+
+	res, err = ti.Instance.SubmitDryRun(defaultTestTenantKey, 20)
+	assert.Nil(t, err)
+	assert.False(t, res.Accepted)
+	assert.Equal(t, uint64(0), res.OverstepPenalty)
+	assert.Equal(t, uint64(10), res.RequestOverheadPenalty)
+	assert.Equal(t, uint64(110), res.WindowTotalBefore)
+	assert.Equal(t, uint64(120), res.WindowTotalAfter)
+
+	ti.AssertWindowStatus(t, defaultTestTenantKey, 110, "1000000:110")
+}
+
+func TestSubmitDryRunWithPenaltyCapping(t *testing.T) {
+	capped := 0
+	ti := buildInstance(t, func(config *Config) {
+		config.OverstepPenaltyFactor = 1.0
+		config.MaxPenaltyCapFactor = 0.1
+		config.OnPenaltyCapped = func(tenantKey string, trimmed uint64) {
+			capped++
+		}
+	})
+
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 100)).Accepted)
+
+	// the reported penalty is the one left after capping
+	res, err := ti.Instance.SubmitDryRun(defaultTestTenantKey, 1)
+	assert.Nil(t, err)
+	assert.False(t, res.Accepted)
+	assert.Equal(t, uint64(10), res.OverstepPenalty)
+	assert.Equal(t, uint64(110), res.WindowTotalAfter)
+
+	// the trim is never applied, so the hook is not called
+	assert.Equal(t, 0, capped)
+
+	ti.AssertWindowStatus(t, defaultTestTenantKey, 100, "1000000:100")
+}
+
+func TestSubmitDryRunDoesNotTouchTenants(t *testing.T) {
+	ti := buildDefaultInstance(t)
+
+	// no state is created for unknown tenants
+	res, err := ti.Instance.SubmitDryRun(defaultTestTenantKey, 10)
+	assert.Nil(t, err)
+	assert.True(t, res.Accepted)
+	assert.Equal(t, uint64(10), res.WindowTotalAfter)
+	assert.Equal(t, []string{}, ti.Instance.ListTenants())
+
+	// the last access time is not updated
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 10)).Accepted)
+	ti.TimeTravel(5000)
+	_, err = ti.Instance.SubmitDryRun(defaultTestTenantKey, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(1000000), ti.Instance.getTenant(defaultTestTenantKey).LastAccess)
+}
@@ -1,6 +1,7 @@
 package goll
 
 import (
+	"errors"
 	"fmt"
 	"time"
 )
@@ -17,16 +18,53 @@ var (
 	// - the request asks for a load greater than the limiter maximum load
 	// - the request gets rejected and the limiter was built with SkipRetryInComputing = true
 	ErrLoadRequestRejected = &LoadRequestRejected{}
+
+	// ErrLimiterClosed is returned when submitting or probing
+	// a load on a limiter that was already closed.
+	ErrLimiterClosed = errors.New("the load limiter is closed")
+
+	// ErrSyncFailed is a sentinel for the error that occurs
+	// when the synchronization with the remote store fails
+	// and the limiter was built with StrictSync = true.
+	ErrSyncFailed = &SyncFailed{}
+
+	// ErrSyncLockTimeout is a sentinel for the error that occurs
+	// when the SyncAdapter lock could not be acquired within the SyncLockTimeout.
+	ErrSyncLockTimeout = &SyncLockTimeout{}
+
+	// ErrInconsistentState is returned when the data held for a tenant
+	// is found to be inconsistent, for instance while computing RetryIn.
+	//
+	// It should never happen: resetting the tenant restores a consistent state.
+	ErrInconsistentState = errors.New("the limiter state is inconsistent")
+
+	// ErrInvalidTenantKey is returned when submitting or probing
+	// a load for a tenant key rejected by the TenantKeyValidator.
+	ErrInvalidTenantKey = errors.New("invalid tenant key")
 )
 
 // LoadRequestTimeout is returned when autoretrying a submission (ex. with SubmitUntil)
 // failed because the maximum timeout was reached
+// or, when AttemptsExhausted is true, because the maximum number of attempts was made.
+//
+// When the timeout was reached, WouldHaveWaited holds the wait required
+// by the last rejection that did not fit in the remaining time:
+// a timeout of about WaitedFor + WouldHaveWaited would have allowed another attempt.
 type LoadRequestTimeout struct {
-	AttemptsNumber uint64
-	WaitedFor      time.Duration
+	AttemptsNumber    uint64
+	WaitedFor         time.Duration
+	AttemptsExhausted bool
+	WouldHaveWaited   time.Duration
 }
 
 func (e *LoadRequestTimeout) Error() string {
+	if e.AttemptsExhausted {
+		return fmt.Sprintf(
+			"LoadRequestTimeout: load submission failed after exhausting %v attempts in %v ms",
+			e.AttemptsNumber,
+			e.WaitedFor.Milliseconds(),
+		)
+	}
 	return fmt.Sprintf(
 		"LoadRequestTimeout: load submission failed and timed out after %v attempts in %v ms",
 		e.AttemptsNumber,
@@ -55,3 +93,55 @@ func (e *LoadRequestRejected) Is(tgt error) bool {
 	_, ok := tgt.(*LoadRequestRejected)
 	return ok
 }
+
+// SyncFailed is returned when the synchronization with the remote store fails
+// and the limiter was built with StrictSync = true.
+//
+// When StrictSync is false the same errors are not returned
+// but reported as warnings in the SyncWarnings field of SubmitResult.
+type SyncFailed struct {
+	// Operation is the failed step, one of "fetch", "restore", "write" or "verify".
+	Operation string
+	Cause     error
+}
+
+func (e *SyncFailed) Error() string {
+	return fmt.Sprintf("SyncFailed: could not %v status: %v", e.Operation, e.Cause)
+}
+
+func (e *SyncFailed) Is(tgt error) bool {
+	_, ok := tgt.(*SyncFailed)
+	return ok
+}
+
+func (e *SyncFailed) Unwrap() error {
+	return e.Cause
+}
+
+// SyncLockTimeout is returned when the SyncAdapter lock
+// could not be acquired within the SyncLockTimeout.
+type SyncLockTimeout struct {
+	AttemptsNumber uint64
+	WaitedFor      time.Duration
+
+	// Cause is the error returned by the last attempt.
+	Cause error
+}
+
+func (e *SyncLockTimeout) Error() string {
+	return fmt.Sprintf(
+		"SyncLockTimeout: could not acquire lock after %v attempts in %v ms: %v",
+		e.AttemptsNumber,
+		e.WaitedFor.Milliseconds(),
+		e.Cause,
+	)
+}
+
+func (e *SyncLockTimeout) Is(tgt error) bool {
+	_, ok := tgt.(*SyncLockTimeout)
+	return ok
+}
+
+func (e *SyncLockTimeout) Unwrap() error {
+	return e.Cause
+}
@@ -4,16 +4,186 @@ import (
 	"errors"
 	"fmt"
 	"math"
+	"math/rand"
 	"time"
 )
 
 var (
 	defaultMaxPenaltyCapFactor = 0.5
+	defaultWriteBackInterval   = 100 * time.Millisecond
+	defaultRefillInterval      = time.Second
+
+	// the window queues are allocated for three windows by default,
+	// leaving room for the segments being rotated and rebuilt.
+	defaultWindowQueueCapacityMultiplier uint64 = 3
+)
+
+// AggregationMode determines how the load held by the window segments
+// is aggregated into the effective load that gets compared against MaxLoad.
+type AggregationMode int
+
+const (
+	// AggregationSum limits the total load in the window.
+	// This is the default mode.
+	AggregationSum AggregationMode = iota
+
+	// AggregationMax limits the load of the busiest segment in the window,
+	// so that MaxLoad acts as a ceiling on the peak rate
+	// rather than on the total volume.
+	AggregationMax
+
+	// AggregationWeightedAvg limits a weighted moving average of the
+	// segments load, where recent segments weigh more than older ones.
+	// The average is scaled to be comparable with the window total:
+	// a load spread evenly over the window has the same effective value
+	// as in AggregationSum mode, while a burst in the current segment
+	// counts up to about twice its nominal value.
+	AggregationWeightedAvg
+)
+
+// Algorithm determines how the load limiter tracks
+// the load accounted in the time window.
+type Algorithm int
+
+const (
+	// AlgorithmSlidingWindow divides the window in segments
+	// that are rotated out as time passes, smoothing the load over time.
+	// This is the default algorithm.
+	AlgorithmSlidingWindow Algorithm = iota
+
+	// AlgorithmFixedWindow keeps a single counter per tenant
+	// that is reset at window boundaries.
+	// It has a lower overhead than the sliding window but allows bursts
+	// of up to twice MaxLoad across a window boundary.
+	// The RetryIn returned on rejection is the time until the next reset.
+	AlgorithmFixedWindow
+)
+
+// SegmentRounding determines how a WindowSegmentSize
+// that does not exactly divide the WindowSize is handled.
+type SegmentRounding int
+
+const (
+	// SegmentRoundingStrict rejects the configuration
+	// when WindowSize is not an exact multiple of WindowSegmentSize.
+	// This is the default policy.
+	SegmentRoundingStrict SegmentRounding = iota
+
+	// SegmentRoundingUp increases the number of segments
+	// up to the nearest one dividing the window evenly,
+	// resulting in a smaller effective WindowSegmentSize.
+	SegmentRoundingUp
+
+	// SegmentRoundingDown decreases the number of segments
+	// down to the nearest one dividing the window evenly,
+	// resulting in a larger effective WindowSegmentSize.
+	SegmentRoundingDown
+)
+
+// PenaltyDistributionStrategy determines how a penalty
+// is spread over the segments it spans.
+type PenaltyDistributionStrategy int
+
+const (
+	// PenaltyDistributionEven spreads the penalty as evenly as possible,
+	// so that the cooldown proceeds at a constant pace.
+	// This is the default strategy.
+	PenaltyDistributionEven PenaltyDistributionStrategy = iota
+
+	// PenaltyDistributionFrontLoaded puts more penalty on the most recent segments,
+	// which are the last ones to slide out of the window:
+	// the cooldown starts slowly and speeds up towards its end.
+	PenaltyDistributionFrontLoaded
+
+	// PenaltyDistributionBackLoaded puts more penalty on the older segments,
+	// which are the first ones to slide out of the window:
+	// most of the penalty is lifted early and the rest lingers until the end.
+	PenaltyDistributionBackLoaded
+)
+
+// CompositeMode determines how the decisions of the composed limiters
+// are combined by a composite limiter.
+type CompositeMode int
+
+const (
+	// CompositeModeAll accepts a load only if all the composed limiters accept it,
+	// committing it to every one of them.
+	// This is the default mode.
+	CompositeModeAll CompositeMode = iota
+
+	// CompositeModeAny accepts a load if at least one of the composed limiters accepts it,
+	// committing it only to the first one in configuration order
+	// and leaving the others untouched.
+	CompositeModeAny
+)
+
+// SerializationFormat determines how the tenant status
+// is encoded when written to the SyncAdapter.
+type SerializationFormat int
+
+const (
+	// SerializationText encodes the status as human-readable text.
+	// This is the default format.
+	SerializationText SerializationFormat = iota
+
+	// SerializationCompact encodes the status as varint-packed binary data,
+	// considerably reducing the payload size for windows with many segments.
+	SerializationCompact
+)
+
+// StaleRemotePolicy determines what happens when the status fetched
+// from the SyncAdapter is older than the local one.
+type StaleRemotePolicy int
+
+const (
+	// StaleRemoteError aborts the synchronization with an error,
+	// tolerated unless StrictSync is enabled.
+	// This is the default policy.
+	StaleRemoteError StaleRemotePolicy = iota
+
+	// StaleRemoteKeepLocal keeps the local status, which is written back
+	// to the remote store with the next change.
+	StaleRemoteKeepLocal
+
+	// StaleRemoteAcceptRemote replaces the local status with the remote one,
+	// rolling back the local version.
+	StaleRemoteAcceptRemote
+)
+
+// PenaltyCapPolicy determines what happens when a penalty
+// would push the window load over the max penalty cap.
+type PenaltyCapPolicy int
+
+const (
+	// PenaltyCapDefault selects PenaltyCapAndNotify when an OnPenaltyCapped
+	// is provided and PenaltyCapSilently otherwise.
+	PenaltyCapDefault PenaltyCapPolicy = iota
+
+	// PenaltyCapSilently trims the load exceeding the cap
+	// starting from the oldest segments, without any notification.
+	// It can't be combined with OnPenaltyCapped.
+	PenaltyCapSilently
+
+	// PenaltyCapAndNotify trims the load like PenaltyCapSilently does,
+	// then calls OnPenaltyCapped with the trimmed amount.
+	PenaltyCapAndNotify
+
+	// PenaltyCapReject refuses the part of the penalties that would exceed the cap,
+	// leaving the window at the cap and the older load untouched.
+	// OnPenaltyCapped, if provided, is called with the refused amount.
+	PenaltyCapReject
 )
 
 // Config holds the basic configuration for a load limiter instance
 type Config struct {
 
+	// Name is an optional label for the limiter,
+	// reported in the runtime statistics.
+	//
+	// When composing limiters, unnamed ones get a default name
+	// based on their position, like "limiter[0]".
+	Name string
+
 	// MaxLoad is the absolute maximum amonut of load
 	// that you want to allow in the specified time window.
 	MaxLoad uint64
@@ -64,12 +234,220 @@ type Config struct {
 	// when unrestricted penalties are applied.
 	MaxPenaltyCapFactor float64
 
+	// PenaltyCapPolicy determines how the window is kept within
+	// the cap defined by MaxPenaltyCapFactor.
+	//
+	// If not provided, the load exceeding the cap is trimmed
+	// starting from the oldest segments, notifying OnPenaltyCapped if any.
+	PenaltyCapPolicy PenaltyCapPolicy
+
+	// OnPenaltyCapped, when provided, is called every time some load
+	// is trimmed to keep the window within the cap with PenaltyCapAndNotify,
+	// or refused with PenaltyCapReject, with the trimmed or refused amount.
+	// Providing it without a PenaltyCapPolicy selects PenaltyCapAndNotify,
+	// while it can't be provided together with PenaltyCapSilently.
+	//
+	// Frequent or large trims usually mean that the cap is too low
+	// with respect to the penalty factors.
+	//
+	// It is called while holding the lock on the tenant,
+	// so it should return quickly and it should not call back into the limiter.
+	// Composed limiters report the key they hold the tenant under.
+	OnPenaltyCapped func(tenantKey string, trimmed uint64)
+
+	// PenaltyDistributionStrategy determines how each penalty is spread
+	// over the segments it spans.
+	//
+	// If not provided, penalties are spread evenly.
+	PenaltyDistributionStrategy PenaltyDistributionStrategy
+
+	// PenaltyDecayFactor makes the penalties expire faster than the regular load.
+	// Every time a new segment starts, the penalty load held by the older segments
+	// is reduced by the given factor, rounding down.
+	//
+	// It should be valued in the range from 0.0 to 1.0.
+	// If not provided, penalties only expire when their segments slide out of the window.
+	PenaltyDecayFactor float64
+
+	// WarmupDuration and WarmupRequests define a warm-up period
+	// during which no penalties are applied to a newly created tenant,
+	// so that an initial burst does not leave it penalized for a whole window.
+	// Loads exceeding the capacity are still rejected as usual.
+	//
+	// The warm-up lasts until WarmupDuration has elapsed from the creation
+	// of the tenant or until more than WarmupRequests submissions have been received,
+	// whichever comes last. If none is provided, no warm-up is applied.
+	//
+	// The creation time is held by each instance locally, so when using a SyncAdapter
+	// a tenant is considered new on every instance that did not serve it before.
+	WarmupDuration time.Duration
+	WarmupRequests uint64
+
+	// GracePeriodAfterRecovery exempts a tenant from the overstep penalty
+	// for the given time after it recovers from overload,
+	// that is after a load is accepted following a rejection.
+	// A rejection during the grace period only gets the request overhead penalty, if enabled,
+	// dampening the oscillation between overloaded and recovered states.
+	//
+	// The recovery time is held by each instance locally.
+	// If not provided, the overstep penalty is always applied.
+	GracePeriodAfterRecovery time.Duration
+
+	// LoadQuantum is the minimum granularity of the accounted load.
+	// When greater than 1, every requested load is rounded up
+	// to the nearest multiple of LoadQuantum before being evaluated,
+	// so that small requests are charged at least a full quantum.
+	//
+	// LoadQuantum should not be greater than MaxLoad
+	// and should ideally be an exact divisor of it.
+	LoadQuantum uint64
+
+	// AcceptanceSpreadSegments spreads every accepted load evenly
+	// over the given number of most recent segments, instead of adding it
+	// to the current segment only, smoothing the footprint of large requests.
+	//
+	// Please note that the share of the load held by the older segments
+	// slides out of the window earlier, changing the RetryIn computed for the subsequent requests.
+	// It should not be greater than the number of segments in the window.
+	// If not provided, the accepted load is added to the current segment only.
+	AcceptanceSpreadSegments uint64
+
+	// WindowQueueInitialCapacity is the number of segments the window queue
+	// of every tenant is allocated for when the tenant is created or its window rebuilt.
+	//
+	// The queue grows as needed, so this is only a memory/allocation trade-off:
+	// lower values save memory with many tenants and large windows,
+	// higher values avoid reallocations when the window gets rebuilt with many segments.
+	// The capacity is rounded up to a power of 2, with a minimum of 16.
+	// If not provided, three times the number of segments is used.
+	WindowQueueInitialCapacity uint64
+
+	// CostFunc computes the load of a request from a descriptor
+	// of the request itself, allowing to centralize the cost policy.
+	//
+	// It is required in order to use SubmitCost.
+	CostFunc func(meta interface{}) uint64
+
+	// FloatLoadPrecision is the number of load units
+	// corresponding to a load of 1.0 submitted with SubmitFloat or ProbeFloat,
+	// allowing fractional cost models without scaling every request by hand.
+	//
+	// MaxLoad, the statistics and the hooks are expressed in load units:
+	// for instance, with FloatLoadPrecision = 1000 a MaxLoad of 50500
+	// allows 50.5 units of fractional load.
+	// Fractional loads are rounded up to the nearest load unit.
+	//
+	// If not provided, it is assumed to be 1.
+	FloatLoadPrecision uint64
+
+	// AggregationMode determines how the load of the single window segments
+	// is aggregated before being compared against MaxLoad.
+	//
+	// If not provided, AggregationSum is assumed.
+	AggregationMode AggregationMode
+
+	// SegmentRounding determines what happens when WindowSize
+	// is not an exact multiple of WindowSegmentSize.
+	// When rounding is enabled, the effective WindowSegmentSize is adjusted
+	// so that it divides the window evenly and a warning is logged.
+	//
+	// If not provided, SegmentRoundingStrict is assumed
+	// and such a configuration is rejected.
+	SegmentRounding SegmentRounding
+
+	// Algorithm determines how the load in the window is tracked.
+	// When AlgorithmFixedWindow is specified,
+	// WindowSegmentSize should be left empty.
+	//
+	// If not provided, AlgorithmSlidingWindow is assumed.
+	Algorithm Algorithm
+
 	// if SkipRetryInComputing is true,
 	// no RetryIn will be computed and RetryInAvailable will always be false.
 	// Enable this if you don't need the RetryIn feature and want a slight
 	// performance gain.
 	SkipRetryInComputing bool
 
+	// MaxRetryIn, when provided, caps the RetryIn returned on rejection,
+	// so that callers are never told to wait longer than that.
+	//
+	// A capped RetryIn is shorter than the time actually required
+	// for the load to be available, so the following retry may still fail.
+	// SubmitUntil keeps retrying until the timeout expires.
+	MaxRetryIn time.Duration
+
+	// RetryInJitterFactor, when provided, randomly increases the RetryIn
+	// returned on rejection by up to the given fraction (from 0.0 to 1.0),
+	// so that clients rejected at the same time don't retry in lockstep.
+	//
+	// The jitter only ever extends the wait.
+	// MaxRetryIn, when provided, is applied after the jitter.
+	RetryInJitterFactor float64
+
+	// RetryInGranularity, when provided, rounds the RetryIn returned
+	// on rejection up to the next multiple of the given duration,
+	// so that polling clients retry in coarser steps (ex. whole seconds).
+	//
+	// The RetryIn is always rounded up, so it is never shorter than
+	// the time actually required for the load to be available.
+	// The rounding is applied after the jitter and before MaxRetryIn.
+	RetryInGranularity time.Duration
+
+	// SerializationFormat determines how the status is encoded
+	// when written to the SyncAdapter.
+	//
+	// Statuses are decoded regardless of the format they were written in,
+	// so instances of the same cluster can use different formats.
+	//
+	// If not provided, SerializationText is assumed.
+	SerializationFormat SerializationFormat
+
+	// OnStaleRemote determines what happens when the status fetched
+	// from the SyncAdapter is older than the local one,
+	// which should only happen when the remote store lost some writes.
+	//
+	// StaleRemoteError, the default, reports an error and keeps the local status.
+	// StaleRemoteKeepLocal silently keeps the local status and overwrites the remote one
+	// with the next change: the load accepted by other instances after the store
+	// was rolled back gets lost, so the load can exceed MaxLoad for a window.
+	// StaleRemoteAcceptRemote makes the remote store authoritative, for instance
+	// after restoring it from a backup: the load accepted locally since then is forgotten
+	// and the other instances still ahead of the store keep reporting the error
+	// unless configured the same way.
+	OnStaleRemote StaleRemotePolicy
+
+	// TenantIdleTTL enables the automatic removal of idle tenants.
+	// When greater than zero, a background routine periodically removes
+	// the state of tenants that were not accessed for longer than TenantIdleTTL.
+	//
+	// The background routine is stopped by calling Close on the limiter.
+	TenantIdleTTL time.Duration
+
+	// TenantSweepInterval is the interval between two checks for idle tenants.
+	//
+	// If not provided, it is assumed to be 1/4 of the TenantIdleTTL.
+	TenantSweepInterval time.Duration
+
+	// TenantKeyValidator, when provided, checks the tenant keys
+	// of every submission and probe: keys for which it returns an error
+	// are rejected with an ErrInvalidTenantKey error.
+	//
+	// If not provided, the keys containing the separators reserved
+	// by the synchronization layer (";" and ":") are rejected.
+	TenantKeyValidator func(tenantKey string) error
+
+	// ParentKeyFunc, when provided, derives a parent tenant from each tenant key,
+	// for instance the team a user belongs to.
+	// When it returns true, every submission is charged to the parent tenant as well
+	// and it is rejected if either the tenant or the parent would exceed its limit.
+	// Reservations are charged to the parent as well and refunds are given back to it,
+	// while probes and RemainingCapacity take its limit into account.
+	//
+	// The parent tenant is limited by MaxLoad, unless a different
+	// limit is assigned to its key via SetTenantMaxLoad.
+	// Only one level of hierarchy is charged.
+	ParentKeyFunc func(tenantKey string) (string, bool)
+
 	// SyncAdapter is an implementation used to synchronize
 	// the limiter data in a clustered environment.
 	//
@@ -78,14 +456,148 @@ type Config struct {
 	// which synchronizes data for multiple instances over a Redis cluster.
 	SyncAdapter SyncAdapter
 
+	// SyncAdapterSelector, when provided, picks the SyncAdapter
+	// to be used for each tenant, allowing different tenants
+	// to be synchronized against different stores.
+	//
+	// When the selector is nil or returns nil, SyncAdapter is used.
+	SyncAdapterSelector func(tenantKey string) SyncAdapter
+
+	// StrictSync makes synchronization errors blocking:
+	// when a status can't be fetched, restored or written,
+	// the operation is aborted and a SyncFailed error is returned.
+	//
+	// By default synchronization is best-effort: errors are logged,
+	// the operation proceeds on the local state and the errors
+	// are reported in the SyncWarnings field of SubmitResult.
+	StrictSync bool
+
+	// OnSyncMetrics, when provided, is called at the end of every synchronization
+	// with the time spent waiting for the SyncAdapter lock
+	// and fetching and writing the status. write is zero when nothing was written.
+	//
+	// It is called while holding the limiter lock, so it should be fast
+	// and must not call back into the limiter.
+	// Nothing is measured when it is not provided.
+	OnSyncMetrics func(tenantKey string, lockWait time.Duration, fetch time.Duration, write time.Duration)
+
+	// SyncHealthCheckKey is the key locked and unlocked by Ping
+	// to check that the SyncAdapter is reachable.
+	// It should not collide with any tenant key.
+	//
+	// If not provided, "goll-healthcheck" is used.
+	SyncHealthCheckKey string
+
+	// VerifyWrites makes every synchronization fetch the status again
+	// after writing it, checking that the remote store holds the written version
+	// in order to detect writes silently lost by the SyncAdapter.
+	//
+	// A mismatch is handled like any other synchronization error,
+	// according to StrictSync. It adds a round trip to every write
+	// and does not apply to the background writes of AsyncWriteBack.
+	VerifyWrites bool
+
+	// SyncLockTimeout enables retrying to acquire the SyncAdapter lock
+	// when it fails, for instance because of a contended distributed lock.
+	// Once the timeout elapses a SyncLockTimeout error is returned,
+	// that can be checked with errors.Is against goll.ErrSyncLockTimeout.
+	// The context passed to the Lock calls expires with the timeout,
+	// so adapters blocking on Lock respect it as well.
+	//
+	// If not provided, the lock is attempted only once.
+	SyncLockTimeout time.Duration
+
+	// SyncLockRetryInterval is the wait between two attempts to acquire the lock.
+	//
+	// If not provided, it is assumed to be 1/10 of the SyncLockTimeout.
+	SyncLockRetryInterval time.Duration
+
+	// AsyncWriteBack trades some accuracy for throughput
+	// when a SyncAdapter is provided.
+	//
+	// When enabled, mutating operations are applied to the local state
+	// and written to the remote store in the background, coalescing
+	// all the changes made to a tenant within a WriteBackInterval.
+	// The remote status is only fetched by read-only operations
+	// and by the first change after each write-back.
+	//
+	// Changes made by other instances between the fetch and the write-back
+	// get overwritten, so the load can exceed MaxLoad under contention.
+	// Call Flush to force a write-back.
+	AsyncWriteBack bool
+
+	// WriteBackInterval is the interval between two background write-backs
+	// when AsyncWriteBack is enabled.
+	//
+	// If not provided, it is assumed to be 100ms.
+	WriteBackInterval time.Duration
+
+	// OnAccept and OnReject, when provided, are called for every load
+	// accepted or rejected by Submit and its variants, including Reserve.
+	// The load is reported after rounding to LoadQuantum.
+	//
+	// Hooks are called after the limiter locks are released,
+	// so they can safely call back into the limiter.
+	// They are called synchronously and slow hooks delay the caller.
+	OnAccept func(tenantKey string, load uint64)
+	OnReject func(tenantKey string, load uint64, retryIn time.Duration, retryInAvailable bool)
+
+	// OnOverloadStart and OnOverloadEnd, when provided, are called
+	// when a tenant enters the overload status because of a rejection
+	// and when it leaves it with the next accepted load.
+	//
+	// They are called once per transition, not for every rejection
+	// while the tenant is already overloaded,
+	// after the limiter locks are released.
+	OnOverloadStart func(tenantKey string)
+	OnOverloadEnd   func(tenantKey string)
+
+	// Global is only allowed on the limiters composed in a CompositeConfig
+	// and makes the limiter enforce a single ceiling shared by all the tenants,
+	// regardless of the tenantKey passed in.
+	//
+	// It allows to express limits like "each tenant gets 100/min
+	// and the whole system gets 10000/min" with a single composite limiter.
+	Global bool
+
+	// Labels is only allowed on the limiters composed in a CompositeConfig
+	// and restricts the limiter to the loads submitted with SubmitLabeled
+	// carrying at least one of the given labels.
+	//
+	// Limiters without labels apply to every load,
+	// while plain submissions are evaluated against all the limiters.
+	Labels []string
+
+	// UseMonotonicClock bases the time computations on the monotonic clock,
+	// making the limiter immune to wall clock steps like the ones applied by NTP.
+	//
+	// The wall clock is read once at construction and the time passed since then
+	// is measured on the monotonic clock: the segment start times become
+	// relative to the construction of the limiter and can drift
+	// from the actual wall clock, and from other synchronized instances, over time.
+	UseMonotonicClock bool
+
 	// Time-related functions can be overriden to allow for easier testing
 	// you should usually not override these.
+	//
+	// A custom TimeFunc is called twice at construction as a sanity check:
+	// it should return non-zero, non-decreasing times.
+	//
+	// A custom SleepFunc cannot be interrupted: when waiting with a cancellable context
+	// it is run in a separate goroutine, that keeps running until the SleepFunc returns
+	// even if the context gets cancelled before.
 	TimeFunc  func() time.Time
 	SleepFunc func(d time.Duration)
 
 	// you can pass your custom logger if you'd like to
 	// but it's not required
 	Logger Logger
+
+	// LogRejections enables a debug message for every rejected load,
+	// reporting the tenant key and the requested load as structured fields.
+	// It is disabled by default because rejections are frequent
+	// exactly when a client is abusing the limiter.
+	LogRejections bool
 }
 
 type CompositeConfig struct {
@@ -94,6 +606,31 @@ type CompositeConfig struct {
 	// of the single limiters you want to compose together.
 	Limiters []Config
 
+	// EnforceHierarchy requires the composed limiters to form a strict hierarchy:
+	// each limiter should have a larger WindowSize than the previous one
+	// and a sustainable rate (MaxLoad over WindowSize) not higher than the previous one.
+	//
+	// Misordered or inconsistent limiters are rejected at construction time.
+	EnforceHierarchy bool
+
+	// Mode determines how the decisions of the composed limiters are combined.
+	//
+	// If not provided, CompositeModeAll is used
+	// and a load has to fit in all the composed limiters.
+	//
+	// With CompositeModeAny the composed limiters act as fallback tiers:
+	// a load is accepted by the first limiter it fits in
+	// and rejected only when none of them can accept it.
+	Mode CompositeMode
+
+	// TenantKeyValidator, when provided, checks the tenant keys
+	// of every submission and probe: keys for which it returns an error
+	// are rejected with an ErrInvalidTenantKey error.
+	//
+	// If not provided, the keys containing the separators reserved
+	// by the synchronization layer (";" and ":") are rejected.
+	TenantKeyValidator func(tenantKey string) error
+
 	// SyncAdapter is an implementation used to synchronize
 	// the limiter data in a clustered environment.
 	//
@@ -102,8 +639,98 @@ type CompositeConfig struct {
 	// which synchronizes data for multiple instances over a Redis cluster.
 	SyncAdapter SyncAdapter
 
+	// SyncAdapterSelector, when provided, picks the SyncAdapter
+	// to be used for each tenant, allowing different tenants
+	// to be synchronized against different stores.
+	//
+	// When the selector is nil or returns nil, SyncAdapter is used.
+	SyncAdapterSelector func(tenantKey string) SyncAdapter
+
+	// StrictSync makes synchronization errors blocking:
+	// when a status can't be fetched, restored or written,
+	// the operation is aborted and a SyncFailed error is returned.
+	//
+	// By default synchronization is best-effort: errors are logged,
+	// the operation proceeds on the local state and the errors
+	// are reported in the SyncWarnings field of SubmitResult.
+	StrictSync bool
+
+	// OnSyncMetrics, when provided, is called at the end of every synchronization
+	// with the time spent waiting for the SyncAdapter lock
+	// and fetching and writing the status. write is zero when nothing was written.
+	//
+	// It is called while holding the limiter lock, so it should be fast
+	// and must not call back into the limiter.
+	// Nothing is measured when it is not provided.
+	OnSyncMetrics func(tenantKey string, lockWait time.Duration, fetch time.Duration, write time.Duration)
+
+	// SyncHealthCheckKey is the key locked and unlocked by Ping
+	// to check that the SyncAdapter is reachable.
+	// It should not collide with any tenant key.
+	//
+	// If not provided, "goll-healthcheck" is used.
+	SyncHealthCheckKey string
+
+	// VerifyWrites makes every synchronization fetch the status again
+	// after writing it, checking that the remote store holds the written version
+	// in order to detect writes silently lost by the SyncAdapter.
+	//
+	// A mismatch is handled like any other synchronization error,
+	// according to StrictSync. It adds a round trip to every write
+	// and does not apply to the background writes of AsyncWriteBack.
+	VerifyWrites bool
+
+	// SyncLockTimeout enables retrying to acquire the SyncAdapter lock
+	// when it fails, for instance because of a contended distributed lock.
+	// Once the timeout elapses a SyncLockTimeout error is returned,
+	// that can be checked with errors.Is against goll.ErrSyncLockTimeout.
+	// The context passed to the Lock calls expires with the timeout,
+	// so adapters blocking on Lock respect it as well.
+	//
+	// If not provided, the lock is attempted only once.
+	SyncLockTimeout time.Duration
+
+	// SyncLockRetryInterval is the wait between two attempts to acquire the lock.
+	//
+	// If not provided, it is assumed to be 1/10 of the SyncLockTimeout.
+	SyncLockRetryInterval time.Duration
+
+	// OnAccept and OnReject, when provided, are called for every load
+	// accepted or rejected by the composite limiter.
+	//
+	// Hooks are called after the limiter lock is released,
+	// so they can safely call back into the limiter.
+	// They are called synchronously and slow hooks delay the caller.
+	OnAccept func(tenantKey string, load uint64)
+	OnReject func(tenantKey string, load uint64, retryIn time.Duration, retryInAvailable bool)
+
+	// OnOverloadStart and OnOverloadEnd, when provided, are called
+	// when a tenant enters the overload status, that is when it gets rejected
+	// by at least one of the composed limiters (by all of them in CompositeModeAny),
+	// and when it leaves it.
+	//
+	// They are called once per transition, after the limiter lock is released.
+	OnOverloadStart func(tenantKey string)
+	OnOverloadEnd   func(tenantKey string)
+
+	// UseMonotonicClock bases the time computations on the monotonic clock,
+	// making the limiter immune to wall clock steps like the ones applied by NTP.
+	//
+	// The wall clock is read once at construction and the time passed since then
+	// is measured on the monotonic clock: the segment start times become
+	// relative to the construction of the limiter and can drift
+	// from the actual wall clock, and from other synchronized instances, over time.
+	UseMonotonicClock bool
+
 	// Time-related functions can be overriden to allow for easier testing
 	// you should usually not override these.
+	//
+	// A custom TimeFunc is called twice at construction as a sanity check:
+	// it should return non-zero, non-decreasing times.
+	//
+	// A custom SleepFunc cannot be interrupted: when waiting with a cancellable context
+	// it is run in a separate goroutine, that keeps running until the SleepFunc returns
+	// even if the context gets cancelled before.
 	TimeFunc  func() time.Time
 	SleepFunc func(d time.Duration)
 
@@ -124,6 +751,17 @@ func New(config *Config) (StandaloneLoadLimiter, error) {
 		effectiveLogger.Info("binding provided logger to composite LoadLimiter")
 	}
 
+	if config.Global {
+		return nil, errors.New("Global can only be specified on a composed limiter")
+	}
+	if len(config.Labels) > 0 {
+		return nil, errors.New("Labels can only be specified on a composed limiter")
+	}
+
+	if err := validateTimeFunc(config.TimeFunc); err != nil {
+		return nil, err
+	}
+
 	parsedConfig, err := validateConfiguration(config, effectiveLogger)
 	if err != nil {
 		return nil, err
@@ -136,13 +774,47 @@ func New(config *Config) (StandaloneLoadLimiter, error) {
 		SleepFunc:   config.SleepFunc,
 		Logger:      effectiveLogger,
 		SyncAdapter: config.SyncAdapter,
+
+		SyncAdapterSelector: config.SyncAdapterSelector,
+		StrictSync:          config.StrictSync,
+		OnSyncMetrics:       config.OnSyncMetrics,
+		SyncHealthCheckKey:  config.SyncHealthCheckKey,
+		VerifyWrites:        config.VerifyWrites,
+		TenantKeyValidator:  config.TenantKeyValidator,
+		ParentKeyFunc:       config.ParentKeyFunc,
+		CostFunc:            config.CostFunc,
+		OnPenaltyCapped:     config.OnPenaltyCapped,
+		Hooks: submitHooks{
+			OnAccept:        config.OnAccept,
+			OnReject:        config.OnReject,
+			OnOverloadStart: config.OnOverloadStart,
+			OnOverloadEnd:   config.OnOverloadEnd,
+		},
 	}
 
 	if out.TimeFunc == nil {
 		out.TimeFunc = time.Now
 	}
-	if out.SleepFunc == nil {
-		out.SleepFunc = time.Sleep
+	if config.UseMonotonicClock {
+		out.TimeFunc = monotonicTimeFunc(out.TimeFunc)
+	}
+
+	if parsedConfig.RetryInJitterFactor > 0 {
+		// seeded per instance so that synchronized instances
+		// don't produce the same jitter.
+		out.jitterRand = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+
+	if parsedConfig.TenantIdleTTL > 0 {
+		out.startIdleTenantsSweeper()
+	}
+
+	if parsedConfig.AsyncWriteBack {
+		if out.SyncAdapter == nil && out.SyncAdapterSelector == nil {
+			effectiveLogger.Warning("AsyncWriteBack was specified without a SyncAdapter and will be ignored")
+		} else {
+			out.startWriteBackFlusher()
+		}
 	}
 
 	return &out, nil
@@ -159,13 +831,85 @@ func validateConfiguration(config *Config, logger Logger) (*loadLimiterEffective
 		ApplyOverstepPenalty: false,
 		ApplyPenaltyCapping:  false,
 		SkipRetryInComputing: config.SkipRetryInComputing,
+		LogRejections:        config.LogRejections,
 	}
 
+	out.Name = config.Name
+
 	if config.MaxLoad <= 0 {
 		return nil, fmt.Errorf("MaxLoad should be greater than 0 (given: %v)", config.MaxLoad)
 	}
 	out.MaxLoad = config.MaxLoad
 
+	if config.LoadQuantum > config.MaxLoad {
+		return nil, fmt.Errorf("LoadQuantum should not be greater than MaxLoad (given: %v over %v)", config.LoadQuantum, config.MaxLoad)
+	}
+	if config.LoadQuantum > 1 {
+		if config.MaxLoad%config.LoadQuantum != 0 {
+			logger.Warning(fmt.Sprintf("the specified MaxLoad of %v is not an exact multiple of LoadQuantum %v, the effective max load will be %v", config.MaxLoad, config.LoadQuantum, config.MaxLoad-config.MaxLoad%config.LoadQuantum))
+		}
+		out.LoadQuantum = config.LoadQuantum
+	}
+
+	out.FloatLoadPrecision = 1
+	if config.FloatLoadPrecision > 1 {
+		out.FloatLoadPrecision = config.FloatLoadPrecision
+	}
+
+	switch config.AggregationMode {
+	case AggregationSum, AggregationMax, AggregationWeightedAvg:
+		out.AggregationMode = config.AggregationMode
+	default:
+		return nil, fmt.Errorf("unknown AggregationMode (given: %v)", config.AggregationMode)
+	}
+
+	switch config.Algorithm {
+	case AlgorithmSlidingWindow, AlgorithmFixedWindow:
+		out.Algorithm = config.Algorithm
+	default:
+		return nil, fmt.Errorf("unknown Algorithm (given: %v)", config.Algorithm)
+	}
+
+	switch config.SegmentRounding {
+	case SegmentRoundingStrict, SegmentRoundingUp, SegmentRoundingDown:
+	default:
+		return nil, fmt.Errorf("unknown SegmentRounding (given: %v)", config.SegmentRounding)
+	}
+
+	switch config.SerializationFormat {
+	case SerializationText, SerializationCompact:
+		out.SerializationFormat = config.SerializationFormat
+	default:
+		return nil, fmt.Errorf("unknown SerializationFormat (given: %v)", config.SerializationFormat)
+	}
+
+	switch config.OnStaleRemote {
+	case StaleRemoteError, StaleRemoteKeepLocal, StaleRemoteAcceptRemote:
+		out.OnStaleRemote = config.OnStaleRemote
+	default:
+		return nil, fmt.Errorf("unknown OnStaleRemote (given: %v)", config.OnStaleRemote)
+	}
+
+	switch config.PenaltyCapPolicy {
+	case PenaltyCapDefault:
+		// a hook without an explicit policy asks to be notified of the trims.
+		if config.OnPenaltyCapped != nil {
+			out.PenaltyCapPolicy = PenaltyCapAndNotify
+		} else {
+			out.PenaltyCapPolicy = PenaltyCapSilently
+		}
+	case PenaltyCapSilently, PenaltyCapAndNotify, PenaltyCapReject:
+		out.PenaltyCapPolicy = config.PenaltyCapPolicy
+	default:
+		return nil, fmt.Errorf("unknown PenaltyCapPolicy (given: %v)", config.PenaltyCapPolicy)
+	}
+	if config.PenaltyCapPolicy == PenaltyCapSilently && config.OnPenaltyCapped != nil {
+		return nil, errors.New("OnPenaltyCapped is never called with PenaltyCapSilently")
+	}
+	if config.PenaltyCapPolicy == PenaltyCapAndNotify && config.OnPenaltyCapped == nil {
+		return nil, errors.New("OnPenaltyCapped is required with PenaltyCapAndNotify")
+	}
+
 	windowSizeMillis := config.WindowSize.Milliseconds()
 	if windowSizeMillis <= 0 {
 		return nil, fmt.Errorf("WindowSize should be at least 1ms (given: %v)", config.WindowSize)
@@ -175,17 +919,25 @@ func validateConfiguration(config *Config, logger Logger) (*loadLimiterEffective
 	if config.MaxPenaltyCapFactor < 0 {
 		return nil, fmt.Errorf("MaxPenaltyCapFactor should be zero or positive (given: %v)", config.MaxPenaltyCapFactor)
 	} else if config.MaxPenaltyCapFactor > 0 {
-		absoluteMaxPenaltyCap := uint64(float64(config.MaxLoad) * (1.0 + config.MaxPenaltyCapFactor))
+		absoluteMaxPenaltyCap := saturatingFloatToUint(float64(config.MaxLoad) * (1.0 + config.MaxPenaltyCapFactor))
+		out.MaxPenaltyCapFactor = config.MaxPenaltyCapFactor
 		out.AbsoluteMaxPenaltyCap = absoluteMaxPenaltyCap
 		out.ApplyPenaltyCapping = true
 	} else {
 		// apply a reasonable default
-		out.AbsoluteMaxPenaltyCap = uint64(float64(config.MaxLoad) * (1.0 + defaultMaxPenaltyCapFactor))
+		out.MaxPenaltyCapFactor = defaultMaxPenaltyCapFactor
+		out.AbsoluteMaxPenaltyCap = saturatingFloatToUint(float64(config.MaxLoad) * (1.0 + defaultMaxPenaltyCapFactor))
 		out.ApplyPenaltyCapping = true
 	}
 
 	var windowSegmentSizeMillis int64
-	if config.WindowSegmentSize == 0 {
+	if config.Algorithm == AlgorithmFixedWindow {
+		if config.WindowSegmentSize != 0 {
+			return nil, fmt.Errorf("WindowSegmentSize should not be specified with AlgorithmFixedWindow (given: %v)", config.WindowSegmentSize)
+		}
+		// a single segment spanning the whole window acts as the counter.
+		windowSegmentSizeMillis = windowSizeMillis
+	} else if config.WindowSegmentSize == 0 {
 		autoSegmentSize, err := pickSegmentSize(windowSizeMillis)
 		if err != nil {
 			return nil, err
@@ -204,13 +956,32 @@ func validateConfiguration(config *Config, logger Logger) (*loadLimiterEffective
 
 	// WindowSize should be exactly divisible by WindowSegmentSize.
 	if windowSizeMillis%windowSegmentSizeMillis > 0 {
-		return nil, fmt.Errorf("WindowSize should be an exact multiple of WindowSegmentSize (given: %v over %v)", config.WindowSize, config.WindowSegmentSize)
+		if config.SegmentRounding == SegmentRoundingStrict {
+			return nil, fmt.Errorf("WindowSize should be an exact multiple of WindowSegmentSize (given: %v over %v)", config.WindowSize, config.WindowSegmentSize)
+		}
+		windowSegmentSizeMillis = roundSegmentSize(windowSizeMillis, windowSegmentSizeMillis, config.SegmentRounding)
+		logger.Warning(fmt.Sprintf("the specified WindowSegmentSize of %v is not an exact divisor of WindowSize %v, the effective WindowSegmentSize will be %v", config.WindowSegmentSize, config.WindowSize, time.Duration(windowSegmentSizeMillis)*time.Millisecond))
 	}
 
 	out.WindowSegmentSize = uint64(windowSegmentSizeMillis)
 	numSegments := uint64(windowSizeMillis / windowSegmentSizeMillis)
 	out.NumSegments = numSegments
 
+	if config.AcceptanceSpreadSegments > numSegments {
+		return nil, fmt.Errorf("AcceptanceSpreadSegments should not be greater than the number of segments (given: %v over %v)", config.AcceptanceSpreadSegments, numSegments)
+	}
+	if config.AcceptanceSpreadSegments > 1 {
+		out.AcceptanceSpreadSegments = config.AcceptanceSpreadSegments
+	}
+
+	out.WindowQueueInitialCapacity = config.WindowQueueInitialCapacity
+	if out.WindowQueueInitialCapacity == 0 {
+		out.WindowQueueInitialCapacity = numSegments * defaultWindowQueueCapacityMultiplier
+	}
+	if out.WindowQueueInitialCapacity > math.MaxInt32 {
+		return nil, fmt.Errorf("WindowQueueInitialCapacity should not be greater than %v (given: %v)", math.MaxInt32, out.WindowQueueInitialCapacity)
+	}
+
 	if config.OverstepPenaltyFactor < 0 {
 		return nil, fmt.Errorf("OverstepPenaltyFactor should be zero or positive (given: %v)", config.OverstepPenaltyFactor)
 	}
@@ -218,7 +989,7 @@ func validateConfiguration(config *Config, logger Logger) (*loadLimiterEffective
 		return nil, fmt.Errorf("OverstepPenaltyDistributionFactor should be valued in the range from 0.0 to 1.0 (given: %v)", config.OverstepPenaltyDistributionFactor)
 	}
 	if config.OverstepPenaltyFactor > 0 {
-		absoluteOverstepPenalty := uint64(float64(config.MaxLoad) * config.OverstepPenaltyFactor)
+		absoluteOverstepPenalty := saturatingFloatToUint(float64(config.MaxLoad) * config.OverstepPenaltyFactor)
 		overstepPenaltySegmentSpan := uint64(1)
 
 		if config.OverstepPenaltyDistributionFactor > 0 {
@@ -230,6 +1001,7 @@ func validateConfiguration(config *Config, logger Logger) (*loadLimiterEffective
 		}
 
 		out.ApplyOverstepPenalty = true
+		out.OverstepPenaltyFactor = config.OverstepPenaltyFactor
 		out.AbsoluteOverstepPenalty = absoluteOverstepPenalty
 		out.OverstepPenaltySegmentSpan = overstepPenaltySegmentSpan
 	}
@@ -256,9 +1028,112 @@ func validateConfiguration(config *Config, logger Logger) (*loadLimiterEffective
 		out.RequestOverheadPenaltySegmentSpan = requestOverheadPenaltySegmentSpan
 	}
 
+	switch config.PenaltyDistributionStrategy {
+	case PenaltyDistributionEven, PenaltyDistributionFrontLoaded, PenaltyDistributionBackLoaded:
+		out.PenaltyDistributionStrategy = config.PenaltyDistributionStrategy
+	default:
+		return nil, fmt.Errorf("unknown PenaltyDistributionStrategy (given: %v)", config.PenaltyDistributionStrategy)
+	}
+
+	if config.PenaltyDecayFactor < 0 || config.PenaltyDecayFactor > 1.0 {
+		return nil, fmt.Errorf("PenaltyDecayFactor should be valued in the range from 0.0 to 1.0 (given: %v)", config.PenaltyDecayFactor)
+	}
+	out.PenaltyDecayFactor = config.PenaltyDecayFactor
+
+	if config.WarmupDuration < 0 {
+		return nil, fmt.Errorf("WarmupDuration should be zero or positive (given: %v)", config.WarmupDuration)
+	}
+	out.WarmupDuration = uint64(config.WarmupDuration.Milliseconds())
+	out.WarmupRequests = config.WarmupRequests
+
+	if config.GracePeriodAfterRecovery < 0 {
+		return nil, fmt.Errorf("GracePeriodAfterRecovery should be zero or positive (given: %v)", config.GracePeriodAfterRecovery)
+	}
+	out.GracePeriodAfterRecovery = uint64(config.GracePeriodAfterRecovery.Milliseconds())
+
+	if config.TenantIdleTTL < 0 {
+		return nil, fmt.Errorf("TenantIdleTTL should be zero or positive (given: %v)", config.TenantIdleTTL)
+	}
+	if config.TenantSweepInterval < 0 {
+		return nil, fmt.Errorf("TenantSweepInterval should be zero or positive (given: %v)", config.TenantSweepInterval)
+	}
+	if config.TenantIdleTTL > 0 {
+		tenantIdleTTLMillis := config.TenantIdleTTL.Milliseconds()
+		if tenantIdleTTLMillis <= 0 {
+			return nil, fmt.Errorf("TenantIdleTTL should be at least 1ms (given: %v)", config.TenantIdleTTL)
+		}
+		out.TenantIdleTTL = uint64(tenantIdleTTLMillis)
+
+		out.TenantSweepInterval = config.TenantSweepInterval
+		if out.TenantSweepInterval == 0 {
+			out.TenantSweepInterval = config.TenantIdleTTL / 4
+		}
+	} else if config.TenantSweepInterval > 0 {
+		logger.Warning("TenantSweepInterval was specified without a TenantIdleTTL and will be ignored")
+	}
+
+	if config.MaxRetryIn < 0 {
+		return nil, fmt.Errorf("MaxRetryIn should be zero or positive (given: %v)", config.MaxRetryIn)
+	}
+	out.MaxRetryIn = config.MaxRetryIn
+
+	if config.RetryInJitterFactor < 0 || config.RetryInJitterFactor > 1.0 {
+		return nil, fmt.Errorf("RetryInJitterFactor should be valued in the range from 0.0 to 1.0 (given: %v)", config.RetryInJitterFactor)
+	}
+	out.RetryInJitterFactor = config.RetryInJitterFactor
+
+	if config.RetryInGranularity < 0 {
+		return nil, fmt.Errorf("RetryInGranularity should be zero or positive (given: %v)", config.RetryInGranularity)
+	}
+	out.RetryInGranularity = config.RetryInGranularity
+
+	if config.WriteBackInterval < 0 {
+		return nil, fmt.Errorf("WriteBackInterval should be zero or positive (given: %v)", config.WriteBackInterval)
+	}
+	if config.AsyncWriteBack {
+		out.AsyncWriteBack = true
+		out.WriteBackInterval = config.WriteBackInterval
+		if out.WriteBackInterval == 0 {
+			out.WriteBackInterval = defaultWriteBackInterval
+		}
+	} else if config.WriteBackInterval > 0 {
+		logger.Warning("WriteBackInterval was specified without AsyncWriteBack and will be ignored")
+	}
+
+	syncLockTimeout, syncLockRetryInterval, err := validateSyncLockRetry(
+		config.SyncLockTimeout, config.SyncLockRetryInterval, logger)
+	if err != nil {
+		return nil, err
+	}
+	out.SyncLockTimeout = syncLockTimeout
+	out.SyncLockRetryInterval = syncLockRetryInterval
+
 	return &out, nil
 }
 
+// validateSyncLockRetry validates the retry policy
+// for acquiring the SyncAdapter lock, applying the defaults.
+func validateSyncLockRetry(timeout time.Duration, retryInterval time.Duration, logger Logger) (time.Duration, time.Duration, error) {
+	if timeout < 0 {
+		return 0, 0, fmt.Errorf("SyncLockTimeout should be zero or positive (given: %v)", timeout)
+	}
+	if retryInterval < 0 {
+		return 0, 0, fmt.Errorf("SyncLockRetryInterval should be zero or positive (given: %v)", retryInterval)
+	}
+
+	if timeout == 0 {
+		if retryInterval > 0 {
+			logger.Warning("SyncLockRetryInterval was specified without a SyncLockTimeout and will be ignored")
+		}
+		return 0, 0, nil
+	}
+
+	if retryInterval == 0 {
+		retryInterval = timeout / 10
+	}
+	return timeout, retryInterval, nil
+}
+
 // NewComposite returns an instance of goll.LoadLimiter
 // built with the specified configuration, combining multiple
 // limiter policies into a single instance.
@@ -272,6 +1147,10 @@ func NewComposite(config *CompositeConfig) (CompositeLoadLimiter, error) {
 		effectiveLogger.Info("binding provided logger to composite LoadLimiter")
 	}
 
+	if err := validateTimeFunc(config.TimeFunc); err != nil {
+		return nil, err
+	}
+
 	parsedConfig, err := validateCompositeConfiguration(config, effectiveLogger)
 	if err != nil {
 		return nil, err
@@ -283,20 +1162,33 @@ func NewComposite(config *CompositeConfig) (CompositeLoadLimiter, error) {
 		SleepFunc:   config.SleepFunc,
 		Logger:      effectiveLogger,
 		SyncAdapter: config.SyncAdapter,
+
+		SyncAdapterSelector: config.SyncAdapterSelector,
+		StrictSync:          config.StrictSync,
+		OnSyncMetrics:       config.OnSyncMetrics,
+		SyncHealthCheckKey:  config.SyncHealthCheckKey,
+		VerifyWrites:        config.VerifyWrites,
+		TenantKeyValidator:  config.TenantKeyValidator,
+		Hooks: submitHooks{
+			OnAccept:        config.OnAccept,
+			OnReject:        config.OnReject,
+			OnOverloadStart: config.OnOverloadStart,
+			OnOverloadEnd:   config.OnOverloadEnd,
+		},
 	}
 
 	if out.TimeFunc == nil {
 		out.TimeFunc = time.Now
 	}
-	if out.SleepFunc == nil {
-		out.SleepFunc = time.Sleep
+	if config.UseMonotonicClock {
+		out.TimeFunc = monotonicTimeFunc(out.TimeFunc)
 	}
 
 	subTimeFunc := func() time.Time {
 		return out.TimeFunc()
 	}
 	subSleepFunc := func(d time.Duration) {
-		out.SleepFunc(d)
+		out.sleep(d)
 	}
 
 	limiters := make([]*loadLimiterDefaultImpl, len(config.Limiters))
@@ -312,9 +1204,54 @@ func NewComposite(config *CompositeConfig) (CompositeLoadLimiter, error) {
 		}
 		config.SleepFunc = subSleepFunc
 
+		if config.UseMonotonicClock {
+			return nil, errors.New("cannot specify UseMonotonicClock on a composed limiter. Please specify it on the parent limiter instead")
+		}
+
 		if config.SyncAdapter != nil {
 			return nil, errors.New("cannot specify SyncAdapter on a composed limiter. Please specify it on the parent limiter instead")
 		}
+		if config.TenantIdleTTL != 0 {
+			return nil, errors.New("cannot specify TenantIdleTTL on a composed limiter")
+		}
+		if config.AsyncWriteBack {
+			return nil, errors.New("cannot specify AsyncWriteBack on a composed limiter")
+		}
+		if config.OnSyncMetrics != nil {
+			return nil, errors.New("cannot specify OnSyncMetrics on a composed limiter. Please specify it on the parent limiter instead")
+		}
+		if config.SyncHealthCheckKey != "" {
+			return nil, errors.New("cannot specify SyncHealthCheckKey on a composed limiter. Please specify it on the parent limiter instead")
+		}
+		if config.VerifyWrites {
+			return nil, errors.New("cannot specify VerifyWrites on a composed limiter. Please specify it on the parent limiter instead")
+		}
+		if config.TenantKeyValidator != nil {
+			return nil, errors.New("cannot specify TenantKeyValidator on a composed limiter. Please specify it on the parent limiter instead")
+		}
+		if config.ParentKeyFunc != nil {
+			return nil, errors.New("cannot specify ParentKeyFunc on a composed limiter")
+		}
+		if config.SyncLockTimeout != 0 || config.SyncLockRetryInterval != 0 {
+			return nil, errors.New("cannot specify SyncLockTimeout or SyncLockRetryInterval on a composed limiter. Please specify them on the parent limiter instead")
+		}
+		if config.SyncAdapterSelector != nil {
+			return nil, errors.New("cannot specify SyncAdapterSelector on a composed limiter. Please specify it on the parent limiter instead")
+		}
+		if config.OnAccept != nil || config.OnReject != nil {
+			return nil, errors.New("cannot specify OnAccept or OnReject on a composed limiter. Please specify them on the parent limiter instead")
+		}
+		if config.OnOverloadStart != nil || config.OnOverloadEnd != nil {
+			return nil, errors.New("cannot specify OnOverloadStart or OnOverloadEnd on a composed limiter. Please specify them on the parent limiter instead")
+		}
+
+		// the global flag and the labels are held by the composite limiter
+		config.Global = false
+		config.Labels = nil
+
+		if config.Name == "" {
+			config.Name = fmt.Sprintf("limiter[%d]", i)
+		}
 
 		if config.Logger == nil {
 			config.Logger = effectiveLogger
@@ -332,9 +1269,160 @@ func NewComposite(config *CompositeConfig) (CompositeLoadLimiter, error) {
 	return &out, nil
 }
 
+// TokenBucketConfig holds the configuration for a token bucket limiter.
+type TokenBucketConfig struct {
+
+	// Capacity is a required parameter holding the maximum amount
+	// of tokens each bucket can hold, that is the maximum burst allowed.
+	//
+	// New buckets start full.
+	Capacity uint64
+
+	// RefillRate is a required parameter holding the amount of tokens
+	// added to each bucket every RefillInterval.
+	//
+	// Tokens are refilled continuously, not at the end of each interval.
+	RefillRate uint64
+
+	// RefillInterval is the interval RefillRate refers to.
+	//
+	// If not provided, it is assumed to be one second.
+	RefillInterval time.Duration
+
+	// CostFunc computes the load of a request from a descriptor
+	// of the request itself, allowing to centralize the cost policy.
+	//
+	// It is required in order to use SubmitCost.
+	CostFunc func(meta interface{}) uint64
+
+	// FloatLoadPrecision is the number of load units
+	// corresponding to a load of 1.0 submitted with SubmitFloat or ProbeFloat,
+	// allowing fractional cost models without scaling every request by hand.
+	//
+	// Capacity and RefillRate are expressed in load units:
+	// for instance, with FloatLoadPrecision = 1000 a Capacity of 50500
+	// allows 50.5 units of fractional load.
+	// Fractional loads are rounded up to the nearest load unit.
+	//
+	// If not provided, it is assumed to be 1.
+	FloatLoadPrecision uint64
+
+	// UseMonotonicClock bases the time computations on the monotonic clock,
+	// making the limiter immune to wall clock steps like the ones applied by NTP.
+	//
+	// The wall clock is read once at construction and the time passed since then
+	// is measured on the monotonic clock: the segment start times become
+	// relative to the construction of the limiter and can drift
+	// from the actual wall clock, and from other synchronized instances, over time.
+	UseMonotonicClock bool
+
+	// Time-related functions can be overriden to allow for easier testing
+	// you should usually not override these.
+	//
+	// A custom TimeFunc is called twice at construction as a sanity check:
+	// it should return non-zero, non-decreasing times.
+	//
+	// A custom SleepFunc cannot be interrupted: when waiting with a cancellable context
+	// it is run in a separate goroutine, that keeps running until the SleepFunc returns
+	// even if the context gets cancelled before.
+	TimeFunc  func() time.Time
+	SleepFunc func(d time.Duration)
+
+	// you can pass your custom logger if you'd like to
+	// but it's not required
+	Logger Logger
+}
+
+// NewTokenBucket returns an instance of goll.StandaloneLoadLimiter
+// implementing the classic token bucket algorithm
+// with the specified configuration.
+//
+// Each tenant gets a bucket holding up to Capacity tokens
+// that gets refilled at the given rate. A load is accepted
+// if the bucket holds enough tokens, which are then consumed.
+//
+// The token bucket limiter does not support synchronization,
+// penalties, snapshots and reservations.
+//
+// A non-nil error is returned in case of invalid configuration.
+func NewTokenBucket(config *TokenBucketConfig) (StandaloneLoadLimiter, error) {
+	effectiveLogger := config.Logger
+	if effectiveLogger == nil {
+		effectiveLogger = &defaultLogger{}
+	} else {
+		effectiveLogger.Info("binding provided logger to token bucket LoadLimiter")
+	}
+
+	if err := validateTimeFunc(config.TimeFunc); err != nil {
+		return nil, err
+	}
+
+	parsedConfig, err := validateTokenBucketConfiguration(config)
+	if err != nil {
+		return nil, err
+	}
+
+	out := tokenBucketLimiterImpl{
+		Config:     parsedConfig,
+		TenantData: make(map[string]*tokenBucketTenantData),
+		TimeFunc:   config.TimeFunc,
+		SleepFunc:  config.SleepFunc,
+		Logger:     effectiveLogger,
+		CostFunc:   config.CostFunc,
+	}
+
+	if out.TimeFunc == nil {
+		out.TimeFunc = time.Now
+	}
+	if config.UseMonotonicClock {
+		out.TimeFunc = monotonicTimeFunc(out.TimeFunc)
+	}
+
+	return &out, nil
+}
+
+// validateTokenBucketConfiguration will parse the user-provided configuration
+// to the required format for runtime while also validating it.
+func validateTokenBucketConfiguration(config *TokenBucketConfig) (*tokenBucketEffectiveConfig, error) {
+	out := tokenBucketEffectiveConfig{}
+
+	if config.Capacity <= 0 {
+		return nil, fmt.Errorf("Capacity should be greater than 0 (given: %v)", config.Capacity)
+	}
+	out.Capacity = config.Capacity
+
+	if config.RefillRate <= 0 {
+		return nil, fmt.Errorf("RefillRate should be greater than 0 (given: %v)", config.RefillRate)
+	}
+
+	refillInterval := config.RefillInterval
+	if refillInterval == 0 {
+		refillInterval = defaultRefillInterval
+	}
+	refillIntervalMillis := refillInterval.Milliseconds()
+	if refillIntervalMillis <= 0 {
+		return nil, fmt.Errorf("RefillInterval should be at least 1ms (given: %v)", config.RefillInterval)
+	}
+
+	out.RefillRate = config.RefillRate
+	out.RefillInterval = uint64(refillIntervalMillis)
+	out.TokensPerMillisecond = float64(config.RefillRate) / float64(refillIntervalMillis)
+
+	out.FloatLoadPrecision = 1
+	if config.FloatLoadPrecision > 1 {
+		out.FloatLoadPrecision = config.FloatLoadPrecision
+	}
+
+	return &out, nil
+}
+
 // validateCompositeConfiguration will parse the user-provided configuration
 // to the required format for runtime while also validating it.
 func validateCompositeConfiguration(config *CompositeConfig, logger Logger) (*compositeLoadLimiterEffectiveConfig, error) {
+	if logger == nil {
+		logger = &defaultLogger{}
+	}
+
 	out := compositeLoadLimiterEffectiveConfig{}
 
 	num := len(config.Limiters)
@@ -342,9 +1430,167 @@ func validateCompositeConfiguration(config *CompositeConfig, logger Logger) (*co
 		return nil, errors.New("composite load limiter requires at least one component configuration")
 	}
 
+	switch config.Mode {
+	case CompositeModeAll, CompositeModeAny:
+		out.Mode = config.Mode
+	default:
+		return nil, fmt.Errorf("unknown Mode (given: %v)", config.Mode)
+	}
+
+	syncLockTimeout, syncLockRetryInterval, err := validateSyncLockRetry(
+		config.SyncLockTimeout, config.SyncLockRetryInterval, logger)
+	if err != nil {
+		return nil, err
+	}
+	out.SyncLockTimeout = syncLockTimeout
+	out.SyncLockRetryInterval = syncLockRetryInterval
+
+	out.Global = make([]bool, num)
+	for i, limiterConfig := range config.Limiters {
+		if !limiterConfig.Global {
+			continue
+		}
+		if config.SyncAdapter != nil || config.SyncAdapterSelector != nil {
+			return nil, fmt.Errorf("limiter at index %d cannot be Global when a SyncAdapter is provided", i)
+		}
+		out.Global[i] = true
+	}
+
+	out.Labels = make([][]string, num)
+	for i, limiterConfig := range config.Limiters {
+		for _, label := range limiterConfig.Labels {
+			if label == "" {
+				return nil, fmt.Errorf("limiter at index %d should not have blank labels (given: %q)", i, limiterConfig.Labels)
+			}
+		}
+		if len(limiterConfig.Labels) > 0 {
+			out.Labels[i] = append([]string(nil), limiterConfig.Labels...)
+		}
+	}
+
+	if config.EnforceHierarchy {
+		for i := 1; i < num; i++ {
+			previous := config.Limiters[i-1]
+			current := config.Limiters[i]
+
+			if current.WindowSize <= 0 || previous.WindowSize <= 0 {
+				// invalid window sizes are reported when building the single limiters
+				continue
+			}
+
+			if current.WindowSize <= previous.WindowSize {
+				return nil, fmt.Errorf("limiter at index %d should have a larger WindowSize than limiter at index %d to enforce hierarchy (given: %v after %v)",
+					i, i-1, current.WindowSize, previous.WindowSize)
+			}
+
+			previousRate := float64(previous.MaxLoad) / previous.WindowSize.Seconds()
+			currentRate := float64(current.MaxLoad) / current.WindowSize.Seconds()
+			if currentRate > previousRate {
+				return nil, fmt.Errorf("limiter at index %d should not allow a higher sustainable rate than limiter at index %d to enforce hierarchy (given: %.2f/s after %.2f/s)",
+					i, i-1, currentRate, previousRate)
+			}
+		}
+	}
+
+	warnRedundantLimiters(config.Limiters, logger)
+
 	return &out, nil
 }
 
+// compositePolicy holds the configuration fields
+// that determine the behaviour of a composed limiter.
+type compositePolicy struct {
+	MaxLoad                                  uint64
+	WindowSize                               time.Duration
+	WindowSegmentSize                        time.Duration
+	OverstepPenaltyFactor                    float64
+	OverstepPenaltyDistributionFactor        float64
+	RequestOverheadPenaltyFactor             float64
+	RequestOverheadPenaltyDistributionFactor float64
+	MaxPenaltyCapFactor                      float64
+	LoadQuantum                              uint64
+	AcceptanceSpreadSegments                 uint64
+	AggregationMode                          AggregationMode
+	Algorithm                                Algorithm
+	Global                                   bool
+}
+
+func compositePolicyOf(config Config) compositePolicy {
+	return compositePolicy{
+		MaxLoad:                                  config.MaxLoad,
+		WindowSize:                               config.WindowSize,
+		WindowSegmentSize:                        config.WindowSegmentSize,
+		OverstepPenaltyFactor:                    config.OverstepPenaltyFactor,
+		OverstepPenaltyDistributionFactor:        config.OverstepPenaltyDistributionFactor,
+		RequestOverheadPenaltyFactor:             config.RequestOverheadPenaltyFactor,
+		RequestOverheadPenaltyDistributionFactor: config.RequestOverheadPenaltyDistributionFactor,
+		MaxPenaltyCapFactor:                      config.MaxPenaltyCapFactor,
+		LoadQuantum:                              config.LoadQuantum,
+		AcceptanceSpreadSegments:                 config.AcceptanceSpreadSegments,
+		AggregationMode:                          config.AggregationMode,
+		Algorithm:                                config.Algorithm,
+		Global:                                   config.Global,
+	}
+}
+
+// warnRedundantLimiters logs a warning for each composed limiter
+// that can never reject a load already accepted by another one,
+// as probing it only wastes CPU.
+//
+// This analysis is not fatal and is conservative:
+// limiters using penalties or a non-default algorithm or aggregation mode are not checked
+// for redundancy as their behaviour depends on the load history.
+func warnRedundantLimiters(limiters []Config, logger Logger) {
+	for i := range limiters {
+		for j := i + 1; j < len(limiters); j++ {
+			if len(limiters[i].Labels) > 0 || len(limiters[j].Labels) > 0 {
+				// labeled limiters may apply to different loads
+				continue
+			}
+			if compositePolicyOf(limiters[i]) == compositePolicyOf(limiters[j]) {
+				logger.Warning(fmt.Sprintf("limiters at index %d and %d have identical configurations, one of them is redundant", i, j))
+			}
+		}
+	}
+
+	for i, weaker := range limiters {
+		if !isRedundancyComparable(weaker) ||
+			weaker.OverstepPenaltyFactor > 0 || weaker.RequestOverheadPenaltyFactor > 0 {
+			continue
+		}
+
+		for j, stricter := range limiters {
+			if i == j || !isRedundancyComparable(stricter) {
+				continue
+			}
+			if compositePolicyOf(weaker) == compositePolicyOf(stricter) {
+				// already reported as identical
+				continue
+			}
+			if weaker.Global && !stricter.Global {
+				// a global limiter sums the load of all the tenants
+				continue
+			}
+
+			// every window of the weaker limiter is contained in a window of the stricter one,
+			// holding at most the MaxLoad of the stricter limiter.
+			if stricter.WindowSize >= weaker.WindowSize && stricter.MaxLoad <= weaker.MaxLoad {
+				logger.Warning(fmt.Sprintf("limiter at index %d is redundant as limiter at index %d is always stricter (%v over %v against %v over %v)",
+					i, j, weaker.MaxLoad, weaker.WindowSize, stricter.MaxLoad, stricter.WindowSize))
+				break
+			}
+		}
+	}
+}
+
+func isRedundancyComparable(config Config) bool {
+	return config.MaxLoad > 0 && config.WindowSize > 0 &&
+		len(config.Labels) == 0 &&
+		config.Algorithm == AlgorithmSlidingWindow &&
+		config.AggregationMode == AggregationSum &&
+		config.AcceptanceSpreadSegments <= 1
+}
+
 func pickSegmentSize(windowSizeMillis int64) (time.Duration, error) {
 	if windowSizeMillis <= 0 {
 		return 0, errors.New("negative duration is not allowed")
@@ -360,3 +1606,24 @@ func pickSegmentSize(windowSizeMillis int64) (time.Duration, error) {
 	}
 	return time.Duration(res) * time.Millisecond, nil
 }
+
+// roundSegmentSize adjusts the given segment size so that it divides the window evenly,
+// rounding the resulting number of segments according to the given policy.
+func roundSegmentSize(windowSizeMillis int64, segmentSizeMillis int64, rounding SegmentRounding) int64 {
+	numSegments := windowSizeMillis / segmentSizeMillis
+
+	if rounding == SegmentRoundingUp {
+		numSegments++
+		// always terminates as the window size divides itself
+		for windowSizeMillis%numSegments != 0 {
+			numSegments++
+		}
+	} else {
+		// always terminates as 1 divides the window size
+		for numSegments > 1 && windowSizeMillis%numSegments != 0 {
+			numSegments--
+		}
+	}
+
+	return windowSizeMillis / numSegments
+}
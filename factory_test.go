@@ -1,6 +1,7 @@
 package goll
 
 import (
+	"math"
 	"testing"
 	"time"
 
@@ -427,3 +428,769 @@ func expectCompositeFailure(t *testing.T, config *CompositeConfig, message strin
 
 	assert.Contains(t, err.Error(), message)
 }
+
+func TestValidateConfigurationWithAggregationMode(t *testing.T) {
+	parsed, err := validateConfiguration(&Config{
+		MaxLoad:    1000,
+		WindowSize: time.Duration(60) * time.Second,
+	}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, AggregationSum, parsed.AggregationMode)
+
+	parsed, err = validateConfiguration(&Config{
+		MaxLoad:         1000,
+		WindowSize:      time.Duration(60) * time.Second,
+		AggregationMode: AggregationWeightedAvg,
+	}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, AggregationWeightedAvg, parsed.AggregationMode)
+
+	_, err = validateConfiguration(&Config{
+		MaxLoad:         1000,
+		WindowSize:      time.Duration(60) * time.Second,
+		AggregationMode: AggregationMode(99),
+	}, nil)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "AggregationMode")
+}
+
+func TestEffectiveConfig(t *testing.T) {
+	ti := buildInstance(t, func(config *Config) {
+		config.WindowSize = time.Duration(60) * time.Second
+		config.WindowSegmentSize = 0
+		config.OverstepPenaltyFactor = 0.2
+	})
+
+	effective := ti.Instance.EffectiveConfig()
+
+	// the segment size is automatically picked as 1/20 of the window
+	assert.Equal(t, uint64(100), effective.MaxLoad)
+	assert.Equal(t, time.Duration(60)*time.Second, effective.WindowSize)
+	assert.Equal(t, time.Duration(3)*time.Second, effective.WindowSegmentSize)
+	assert.Equal(t, uint64(20), effective.NumSegments)
+	assert.Equal(t, AlgorithmSlidingWindow, effective.Algorithm)
+	assert.Equal(t, 0.2, effective.OverstepPenaltyFactor)
+	assert.Equal(t, uint64(20), effective.AbsoluteOverstepPenalty)
+	assert.Equal(t, uint64(1), effective.OverstepPenaltySegmentSpan)
+	assert.Equal(t, defaultMaxPenaltyCapFactor, effective.MaxPenaltyCapFactor)
+	assert.Equal(t, uint64(150), effective.AbsoluteMaxPenaltyCap)
+	assert.False(t, effective.Global)
+
+	// changes at runtime are reflected
+	assert.Nil(t, ti.Instance.SetMaxLoad(200))
+	effective = ti.Instance.EffectiveConfig()
+	assert.Equal(t, uint64(200), effective.MaxLoad)
+	assert.Equal(t, uint64(300), effective.AbsoluteMaxPenaltyCap)
+}
+
+func TestValidateConfigurationWithSegmentRounding(t *testing.T) {
+	_, err := validateConfiguration(&Config{
+		MaxLoad:           1000,
+		WindowSize:        time.Duration(60) * time.Second,
+		WindowSegmentSize: time.Duration(7) * time.Second,
+	}, nil)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "exact multiple")
+
+	parsed, err := validateConfiguration(&Config{
+		MaxLoad:           1000,
+		WindowSize:        time.Duration(60) * time.Second,
+		WindowSegmentSize: time.Duration(7) * time.Second,
+		SegmentRounding:   SegmentRoundingUp,
+	}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(6000), parsed.WindowSegmentSize)
+	assert.Equal(t, uint64(10), parsed.NumSegments)
+
+	parsed, err = validateConfiguration(&Config{
+		MaxLoad:           1000,
+		WindowSize:        time.Duration(60) * time.Second,
+		WindowSegmentSize: time.Duration(7) * time.Second,
+		SegmentRounding:   SegmentRoundingDown,
+	}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(7500), parsed.WindowSegmentSize)
+	assert.Equal(t, uint64(8), parsed.NumSegments)
+
+	// a prime window size can only be rounded to a single segment or to 1ms segments
+	parsed, err = validateConfiguration(&Config{
+		MaxLoad:           1000,
+		WindowSize:        time.Duration(7) * time.Millisecond,
+		WindowSegmentSize: time.Duration(2) * time.Millisecond,
+		SegmentRounding:   SegmentRoundingDown,
+	}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(7), parsed.WindowSegmentSize)
+	assert.Equal(t, uint64(1), parsed.NumSegments)
+
+	parsed, err = validateConfiguration(&Config{
+		MaxLoad:           1000,
+		WindowSize:        time.Duration(7) * time.Millisecond,
+		WindowSegmentSize: time.Duration(2) * time.Millisecond,
+		SegmentRounding:   SegmentRoundingUp,
+	}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(1), parsed.WindowSegmentSize)
+	assert.Equal(t, uint64(7), parsed.NumSegments)
+
+	_, err = validateConfiguration(&Config{
+		MaxLoad:         1000,
+		WindowSize:      time.Duration(60) * time.Second,
+		SegmentRounding: SegmentRounding(99),
+	}, nil)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "SegmentRounding")
+}
+
+func TestValidateConfigurationWithPenaltyDecayFactor(t *testing.T) {
+	parsed, err := validateConfiguration(&Config{
+		MaxLoad:            1000,
+		WindowSize:         time.Duration(60) * time.Second,
+		PenaltyDecayFactor: 0.3,
+	}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 0.3, parsed.PenaltyDecayFactor)
+
+	expectFailure(t, &Config{
+		MaxLoad:            1000,
+		WindowSize:         time.Duration(60) * time.Second,
+		PenaltyDecayFactor: 1.1,
+	}, "PenaltyDecayFactor should be valued in the range from 0.0 to 1.0")
+
+	expectFailure(t, &Config{
+		MaxLoad:            1000,
+		WindowSize:         time.Duration(60) * time.Second,
+		PenaltyDecayFactor: -0.1,
+	}, "PenaltyDecayFactor should be valued in the range from 0.0 to 1.0")
+}
+
+func TestValidateConfigurationWithWarmup(t *testing.T) {
+	parsed, err := validateConfiguration(&Config{
+		MaxLoad:        1000,
+		WindowSize:     time.Duration(60) * time.Second,
+		WarmupDuration: time.Duration(5) * time.Second,
+		WarmupRequests: 10,
+	}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(5000), parsed.WarmupDuration)
+	assert.Equal(t, uint64(10), parsed.WarmupRequests)
+
+	expectFailure(t, &Config{
+		MaxLoad:        1000,
+		WindowSize:     time.Duration(60) * time.Second,
+		WarmupDuration: -time.Second,
+	}, "WarmupDuration should be zero or positive")
+}
+
+func TestValidateConfigurationWithGracePeriodAfterRecovery(t *testing.T) {
+	parsed, err := validateConfiguration(&Config{
+		MaxLoad:                  1000,
+		WindowSize:               time.Duration(60) * time.Second,
+		GracePeriodAfterRecovery: time.Duration(2) * time.Second,
+	}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(2000), parsed.GracePeriodAfterRecovery)
+
+	expectFailure(t, &Config{
+		MaxLoad:                  1000,
+		WindowSize:               time.Duration(60) * time.Second,
+		GracePeriodAfterRecovery: -time.Second,
+	}, "GracePeriodAfterRecovery should be zero or positive")
+}
+
+func TestValidateConfigurationWithPenaltyCapPolicy(t *testing.T) {
+	parsed, err := validateConfiguration(&Config{
+		MaxLoad:          1000,
+		WindowSize:       time.Duration(60) * time.Second,
+		PenaltyCapPolicy: PenaltyCapReject,
+	}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, PenaltyCapReject, parsed.PenaltyCapPolicy)
+
+	expectFailure(t, &Config{
+		MaxLoad:          1000,
+		WindowSize:       time.Duration(60) * time.Second,
+		PenaltyCapPolicy: PenaltyCapPolicy(42),
+	}, "unknown PenaltyCapPolicy")
+
+	expectFailure(t, &Config{
+		MaxLoad:          1000,
+		WindowSize:       time.Duration(60) * time.Second,
+		PenaltyCapPolicy: PenaltyCapAndNotify,
+	}, "OnPenaltyCapped is required with PenaltyCapAndNotify")
+}
+
+func TestValidateConfigurationWithSyncLockTimeout(t *testing.T) {
+	parsed, err := validateConfiguration(&Config{
+		MaxLoad:         1000,
+		WindowSize:      time.Duration(60) * time.Second,
+		SyncLockTimeout: time.Second,
+	}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, time.Second, parsed.SyncLockTimeout)
+	assert.Equal(t, 100*time.Millisecond, parsed.SyncLockRetryInterval)
+
+	// the retry interval is ignored without a timeout
+	parsed, err = validateConfiguration(&Config{
+		MaxLoad:               1000,
+		WindowSize:            time.Duration(60) * time.Second,
+		SyncLockRetryInterval: time.Second,
+	}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, time.Duration(0), parsed.SyncLockRetryInterval)
+
+	expectFailure(t, &Config{
+		MaxLoad:         1000,
+		WindowSize:      time.Duration(60) * time.Second,
+		SyncLockTimeout: -time.Second,
+	}, "SyncLockTimeout should be zero or positive")
+
+	expectFailure(t, &Config{
+		MaxLoad:               1000,
+		WindowSize:            time.Duration(60) * time.Second,
+		SyncLockTimeout:       time.Second,
+		SyncLockRetryInterval: -time.Second,
+	}, "SyncLockRetryInterval should be zero or positive")
+}
+
+func TestValidateConfigurationWithAcceptanceSpreadSegments(t *testing.T) {
+	parsed, err := validateConfiguration(&Config{
+		MaxLoad:                  1000,
+		WindowSize:               time.Duration(60) * time.Second,
+		WindowSegmentSize:        time.Duration(1) * time.Second,
+		AcceptanceSpreadSegments: 5,
+	}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(5), parsed.AcceptanceSpreadSegments)
+
+	parsed, err = validateConfiguration(&Config{
+		MaxLoad:                  1000,
+		WindowSize:               time.Duration(60) * time.Second,
+		AcceptanceSpreadSegments: 1,
+	}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(0), parsed.AcceptanceSpreadSegments)
+
+	expectFailure(t, &Config{
+		MaxLoad:                  1000,
+		WindowSize:               time.Duration(60) * time.Second,
+		WindowSegmentSize:        time.Duration(1) * time.Second,
+		AcceptanceSpreadSegments: 61,
+	}, "AcceptanceSpreadSegments should not be greater than the number of segments")
+}
+
+func TestValidateConfigurationWithWindowQueueInitialCapacity(t *testing.T) {
+	// three windows by default
+	parsed, err := validateConfiguration(&Config{
+		MaxLoad:           1000,
+		WindowSize:        time.Duration(60) * time.Second,
+		WindowSegmentSize: time.Duration(1) * time.Second,
+	}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(180), parsed.WindowQueueInitialCapacity)
+
+	parsed, err = validateConfiguration(&Config{
+		MaxLoad:                    1000,
+		WindowSize:                 time.Duration(60) * time.Second,
+		WindowSegmentSize:          time.Duration(1) * time.Second,
+		WindowQueueInitialCapacity: 16,
+	}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(16), parsed.WindowQueueInitialCapacity)
+
+	expectFailure(t, &Config{
+		MaxLoad:                    1000,
+		WindowSize:                 time.Duration(60) * time.Second,
+		WindowQueueInitialCapacity: math.MaxInt32 + 1,
+	}, "WindowQueueInitialCapacity should not be greater than")
+}
+
+func TestValidateConfigurationWithPenaltyDistributionStrategy(t *testing.T) {
+	parsed, err := validateConfiguration(&Config{
+		MaxLoad:    1000,
+		WindowSize: time.Duration(60) * time.Second,
+	}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, PenaltyDistributionEven, parsed.PenaltyDistributionStrategy)
+
+	parsed, err = validateConfiguration(&Config{
+		MaxLoad:                     1000,
+		WindowSize:                  time.Duration(60) * time.Second,
+		PenaltyDistributionStrategy: PenaltyDistributionBackLoaded,
+	}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, PenaltyDistributionBackLoaded, parsed.PenaltyDistributionStrategy)
+
+	expectFailure(t, &Config{
+		MaxLoad:                     1000,
+		WindowSize:                  time.Duration(60) * time.Second,
+		PenaltyDistributionStrategy: PenaltyDistributionStrategy(42),
+	}, "unknown PenaltyDistributionStrategy")
+}
+
+func TestValidateConfigurationWithOnStaleRemote(t *testing.T) {
+	parsed, err := validateConfiguration(&Config{
+		MaxLoad:    1000,
+		WindowSize: time.Duration(60) * time.Second,
+	}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, StaleRemoteError, parsed.OnStaleRemote)
+
+	parsed, err = validateConfiguration(&Config{
+		MaxLoad:       1000,
+		WindowSize:    time.Duration(60) * time.Second,
+		OnStaleRemote: StaleRemoteAcceptRemote,
+	}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, StaleRemoteAcceptRemote, parsed.OnStaleRemote)
+
+	expectFailure(t, &Config{
+		MaxLoad:       1000,
+		WindowSize:    time.Duration(60) * time.Second,
+		OnStaleRemote: StaleRemotePolicy(42),
+	}, "unknown OnStaleRemote")
+}
+
+func TestValidateConfigurationWithAlgorithm(t *testing.T) {
+	parsed, err := validateConfiguration(&Config{
+		MaxLoad:    1000,
+		WindowSize: time.Duration(60) * time.Second,
+	}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, AlgorithmSlidingWindow, parsed.Algorithm)
+
+	parsed, err = validateConfiguration(&Config{
+		MaxLoad:    1000,
+		WindowSize: time.Duration(60) * time.Second,
+		Algorithm:  AlgorithmFixedWindow,
+	}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, AlgorithmFixedWindow, parsed.Algorithm)
+	assert.Equal(t, uint64(60000), parsed.WindowSegmentSize)
+	assert.Equal(t, uint64(1), parsed.NumSegments)
+
+	_, err = validateConfiguration(&Config{
+		MaxLoad:           1000,
+		WindowSize:        time.Duration(60) * time.Second,
+		WindowSegmentSize: time.Duration(1) * time.Second,
+		Algorithm:         AlgorithmFixedWindow,
+	}, nil)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "WindowSegmentSize")
+
+	_, err = validateConfiguration(&Config{
+		MaxLoad:    1000,
+		WindowSize: time.Duration(60) * time.Second,
+		Algorithm:  Algorithm(99),
+	}, nil)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "Algorithm")
+}
+
+func TestValidateConfigurationWithAsyncWriteBack(t *testing.T) {
+	parsed, err := validateConfiguration(&Config{
+		MaxLoad:        1000,
+		WindowSize:     time.Duration(60) * time.Second,
+		AsyncWriteBack: true,
+	}, nil)
+	assert.Nil(t, err)
+	assert.True(t, parsed.AsyncWriteBack)
+	assert.Equal(t, 100*time.Millisecond, parsed.WriteBackInterval)
+
+	parsed, err = validateConfiguration(&Config{
+		MaxLoad:           1000,
+		WindowSize:        time.Duration(60) * time.Second,
+		AsyncWriteBack:    true,
+		WriteBackInterval: time.Second,
+	}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, time.Second, parsed.WriteBackInterval)
+
+	_, err = validateConfiguration(&Config{
+		MaxLoad:           1000,
+		WindowSize:        time.Duration(60) * time.Second,
+		AsyncWriteBack:    true,
+		WriteBackInterval: -time.Second,
+	}, nil)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "WriteBackInterval")
+
+	_, err = NewComposite(&CompositeConfig{
+		Limiters: []Config{
+			{
+				MaxLoad:        1000,
+				WindowSize:     time.Duration(60) * time.Second,
+				AsyncWriteBack: true,
+			},
+		},
+	})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "AsyncWriteBack")
+}
+
+func TestValidateConfigurationWithSerializationFormat(t *testing.T) {
+	parsed, err := validateConfiguration(&Config{
+		MaxLoad:    1000,
+		WindowSize: time.Duration(60) * time.Second,
+	}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, SerializationText, parsed.SerializationFormat)
+
+	parsed, err = validateConfiguration(&Config{
+		MaxLoad:             1000,
+		WindowSize:          time.Duration(60) * time.Second,
+		SerializationFormat: SerializationCompact,
+	}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, SerializationCompact, parsed.SerializationFormat)
+
+	_, err = validateConfiguration(&Config{
+		MaxLoad:             1000,
+		WindowSize:          time.Duration(60) * time.Second,
+		SerializationFormat: SerializationFormat(99),
+	}, nil)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "SerializationFormat")
+}
+
+func TestValidateConfigurationWithLoadQuantum(t *testing.T) {
+	parsed, err := validateConfiguration(&Config{
+		MaxLoad:     1000,
+		WindowSize:  time.Duration(60) * time.Second,
+		LoadQuantum: 10,
+	}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(10), parsed.LoadQuantum)
+
+	// a quantum of 1 is the same as no quantum at all
+	parsed, err = validateConfiguration(&Config{
+		MaxLoad:     1000,
+		WindowSize:  time.Duration(60) * time.Second,
+		LoadQuantum: 1,
+	}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(0), parsed.LoadQuantum)
+
+	// not an exact divisor is allowed but logs a warning
+	logger := &testLogger{}
+	_, err = validateConfiguration(&Config{
+		MaxLoad:     1000,
+		WindowSize:  time.Duration(60) * time.Second,
+		LoadQuantum: 300,
+	}, logger)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(logger.Messages))
+	assert.Contains(t, logger.Messages[0], "effective max load will be 900")
+
+	_, err = validateConfiguration(&Config{
+		MaxLoad:     1000,
+		WindowSize:  time.Duration(60) * time.Second,
+		LoadQuantum: 1001,
+	}, nil)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "LoadQuantum")
+}
+
+func TestValidateCompositeConfigurationWithHierarchy(t *testing.T) {
+	perSecond := Config{
+		MaxLoad:    10,
+		WindowSize: time.Second,
+	}
+	perMinute := Config{
+		MaxLoad:    500,
+		WindowSize: time.Minute,
+	}
+	perHour := Config{
+		MaxLoad:    20000,
+		WindowSize: time.Hour,
+	}
+
+	parsed, err := validateCompositeConfiguration(&CompositeConfig{
+		EnforceHierarchy: true,
+		Limiters:         []Config{perSecond, perMinute, perHour},
+	}, nil)
+	assert.Nil(t, err)
+	assert.NotNil(t, parsed)
+
+	// misordered limiters are accepted when the hierarchy is not enforced
+	parsed, err = validateCompositeConfiguration(&CompositeConfig{
+		Limiters: []Config{perMinute, perSecond},
+	}, nil)
+	assert.Nil(t, err)
+	assert.NotNil(t, parsed)
+
+	expectCompositeFailure(t, &CompositeConfig{
+		EnforceHierarchy: true,
+		Limiters:         []Config{perSecond, perHour, perMinute},
+	}, "index 2 should have a larger WindowSize than limiter at index 1")
+
+	expectCompositeFailure(t, &CompositeConfig{
+		EnforceHierarchy: true,
+		Limiters:         []Config{perSecond, perSecond},
+	}, "index 1 should have a larger WindowSize")
+
+	expectCompositeFailure(t, &CompositeConfig{
+		EnforceHierarchy: true,
+		Limiters: []Config{perSecond, {
+			MaxLoad:    1000,
+			WindowSize: time.Minute,
+		}},
+	}, "index 1 should not allow a higher sustainable rate than limiter at index 0 to enforce hierarchy (given: 16.67/s after 10.00/s)")
+}
+
+func TestValidateConfigurationWithMaxRetryIn(t *testing.T) {
+	parsed, err := validateConfiguration(&Config{
+		MaxLoad:    1000,
+		WindowSize: time.Duration(60) * time.Second,
+		MaxRetryIn: time.Second,
+	}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, time.Second, parsed.MaxRetryIn)
+
+	expectFailure(t, &Config{
+		MaxLoad:    1000,
+		WindowSize: time.Duration(60) * time.Second,
+		MaxRetryIn: -time.Second,
+	}, "MaxRetryIn should be zero or positive (given: -1s)")
+}
+
+func TestValidateConfigurationWithRetryInJitterFactor(t *testing.T) {
+	parsed, err := validateConfiguration(&Config{
+		MaxLoad:             1000,
+		WindowSize:          time.Duration(60) * time.Second,
+		RetryInJitterFactor: 0.3,
+	}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 0.3, parsed.RetryInJitterFactor)
+
+	expectFailure(t, &Config{
+		MaxLoad:             1000,
+		WindowSize:          time.Duration(60) * time.Second,
+		RetryInJitterFactor: -0.1,
+	}, "RetryInJitterFactor should be valued in the range from 0.0 to 1.0 (given: -0.1)")
+
+	expectFailure(t, &Config{
+		MaxLoad:             1000,
+		WindowSize:          time.Duration(60) * time.Second,
+		RetryInJitterFactor: 1.5,
+	}, "RetryInJitterFactor should be valued in the range from 0.0 to 1.0 (given: 1.5)")
+}
+
+func TestValidateConfigurationWithRetryInGranularity(t *testing.T) {
+	parsed, err := validateConfiguration(&Config{
+		MaxLoad:            1000,
+		WindowSize:         time.Duration(60) * time.Second,
+		RetryInGranularity: 100 * time.Millisecond,
+	}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 100*time.Millisecond, parsed.RetryInGranularity)
+
+	expectFailure(t, &Config{
+		MaxLoad:            1000,
+		WindowSize:         time.Duration(60) * time.Second,
+		RetryInGranularity: -time.Second,
+	}, "RetryInGranularity should be zero or positive (given: -1s)")
+}
+
+func TestValidateCompositeConfigurationWithRedundancy(t *testing.T) {
+	perSecond := Config{
+		MaxLoad:    10,
+		WindowSize: time.Second,
+	}
+	perMinute := Config{
+		MaxLoad:    500,
+		WindowSize: time.Minute,
+	}
+
+	// no warnings for complementary limiters
+	logger := &testLogger{}
+	_, err := validateCompositeConfiguration(&CompositeConfig{
+		Limiters: []Config{perSecond, perMinute},
+	}, logger)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(logger.Messages))
+
+	// a larger window with a lower max load is always stricter
+	dominated := Config{
+		MaxLoad:    600,
+		WindowSize: time.Second * 30,
+	}
+	logger = &testLogger{}
+	_, err = validateCompositeConfiguration(&CompositeConfig{
+		Limiters: []Config{perSecond, dominated, perMinute},
+	}, logger)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		"[w] limiter at index 1 is redundant as limiter at index 2 is always stricter (600 over 30s against 500 over 1m0s)",
+	}, logger.Messages)
+
+	// identical limiters are reported once
+	logger = &testLogger{}
+	_, err = validateCompositeConfiguration(&CompositeConfig{
+		Limiters: []Config{perSecond, perMinute, perSecond},
+	}, logger)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		"[w] limiters at index 0 and 2 have identical configurations, one of them is redundant",
+	}, logger.Messages)
+
+	// a per-tenant limiter does not make a global one redundant
+	global := dominated
+	global.Global = true
+	logger = &testLogger{}
+	_, err = validateCompositeConfiguration(&CompositeConfig{
+		Limiters: []Config{perMinute, global},
+	}, logger)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(logger.Messages))
+
+	// limiters applying penalties are not considered redundant
+	penalized := dominated
+	penalized.RequestOverheadPenaltyFactor = 0.1
+	logger = &testLogger{}
+	_, err = validateCompositeConfiguration(&CompositeConfig{
+		Limiters: []Config{perMinute, penalized},
+	}, logger)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(logger.Messages))
+}
+
+func TestValidateCompositeConfigurationWithGlobal(t *testing.T) {
+	perTenant := Config{
+		MaxLoad:    100,
+		WindowSize: time.Minute,
+	}
+	global := Config{
+		MaxLoad:    10000,
+		WindowSize: time.Minute,
+		Global:     true,
+	}
+
+	parsed, err := validateCompositeConfiguration(&CompositeConfig{
+		Limiters: []Config{perTenant, global},
+	}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []bool{false, true}, parsed.Global)
+
+	expectFailure(t, &global, "Global can only be specified on a composed limiter")
+
+	expectCompositeFailure(t, &CompositeConfig{
+		Limiters:    []Config{perTenant, global},
+		SyncAdapter: &testSyncAdapter{},
+	}, "limiter at index 1 cannot be Global when a SyncAdapter is provided")
+
+	expectCompositeFailure(t, &CompositeConfig{
+		Limiters: []Config{perTenant, global},
+		SyncAdapterSelector: func(tenantKey string) SyncAdapter {
+			return nil
+		},
+	}, "limiter at index 1 cannot be Global when a SyncAdapter is provided")
+}
+
+func TestValidateCompositeConfigurationWithLabels(t *testing.T) {
+	reads := Config{
+		MaxLoad:    100,
+		WindowSize: time.Minute,
+		Labels:     []string{"read"},
+	}
+	writes := Config{
+		MaxLoad:    100,
+		WindowSize: time.Minute,
+		Labels:     []string{"write"},
+	}
+
+	// limiters with different labels are not redundant
+	logger := &testLogger{}
+	parsed, err := validateCompositeConfiguration(&CompositeConfig{
+		Limiters: []Config{reads, writes, {MaxLoad: 500, WindowSize: time.Minute}},
+	}, logger)
+	assert.Nil(t, err)
+	assert.Equal(t, [][]string{{"read"}, {"write"}, nil}, parsed.Labels)
+	assert.Equal(t, 0, len(logger.Messages))
+
+	expectFailure(t, &reads, "Labels can only be specified on a composed limiter")
+
+	blank := reads
+	blank.Labels = []string{"read", ""}
+	expectCompositeFailure(t, &CompositeConfig{
+		Limiters: []Config{writes, blank},
+	}, `limiter at index 1 should not have blank labels (given: ["read" ""])`)
+}
+
+func TestValidateCompositeConfigurationWithMode(t *testing.T) {
+	limiter := Config{
+		MaxLoad:    100,
+		WindowSize: time.Minute,
+	}
+
+	parsed, err := validateCompositeConfiguration(&CompositeConfig{
+		Limiters: []Config{limiter},
+	}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, CompositeModeAll, parsed.Mode)
+
+	parsed, err = validateCompositeConfiguration(&CompositeConfig{
+		Limiters: []Config{limiter},
+		Mode:     CompositeModeAny,
+	}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, CompositeModeAny, parsed.Mode)
+
+	expectCompositeFailure(t, &CompositeConfig{
+		Limiters: []Config{limiter},
+		Mode:     CompositeMode(42),
+	}, "unknown Mode")
+}
+
+func TestValidateConfigurationWithTenantIdleTTL(t *testing.T) {
+	parsed, err := validateConfiguration(&Config{
+		MaxLoad:    1000,
+		WindowSize: time.Duration(60) * time.Second,
+	}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(0), parsed.TenantIdleTTL)
+
+	parsed, err = validateConfiguration(&Config{
+		MaxLoad:       1000,
+		WindowSize:    time.Duration(60) * time.Second,
+		TenantIdleTTL: time.Hour,
+	}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(3600000), parsed.TenantIdleTTL)
+	assert.Equal(t, 15*time.Minute, parsed.TenantSweepInterval)
+
+	parsed, err = validateConfiguration(&Config{
+		MaxLoad:             1000,
+		WindowSize:          time.Duration(60) * time.Second,
+		TenantIdleTTL:       time.Hour,
+		TenantSweepInterval: time.Minute,
+	}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, time.Minute, parsed.TenantSweepInterval)
+
+	expectFailure(t, &Config{
+		MaxLoad:       1000,
+		WindowSize:    time.Duration(60) * time.Second,
+		TenantIdleTTL: -time.Second,
+	}, "TenantIdleTTL should be zero or positive")
+	expectFailure(t, &Config{
+		MaxLoad:       1000,
+		WindowSize:    time.Duration(60) * time.Second,
+		TenantIdleTTL: time.Microsecond,
+	}, "TenantIdleTTL should be at least 1ms")
+	expectFailure(t, &Config{
+		MaxLoad:             1000,
+		WindowSize:          time.Duration(60) * time.Second,
+		TenantIdleTTL:       time.Hour,
+		TenantSweepInterval: -time.Second,
+	}, "TenantSweepInterval should be zero or positive")
+	expectCompositeFailure(t, &CompositeConfig{
+		Limiters: []Config{
+			{
+				MaxLoad:       1000,
+				WindowSize:    time.Duration(60) * time.Second,
+				TenantIdleTTL: time.Hour,
+			},
+		},
+	}, "cannot specify TenantIdleTTL on a composed limiter")
+}
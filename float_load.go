@@ -0,0 +1,75 @@
+package goll
+
+import (
+	"fmt"
+	"math"
+)
+
+// floatLoadTolerance absorbs the floating point errors
+// of the scaling, like 0.7 * 100 = 70.00000000000001,
+// that would otherwise be rounded up to the next load unit.
+const floatLoadTolerance = 1e-9
+
+// scaleFloatLoad converts the given fractional load to load units,
+// rounding it up so that fractional costs are never under-accounted.
+func scaleFloatLoad(load float64, precision uint64) (uint64, error) {
+	if math.IsNaN(load) || load < 0 {
+		return 0, fmt.Errorf("load should be zero or positive (given: %v)", load)
+	}
+
+	scaled := load * float64(precision)
+	if rounded := math.Round(scaled); math.Abs(scaled-rounded) < floatLoadTolerance {
+		scaled = rounded
+	}
+	scaled = math.Ceil(scaled)
+
+	if scaled >= math.MaxUint64 {
+		return 0, fmt.Errorf("load is too large for FloatLoadPrecision %v (given: %v)", precision, load)
+	}
+	return uint64(scaled), nil
+}
+
+// SubmitFloat asks for the given fractional load to be accepted,
+// scaling it by the configured FloatLoadPrecision
+// and rounding it up to the nearest load unit.
+func (instance *loadLimiterDefaultImpl) SubmitFloat(tenantKey string, load float64) (SubmitResult, error) {
+	scaled, err := scaleFloatLoad(load, instance.Config.FloatLoadPrecision)
+	if err != nil {
+		return SubmitResult{}, err
+	}
+
+	return instance.Submit(tenantKey, scaled)
+}
+
+// ProbeFloat checks if the given fractional load would be allowed right now,
+// scaling it like SubmitFloat does.
+func (instance *loadLimiterDefaultImpl) ProbeFloat(tenantKey string, load float64) (bool, error) {
+	scaled, err := scaleFloatLoad(load, instance.Config.FloatLoadPrecision)
+	if err != nil {
+		return false, err
+	}
+
+	return instance.Probe(tenantKey, scaled)
+}
+
+// SubmitFloat asks for the given fractional load to be accepted,
+// consuming the corresponding tokens scaled by the configured FloatLoadPrecision.
+func (instance *tokenBucketLimiterImpl) SubmitFloat(tenantKey string, load float64) (SubmitResult, error) {
+	scaled, err := scaleFloatLoad(load, instance.Config.FloatLoadPrecision)
+	if err != nil {
+		return SubmitResult{}, err
+	}
+
+	return instance.Submit(tenantKey, scaled)
+}
+
+// ProbeFloat checks if the given fractional load would be allowed right now,
+// scaling it like SubmitFloat does.
+func (instance *tokenBucketLimiterImpl) ProbeFloat(tenantKey string, load float64) (bool, error) {
+	scaled, err := scaleFloatLoad(load, instance.Config.FloatLoadPrecision)
+	if err != nil {
+		return false, err
+	}
+
+	return instance.Probe(tenantKey, scaled)
+}
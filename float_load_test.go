@@ -0,0 +1,69 @@
+package goll
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScaleFloatLoad(t *testing.T) {
+	assert.Equal(t, uint64(500), noErrors(scaleFloatLoad(0.5, 1000)))
+	assert.Equal(t, uint64(70), noErrors(scaleFloatLoad(0.7, 100)))
+	assert.Equal(t, uint64(0), noErrors(scaleFloatLoad(0, 1000)))
+
+	// rounded up to the nearest load unit
+	assert.Equal(t, uint64(1), noErrors(scaleFloatLoad(0.5, 1)))
+	assert.Equal(t, uint64(2), noErrors(scaleFloatLoad(1.0001, 1)))
+	assert.Equal(t, uint64(1235), noErrors(scaleFloatLoad(1.2341, 1000)))
+
+	_, err := scaleFloatLoad(-1, 1000)
+	assert.NotNil(t, err)
+	_, err = scaleFloatLoad(math.NaN(), 1000)
+	assert.NotNil(t, err)
+	_, err = scaleFloatLoad(math.Inf(1), 1000)
+	assert.NotNil(t, err)
+	_, err = scaleFloatLoad(1e17, 1000)
+	assert.NotNil(t, err)
+}
+
+func TestSubmitFloat(t *testing.T) {
+	// 10.0 units of fractional load
+	ti := buildInstance(t, func(config *Config) {
+		config.MaxLoad = 10000
+		config.FloatLoadPrecision = 1000
+	})
+
+	assert.True(t, submitNoError(ti.Instance.SubmitFloat(defaultTestTenantKey, 2.5)).Accepted)
+	ti.TimeTravel(1000)
+	assert.True(t, submitNoError(ti.Instance.SubmitFloat(defaultTestTenantKey, 7.25)).Accepted)
+	ti.AssertWindowStatus(t, defaultTestTenantKey, 9750, "1001000:7250", "1000000:2500")
+
+	assert.True(t, noErrors(ti.Instance.ProbeFloat(defaultTestTenantKey, 0.25)).(bool))
+	assert.False(t, noErrors(ti.Instance.ProbeFloat(defaultTestTenantKey, 0.251)).(bool))
+
+	// RetryIn works with the finer granularity
+	rejected := submitNoError(ti.Instance.SubmitFloat(defaultTestTenantKey, 0.3))
+	assert.False(t, rejected.Accepted)
+	assert.True(t, rejected.RetryInAvailable)
+	assert.Equal(t, 9*time.Second, rejected.RetryIn)
+
+	_, err := ti.Instance.SubmitFloat(defaultTestTenantKey, -0.5)
+	assert.NotNil(t, err)
+
+	assert.Equal(t, uint64(1000), ti.Instance.EffectiveConfig().FloatLoadPrecision)
+	assert.Equal(t, uint64(1), buildDefaultInstance(t).Instance.EffectiveConfig().FloatLoadPrecision)
+}
+
+func TestTokenBucketSubmitFloat(t *testing.T) {
+	ti := buildTokenBucketInstance(t, func(config *TokenBucketConfig) {
+		config.Capacity = 1000
+		config.RefillRate = 100
+		config.FloatLoadPrecision = 100
+	})
+
+	assert.True(t, submitNoError(ti.Instance.SubmitFloat(defaultTestTenantKey, 9.5)).Accepted)
+	assert.True(t, noErrors(ti.Instance.ProbeFloat(defaultTestTenantKey, 0.5)).(bool))
+	assert.False(t, noErrors(ti.Instance.ProbeFloat(defaultTestTenantKey, 0.51)).(bool))
+}
@@ -0,0 +1,61 @@
+package goll
+
+import "time"
+
+// submitHooks holds the optional callbacks
+// notified of every accepted or rejected load
+// and of the changes of the overload status.
+type submitHooks struct {
+	OnAccept func(tenantKey string, load uint64)
+	OnReject func(tenantKey string, load uint64, retryIn time.Duration, retryInAvailable bool)
+
+	OnOverloadStart func(tenantKey string)
+	OnOverloadEnd   func(tenantKey string)
+}
+
+// overloadTransition describes how the overload status
+// of a tenant changed with a submission.
+type overloadTransition int
+
+const (
+	overloadUnchanged overloadTransition = iota
+	overloadStarted
+	overloadEnded
+)
+
+// overloadTransitionOf compares the overload status
+// before and after a submission.
+func overloadTransitionOf(wasOverBefore bool, wasOverAfter bool) overloadTransition {
+	if !wasOverBefore && wasOverAfter {
+		return overloadStarted
+	}
+	if wasOverBefore && !wasOverAfter {
+		return overloadEnded
+	}
+	return overloadUnchanged
+}
+
+// notify invokes the hooks matching the given result and transition, if provided.
+//
+// It should be called after releasing all the locks,
+// so that the hooks can safely call back into the limiter.
+func (h submitHooks) notify(tenantKey string, load uint64, res SubmitResult, transition overloadTransition) {
+	if res.Accepted {
+		if h.OnAccept != nil {
+			h.OnAccept(tenantKey, load)
+		}
+	} else if h.OnReject != nil {
+		h.OnReject(tenantKey, load, res.RetryIn, res.RetryInAvailable)
+	}
+
+	switch transition {
+	case overloadStarted:
+		if h.OnOverloadStart != nil {
+			h.OnOverloadStart(tenantKey)
+		}
+	case overloadEnded:
+		if h.OnOverloadEnd != nil {
+			h.OnOverloadEnd(tenantKey)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package goll
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubmitHooks(t *testing.T) {
+	var accepted []uint64
+	var rejected []time.Duration
+
+	var ti *testableInstance
+	ti = buildInstance(t, func(config *Config) {
+		config.LoadQuantum = 5
+		config.OnAccept = func(tenantKey string, load uint64) {
+			assert.Equal(t, defaultTestTenantKey, tenantKey)
+			accepted = append(accepted, load)
+
+			// hooks are called without holding the lock
+			_, err := ti.Instance.Stats(tenantKey)
+			assert.Nil(t, err)
+		}
+		config.OnReject = func(tenantKey string, load uint64, retryIn time.Duration, retryInAvailable bool) {
+			assert.Equal(t, defaultTestTenantKey, tenantKey)
+			assert.Equal(t, uint64(10), load)
+			assert.True(t, retryInAvailable)
+			rejected = append(rejected, retryIn)
+
+			_, err := ti.Instance.Probe(tenantKey, 1)
+			assert.Nil(t, err)
+		}
+	})
+
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 3)).Accepted)
+	ti.TimeTravel(1000)
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 90)).Accepted)
+	assert.False(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 10)).Accepted)
+
+	reservation, err := ti.Instance.Reserve(defaultTestTenantKey, 10)
+	assert.Nil(t, err)
+	assert.False(t, reservation.Accepted)
+
+	// loads are reported after quantization
+	assert.Equal(t, []uint64{5, 90}, accepted)
+	assert.Equal(t, []time.Duration{9 * time.Second, 9 * time.Second}, rejected)
+
+	// probes do not trigger the hooks
+	_, err = ti.Instance.Probe(defaultTestTenantKey, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(accepted))
+	assert.Equal(t, 2, len(rejected))
+}
+
+func TestCompositeSubmitHooks(t *testing.T) {
+	acceptedCount := 0
+	rejectedCount := 0
+
+	var ti *compositeTestableInstance
+	ti = buildCompositeInstance(t, func(config *CompositeConfig) {
+		config.OnAccept = func(tenantKey string, load uint64) {
+			acceptedCount++
+			_, err := ti.Instance.Stats(tenantKey)
+			assert.Nil(t, err)
+		}
+		config.OnReject = func(tenantKey string, load uint64, retryIn time.Duration, retryInAvailable bool) {
+			rejectedCount++
+			assert.Equal(t, uint64(21), load)
+		}
+	})
+
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 20)).Accepted)
+	assert.False(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 21)).Accepted)
+
+	assert.Equal(t, 1, acceptedCount)
+	assert.Equal(t, 1, rejectedCount)
+
+	// hooks are not allowed on the composed limiters
+	_, err := NewComposite(&CompositeConfig{
+		Limiters: []Config{
+			{
+				MaxLoad:    10,
+				WindowSize: time.Second,
+				OnAccept:   func(tenantKey string, load uint64) {},
+			},
+		},
+	})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "cannot specify OnAccept or OnReject on a composed limiter")
+}
+
+func TestOverloadHooks(t *testing.T) {
+	var events []string
+
+	var ti *testableInstance
+	ti = buildInstance(t, func(config *Config) {
+		config.OnOverloadStart = func(tenantKey string) {
+			events = append(events, "start "+tenantKey)
+
+			overloaded, err := ti.Instance.IsOverloaded(tenantKey)
+			assert.Nil(t, err)
+			assert.True(t, overloaded)
+		}
+		config.OnOverloadEnd = func(tenantKey string) {
+			events = append(events, "end "+tenantKey)
+		}
+	})
+
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 90)).Accepted)
+	assert.Empty(t, events)
+
+	// fired once, not for every rejection while overloaded
+	assert.False(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 20)).Accepted)
+	assert.False(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 20)).Accepted)
+	reservation, err := ti.Instance.Reserve(defaultTestTenantKey, 20)
+	assert.Nil(t, err)
+	assert.False(t, reservation.Accepted)
+	assert.Equal(t, []string{"start test"}, events)
+
+	// the next accepted load ends the overload
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 5)).Accepted)
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 5)).Accepted)
+	assert.Equal(t, []string{"start test", "end test"}, events)
+
+	// again through a reservation
+	assert.True(t, submitNoError(ti.Instance.Submit("other", 95)).Accepted)
+	assert.False(t, submitNoError(ti.Instance.Submit("other", 10)).Accepted)
+	reservation, err = ti.Instance.Reserve("other", 5)
+	assert.Nil(t, err)
+	assert.True(t, reservation.Accepted)
+	assert.Equal(t, []string{"start test", "end test", "start other", "end other"}, events)
+}
+
+func TestCompositeOverloadHooks(t *testing.T) {
+	var events []string
+
+	ti := buildCompositeInstance(t, func(config *CompositeConfig) {
+		config.OnOverloadStart = func(tenantKey string) {
+			events = append(events, "start "+tenantKey)
+		}
+		config.OnOverloadEnd = func(tenantKey string) {
+			events = append(events, "end "+tenantKey)
+		}
+	})
+
+	// rejected by the second limiter only
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 20)).Accepted)
+	assert.False(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 1)).Accepted)
+	assert.False(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 1)).Accepted)
+	assert.Equal(t, []string{"start test"}, events)
+
+	ti.TimeTravel(1000)
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 1)).Accepted)
+	assert.Equal(t, []string{"start test", "end test"}, events)
+
+	_, err := NewComposite(&CompositeConfig{
+		Limiters: []Config{
+			{
+				MaxLoad:         10,
+				WindowSize:      time.Second,
+				OnOverloadStart: func(tenantKey string) {},
+			},
+		},
+	})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "cannot specify OnOverloadStart or OnOverloadEnd on a composed limiter")
+}
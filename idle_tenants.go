@@ -0,0 +1,54 @@
+package goll
+
+import (
+	"fmt"
+	"time"
+)
+
+// startIdleTenantsSweeper starts a background routine
+// periodically removing idle tenants until Close is called.
+func (instance *loadLimiterDefaultImpl) startIdleTenantsSweeper() {
+	stop := make(chan struct{})
+	instance.stopSweeper = stop
+
+	ticker := time.NewTicker(instance.Config.TenantSweepInterval)
+
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				instance.sweepIdleTenants()
+			}
+		}
+	}()
+}
+
+// sweepIdleTenants removes all the tenants that were not accessed
+// for longer than the configured TenantIdleTTL,
+// returning the number of removed tenants.
+//
+// Tenants with a pending write-back are kept until it gets written,
+// otherwise their changes would never reach the remote store.
+func (instance *loadLimiterDefaultImpl) sweepIdleTenants() int {
+	t := uint64(instance.currentTime().UnixMilli())
+
+	instance.Lock.Lock()
+	defer instance.Lock.Unlock()
+
+	removed := 0
+	for tenantKey, tenant := range instance.TenantData {
+		if t > tenant.LastAccess && t-tenant.LastAccess > instance.Config.TenantIdleTTL && !instance.hasPendingWriteBack(tenantKey) {
+			instance.evictTenant(tenantKey)
+			removed++
+		}
+	}
+
+	if removed > 0 {
+		instance.Logger.Debug(fmt.Sprintf("removed %d idle tenants", removed))
+	}
+
+	return removed
+}
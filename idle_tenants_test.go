@@ -0,0 +1,90 @@
+package goll
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSweepIdleTenants(t *testing.T) {
+	ti := buildInstance(t, func(config *Config) {
+		// keep the background routine from interfering with the test
+		config.TenantIdleTTL = 5 * time.Second
+		config.TenantSweepInterval = time.Hour
+	})
+	defer ti.Instance.Close()
+
+	_, _ = ti.Instance.Submit("first", 1)
+	ti.TimeTravel(3000)
+	_, _ = ti.Instance.Probe("second", 1)
+	assert.Equal(t, 0, ti.Instance.sweepIdleTenants())
+
+	ti.TimeTravel(2001)
+	assert.Equal(t, 1, ti.Instance.sweepIdleTenants())
+	assert.Equal(t, []string{"second"}, ti.Instance.ListTenants())
+
+	// accessing the tenant keeps it alive
+	ti.TimeTravel(3000)
+	_, _ = ti.Instance.Submit("second", 1)
+	ti.TimeTravel(3000)
+	assert.Equal(t, 0, ti.Instance.sweepIdleTenants())
+
+	ti.TimeTravel(2001)
+	assert.Equal(t, 1, ti.Instance.sweepIdleTenants())
+	assert.Equal(t, []string{}, ti.Instance.ListTenants())
+}
+
+func TestIdleTenantsSweeperRoutine(t *testing.T) {
+	instance, err := New(&Config{
+		MaxLoad:             100,
+		WindowSize:          time.Second,
+		TenantIdleTTL:       20 * time.Millisecond,
+		TenantSweepInterval: 5 * time.Millisecond,
+	})
+	assert.Nil(t, err)
+
+	_, _ = instance.Submit(defaultTestTenantKey, 1)
+	assert.Equal(t, []string{defaultTestTenantKey}, instance.ListTenants())
+
+	assert.Eventually(t, func() bool {
+		return len(instance.ListTenants()) == 0
+	}, time.Second, 5*time.Millisecond)
+
+	assert.Nil(t, instance.Close())
+	// closing twice is allowed
+	assert.Nil(t, instance.Close())
+}
+
+func TestSweepIdleTenantsKeepsPendingWriteBacks(t *testing.T) {
+	adapter := testSyncAdapter{}
+	adapter.Clear()
+
+	ti := buildInstance(t, func(config *Config) {
+		config.SyncAdapter = &adapter
+		config.AsyncWriteBack = true
+		// keep the background routines from interfering with the test
+		config.WriteBackInterval = time.Hour
+		config.TenantIdleTTL = 5 * time.Second
+		config.TenantSweepInterval = time.Hour
+	})
+	defer ti.Instance.Close()
+
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 5)).Accepted)
+
+	// the change was not written yet: the tenant is kept
+	ti.TimeTravel(6000)
+	assert.Equal(t, 0, ti.Instance.sweepIdleTenants())
+	assert.Equal(t, []string{defaultTestTenantKey}, ti.Instance.ListTenants())
+
+	adapter.Clear()
+	assert.Nil(t, ti.Instance.Flush())
+	assert.Equal(t, []string{
+		"LOCK test",
+		"WRITE test v2/ver=3/total=5/over=0/seg=1000000:5/acc=1/rej=0",
+		"UNLOCK test",
+	}, adapter.collector)
+
+	assert.Equal(t, 1, ti.Instance.sweepIdleTenants())
+	assert.Equal(t, []string{}, ti.Instance.ListTenants())
+}
@@ -0,0 +1,54 @@
+package goll
+
+import (
+	"errors"
+	"fmt"
+)
+
+// SubmitLabeled asks for the given load to be accepted
+// by the composed limiters applying to the given labels.
+//
+// A composed limiter applies to the load if it has no labels
+// or if at least one of its labels is among the given ones.
+// An error is returned if none of the composed limiters applies.
+func (instance *compositeLoadLimiterDefaultImpl) SubmitLabeled(tenantKey string, labels []string, load uint64) (SubmitResult, error) {
+	if len(labels) == 0 {
+		return SubmitResult{}, errors.New("SubmitLabeled requires at least one label")
+	}
+
+	applies := false
+	for i := range instance.Limiters {
+		if instance.appliesTo(i, labels) {
+			applies = true
+			break
+		}
+	}
+	if !applies {
+		return SubmitResult{}, fmt.Errorf("no composed limiter applies to the given labels (given: %q)", labels)
+	}
+
+	res, transition, err := instance.submitLocked(tenantKey, labels, load)
+	if err == nil {
+		instance.Hooks.notify(tenantKey, load, res, transition)
+	}
+	return res, err
+}
+
+// appliesTo checks if the composed limiter at the given index
+// should evaluate a load submitted with the given labels.
+//
+// Loads submitted without labels are evaluated by all the composed limiters.
+func (instance *compositeLoadLimiterDefaultImpl) appliesTo(index int, labels []string) bool {
+	limiterLabels := instance.Config.Labels[index]
+	if labels == nil || len(limiterLabels) == 0 {
+		return true
+	}
+	for _, limiterLabel := range limiterLabels {
+		for _, label := range labels {
+			if label == limiterLabel {
+				return true
+			}
+		}
+	}
+	return false
+}
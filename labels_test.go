@@ -0,0 +1,111 @@
+package goll
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func buildLabeledCompositeInstance(t *testing.T, mode CompositeMode) *compositeTestableInstance {
+	return buildCompositeInstance(t, func(config *CompositeConfig) {
+		config.Mode = mode
+		config.Limiters = []Config{
+			{
+				Name:              "reads",
+				MaxLoad:           20,
+				WindowSize:        defaultWindowSize,
+				WindowSegmentSize: defaultSegmentSize,
+				Labels:            []string{"read"},
+			},
+			{
+				Name:              "writes",
+				MaxLoad:           10,
+				WindowSize:        defaultWindowSize,
+				WindowSegmentSize: defaultSegmentSize,
+				Labels:            []string{"write", "delete"},
+			},
+			{
+				Name:              "all",
+				MaxLoad:           50,
+				WindowSize:        defaultWindowSize,
+				WindowSegmentSize: defaultSegmentSize,
+			},
+		}
+	})
+}
+
+func TestCompositeSubmitLabeled(t *testing.T) {
+	ti := buildLabeledCompositeInstance(t, CompositeModeAll)
+
+	// reads are checked against the read limit and the unlabeled one
+	assert.True(t, submitNoError(ti.Instance.SubmitLabeled(defaultTestTenantKey, []string{"read"}, 20)).Accepted)
+	rejected := submitNoError(ti.Instance.SubmitLabeled(defaultTestTenantKey, []string{"read"}, 1))
+	assert.False(t, rejected.Accepted)
+	assert.Equal(t, []int{0}, rejected.RejectedBy)
+
+	// writes are not affected by the read limit
+	assert.True(t, submitNoError(ti.Instance.SubmitLabeled(defaultTestTenantKey, []string{"write"}, 10)).Accepted)
+	rejected = submitNoError(ti.Instance.SubmitLabeled(defaultTestTenantKey, []string{"delete"}, 1))
+	assert.False(t, rejected.Accepted)
+	assert.Equal(t, []int{1}, rejected.RejectedBy)
+
+	stats, err := ti.Instance.Stats(defaultTestTenantKey)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(20), stats.LimitersStats[0].WindowTotal)
+	assert.Equal(t, uint64(10), stats.LimitersStats[1].WindowTotal)
+	assert.Equal(t, uint64(30), stats.LimitersStats[2].WindowTotal)
+
+	// the labels of a request are matched against any of the limiter labels
+	rejected = submitNoError(ti.Instance.SubmitLabeled(defaultTestTenantKey, []string{"read", "write"}, 1))
+	assert.False(t, rejected.Accepted)
+	assert.Equal(t, []int{0, 1}, rejected.RejectedBy)
+
+	// plain submissions are evaluated against all the limiters
+	rejected = submitNoError(ti.Instance.Submit(defaultTestTenantKey, 1))
+	assert.False(t, rejected.Accepted)
+	assert.Equal(t, []int{0, 1}, rejected.RejectedBy)
+
+	// unknown labels only hit the unlabeled limiters
+	assert.True(t, submitNoError(ti.Instance.SubmitLabeled(defaultTestTenantKey, []string{"list"}, 20)).Accepted)
+	rejected = submitNoError(ti.Instance.SubmitLabeled(defaultTestTenantKey, []string{"list"}, 1))
+	assert.False(t, rejected.Accepted)
+	assert.Equal(t, []int{2}, rejected.RejectedBy)
+
+	_, err = ti.Instance.SubmitLabeled(defaultTestTenantKey, nil, 1)
+	assert.NotNil(t, err)
+}
+
+func TestCompositeSubmitLabeledAnyMode(t *testing.T) {
+	ti := buildLabeledCompositeInstance(t, CompositeModeAny)
+
+	// the load is committed to the first applying limiter accepting it
+	assert.True(t, submitNoError(ti.Instance.SubmitLabeled(defaultTestTenantKey, []string{"write"}, 10)).Accepted)
+	assert.True(t, submitNoError(ti.Instance.SubmitLabeled(defaultTestTenantKey, []string{"write"}, 10)).Accepted)
+
+	stats, err := ti.Instance.Stats(defaultTestTenantKey)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(0), stats.LimitersStats[0].WindowTotal)
+	assert.Equal(t, uint64(10), stats.LimitersStats[1].WindowTotal)
+	assert.Equal(t, uint64(10), stats.LimitersStats[2].WindowTotal)
+
+	// only the applying limiters are rejecting
+	rejected := submitNoError(ti.Instance.SubmitLabeled(defaultTestTenantKey, []string{"write"}, 41))
+	assert.False(t, rejected.Accepted)
+	assert.Equal(t, []int{1, 2}, rejected.RejectedBy)
+}
+
+func TestCompositeSubmitLabeledWithoutApplyingLimiters(t *testing.T) {
+	ti := buildCompositeInstance(t, func(config *CompositeConfig) {
+		config.Limiters = []Config{
+			{
+				MaxLoad:    20,
+				WindowSize: defaultWindowSize,
+				Labels:     []string{"read"},
+			},
+		}
+	})
+
+	_, err := ti.Instance.SubmitLabeled(defaultTestTenantKey, []string{"write"}, 1)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "no composed limiter applies to the given labels")
+}
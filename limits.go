@@ -0,0 +1,152 @@
+package goll
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// GrantTemporaryBoost raises the max load for the given tenant
+// by extraLoad until the given time, then automatically reverts.
+//
+// Multiple boosts stack on top of each other.
+func (instance *loadLimiterDefaultImpl) GrantTemporaryBoost(tenantKey string, extraLoad uint64, until time.Time) error {
+	if err := instance.validateTenantKey(tenantKey); err != nil {
+		return err
+	}
+
+	t := instance.currentTime()
+
+	if extraLoad == 0 {
+		return errors.New("boost extraLoad should be greater than 0")
+	}
+	if !until.After(t) {
+		return errors.New("boost expiration should be in the future")
+	}
+
+	defer instance.lockTenant(tenantKey)()
+
+	tenant := instance.getTenant(tenantKey)
+	instance.pruneExpiredBoosts(tenant, uint64(t.UnixMilli()))
+
+	tenant.Boosts = append(tenant.Boosts, tenantBoost{
+		ExtraLoad: extraLoad,
+		Until:     uint64(until.UnixMilli()),
+	})
+
+	return nil
+}
+
+func (instance *loadLimiterDefaultImpl) pruneExpiredBoosts(tenant *loadLimiterDefaultImplTenantData, t uint64) {
+	if len(tenant.Boosts) == 0 {
+		return
+	}
+	active := tenant.Boosts[:0]
+	for _, boost := range tenant.Boosts {
+		if boost.Until > t {
+			active = append(active, boost)
+		}
+	}
+	if len(active) == 0 {
+		active = nil
+	}
+	tenant.Boosts = active
+}
+
+// SetMaxLoad changes the max load allowed by the limiter,
+// preserving the load already accumulated in the windows.
+//
+// Penalties and penalty capping are scaled proportionally.
+func (instance *loadLimiterDefaultImpl) SetMaxLoad(newMax uint64) error {
+	if newMax <= 0 {
+		return fmt.Errorf("MaxLoad should be greater than 0 (given: %v)", newMax)
+	}
+
+	instance.Lock.Lock()
+	defer instance.Lock.Unlock()
+
+	config := instance.Config
+
+	if config.LoadQuantum > newMax {
+		return fmt.Errorf("LoadQuantum should not be greater than MaxLoad (given: %v over %v)", config.LoadQuantum, newMax)
+	}
+
+	config.MaxLoad = newMax
+	config.AbsoluteMaxPenaltyCap = saturatingFloatToUint(float64(newMax) * (1.0 + config.MaxPenaltyCapFactor))
+
+	if config.ApplyOverstepPenalty {
+		config.AbsoluteOverstepPenalty = saturatingFloatToUint(float64(newMax) * config.OverstepPenaltyFactor)
+	}
+
+	return nil
+}
+
+// SetTenantMaxLoad overrides the max load allowed for the given tenant.
+//
+// Penalties and penalty capping are scaled from the overridden max load.
+func (instance *loadLimiterDefaultImpl) SetTenantMaxLoad(tenantKey string, maxLoad uint64) error {
+	if err := instance.validateTenantKey(tenantKey); err != nil {
+		return err
+	}
+	if maxLoad <= 0 {
+		return fmt.Errorf("MaxLoad should be greater than 0 (given: %v)", maxLoad)
+	}
+
+	defer instance.lockTenant(tenantKey)()
+
+	if instance.Config.LoadQuantum > maxLoad {
+		return fmt.Errorf("LoadQuantum should not be greater than MaxLoad (given: %v over %v)", instance.Config.LoadQuantum, maxLoad)
+	}
+
+	instance.getTenant(tenantKey).MaxLoadOverride = maxLoad
+
+	return nil
+}
+
+// ClearTenantMaxLoad removes the max load override for the given tenant,
+// restoring the configured max load.
+func (instance *loadLimiterDefaultImpl) ClearTenantMaxLoad(tenantKey string) {
+	defer instance.lockTenant(tenantKey)()
+
+	if tenant, exists := instance.lookupTenant(tenantKey); exists {
+		tenant.MaxLoadOverride = 0
+	}
+}
+
+// CanEverFit returns true if the given load could be accepted
+// for the tenant, at least when the window is empty,
+// that is if it is not greater than the max load of the tenant.
+//
+// When a ParentKeyFunc is configured the max load of the parent is checked as well.
+// It is a cheap check that allows to discard the loads that would be
+// permanently rejected before even submitting them.
+func (instance *loadLimiterDefaultImpl) CanEverFit(tenantKey string, load uint64) bool {
+	if instance.validateTenantKey(tenantKey) != nil {
+		return false
+	}
+	t := uint64(instance.currentTime().UnixMilli())
+
+	if !instance.canEverFitLocked(t, tenantKey, load) {
+		return false
+	}
+	if parentKey, ok := instance.parentTenantKey(tenantKey); ok {
+		return instance.validateTenantKey(parentKey) == nil && instance.canEverFitLocked(t, parentKey, load)
+	}
+	return true
+}
+
+func (instance *loadLimiterDefaultImpl) canEverFitLocked(t uint64, tenantKey string, load uint64) bool {
+	defer instance.rlockTenant(tenantKey)()
+
+	return instance.canEverFit(t, tenantKey, load)
+}
+
+// canEverFit checks the load against the max load of the tenant,
+// without creating any tenant state.
+func (instance *loadLimiterDefaultImpl) canEverFit(t uint64, tenantKey string, load uint64) bool {
+	maxLoad := instance.Config.MaxLoad
+	if tenant, exists := instance.lookupTenant(tenantKey); exists {
+		maxLoad = instance.tenantMaxLoad(tenant, t)
+	}
+	return instance.quantizeLoad(load) <= maxLoad
+}
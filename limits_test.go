@@ -0,0 +1,155 @@
+package goll
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGrantTemporaryBoost(t *testing.T) {
+	ti := buildDefaultInstance(t)
+	now := ti.Instance.currentTime()
+
+	assert.Nil(t, ti.Instance.GrantTemporaryBoost(defaultTestTenantKey, 30, now.Add(5*time.Second)))
+	assert.Nil(t, ti.Instance.GrantTemporaryBoost(defaultTestTenantKey, 20, now.Add(3*time.Second)))
+
+	// boosts stack and do not get capped
+	assert.True(t, noErrors(ti.Instance.Probe(defaultTestTenantKey, 150)).(bool))
+	assert.False(t, noErrors(ti.Instance.Probe(defaultTestTenantKey, 151)).(bool))
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 140)).Accepted)
+	ti.AssertWindowStatus(t, defaultTestTenantKey, 140, "1000000:140")
+
+	// other tenants are not affected
+	assert.False(t, noErrors(ti.Instance.Probe("other", 101)).(bool))
+
+	// the second boost expired
+	ti.TimeTravel(3000)
+	assert.False(t, noErrors(ti.Instance.Probe(defaultTestTenantKey, 1)).(bool))
+
+	ti.TimeTravel(2000)
+	assert.False(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 1)).Accepted)
+
+	// once the boosted load slides out of the window the base max load applies
+	ti.TimeTravel(5000)
+	assert.True(t, noErrors(ti.Instance.Probe(defaultTestTenantKey, 100)).(bool))
+	assert.False(t, noErrors(ti.Instance.Probe(defaultTestTenantKey, 101)).(bool))
+}
+
+func TestGrantTemporaryBoostValidation(t *testing.T) {
+	ti := buildDefaultInstance(t)
+	now := ti.Instance.currentTime()
+
+	assert.NotNil(t, ti.Instance.GrantTemporaryBoost(defaultTestTenantKey, 0, now.Add(time.Second)))
+	assert.NotNil(t, ti.Instance.GrantTemporaryBoost(defaultTestTenantKey, 10, now))
+	assert.NotNil(t, ti.Instance.GrantTemporaryBoost(defaultTestTenantKey, 10, now.Add(-time.Second)))
+}
+
+func TestSetMaxLoad(t *testing.T) {
+	ti := buildInstance(t, func(config *Config) {
+		config.OverstepPenaltyFactor = 0.2
+	})
+
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 80)).Accepted)
+	assert.True(t, submitNoError(ti.Instance.Submit("other", 100)).Accepted)
+
+	assert.Nil(t, ti.Instance.SetMaxLoad(200))
+	assert.Equal(t, uint64(200), ti.Instance.Config.MaxLoad)
+	assert.Equal(t, uint64(300), ti.Instance.Config.AbsoluteMaxPenaltyCap)
+	assert.Equal(t, uint64(40), ti.Instance.Config.AbsoluteOverstepPenalty)
+
+	// the accumulated load is preserved and the new ceiling applies to all tenants
+	ti.AssertWindowStatus(t, defaultTestTenantKey, 80, "1000000:80")
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 120)).Accepted)
+	assert.False(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 1)).Accepted)
+	ti.AssertWindowStatus(t, defaultTestTenantKey, 240, "1000000:240")
+	assert.True(t, submitNoError(ti.Instance.Submit("other", 100)).Accepted)
+
+	// lowering the max load does not drop accumulated load
+	assert.Nil(t, ti.Instance.SetMaxLoad(50))
+	ti.AssertWindowStatus(t, "other", 200, "1000000:200")
+	assert.False(t, noErrors(ti.Instance.Probe("other", 1)).(bool))
+
+	assert.NotNil(t, ti.Instance.SetMaxLoad(0))
+	assert.Equal(t, uint64(50), ti.Instance.Config.MaxLoad)
+
+	ti = buildInstance(t, func(config *Config) {
+		config.LoadQuantum = 10
+	})
+	err := ti.Instance.SetMaxLoad(5)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "LoadQuantum")
+}
+
+func TestSetTenantMaxLoad(t *testing.T) {
+	ti := buildInstance(t, func(config *Config) {
+		config.OverstepPenaltyFactor = 0.2
+	})
+
+	assert.Nil(t, ti.Instance.SetTenantMaxLoad("premium", 1000))
+
+	assert.True(t, submitNoError(ti.Instance.Submit("premium", 1000)).Accepted)
+	assert.False(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 101)).Accepted)
+
+	// the overstep penalty scales from the overridden max load
+	assert.False(t, submitNoError(ti.Instance.Submit("premium", 1)).Accepted)
+	ti.AssertWindowStatus(t, "premium", 1200, "1000000:1200")
+
+	stats, err := ti.Instance.Stats("premium")
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(1000), stats.MaxLoad)
+
+	// boosts stack on top of the override
+	assert.Nil(t, ti.Instance.GrantTemporaryBoost("premium", 300, ti.Instance.currentTime().Add(time.Second)))
+	assert.True(t, noErrors(ti.Instance.Probe("premium", 100)).(bool))
+
+	// clearing the override restores the configured max load
+	ti.Instance.ClearTenantMaxLoad("premium")
+	ti.Instance.ClearTenantMaxLoad("unknown")
+	ti.TimeTravel(10000)
+	assert.False(t, noErrors(ti.Instance.Probe("premium", 101)).(bool))
+	assert.True(t, noErrors(ti.Instance.Probe("premium", 100)).(bool))
+
+	assert.NotNil(t, ti.Instance.SetTenantMaxLoad("premium", 0))
+}
+
+func TestCanEverFit(t *testing.T) {
+	ti := buildInstance(t, func(config *Config) {
+		config.ParentKeyFunc = teamParentKey
+	})
+
+	assert.True(t, ti.Instance.CanEverFit(defaultTestTenantKey, 100))
+	assert.False(t, ti.Instance.CanEverFit(defaultTestTenantKey, 101))
+
+	// the check does not create any tenant state
+	assert.Equal(t, []string{}, ti.Instance.ListTenants())
+
+	assert.Nil(t, ti.Instance.SetTenantMaxLoad("premium", 1000))
+	assert.True(t, ti.Instance.CanEverFit("premium", 1000))
+	assert.False(t, ti.Instance.CanEverFit("premium", 1001))
+
+	// boosts are included while active
+	assert.Nil(t, ti.Instance.GrantTemporaryBoost(defaultTestTenantKey, 100, ti.Instance.currentTime().Add(time.Second)))
+	assert.True(t, ti.Instance.CanEverFit(defaultTestTenantKey, 200))
+	ti.TimeTravel(1000)
+	assert.False(t, ti.Instance.CanEverFit(defaultTestTenantKey, 200))
+
+	// the parent tenant is checked as well
+	assert.Nil(t, ti.Instance.SetTenantMaxLoad("team/alice", 1000))
+	assert.False(t, ti.Instance.CanEverFit("team/alice", 200))
+	assert.Nil(t, ti.Instance.SetTenantMaxLoad("team", 1000))
+	assert.True(t, ti.Instance.CanEverFit("team/alice", 200))
+
+	// invalid keys never fit
+	assert.False(t, ti.Instance.CanEverFit("a;b", 1))
+}
+
+func TestCanEverFitWithLoadQuantum(t *testing.T) {
+	ti := buildInstance(t, func(config *Config) {
+		config.LoadQuantum = 30
+	})
+
+	// the load is quantized before the check
+	assert.True(t, ti.Instance.CanEverFit(defaultTestTenantKey, 90))
+	assert.False(t, ti.Instance.CanEverFit(defaultTestTenantKey, 91))
+}
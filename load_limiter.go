@@ -1,6 +1,9 @@
 package goll
 
-import "time"
+import (
+	"context"
+	"time"
+)
 
 // LoadLimiter is the parent interface for all kinds
 // of load limiters.
@@ -44,6 +47,24 @@ type LoadLimiter interface {
 	// types if you need additional info.
 	SubmitUntilWithDetails(tenantKey string, load uint64, timeout time.Duration) SubmitUntilResult
 
+	// SubmitUntilCtx works like SubmitUntilWithDetails
+	// but stops waiting as soon as the given context is cancelled.
+	//
+	// In case of cancellation the Error field of the output object
+	// wraps the context error and can be checked with errors.Is
+	// against context.Canceled or context.DeadlineExceeded.
+	SubmitUntilCtx(ctx context.Context, tenantKey string, load uint64, timeout time.Duration) SubmitUntilResult
+
+	// SubmitUntilWithOptions works like SubmitUntilWithDetails
+	// but accepts additional options, like a maximum number of attempts
+	// to be made regardless of the timeout.
+	SubmitUntilWithOptions(tenantKey string, load uint64, options SubmitUntilOptions) SubmitUntilResult
+
+	// SubmitUntilWithBackoff works like SubmitUntilWithDetails
+	// but waits before each retry for the time computed by the given BackoffFunc.
+	// The timeout is still honored.
+	SubmitUntilWithBackoff(tenantKey string, load uint64, timeout time.Duration, backoff BackoffFunc) SubmitUntilResult
+
 	// IsComposite returns true if the limiter is a CompositeLoadLimiter.
 	IsComposite() bool
 }
@@ -91,6 +112,24 @@ type StandaloneLoadLimiter interface {
 	// types if you need additional info.
 	SubmitUntilWithDetails(tenantKey string, load uint64, timeout time.Duration) SubmitUntilResult
 
+	// SubmitUntilCtx works like SubmitUntilWithDetails
+	// but stops waiting as soon as the given context is cancelled.
+	//
+	// In case of cancellation the Error field of the output object
+	// wraps the context error and can be checked with errors.Is
+	// against context.Canceled or context.DeadlineExceeded.
+	SubmitUntilCtx(ctx context.Context, tenantKey string, load uint64, timeout time.Duration) SubmitUntilResult
+
+	// SubmitUntilWithOptions works like SubmitUntilWithDetails
+	// but accepts additional options, like a maximum number of attempts
+	// to be made regardless of the timeout.
+	SubmitUntilWithOptions(tenantKey string, load uint64, options SubmitUntilOptions) SubmitUntilResult
+
+	// SubmitUntilWithBackoff works like SubmitUntilWithDetails
+	// but waits before each retry for the time computed by the given BackoffFunc.
+	// The timeout is still honored.
+	SubmitUntilWithBackoff(tenantKey string, load uint64, timeout time.Duration, backoff BackoffFunc) SubmitUntilResult
+
 	// IsComposite is "inherited" from LoadLimiter
 	// and always returns false for this type.
 	IsComposite() bool
@@ -99,6 +138,18 @@ type StandaloneLoadLimiter interface {
 	// performance and overhead.
 	Stats(tenantKey string) (RuntimeStatistics, error)
 
+	// StatsAll returns runtime statistics for all the tenants
+	// currently holding some state in the limiter, indexed by tenant key.
+	//
+	// Unlike calling Stats for each tenant, all the statistics
+	// are collected with a single lock acquisition.
+	// No synchronization via SyncAdapter is performed.
+	StatsAll() (map[string]RuntimeStatistics, error)
+
+	// IsOverloaded returns true if the tenant is currently in overload status,
+	// that is when its most recent request was rejected.
+	IsOverloaded(tenantKey string) (bool, error)
+
 	// ForTenant returns a semplified proxy that applies the load limiting
 	// for the specified tenant, dropping the tenantKey input parameter.
 	//
@@ -108,6 +159,12 @@ type StandaloneLoadLimiter interface {
 	// it just proxies the calls to the current limiter adding a fixed tenantKey.
 	ForTenant(tenantKey string) SingleTenantStandaloneLoadLimiter
 
+	// ForTenantSafe works like ForTenant but returns an error
+	// instead of panicking when the tenantKey is blank or reserved.
+	//
+	// Use it when the tenantKey comes from user input.
+	ForTenantSafe(tenantKey string) (SingleTenantStandaloneLoadLimiter, error)
+
 	// ForTenant returns a semplified proxy drops the tenantKey input parameter.
 	//
 	// It's useful to simplify the code when you don't need multitenancy.
@@ -115,6 +172,281 @@ type StandaloneLoadLimiter interface {
 	// Please note that this does not create a new limiter instance,
 	// it just proxies the calls to the current limiter adding a fixed tenantKey.
 	AsSingleTenant() SingleTenantStandaloneLoadLimiter
+
+	// SnapshotTenant captures the current status of the window for the given tenant.
+	//
+	// The returned snapshot can be compared with another one
+	// taken at a different time by using goll.DiffSnapshots.
+	// Unknown tenants are captured with an empty window
+	// and no state is created for them.
+	SnapshotTenant(tenantKey string) (TenantSnapshot, error)
+
+	// CopyTenantState returns a consistent deep copy of the window for the given tenant,
+	// taken atomically under the limiter lock.
+	//
+	// The returned copy can be processed without holding the limiter,
+	// which is useful for expensive exports.
+	// Unknown tenants are copied with an empty window
+	// and no state is created for them.
+	CopyTenantState(tenantKey string) (TenantStateCopy, error)
+
+	// ExportTenantState returns the status of the given tenant
+	// in the same format written to the SyncAdapter,
+	// to be used for backups and migrations.
+	ExportTenantState(tenantKey string) (string, error)
+
+	// ImportTenantState replaces the status of the given tenant
+	// with one obtained from ExportTenantState,
+	// propagating the change through the SyncAdapter if any.
+	ImportTenantState(tenantKey string, serialized string) error
+
+	// Snapshot returns the serialized status of every tenant
+	// held by the local instance, indexed by tenant key.
+	Snapshot() (map[string]string, error)
+
+	// Restore rebuilds the state of the tenants from a map obtained via Snapshot.
+	// Entries that can't be parsed are logged and skipped.
+	Restore(snapshot map[string]string) error
+
+	// DumpState returns a human-readable report of the whole limiter state,
+	// meant to be attached to bug reports.
+	//
+	// Only the state held by the local instance is included.
+	DumpState() string
+
+	// EffectiveConfig returns a read-only snapshot of the configuration
+	// in use, after defaults were applied and derived values were computed.
+	EffectiveConfig() EffectiveConfig
+
+	// GrantTemporaryBoost raises the max load for the given tenant
+	// by extraLoad until the given time, then automatically reverts.
+	//
+	// Multiple boosts stack on top of each other.
+	// Penalty capping scales with the boosted max load.
+	//
+	// Boosts are kept in memory and are not synchronized via SyncAdapter.
+	GrantTemporaryBoost(tenantKey string, extraLoad uint64, until time.Time) error
+
+	// SetMaxLoad changes the max load allowed by the limiter,
+	// preserving the load already accumulated in the windows.
+	// Penalties and penalty capping are scaled proportionally.
+	//
+	// Please note that the configuration is shared,
+	// so the change affects all the tenants.
+	SetMaxLoad(newMax uint64) error
+
+	// SetTenantMaxLoad overrides the max load allowed for the given tenant.
+	// Penalties and penalty capping are scaled from the overridden max load.
+	//
+	// Overrides are kept in memory and are not synchronized via SyncAdapter.
+	// Evicting the tenant also removes its override.
+	SetTenantMaxLoad(tenantKey string, maxLoad uint64) error
+
+	// ClearTenantMaxLoad removes the max load override for the given tenant,
+	// restoring the configured max load.
+	ClearTenantMaxLoad(tenantKey string)
+
+	// SetDraining stops admitting new load for the given tenant until the given time,
+	// leaving the load already accumulated untouched.
+	// Submissions are rejected without penalties, with a RetryIn pointing past the drain.
+	// A zero time stops the draining.
+	//
+	// Draining is kept in memory and is not synchronized via SyncAdapter.
+	SetDraining(tenantKey string, until time.Time) error
+
+	// SetDrainingAll stops admitting new load for all the tenants until the given time,
+	// like SetDraining does for a single tenant. A zero time stops the draining.
+	SetDrainingAll(until time.Time) error
+
+	// AdvisedSegmentSize recommends a WindowSegmentSize based on the interval
+	// between the submissions observed so far, so that each segment
+	// holds a few requests on average. It does not change the configuration in use.
+	//
+	// Limiters without segments return zero.
+	AdvisedSegmentSize() time.Duration
+
+	// CloneEmpty returns a new limiter with the same configuration
+	// but without any tenant state, for instance to simulate
+	// different traffic scenarios against the same policy.
+	//
+	// The clone is never synchronized via SyncAdapter
+	// and does not call the OnAccept/OnReject/OnOverload hooks.
+	CloneEmpty() StandaloneLoadLimiter
+
+	// SubmitBatch asks for all the given loads to be accepted at once.
+	//
+	// The batch is accepted only if the combined load fits,
+	// otherwise the whole batch is rejected and RetryIn is computed for the total.
+	SubmitBatch(tenantKey string, loads []uint64) (SubmitResult, error)
+
+	// SubmitCost asks for the load computed by the configured CostFunc
+	// for the given request descriptor to be accepted.
+	//
+	// An error is returned if no CostFunc was configured.
+	SubmitCost(tenantKey string, meta interface{}) (SubmitResult, error)
+
+	// SubmitFloat asks for the given fractional load to be accepted,
+	// scaling it by the configured FloatLoadPrecision
+	// and rounding it up to the nearest load unit.
+	SubmitFloat(tenantKey string, load float64) (SubmitResult, error)
+
+	// ProbeFloat checks if the given fractional load would be allowed right now,
+	// scaling it like SubmitFloat does.
+	ProbeFloat(tenantKey string, load float64) (bool, error)
+
+	// Reserve asks for the estimated load to be accepted, like Submit does.
+	//
+	// If accepted, the returned reservation should later be settled
+	// with Commit, once the actual load is known, or with Cancel
+	// to refund all of the estimated load.
+	Reserve(tenantKey string, estimated uint64) (Reservation, error)
+
+	// Refund gives back the given load to the tenant,
+	// removing it from the window starting from the most recent segments.
+	//
+	// Only accepted load is refunded: the penalties are left in the window,
+	// so refunding more than the accepted load removes all of it
+	// but keeps the penalties.
+	Refund(tenantKey string, load uint64) error
+
+	// ProbeWithDetails checks if the given load would be allowed right now,
+	// returning the same details that a Submit would return,
+	// including RetryIn information when available.
+	//
+	// Unlike Submit, it is a readonly method that does not modify
+	// the current window data and never applies penalties.
+	ProbeWithDetails(tenantKey string, load uint64) (SubmitResult, error)
+
+	// ProbeReadOnly checks if the given load would be allowed right now
+	// like Probe does, but evaluates it against the window as it is, without rotating it.
+	//
+	// Unlike Probe, it never changes the tenant state,
+	// so it never causes a write to the SyncAdapter.
+	ProbeReadOnly(tenantKey string, load uint64) (bool, error)
+
+	// ProbeMany checks which of the given loads would be allowed right now,
+	// returning the results in the same order of the loads.
+	//
+	// All the loads are evaluated independently against the same instant,
+	// under a single lock. Like Probe, it does not modify the current window data.
+	ProbeMany(tenantKey string, loads []uint64) ([]bool, error)
+
+	// SubmitDryRun evaluates the given load exactly like Submit does,
+	// reporting the outcome together with the penalties that would be applied
+	// and the resulting window total.
+	//
+	// Like ProbeWithDetails, it does not modify the current window data.
+	SubmitDryRun(tenantKey string, load uint64) (DryRunResult, error)
+
+	// SubmitAt asks for the given load to be accepted like Submit does,
+	// evaluating it at the given time instead of the current one.
+	//
+	// It is an advanced API meant for replaying historical load
+	// for offline analysis or testing: the times should be submitted
+	// in chronological order, as a time older than the most recent segment
+	// is handled like a clock going backwards.
+	SubmitAt(tenantKey string, load uint64, at time.Time) (SubmitResult, error)
+
+	// TimeToAvailable returns how long the caller would have to wait
+	// before the given load gets accepted, without submitting anything.
+	// A zero duration is returned if the load would be accepted right now.
+	//
+	// An error is returned if the limiter was built with SkipRetryInComputing
+	// or if the load would never be accepted.
+	TimeToAvailable(tenantKey string, load uint64) (time.Duration, error)
+
+	// NextAvailableAt returns the earliest time at which the given load
+	// would be accepted, without submitting anything.
+	// The current time is returned if the load would be accepted right now.
+	//
+	// Unlike TimeToAvailable, the absolute time does not drift
+	// when the caller stores it and acts on it later.
+	NextAvailableAt(tenantKey string, load uint64) (time.Time, error)
+
+	// RemainingCapacity returns how much load the tenant could submit right now,
+	// that is MaxLoad minus the current load in the window, clamped at zero.
+	// it is a readonly method that does not modify the current window data.
+	RemainingCapacity(tenantKey string) (uint64, error)
+
+	// CanEverFit returns true if the given load could be accepted
+	// for the tenant at least when the window is empty,
+	// that is if it is not greater than the max load of the tenant.
+	// Loads for which it returns false are always permanently rejected.
+	CanEverFit(tenantKey string, load uint64) bool
+
+	// CurrentRate returns the average load rate of the tenant over the window,
+	// that is the load held by the window, penalties included,
+	// divided by the WindowSize in seconds.
+	// it is a readonly method that does not modify the current window data.
+	CurrentRate(tenantKey string) (float64, error)
+
+	// WindowBounds returns the time range covered by the current window of the tenant,
+	// from the start of its oldest segment to the end of the most recent one.
+	// it is a readonly method that does not modify the current window data.
+	WindowBounds(tenantKey string) (start time.Time, end time.Time, err error)
+
+	// ListTenants returns the keys of all the tenants
+	// currently holding some state in the limiter.
+	//
+	// The order of the keys is not guaranteed.
+	ListTenants() []string
+
+	// EvictTenant removes all the state held for the given tenant,
+	// returning true if some state existed.
+	//
+	// A subsequent request for the same tenant starts from a fresh state.
+	// Eviction only affects the local instance and does not touch the SyncAdapter store.
+	EvictTenant(tenantKey string) bool
+
+	// PrewarmTenants allocates the state for the given tenants in advance,
+	// so that their first requests don't pay for the allocation.
+	// Tenants already holding some state are not affected.
+	//
+	// Prewarmed tenants are considered accessed, so the warm-up period
+	// and the TenantIdleTTL start counting from the prewarming.
+	PrewarmTenants(tenantKeys ...string)
+
+	// Flush writes all the pending changes to the remote store
+	// when the limiter was built with AsyncWriteBack = true.
+	//
+	// It does nothing otherwise. Tenants that could not be written
+	// are kept pending and retried with the next write-back.
+	Flush() error
+
+	// SyncAll synchronizes all the tenants known to the local instance
+	// with the remote store, restoring the remote status
+	// and writing the local one where it is ahead.
+	//
+	// Adapters implementing BatchSyncAdapter are called once
+	// for all the tenants. It does nothing without a SyncAdapter.
+	SyncAll(ctx context.Context) error
+
+	// Ping checks that the SyncAdapter is reachable, without affecting any tenant,
+	// by locking and unlocking a reserved key.
+	// It is meant to be used in readiness probes.
+	//
+	// It returns nil when the limiter has no SyncAdapter.
+	Ping(ctx context.Context) error
+
+	// Close releases the resources held by the limiter,
+	// stopping any background routine.
+	//
+	// If the SyncAdapter implements io.Closer, it gets closed as well.
+	// Further calls to Probe and Submit will return goll.ErrLimiterClosed.
+	Close() error
+
+	// ResetTenant clears all the load accumulated by the given tenant,
+	// propagating the change through the SyncAdapter if any.
+	//
+	// It does nothing for a tenant that has no state yet.
+	ResetTenant(tenantKey string) error
+
+	// TruncateAfter removes from the window of the given tenant
+	// all the load allocated to segments starting at or after the cutoff time.
+	//
+	// It is meant as a repair tool for correcting a bad state:
+	// load held by segments starting before the cutoff is preserved.
+	TruncateAfter(tenantKey string, cutoff time.Time) error
 }
 
 // CompositeLoadLimiter is the specialized interface for the composite
@@ -133,6 +465,12 @@ type CompositeLoadLimiter interface {
 	// together with RetryIn information when available.
 	Submit(tenantKey string, load uint64) (SubmitResult, error)
 
+	// SubmitLabeled asks for the given load to be accepted
+	// by the composed limiters applying to at least one of the given labels,
+	// as well as by the composed limiters without labels.
+	// The other composed limiters are not affected.
+	SubmitLabeled(tenantKey string, labels []string, load uint64) (SubmitResult, error)
+
 	// SubmitUntil asks for the given load to be accepted and,
 	// in case of rejection, automatically handles retries and delays.
 	// In case of acceptance a nil value is returned.
@@ -160,6 +498,24 @@ type CompositeLoadLimiter interface {
 	// types if you need additional info.
 	SubmitUntilWithDetails(tenantKey string, load uint64, timeout time.Duration) SubmitUntilResult
 
+	// SubmitUntilCtx works like SubmitUntilWithDetails
+	// but stops waiting as soon as the given context is cancelled.
+	//
+	// In case of cancellation the Error field of the output object
+	// wraps the context error and can be checked with errors.Is
+	// against context.Canceled or context.DeadlineExceeded.
+	SubmitUntilCtx(ctx context.Context, tenantKey string, load uint64, timeout time.Duration) SubmitUntilResult
+
+	// SubmitUntilWithOptions works like SubmitUntilWithDetails
+	// but accepts additional options, like a maximum number of attempts
+	// to be made regardless of the timeout.
+	SubmitUntilWithOptions(tenantKey string, load uint64, options SubmitUntilOptions) SubmitUntilResult
+
+	// SubmitUntilWithBackoff works like SubmitUntilWithDetails
+	// but waits before each retry for the time computed by the given BackoffFunc.
+	// The timeout is still honored.
+	SubmitUntilWithBackoff(tenantKey string, load uint64, timeout time.Duration, backoff BackoffFunc) SubmitUntilResult
+
 	// IsComposite is "inherited" from LoadLimiter
 	// and always returns true for this type.
 	IsComposite() bool
@@ -172,6 +528,52 @@ type CompositeLoadLimiter interface {
 	// limiters will be returned.
 	Stats(tenantKey string) (CompositeRuntimeStatistics, error)
 
+	// StatsAll returns runtime statistics for all the tenants
+	// currently holding some state in any of the composed limiters, indexed by tenant key.
+	//
+	// Unlike calling Stats for each tenant, all the statistics
+	// are collected with a single lock acquisition.
+	// No synchronization via SyncAdapter is performed.
+	StatsAll() (map[string]CompositeRuntimeStatistics, error)
+
+	// IsOverloaded returns true if the tenant is currently in overload status
+	// for at least one of the composed limiters.
+	IsOverloaded(tenantKey string) (bool, error)
+
+	// ProbeReadOnly checks if the given load would be allowed right now
+	// like Probe does, but evaluates it against the windows as they are, without rotating them.
+	//
+	// Unlike Probe, it never changes the tenant state,
+	// so it never causes a write to the SyncAdapter.
+	ProbeReadOnly(tenantKey string, load uint64) (bool, error)
+
+	// RemainingCapacity returns how much load the tenant could submit right now,
+	// that is the minimum remaining capacity across the composed limiters.
+	// it is a readonly method that does not modify the current window data.
+	RemainingCapacity(tenantKey string) (uint64, error)
+
+	// CanEverFit returns true if the given load could be accepted
+	// for the tenant at least when the window is empty,
+	// that is if it is not greater than the max load of the tenant.
+	// Loads for which it returns false are always permanently rejected.
+	CanEverFit(tenantKey string, load uint64) bool
+
+	// CurrentRate returns the average load rate of the tenant
+	// over the window of each composed limiter, in the same order they were given.
+	// it is a readonly method that does not modify the current window data.
+	CurrentRate(tenantKey string) ([]float64, error)
+
+	// WindowBounds returns the time range covered by the current window of the tenant
+	// in the composed limiter with the narrowest window.
+	// it is a readonly method that does not modify the current window data.
+	WindowBounds(tenantKey string) (start time.Time, end time.Time, err error)
+
+	// NextAvailableAt returns the earliest time at which the given load
+	// would be accepted, without submitting anything,
+	// that is the latest of the times computed by the composed limiters.
+	// The current time is returned if the load would be accepted right now.
+	NextAvailableAt(tenantKey string, load uint64) (time.Time, error)
+
 	// ForTenant returns a semplified proxy that applies the load limiting
 	// for the specified tenant, dropping the tenantKey input parameter.
 	//
@@ -181,6 +583,12 @@ type CompositeLoadLimiter interface {
 	// it just proxies the calls to the current limiter adding a fixed tenantKey.
 	ForTenant(tenantKey string) SingleTenantCompositeLoadLimiter
 
+	// ForTenantSafe works like ForTenant but returns an error
+	// instead of panicking when the tenantKey is blank or reserved.
+	//
+	// Use it when the tenantKey comes from user input.
+	ForTenantSafe(tenantKey string) (SingleTenantCompositeLoadLimiter, error)
+
 	// ForTenant returns a semplified proxy drops the tenantKey input parameter.
 	//
 	// It's useful to simplify the code when you don't need multitenancy.
@@ -188,6 +596,77 @@ type CompositeLoadLimiter interface {
 	// Please note that this does not create a new limiter instance,
 	// it just proxies the calls to the current limiter adding a fixed tenantKey.
 	AsSingleTenant() SingleTenantCompositeLoadLimiter
+
+	// DumpState returns a human-readable report of the whole limiter state,
+	// meant to be attached to bug reports.
+	//
+	// Only the state held by the local instance is included.
+	DumpState() string
+
+	// Snapshot returns the serialized status of every tenant
+	// held by the local instance, indexed by tenant key.
+	Snapshot() (map[string]string, error)
+
+	// Restore rebuilds the state of the tenants from a map obtained via Snapshot.
+	// Entries that can't be parsed are logged and skipped.
+	Restore(snapshot map[string]string) error
+
+	// EffectiveConfig returns a read-only snapshot of the configuration
+	// in use by each composed limiter, in the same order they were given.
+	EffectiveConfig() []EffectiveConfig
+
+	// ListTenants returns the keys of all the tenants
+	// currently holding some state in any of the composed limiters.
+	//
+	// The order of the keys is not guaranteed.
+	ListTenants() []string
+
+	// EvictTenant removes all the state held for the given tenant
+	// from all the composed limiters, returning true if some state existed.
+	//
+	// A subsequent request for the same tenant starts from a fresh state.
+	// Eviction only affects the local instance and does not touch the SyncAdapter store.
+	EvictTenant(tenantKey string) bool
+
+	// PrewarmTenants allocates the state for the given tenants
+	// in all the composed limiters in advance,
+	// so that their first requests don't pay for the allocation.
+	// Tenants already holding some state are not affected.
+	PrewarmTenants(tenantKeys ...string)
+
+	// SyncAll synchronizes all the tenants known to the local instance
+	// with the remote store, restoring the remote status
+	// and writing the local one where the remote store has none.
+	//
+	// Adapters implementing BatchSyncAdapter are called once
+	// for all the tenants. It does nothing without a SyncAdapter.
+	SyncAll(ctx context.Context) error
+
+	// Ping checks that the SyncAdapter is reachable, without affecting any tenant,
+	// by locking and unlocking a reserved key.
+	// It is meant to be used in readiness probes.
+	//
+	// It returns nil when the limiter has no SyncAdapter.
+	Ping(ctx context.Context) error
+
+	// Close releases the resources held by the limiter
+	// and by all the composed limiters, stopping any background routine.
+	//
+	// If the SyncAdapter implements io.Closer, it gets closed as well.
+	// Further calls to Probe and Submit will return goll.ErrLimiterClosed.
+	Close() error
+
+	// ResetTenant clears all the load accumulated by the given tenant
+	// in all the composed limiters,
+	// propagating the change through the SyncAdapter if any.
+	//
+	// It does nothing for a tenant that has no state yet.
+	ResetTenant(tenantKey string) error
+
+	// TruncateAfter removes from the windows of all the composed limiters
+	// all the load allocated to segments starting at or after the cutoff time
+	// for the given tenant.
+	TruncateAfter(tenantKey string, cutoff time.Time) error
 }
 
 // SingleTenantLoadLimiter is the specialized interface
@@ -231,6 +710,24 @@ type SingleTenantLoadLimiter interface {
 	// types if you need additional info.
 	SubmitUntilWithDetails(load uint64, timeout time.Duration) SubmitUntilResult
 
+	// SubmitUntilCtx works like SubmitUntilWithDetails
+	// but stops waiting as soon as the given context is cancelled.
+	//
+	// In case of cancellation the Error field of the output object
+	// wraps the context error and can be checked with errors.Is
+	// against context.Canceled or context.DeadlineExceeded.
+	SubmitUntilCtx(ctx context.Context, load uint64, timeout time.Duration) SubmitUntilResult
+
+	// SubmitUntilWithOptions works like SubmitUntilWithDetails
+	// but accepts additional options, like a maximum number of attempts
+	// to be made regardless of the timeout.
+	SubmitUntilWithOptions(load uint64, options SubmitUntilOptions) SubmitUntilResult
+
+	// SubmitUntilWithBackoff works like SubmitUntilWithDetails
+	// but waits before each retry for the time computed by the given BackoffFunc.
+	// The timeout is still honored.
+	SubmitUntilWithBackoff(load uint64, timeout time.Duration, backoff BackoffFunc) SubmitUntilResult
+
 	// IsComposite returns true if the limiter is a CompositeLoadLimiter.
 	IsComposite() bool
 }
@@ -276,6 +773,24 @@ type SingleTenantStandaloneLoadLimiter interface {
 	// types if you need additional info.
 	SubmitUntilWithDetails(load uint64, timeout time.Duration) SubmitUntilResult
 
+	// SubmitUntilCtx works like SubmitUntilWithDetails
+	// but stops waiting as soon as the given context is cancelled.
+	//
+	// In case of cancellation the Error field of the output object
+	// wraps the context error and can be checked with errors.Is
+	// against context.Canceled or context.DeadlineExceeded.
+	SubmitUntilCtx(ctx context.Context, load uint64, timeout time.Duration) SubmitUntilResult
+
+	// SubmitUntilWithOptions works like SubmitUntilWithDetails
+	// but accepts additional options, like a maximum number of attempts
+	// to be made regardless of the timeout.
+	SubmitUntilWithOptions(load uint64, options SubmitUntilOptions) SubmitUntilResult
+
+	// SubmitUntilWithBackoff works like SubmitUntilWithDetails
+	// but waits before each retry for the time computed by the given BackoffFunc.
+	// The timeout is still honored.
+	SubmitUntilWithBackoff(load uint64, timeout time.Duration, backoff BackoffFunc) SubmitUntilResult
+
 	// Stats returns runtime statistics useful to evaluate system status,
 	// performance and overhead.
 	Stats() (RuntimeStatistics, error)
@@ -325,6 +840,24 @@ type SingleTenantCompositeLoadLimiter interface {
 	// types if you need additional info.
 	SubmitUntilWithDetails(load uint64, timeout time.Duration) SubmitUntilResult
 
+	// SubmitUntilCtx works like SubmitUntilWithDetails
+	// but stops waiting as soon as the given context is cancelled.
+	//
+	// In case of cancellation the Error field of the output object
+	// wraps the context error and can be checked with errors.Is
+	// against context.Canceled or context.DeadlineExceeded.
+	SubmitUntilCtx(ctx context.Context, load uint64, timeout time.Duration) SubmitUntilResult
+
+	// SubmitUntilWithOptions works like SubmitUntilWithDetails
+	// but accepts additional options, like a maximum number of attempts
+	// to be made regardless of the timeout.
+	SubmitUntilWithOptions(load uint64, options SubmitUntilOptions) SubmitUntilResult
+
+	// SubmitUntilWithBackoff works like SubmitUntilWithDetails
+	// but waits before each retry for the time computed by the given BackoffFunc.
+	// The timeout is still honored.
+	SubmitUntilWithBackoff(load uint64, timeout time.Duration, backoff BackoffFunc) SubmitUntilResult
+
 	// Stats returns runtime statistics useful to evaluate system status,
 	// performance and overhead.
 	//
@@ -340,12 +873,133 @@ type SingleTenantCompositeLoadLimiter interface {
 // RuntimeStatistics holds runtime statistics
 // for a single load limiter.
 type RuntimeStatistics struct {
+	// Name holds the name of the limiter.
+	// Composed limiters are always named, either explicitly or by their position.
+	Name string
+
 	// WindowTotal holds the current active load in absolute units.
 	WindowTotal uint64
 
 	// WindowSegments is a slice holding the amount of absolute load
 	// allocated to each segment of the window.
 	WindowSegments []uint64
+
+	// WindowPenaltyTotal holds the portion of WindowTotal
+	// that was added as penalty.
+	WindowPenaltyTotal uint64
+
+	// WindowSegmentPenalties holds the portion of each value
+	// in WindowSegments that was added as penalty.
+	WindowSegmentPenalties []uint64
+
+	// WindowSegmentTimes holds the start time of each segment
+	// in WindowSegments, in milliseconds since the Unix epoch.
+	WindowSegmentTimes []uint64
+
+	// MaxLoad holds the max load currently allowed,
+	// including any active temporary boost.
+	MaxLoad uint64
+
+	// MaxPenaltyCap holds the highest load the window can reach
+	// because of penalties, scaled from MaxLoad.
+	// It is zero for limiters that do not apply penalties.
+	MaxPenaltyCap uint64
+
+	// UtilizationPercent is the ratio between WindowTotal and MaxLoad,
+	// expressed as a percentage. It can exceed 100 when penalties are applied.
+	UtilizationPercent float64
+
+	// AcceptedCount and RejectedCount hold the number of submissions
+	// accepted and rejected over the lifetime of the tenant.
+	AcceptedCount uint64
+	RejectedCount uint64
+}
+
+// Utilization returns the ratio between WindowTotal and MaxLoad,
+// where 1.0 means that the window is full.
+//
+// The returned value can exceed 1.0 when penalties are applied,
+// but it is clamped to the ratio between MaxPenaltyCap and MaxLoad
+// so that a window holding more load than currently allowed,
+// for instance after lowering the MaxLoad, never reports an unreasonable value.
+func (s RuntimeStatistics) Utilization() float64 {
+	if s.MaxLoad == 0 {
+		return 0
+	}
+	out := float64(s.WindowTotal) / float64(s.MaxLoad)
+	if s.MaxPenaltyCap > 0 {
+		if upperBound := float64(s.MaxPenaltyCap) / float64(s.MaxLoad); out > upperBound {
+			return upperBound
+		}
+	}
+	return out
+}
+
+// EffectiveConfig holds the configuration in use by a load limiter,
+// after defaults were applied and derived values were computed.
+//
+// Fields that do not apply to the limiter algorithm are left zero.
+type EffectiveConfig struct {
+	Name string
+
+	// MaxLoad holds the max load currently allowed,
+	// reflecting any change made with SetMaxLoad.
+	MaxLoad                  uint64
+	LoadQuantum              uint64
+	FloatLoadPrecision       uint64
+	AcceptanceSpreadSegments uint64
+
+	// WindowSize and WindowSegmentSize hold the window composition,
+	// including the automatically picked segment size when it was not provided.
+	WindowSize        time.Duration
+	WindowSegmentSize time.Duration
+	NumSegments       uint64
+
+	// WindowQueueInitialCapacity holds the number of segments
+	// the window queues are allocated for, before rounding.
+	WindowQueueInitialCapacity uint64
+
+	Algorithm       Algorithm
+	AggregationMode AggregationMode
+
+	SkipRetryInComputing bool
+	MaxRetryIn           time.Duration
+	RetryInJitterFactor  float64
+	RetryInGranularity   time.Duration
+
+	// OverstepPenaltyFactor is zero when no overstep penalty is applied.
+	OverstepPenaltyFactor      float64
+	AbsoluteOverstepPenalty    uint64
+	OverstepPenaltySegmentSpan uint64
+
+	// RequestOverheadPenaltyFactor is zero when no request overhead penalty is applied.
+	RequestOverheadPenaltyFactor      float64
+	RequestOverheadPenaltySegmentSpan uint64
+
+	MaxPenaltyCapFactor   float64
+	AbsoluteMaxPenaltyCap uint64
+	PenaltyCapPolicy      PenaltyCapPolicy
+	PenaltyDecayFactor    float64
+
+	PenaltyDistributionStrategy PenaltyDistributionStrategy
+
+	WarmupDuration time.Duration
+	WarmupRequests uint64
+
+	GracePeriodAfterRecovery time.Duration
+
+	TenantIdleTTL     time.Duration
+	AsyncWriteBack    bool
+	WriteBackInterval time.Duration
+
+	SyncLockTimeout       time.Duration
+	SyncLockRetryInterval time.Duration
+
+	// Global is only set for composed limiters shared by all the tenants.
+	Global bool
+
+	// Labels is only set for composed limiters restricted to some labels.
+	Labels []string
 }
 
 // RuntimeStatistics holds runtime statistics
@@ -354,4 +1008,21 @@ type CompositeRuntimeStatistics struct {
 
 	// LimitersStats holds the statistics for each composed limiter
 	LimitersStats []RuntimeStatistics
+
+	// BottleneckCounts holds, for each composed limiter,
+	// the number of loads it rejected while at least one of the other
+	// composed limiters would have accepted them, that is how often it was the bottleneck.
+	//
+	// Counters are held locally by each instance and are not synchronized.
+	BottleneckCounts []uint64
+
+	// WindowLoadTotal and WindowPenaltyTotal hold the sum,
+	// across all the composed limiters, of the active load
+	// that was accepted and of the one that was added as penalty.
+	WindowLoadTotal    uint64
+	WindowPenaltyTotal uint64
+
+	// BindingLimiter holds the index of the most constrained composed limiter,
+	// that is the one with the highest utilization.
+	BindingLimiter int
 }
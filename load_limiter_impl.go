@@ -1,6 +1,10 @@
 package goll
 
 import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
 	"sync"
 	"time"
 
@@ -17,16 +21,80 @@ type loadLimiterDefaultImpl struct {
 	TimeFunc  func() time.Time
 	SleepFunc func(d time.Duration)
 
+	// CostFunc computes the load of a request descriptor for SubmitCost.
+	CostFunc func(meta interface{}) uint64
+
+	// Hooks are notified of every accepted or rejected load.
+	Hooks submitHooks
+
 	// a lock provides thread safety.
-	Lock sync.Mutex
+	// It is taken in write mode by the operations involving the whole limiter,
+	// while operations on a single tenant take it in read mode
+	// together with the tenant lock. See tenant_locks.go.
+	Lock sync.RWMutex
+
+	// tenantLocks serialize the operations on the tenants,
+	// that are spread across the shards by key.
+	tenantLocks [numTenantLockShards]sync.RWMutex
+
+	// tenantsLock guards the TenantData and pendingWriteBacks maps.
+	tenantsLock sync.Mutex
 
 	// SyncAdapter is an implementation used to synchronize
 	// the limiter data in a clustered environment.
 	SyncAdapter SyncAdapter
 
+	// SyncAdapterSelector optionally picks the SyncAdapter for each tenant.
+	SyncAdapterSelector func(tenantKey string) SyncAdapter
+
+	// StrictSync makes synchronization errors blocking.
+	StrictSync bool
+
+	// OnSyncMetrics optionally receives the timings of every synchronization.
+	OnSyncMetrics func(tenantKey string, lockWait time.Duration, fetch time.Duration, write time.Duration)
+
+	// SyncHealthCheckKey is the key used by Ping.
+	SyncHealthCheckKey string
+
+	// VerifyWrites makes every write to the remote store verified with a fetch.
+	VerifyWrites bool
+
+	// TenantKeyValidator optionally checks the tenant keys of the load requests.
+	TenantKeyValidator func(tenantKey string) error
+
+	// ParentKeyFunc optionally derives the parent tenant
+	// charged along with each submission.
+	ParentKeyFunc func(tenantKey string) (string, bool)
+
+	// OnPenaltyCapped is optionally notified of the load
+	// trimmed to keep the window within the max penalty cap.
+	OnPenaltyCapped func(tenantKey string, trimmed uint64)
+
 	// we keep all runtime data for tenants
 	// in a map indexed by tenant key
 	TenantData map[string]*loadLimiterDefaultImplTenantData
+
+	// drainUntil is the end of the draining of all the tenants,
+	// 0 if not draining.
+	drainUntil uint64
+
+	// closing this channel stops the idle tenants sweeper, if running.
+	stopSweeper chan struct{}
+
+	// pendingWriteBacks holds the keys of the tenants
+	// with changes not yet written to the remote store.
+	pendingWriteBacks map[string]struct{}
+
+	// closing this channel stops the write-back flusher, if running.
+	stopFlusher chan struct{}
+
+	// jitterRand is the random source for the RetryIn jitter,
+	// guarded by jitterLock.
+	jitterRand *rand.Rand
+	jitterLock sync.Mutex
+
+	// closed is set when the limiter gets closed.
+	closed bool
 }
 
 type loadLimiterDefaultImplTenantData struct {
@@ -42,24 +110,94 @@ type loadLimiterDefaultImplTenantData struct {
 
 	// Versioning data for persistence and synchronization
 	Version uint64
+
+	// LastAccess is the time of the last request for the tenant
+	LastAccess uint64
+
+	// CreatedAt is the time the tenant was created on the local instance.
+	// It is held locally and is not synchronized.
+	CreatedAt uint64
+
+	// RecoveredAt is the time the tenant last recovered from overload,
+	// 0 if it never did. It is held locally and is not synchronized.
+	RecoveredAt uint64
+
+	// DrainUntil is the end of the draining of the tenant, 0 if not draining.
+	// It is held locally and is not synchronized.
+	DrainUntil uint64
+
+	// MaxLoadOverride replaces the configured max load
+	// for the tenant, 0 if not set.
+	MaxLoadOverride uint64
+
+	// Boosts holds the temporary increments of the max load
+	// granted to the tenant.
+	Boosts []tenantBoost
+
+	// AcceptedCount and RejectedCount hold the number of
+	// submissions accepted and rejected over the lifetime of the tenant.
+	AcceptedCount uint64
+	RejectedCount uint64
+
+	// BottleneckCount holds, for a composed limiter, the number of loads
+	// it rejected while at least one of the other composed limiters accepted them.
+	// It is held locally and is not synchronized.
+	BottleneckCount uint64
+
+	// LastSubmittedAt, IntervalsSum and IntervalsCount track the interval
+	// between submissions, used to compute the AdvisedSegmentSize.
+	// They are held locally and are not synchronized.
+	LastSubmittedAt uint64
+	IntervalsSum    uint64
+	IntervalsCount  uint64
+}
+
+// tenantBoost represents extra load temporarily granted to a tenant.
+type tenantBoost struct {
+	ExtraLoad uint64
+	Until     uint64
 }
 
 // loadLimiterEffectiveConfig holds the validated and parsed configuration
 // that was obtained from the user-provided configuration.
 type loadLimiterEffectiveConfig struct {
+	// optional label
+	Name string
+
 	// max absolute load
 	MaxLoad uint64
 
+	// load granularity, 0 if not required
+	LoadQuantum uint64
+
+	// segments spanned by the accepted load, 0 if not required
+	AcceptanceSpreadSegments uint64
+
+	// load units per 1.0 of fractional load
+	FloatLoadPrecision uint64
+
 	// window composition
 	WindowSize        uint64
 	WindowSegmentSize uint64
 	NumSegments       uint64
 
+	// segments the window queues are allocated for
+	WindowQueueInitialCapacity uint64
+
 	// features control
 	SkipRetryInComputing bool
+	LogRejections        bool
+	MaxRetryIn           time.Duration
+	RetryInJitterFactor  float64
+	RetryInGranularity   time.Duration
+	AggregationMode      AggregationMode
+	Algorithm            Algorithm
+	SerializationFormat  SerializationFormat
+	OnStaleRemote        StaleRemotePolicy
 
 	// overstep penalty
 	ApplyOverstepPenalty       bool
+	OverstepPenaltyFactor      float64
 	AbsoluteOverstepPenalty    uint64
 	OverstepPenaltySegmentSpan uint64
 
@@ -70,25 +208,192 @@ type loadLimiterEffectiveConfig struct {
 
 	// penalty capping
 	ApplyPenaltyCapping   bool
+	MaxPenaltyCapFactor   float64
 	AbsoluteMaxPenaltyCap uint64
+	PenaltyCapPolicy      PenaltyCapPolicy
+
+	// penalty decay, 0 if not required
+	PenaltyDecayFactor float64
+
+	PenaltyDistributionStrategy PenaltyDistributionStrategy
+
+	// penalty-free warm-up of new tenants, 0 if not required
+	WarmupDuration uint64
+	WarmupRequests uint64
+
+	// penalty-free grace after recovering from overload, 0 if not required
+	GracePeriodAfterRecovery uint64
+
+	// idle tenants removal, 0 if not required
+	TenantIdleTTL       uint64
+	TenantSweepInterval time.Duration
+
+	// deferred synchronization
+	AsyncWriteBack    bool
+	WriteBackInterval time.Duration
+
+	// lock acquisition retries, 0 if not required
+	SyncLockTimeout       time.Duration
+	SyncLockRetryInterval time.Duration
+}
+
+// toEffectiveConfig converts the parsed configuration
+// to the exported read-only representation.
+func (c *loadLimiterEffectiveConfig) toEffectiveConfig() EffectiveConfig {
+	return EffectiveConfig{
+		Name:                              c.Name,
+		MaxLoad:                           c.MaxLoad,
+		LoadQuantum:                       c.LoadQuantum,
+		AcceptanceSpreadSegments:          c.AcceptanceSpreadSegments,
+		FloatLoadPrecision:                c.FloatLoadPrecision,
+		WindowSize:                        time.Duration(c.WindowSize) * time.Millisecond,
+		WindowSegmentSize:                 time.Duration(c.WindowSegmentSize) * time.Millisecond,
+		NumSegments:                       c.NumSegments,
+		WindowQueueInitialCapacity:        c.WindowQueueInitialCapacity,
+		Algorithm:                         c.Algorithm,
+		AggregationMode:                   c.AggregationMode,
+		SkipRetryInComputing:              c.SkipRetryInComputing,
+		MaxRetryIn:                        c.MaxRetryIn,
+		RetryInJitterFactor:               c.RetryInJitterFactor,
+		RetryInGranularity:                c.RetryInGranularity,
+		OverstepPenaltyFactor:             c.OverstepPenaltyFactor,
+		AbsoluteOverstepPenalty:           c.AbsoluteOverstepPenalty,
+		OverstepPenaltySegmentSpan:        c.OverstepPenaltySegmentSpan,
+		RequestOverheadPenaltyFactor:      c.RequestOverheadPenaltyFactor,
+		RequestOverheadPenaltySegmentSpan: c.RequestOverheadPenaltySegmentSpan,
+		MaxPenaltyCapFactor:               c.MaxPenaltyCapFactor,
+		AbsoluteMaxPenaltyCap:             c.AbsoluteMaxPenaltyCap,
+		PenaltyCapPolicy:                  c.PenaltyCapPolicy,
+		PenaltyDecayFactor:                c.PenaltyDecayFactor,
+		PenaltyDistributionStrategy:       c.PenaltyDistributionStrategy,
+		WarmupDuration:                    time.Duration(c.WarmupDuration) * time.Millisecond,
+		WarmupRequests:                    c.WarmupRequests,
+		GracePeriodAfterRecovery:          time.Duration(c.GracePeriodAfterRecovery) * time.Millisecond,
+		TenantIdleTTL:                     time.Duration(c.TenantIdleTTL) * time.Millisecond,
+		AsyncWriteBack:                    c.AsyncWriteBack,
+		WriteBackInterval:                 c.WriteBackInterval,
+		SyncLockTimeout:                   c.SyncLockTimeout,
+		SyncLockRetryInterval:             c.SyncLockRetryInterval,
+	}
+}
+
+// EffectiveConfig returns a read-only snapshot of the configuration in use.
+func (instance *loadLimiterDefaultImpl) EffectiveConfig() EffectiveConfig {
+	instance.Lock.RLock()
+	defer instance.Lock.RUnlock()
+
+	return instance.Config.toEffectiveConfig()
 }
 
 // windowSegment represents a single segment the activeWindow is divided in
+//
+// The accepted load and the penalty load are held separately,
+// the load of the segment being the sum of the two.
 type windowSegment struct {
-	StartTime uint64
-	Value     uint64
+	StartTime    uint64
+	Value        uint64
+	PenaltyValue uint64
+}
+
+// total returns the whole load held by the segment.
+func (s *windowSegment) total() uint64 {
+	return saturatingAdd(s.Value, s.PenaltyValue)
+}
+
+// saturatingAdd returns the sum of the given values,
+// clamped at math.MaxUint64 instead of wrapping around.
+//
+// Loads come from untrusted input, so every addition to the window
+// is saturating: an overflowing load is then simply rejected.
+func saturatingAdd(a uint64, b uint64) uint64 {
+	if a > math.MaxUint64-b {
+		return math.MaxUint64
+	}
+	return a + b
+}
+
+// saturatingMul returns the product of the given values,
+// clamped at math.MaxUint64 instead of wrapping around.
+func saturatingMul(a uint64, b uint64) uint64 {
+	if a != 0 && b > math.MaxUint64/a {
+		return math.MaxUint64
+	}
+	return a * b
+}
+
+// saturatingFloatToUint converts the given non-negative value to uint64,
+// clamped at math.MaxUint64 since out of range conversions are implementation-specific.
+func saturatingFloatToUint(v float64) uint64 {
+	if v >= math.MaxUint64 {
+		return math.MaxUint64
+	}
+	return uint64(v)
+}
+
+// remove subtracts up to the given amount of load from the segment,
+// starting from the penalty load when penaltyFirst is set
+// or from the accepted load otherwise.
+// The amount actually removed is returned.
+func (s *windowSegment) remove(amount uint64, penaltyFirst bool) uint64 {
+	first, second := &s.Value, &s.PenaltyValue
+	if penaltyFirst {
+		first, second = second, first
+	}
+
+	removed := uint64(0)
+	for _, v := range []*uint64{first, second} {
+		if amount == 0 {
+			break
+		}
+		taken := amount
+		if *v < taken {
+			taken = *v
+		}
+		*v -= taken
+		amount -= taken
+		removed += taken
+	}
+
+	return removed
+}
+
+// removeAccepted subtracts up to the given amount of load from the accepted load
+// of the segment, leaving the penalty load untouched.
+// The amount actually removed is returned.
+func (s *windowSegment) removeAccepted(amount uint64) uint64 {
+	if s.Value < amount {
+		amount = s.Value
+	}
+	s.Value -= amount
+	return amount
 }
 
 func (instance *loadLimiterDefaultImpl) getTenant(key string) *loadLimiterDefaultImplTenantData {
+	instance.tenantsLock.Lock()
+	defer instance.tenantsLock.Unlock()
+
 	existing, exists := instance.TenantData[key]
 	if exists {
 		return existing
 	}
 
+	newTenantData := instance.newTenantData()
+
+	instance.TenantData[key] = newTenantData
+	return newTenantData
+}
+
+// newTenantData builds the empty state of a tenant
+// without registering it in the limiter.
+func (instance *loadLimiterDefaultImpl) newTenantData() *loadLimiterDefaultImplTenantData {
+	now := uint64(instance.currentTime().UnixMilli())
+
 	newTenantData := &loadLimiterDefaultImplTenantData{
 		WindowTotal: 0,
 		WasOver:     false,
 		Version:     1,
+		LastAccess:  now,
+		CreatedAt:   now,
 	}
 
 	// call setMinCapacity on queue
@@ -96,12 +401,39 @@ func (instance *loadLimiterDefaultImpl) getTenant(key string) *loadLimiterDefaul
 	windowQueue := instance.newWindowQueue()
 	newTenantData.WindowQueue = windowQueue
 
-	instance.TenantData[key] = newTenantData
 	return newTenantData
 }
 
+// lookupTenantOrEmpty returns the state of the given tenant if it exists,
+// or an empty one that is not registered in the limiter,
+// so that read-only operations never create state for unknown tenants.
+func (instance *loadLimiterDefaultImpl) lookupTenantOrEmpty(key string) *loadLimiterDefaultImplTenantData {
+	if existing, exists := instance.lookupTenant(key); exists {
+		return existing
+	}
+	return instance.newTenantData()
+}
+
+// detachedTenantCopy returns a deep copy of the given tenant data
+// that can be modified without affecting the limiter state.
+func (instance *loadLimiterDefaultImpl) detachedTenantCopy(tenant *loadLimiterDefaultImplTenantData) *loadLimiterDefaultImplTenantData {
+	out := *tenant
+
+	out.WindowQueue = instance.newWindowQueue()
+	for i := 0; i < tenant.WindowQueue.Len(); i++ {
+		segment := *tenant.WindowQueue.At(i).(*windowSegment)
+		out.WindowQueue.PushBack(&segment)
+	}
+
+	if tenant.Boosts != nil {
+		out.Boosts = append([]tenantBoost(nil), tenant.Boosts...)
+	}
+
+	return &out
+}
+
 func (instance *loadLimiterDefaultImpl) newWindowQueue() *deque.Deque {
-	minQueueCapacity := int(instance.Config.NumSegments) * 3
+	minQueueCapacity := int(instance.Config.WindowQueueInitialCapacity)
 	return deque.New(minQueueCapacity, minQueueCapacity)
 }
 
@@ -112,9 +444,19 @@ func (instance *loadLimiterDefaultImpl) currentTime() time.Time {
 
 func (instance *loadLimiterDefaultImpl) sleep(d time.Duration) {
 	// hook time provider here to allow easier testing
+	if instance.SleepFunc == nil {
+		time.Sleep(d)
+		return
+	}
 	instance.SleepFunc(d)
 }
 
+// sleepCtx works like sleep but returns early
+// with the context error if the context gets cancelled while waiting.
+func (instance *loadLimiterDefaultImpl) sleepCtx(ctx context.Context, d time.Duration) error {
+	return sleepWithContext(ctx, d, instance.SleepFunc)
+}
+
 // for future usage (persistence)
 func (instance *loadLimiterDefaultImpl) markDirty(req *submitRequest) {
 	req.TenantData.Version++
@@ -127,8 +469,15 @@ func (instance *loadLimiterDefaultImpl) IsComposite() bool {
 // Stats returns runtime statistics useful to evaluate system status,
 // performance and overhead.
 func (instance *loadLimiterDefaultImpl) Stats(tenantKey string) (RuntimeStatistics, error) {
-	instance.Lock.Lock()
-	defer instance.Lock.Unlock()
+	if err := instance.validateTenantKey(tenantKey); err != nil {
+		return RuntimeStatistics{}, err
+	}
+
+	if out, ok := instance.statsShared(tenantKey); ok {
+		return out, nil
+	}
+
+	defer instance.lockTenant(tenantKey)()
 
 	var out RuntimeStatistics
 	var outErr error
@@ -146,6 +495,230 @@ func (instance *loadLimiterDefaultImpl) Stats(tenantKey string) (RuntimeStatisti
 	return out, outErr
 }
 
+// IsOverloaded returns true if the tenant is currently in overload status,
+// that is when its most recent request was rejected.
+func (instance *loadLimiterDefaultImpl) IsOverloaded(tenantKey string) (bool, error) {
+	if err := instance.validateTenantKey(tenantKey); err != nil {
+		return false, err
+	}
+
+	defer instance.lockTenant(tenantKey)()
+
+	var out bool
+
+	err := instance.withSyncTransaction(func() {
+		out = instance.getTenant(tenantKey).WasOver
+	}, syncTxOptions{
+		TenantKey: tenantKey,
+		ReadOnly:  true,
+	})
+
+	return out, err
+}
+
+// statsShared collects the statistics holding only the read lock.
+// It returns ok = false when the exclusive lock is required,
+// that is when the tenant is synchronized or does not exist yet.
+func (instance *loadLimiterDefaultImpl) statsShared(tenantKey string) (out RuntimeStatistics, ok bool) {
+	if instance.syncAdapterFor(tenantKey) != nil {
+		return out, false
+	}
+
+	defer instance.rlockTenant(tenantKey)()
+
+	if _, exists := instance.lookupTenant(tenantKey); !exists {
+		return out, false
+	}
+
+	out, err := instance.stats(tenantKey)
+	return out, err == nil
+}
+
+// ListTenants returns the keys of all the tenants
+// currently holding some state in the limiter.
+func (instance *loadLimiterDefaultImpl) ListTenants() []string {
+	instance.Lock.RLock()
+	defer instance.Lock.RUnlock()
+
+	instance.tenantsLock.Lock()
+	defer instance.tenantsLock.Unlock()
+
+	return instance.listTenants()
+}
+
+func (instance *loadLimiterDefaultImpl) listTenants() []string {
+	out := make([]string, 0, len(instance.TenantData))
+	for tenantKey := range instance.TenantData {
+		out = append(out, tenantKey)
+	}
+	return out
+}
+
+// EvictTenant removes all the state held for the given tenant,
+// returning true if some state existed.
+//
+// A subsequent request for the same tenant starts from a fresh state.
+func (instance *loadLimiterDefaultImpl) EvictTenant(tenantKey string) bool {
+	if instance.validateTenantKey(tenantKey) != nil {
+		return false
+	}
+
+	defer instance.lockTenant(tenantKey)()
+
+	return instance.evictTenant(tenantKey)
+}
+
+// PrewarmTenants allocates the state for the given tenants in advance,
+// so that their first requests don't pay for the allocation.
+// Tenants already holding some state are not affected
+// and invalid tenant keys are logged and skipped.
+func (instance *loadLimiterDefaultImpl) PrewarmTenants(tenantKeys ...string) {
+	for _, tenantKey := range tenantKeys {
+		instance.prewarmTenant(tenantKey)
+	}
+}
+
+func (instance *loadLimiterDefaultImpl) prewarmTenant(tenantKey string) {
+	if err := instance.validateTenantKey(tenantKey); err != nil {
+		logWarnw(instance.Logger, "skipping invalid tenant key on prewarm",
+			"tenantKey", tenantKey,
+			"error", err,
+		)
+		return
+	}
+
+	defer instance.lockTenant(tenantKey)()
+
+	instance.getTenant(tenantKey)
+}
+
+func (instance *loadLimiterDefaultImpl) evictTenant(tenantKey string) bool {
+	tenant, exists := instance.lookupTenant(tenantKey)
+	if !exists {
+		return false
+	}
+
+	// drop the queue reference to speed up garbage collection
+	tenant.WindowQueue = nil
+
+	instance.tenantsLock.Lock()
+	delete(instance.TenantData, tenantKey)
+	instance.tenantsLock.Unlock()
+
+	return true
+}
+
+// Close releases the resources held by the limiter,
+// stopping any background routine.
+//
+// Pending changes are written to the remote store before closing
+// when the limiter was built with AsyncWriteBack = true.
+//
+// If the SyncAdapter implements io.Closer, it gets closed as well.
+// Further calls to Probe and Submit will return ErrLimiterClosed.
+func (instance *loadLimiterDefaultImpl) Close() error {
+	instance.Lock.Lock()
+	defer instance.Lock.Unlock()
+
+	if instance.closed {
+		return nil
+	}
+	instance.closed = true
+
+	if instance.stopSweeper != nil {
+		close(instance.stopSweeper)
+		instance.stopSweeper = nil
+	}
+
+	if instance.stopFlusher != nil {
+		close(instance.stopFlusher)
+		instance.stopFlusher = nil
+	}
+
+	// changes not yet written to the remote store are not lost on shutdown
+	if err := instance.flushWriteBacks(); err != nil {
+		instance.Logger.Error(fmt.Sprintf("could not flush pending changes on close: %v", err))
+	}
+
+	return closeSyncAdapter(instance.SyncAdapter)
+}
+
+// ResetTenant clears all the load accumulated by the given tenant.
+//
+// It does nothing for a tenant that has no state yet.
+func (instance *loadLimiterDefaultImpl) ResetTenant(tenantKey string) error {
+	defer instance.lockTenant(tenantKey)()
+
+	if err := instance.validateTenantKey(tenantKey); err != nil {
+		return err
+	}
+
+	if _, exists := instance.lookupTenant(tenantKey); !exists && instance.syncAdapterFor(tenantKey) == nil {
+		return nil
+	}
+
+	return instance.withSyncTransaction(func() {
+		instance.resetTenant(instance.getTenant(tenantKey))
+	}, syncTxOptions{
+		TenantKey: tenantKey,
+		ReadOnly:  false,
+	})
+}
+
+func (instance *loadLimiterDefaultImpl) resetTenant(tenant *loadLimiterDefaultImplTenantData) {
+	tenant.WindowQueue.Clear()
+	tenant.WindowTotal = 0
+	tenant.WasOver = false
+	tenant.Version++
+}
+
+// TruncateAfter removes from the window of the given tenant
+// all the load allocated to segments starting at or after the cutoff time.
+func (instance *loadLimiterDefaultImpl) TruncateAfter(tenantKey string, cutoff time.Time) error {
+	t := instance.currentTime()
+
+	defer instance.lockTenant(tenantKey)()
+
+	if instance.closed {
+		return ErrLimiterClosed
+	}
+	if err := instance.validateTenantKey(tenantKey); err != nil {
+		return err
+	}
+
+	return instance.withSyncTransaction(func() {
+		req := instance.buildLoadRequest(t, tenantKey, 0)
+
+		instance.truncateAfter(req, uint64(cutoff.UnixMilli()))
+	}, syncTxOptions{
+		TenantKey: tenantKey,
+		ReadOnly:  false,
+	})
+}
+
+// StatsAll returns runtime statistics for all the tenants
+// currently holding some state in the limiter, indexed by tenant key.
+//
+// All the statistics are collected with a single lock acquisition.
+// No sync transaction is performed: only the state held by
+// the local instance is considered.
+func (instance *loadLimiterDefaultImpl) StatsAll() (map[string]RuntimeStatistics, error) {
+	instance.Lock.Lock()
+	defer instance.Lock.Unlock()
+
+	out := make(map[string]RuntimeStatistics, len(instance.TenantData))
+
+	for tenantKey := range instance.TenantData {
+		s, err := instance.stats(tenantKey)
+		if err != nil {
+			return nil, err
+		}
+		out[tenantKey] = s
+	}
+
+	return out, nil
+}
+
 func (instance *loadLimiterDefaultImpl) stats(tenantKey string) (RuntimeStatistics, error) {
 
 	tenant := instance.getTenant(tenantKey)
@@ -155,14 +728,32 @@ func (instance *loadLimiterDefaultImpl) stats(tenantKey string) (RuntimeStatisti
 	qLen := tenant.WindowQueue.Len()
 
 	segments := make([]uint64, qLen)
+	segmentPenalties := make([]uint64, qLen)
+	segmentTimes := make([]uint64, qLen)
+	penaltyTotal := uint64(0)
 
 	for i := 0; i < qLen; i++ {
-		segments[i] = tenant.WindowQueue.At(i).(*windowSegment).Value
+		segment := tenant.WindowQueue.At(i).(*windowSegment)
+		segments[i] = segment.total()
+		segmentPenalties[i] = segment.PenaltyValue
+		segmentTimes[i] = segment.StartTime
+		penaltyTotal += segment.PenaltyValue
 	}
 
+	maxLoad := instance.tenantMaxLoad(tenant, uint64(instance.currentTime().UnixMilli()))
+
 	out = RuntimeStatistics{
-		WindowTotal:    tenant.WindowTotal,
-		WindowSegments: segments,
+		Name:                   instance.Config.Name,
+		WindowTotal:            tenant.WindowTotal,
+		WindowSegments:         segments,
+		WindowPenaltyTotal:     penaltyTotal,
+		WindowSegmentPenalties: segmentPenalties,
+		WindowSegmentTimes:     segmentTimes,
+		MaxLoad:                maxLoad,
+		MaxPenaltyCap:          instance.maxPenaltyCap(maxLoad),
+		UtilizationPercent:     float64(tenant.WindowTotal) * 100.0 / float64(maxLoad),
+		AcceptedCount:          tenant.AcceptedCount,
+		RejectedCount:          tenant.RejectedCount,
 	}
 
 	return out, nil
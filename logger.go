@@ -3,6 +3,7 @@ package goll
 import (
 	"fmt"
 	"log"
+	"strings"
 )
 
 // Logger interface is provided
@@ -22,6 +23,75 @@ type Logger interface {
 	Error(string)
 }
 
+// StructuredLogger can be optionally implemented by a Logger
+// to receive the context of the messages as structured fields,
+// like the tenant key or the requested load,
+// instead of having it formatted in the message text.
+//
+// keysAndValues holds alternated keys and values,
+// following the conventions of zap's SugaredLogger.
+//
+// When the provided Logger does not implement StructuredLogger
+// the fields are appended to the message as key=value pairs.
+type StructuredLogger interface {
+	Logger
+	Debugw(msg string, keysAndValues ...interface{})
+	Infow(msg string, keysAndValues ...interface{})
+	Warnw(msg string, keysAndValues ...interface{})
+	Errorw(msg string, keysAndValues ...interface{})
+}
+
+func logDebugw(l Logger, msg string, keysAndValues ...interface{}) {
+	if sl, ok := l.(StructuredLogger); ok {
+		sl.Debugw(msg, keysAndValues...)
+		return
+	}
+	l.Debug(formatLogFields(msg, keysAndValues))
+}
+
+func logInfow(l Logger, msg string, keysAndValues ...interface{}) {
+	if sl, ok := l.(StructuredLogger); ok {
+		sl.Infow(msg, keysAndValues...)
+		return
+	}
+	l.Info(formatLogFields(msg, keysAndValues))
+}
+
+func logWarnw(l Logger, msg string, keysAndValues ...interface{}) {
+	if sl, ok := l.(StructuredLogger); ok {
+		sl.Warnw(msg, keysAndValues...)
+		return
+	}
+	l.Warning(formatLogFields(msg, keysAndValues))
+}
+
+func logErrorw(l Logger, msg string, keysAndValues ...interface{}) {
+	if sl, ok := l.(StructuredLogger); ok {
+		sl.Errorw(msg, keysAndValues...)
+		return
+	}
+	l.Error(formatLogFields(msg, keysAndValues))
+}
+
+// formatLogFields appends the given fields to the message
+// for the loggers that don't support structured logging.
+func formatLogFields(msg string, keysAndValues []interface{}) string {
+	if len(keysAndValues) == 0 {
+		return msg
+	}
+
+	sb := strings.Builder{}
+	sb.WriteString(msg)
+	for i := 0; i < len(keysAndValues); i += 2 {
+		if i+1 < len(keysAndValues) {
+			fmt.Fprintf(&sb, " %v=%v", keysAndValues[i], keysAndValues[i+1])
+		} else {
+			fmt.Fprintf(&sb, " %v", keysAndValues[i])
+		}
+	}
+	return sb.String()
+}
+
 type defaultLogger struct {
 }
 
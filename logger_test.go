@@ -1,7 +1,10 @@
 package goll
 
 import (
+	"fmt"
 	"testing"
+
+	"github.com/stretchr/testify/assert"
 )
 
 func TestDefaultLogger(t *testing.T) {
@@ -39,3 +42,73 @@ func TestNoOpLogger(t *testing.T) {
 		instance.Error(message)
 	}
 }
+
+type testStructuredLogger struct {
+	testLogger
+	Entries []string
+}
+
+func (l *testStructuredLogger) Debugw(msg string, keysAndValues ...interface{}) {
+	l.Entries = append(l.Entries, fmt.Sprintf("[d] %v %v", msg, keysAndValues))
+}
+func (l *testStructuredLogger) Infow(msg string, keysAndValues ...interface{}) {
+	l.Entries = append(l.Entries, fmt.Sprintf("[i] %v %v", msg, keysAndValues))
+}
+func (l *testStructuredLogger) Warnw(msg string, keysAndValues ...interface{}) {
+	l.Entries = append(l.Entries, fmt.Sprintf("[w] %v %v", msg, keysAndValues))
+}
+func (l *testStructuredLogger) Errorw(msg string, keysAndValues ...interface{}) {
+	l.Entries = append(l.Entries, fmt.Sprintf("[e] %v %v", msg, keysAndValues))
+}
+
+func TestStructuredLogger(t *testing.T) {
+	logger := &testStructuredLogger{}
+
+	ti := buildInstance(t, func(config *Config) {
+		config.Logger = logger
+		config.LogRejections = true
+	})
+
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 100)).Accepted)
+	assert.False(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 10)).Accepted)
+
+	assert.Contains(t, logger.Entries, "[d] load rejected [tenantKey test load 10 windowTotal 100 version 3]")
+
+	// the plain methods are still used for messages without fields
+	assert.NotEmpty(t, logger.Messages)
+	for _, message := range logger.Messages {
+		assert.NotContains(t, message, "load rejected")
+	}
+}
+
+func TestRejectionsNotLoggedByDefault(t *testing.T) {
+	logger := &testStructuredLogger{}
+
+	ti := buildInstance(t, func(config *Config) {
+		config.Logger = logger
+	})
+
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 100)).Accepted)
+	assert.False(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 10)).Accepted)
+	assert.False(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 1000)).Accepted)
+
+	for _, entry := range logger.Entries {
+		assert.NotContains(t, entry, "rejected")
+	}
+}
+
+func TestStructuredLoggerFallback(t *testing.T) {
+	logger := &testLogger{}
+
+	logDebugw(logger, "message", "tenantKey", "test", "load", 10)
+	logInfow(logger, "message")
+	logWarnw(logger, "message", "odd")
+	logErrorw(logger, "message", "key", nil)
+
+	assert.Equal(t, []string{
+		"[d] message tenantKey=test load=10",
+		"[i] message",
+		"[w] message odd",
+		"[e] message key=<nil>",
+	}, logger.Messages)
+}
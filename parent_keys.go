@@ -0,0 +1,175 @@
+package goll
+
+import (
+	"time"
+)
+
+// parentTenantKey returns the parent of the given tenant
+// as derived by the ParentKeyFunc, if any.
+func (instance *loadLimiterDefaultImpl) parentTenantKey(tenantKey string) (string, bool) {
+	if instance.ParentKeyFunc == nil {
+		return "", false
+	}
+	parentKey, ok := instance.ParentKeyFunc(tenantKey)
+	if !ok || parentKey == tenantKey {
+		return "", false
+	}
+	return parentKey, true
+}
+
+// lockTenantAndParent acquires the locks required to modify the given tenant
+// and its parent, if any, returning the parent key
+// and the function releasing the locks.
+func (instance *loadLimiterDefaultImpl) lockTenantAndParent(tenantKey string) (string, bool, func()) {
+	if parentKey, ok := instance.parentTenantKey(tenantKey); ok {
+		return parentKey, true, instance.lockTenantWithParent(tenantKey, parentKey)
+	}
+	return "", false, instance.lockTenant(tenantKey)
+}
+
+// validateTenantAndParentKeys checks the keys of the given tenant and of its parent, if any.
+func (instance *loadLimiterDefaultImpl) validateTenantAndParentKeys(tenantKey string, parentKey string, hasParent bool) error {
+	if err := instance.validateTenantKey(tenantKey); err != nil {
+		return err
+	}
+	if hasParent {
+		return instance.validateTenantKey(parentKey)
+	}
+	return nil
+}
+
+// runParentSyncTransaction runs the given task within a sync transaction
+// on the given tenant and, when hasParent is set, within a nested one on its parent.
+//
+// The warnings of both the transactions are reported together.
+func (instance *loadLimiterDefaultImpl) runParentSyncTransaction(
+	task func(), tenantKey string, parentKey string, hasParent bool, readOnly bool,
+) (syncTxResult, error) {
+	if !hasParent {
+		return instance.runSyncTransaction(task, syncTxOptions{
+			TenantKey: tenantKey,
+			ReadOnly:  readOnly,
+		})
+	}
+
+	var parentTxResult syncTxResult
+	var parentErr error
+
+	txResult, err := instance.runSyncTransaction(func() {
+		parentTxResult, parentErr = instance.runSyncTransaction(task, syncTxOptions{
+			TenantKey: parentKey,
+			ReadOnly:  readOnly,
+		})
+	}, syncTxOptions{
+		TenantKey: tenantKey,
+		ReadOnly:  readOnly,
+	})
+
+	if err != nil {
+		return syncTxResult{}, err
+	}
+	if parentErr != nil {
+		return syncTxResult{}, parentErr
+	}
+
+	txResult.Warnings = append(txResult.Warnings, parentTxResult.Warnings...)
+	return txResult, nil
+}
+
+// combineRejections merges the results of the tenants rejecting a load
+// charged to both a tenant and its parent:
+// the output has a RetryIn corresponding to the highest RetryIn of the given results,
+// while a single rejection is reported as is.
+func combineRejections(rejections ...*SubmitResult) SubmitResult {
+	var nonNil []*SubmitResult
+	for _, rejection := range rejections {
+		if rejection != nil {
+			nonNil = append(nonNil, rejection)
+		}
+	}
+	if len(nonNil) == 1 {
+		return *nonNil[0]
+	}
+
+	res := SubmitResult{
+		Accepted: false,
+	}
+	highestWaitTime := time.Duration(0)
+
+	for _, rejection := range nonNil {
+		if rejection.PermanentlyRejected {
+			res.PermanentlyRejected = true
+		}
+		if rejection.RetryInAvailable && rejection.RetryIn > highestWaitTime {
+			highestWaitTime = rejection.RetryIn
+		}
+	}
+
+	if !res.PermanentlyRejected && highestWaitTime > 0 {
+		res.RetryInAvailable = true
+		res.RetryIn = highestWaitTime
+	}
+
+	return res
+}
+
+// submitWithParentLocked handles a submission charged
+// to both the given tenant and its parent.
+//
+// The load is accepted only if both the tenants accept it,
+// otherwise rejectLoad is called on the rejecting ones
+// and the output will have a RetryIn corresponding to the highest
+// RetryIn of the reject responses. See tenant_locks.go for the locking order.
+func (instance *loadLimiterDefaultImpl) submitWithParentLocked(t time.Time, tenantKey string, parentKey string, load uint64) (SubmitResult, overloadTransition, error) {
+	defer instance.lockTenantWithParent(tenantKey, parentKey)()
+
+	if instance.closed {
+		return SubmitResult{}, overloadUnchanged, ErrLimiterClosed
+	}
+	if err := instance.validateTenantAndParentKeys(tenantKey, parentKey, true); err != nil {
+		return SubmitResult{}, overloadUnchanged, err
+	}
+
+	var res SubmitResult
+	var transition overloadTransition
+
+	txResult, err := instance.runParentSyncTransaction(func() {
+		req := instance.buildLoadRequest(t, tenantKey, load)
+		parentReq := instance.buildLoadRequest(t, parentKey, load)
+
+		wasOverBefore := req.TenantData.WasOver
+		defer func() {
+			transition = overloadTransitionOf(wasOverBefore, req.TenantData.WasOver)
+		}()
+
+		// both the tenants are probed before changing any of them
+		accepted := instance.probe(req)
+		parentAccepted := instance.probe(parentReq)
+
+		if accepted && parentAccepted {
+			instance.acceptLoad(req)
+			instance.acceptLoad(parentReq)
+			res = SubmitResult{
+				Accepted: true,
+			}
+			return
+		}
+
+		var rejection, parentRejection *SubmitResult
+		if !accepted {
+			rejection = instance.rejectLoad(req)
+		}
+		if !parentAccepted {
+			parentRejection = instance.rejectLoad(parentReq)
+		}
+		res = combineRejections(rejection, parentRejection)
+	}, tenantKey, parentKey, true, false)
+
+	if err != nil {
+		return SubmitResult{}, overloadUnchanged, err
+	}
+
+	res.SyncWarnings = txResult.Warnings
+
+	return res, transition, nil
+}
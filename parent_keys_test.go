@@ -0,0 +1,227 @@
+package goll
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// teamParentKey derives the team from keys in the "team/user" form.
+func teamParentKey(tenantKey string) (string, bool) {
+	if i := strings.Index(tenantKey, "/"); i > 0 {
+		return tenantKey[:i], true
+	}
+	return "", false
+}
+
+func TestParentKeyFuncChargesParent(t *testing.T) {
+	ti := buildInstance(t, func(config *Config) {
+		config.ParentKeyFunc = teamParentKey
+	})
+
+	assert.Nil(t, ti.Instance.SetTenantMaxLoad("team", 150))
+
+	assert.True(t, submitNoError(ti.Instance.Submit("team/alice", 100)).Accepted)
+	ti.AssertWindowStatus(t, "team/alice", 100, "1000000:100")
+	ti.AssertWindowStatus(t, "team", 100, "1000000:100")
+
+	// bob is within his limit but the team would exceed its own
+	res := submitNoError(ti.Instance.Submit("team/bob", 60))
+	assert.False(t, res.Accepted)
+	assert.True(t, res.RetryInAvailable)
+	ti.AssertWindowStatus(t, "team/bob", 0, "1000000:0")
+	ti.AssertWindowStatus(t, "team", 100, "1000000:100")
+
+	assert.True(t, submitNoError(ti.Instance.Submit("team/bob", 50)).Accepted)
+	ti.AssertWindowStatus(t, "team/bob", 50, "1000000:50")
+	ti.AssertWindowStatus(t, "team", 150, "1000000:150")
+
+	// alice would exceed her own limit: the team is not charged
+	ti.TimeTravel(10000)
+	assert.True(t, submitNoError(ti.Instance.Submit("team/alice", 100)).Accepted)
+	assert.False(t, submitNoError(ti.Instance.Submit("team/alice", 1)).Accepted)
+	ti.AssertWindowStatus(t, "team", 100, "1010000:100")
+
+	// keys without a parent are limited on their own
+	assert.True(t, submitNoError(ti.Instance.Submit("solo", 100)).Accepted)
+	assert.False(t, submitNoError(ti.Instance.Submit("solo", 1)).Accepted)
+}
+
+func TestParentKeyFuncPermanentRejection(t *testing.T) {
+	ti := buildInstance(t, func(config *Config) {
+		config.ParentKeyFunc = teamParentKey
+	})
+
+	assert.Nil(t, ti.Instance.SetTenantMaxLoad("team", 50))
+
+	res := submitNoError(ti.Instance.Submit("team/alice", 60))
+	assert.False(t, res.Accepted)
+	assert.True(t, res.PermanentlyRejected)
+	assert.False(t, res.RetryInAvailable)
+	ti.AssertWindowStatus(t, "team/alice", 0, "1000000:0")
+}
+
+func TestParentKeyFuncValidatesParentKey(t *testing.T) {
+	ti := buildInstance(t, func(config *Config) {
+		config.ParentKeyFunc = func(tenantKey string) (string, bool) {
+			return "team;" + tenantKey, true
+		}
+	})
+
+	_, err := ti.Instance.Submit("alice", 1)
+	assert.ErrorIs(t, err, ErrInvalidTenantKey)
+	ti.AssertWindowStatus(t, "alice", 0)
+}
+
+func TestParentKeyFuncConcurrentSubmit(t *testing.T) {
+	ti := buildInstance(t, func(config *Config) {
+		config.MaxLoad = 1000000
+		config.ParentKeyFunc = teamParentKey
+	})
+
+	numUsers := 16
+	numSubmissions := 100
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < numUsers; i++ {
+		tenantKey := fmt.Sprintf("team-%d/user-%d", i%2, i)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for k := 0; k < numSubmissions; k++ {
+				_, _ = ti.Instance.Submit(tenantKey, 1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	total := uint64(numUsers * numSubmissions)
+	assert.Equal(t, total/2, ti.Instance.getTenant("team-0").WindowTotal)
+	assert.Equal(t, total/2, ti.Instance.getTenant("team-1").WindowTotal)
+}
+
+func TestParentKeyFuncOnComposedLimiter(t *testing.T) {
+	_, err := NewComposite(&CompositeConfig{
+		Limiters: []Config{
+			{
+				MaxLoad:       100,
+				WindowSize:    10 * time.Second,
+				ParentKeyFunc: teamParentKey,
+			},
+		},
+	})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "cannot specify ParentKeyFunc on a composed limiter")
+}
+
+func TestParentKeyFuncProbe(t *testing.T) {
+	ti := buildInstance(t, func(config *Config) {
+		config.ParentKeyFunc = teamParentKey
+	})
+
+	assert.Nil(t, ti.Instance.SetTenantMaxLoad("team", 50))
+
+	// alice is within her limit but the team would exceed its own
+	assert.False(t, noErrors(ti.Instance.Probe("team/alice", 60)).(bool))
+	assert.False(t, noErrors(ti.Instance.ProbeReadOnly("team/alice", 60)).(bool))
+	assert.True(t, noErrors(ti.Instance.Probe("team/alice", 50)).(bool))
+	assert.True(t, noErrors(ti.Instance.ProbeReadOnly("team/alice", 50)).(bool))
+
+	details, err := ti.Instance.ProbeWithDetails("team/alice", 60)
+	assert.Nil(t, err)
+	assert.False(t, details.Accepted)
+	assert.True(t, details.PermanentlyRejected)
+
+	remaining, err := ti.Instance.RemainingCapacity("team/alice")
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(50), remaining)
+
+	assert.True(t, submitNoError(ti.Instance.Submit("team/bob", 30)).Accepted)
+
+	assert.False(t, noErrors(ti.Instance.Probe("team/alice", 30)).(bool))
+	assert.True(t, noErrors(ti.Instance.Probe("team/alice", 20)).(bool))
+
+	details, err = ti.Instance.ProbeWithDetails("team/alice", 30)
+	assert.Nil(t, err)
+	assert.False(t, details.Accepted)
+	assert.False(t, details.PermanentlyRejected)
+	assert.True(t, details.RetryInAvailable)
+
+	dryRun, err := ti.Instance.SubmitDryRun("team/alice", 30)
+	assert.Nil(t, err)
+	assert.False(t, dryRun.Accepted)
+	assert.True(t, dryRun.RetryInAvailable)
+
+	remaining, err = ti.Instance.RemainingCapacity("team/alice")
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(20), remaining)
+
+	many, err := ti.Instance.ProbeMany("team/alice", []uint64{20, 30})
+	assert.Nil(t, err)
+	assert.Equal(t, []bool{true, false}, many)
+
+	// probes never charge any of the tenants
+	ti.AssertWindowStatus(t, "team/alice", 0, "1000000:0")
+	ti.AssertWindowStatus(t, "team", 30, "1000000:30")
+}
+
+func TestParentKeyFuncReserve(t *testing.T) {
+	ti := buildInstance(t, func(config *Config) {
+		config.ParentKeyFunc = teamParentKey
+	})
+
+	assert.Nil(t, ti.Instance.SetTenantMaxLoad("team", 50))
+
+	// the team would exceed its limit: nothing is charged
+	res, err := ti.Instance.Reserve("team/alice", 60)
+	assert.Nil(t, err)
+	assert.False(t, res.Accepted)
+	assert.True(t, res.PermanentlyRejected)
+	ti.AssertWindowStatus(t, "team/alice", 0, "1000000:0")
+
+	res, err = ti.Instance.Reserve("team/alice", 40)
+	assert.Nil(t, err)
+	assert.True(t, res.Accepted)
+	ti.AssertWindowStatus(t, "team/alice", 40, "1000000:40")
+	ti.AssertWindowStatus(t, "team", 40, "1000000:40")
+
+	// the reserved load counts against the team
+	assert.False(t, submitNoError(ti.Instance.Submit("team/bob", 20)).Accepted)
+
+	// settling refunds the parent too
+	assert.Nil(t, res.Commit(15))
+	ti.AssertWindowStatus(t, "team/alice", 15, "1000000:15")
+	ti.AssertWindowStatus(t, "team", 15, "1000000:15")
+
+	res, err = ti.Instance.Reserve("team/alice", 10)
+	assert.Nil(t, err)
+	assert.True(t, res.Accepted)
+	ti.AssertWindowStatus(t, "team", 25, "1000000:25")
+
+	assert.Nil(t, res.Cancel())
+	ti.AssertWindowStatus(t, "team/alice", 15, "1000000:15")
+	ti.AssertWindowStatus(t, "team", 15, "1000000:15")
+}
+
+func TestParentKeyFuncRefund(t *testing.T) {
+	ti := buildInstance(t, func(config *Config) {
+		config.ParentKeyFunc = teamParentKey
+	})
+
+	assert.True(t, submitNoError(ti.Instance.Submit("team/alice", 90)).Accepted)
+	ti.AssertWindowStatus(t, "team", 90, "1000000:90")
+
+	assert.Nil(t, ti.Instance.Refund("team/alice", 60))
+	ti.AssertWindowStatus(t, "team/alice", 30, "1000000:30")
+	ti.AssertWindowStatus(t, "team", 30, "1000000:30")
+
+	// only the load actually refunded to the tenant is given back to the parent
+	assert.True(t, submitNoError(ti.Instance.Submit("team/bob", 20)).Accepted)
+	assert.Nil(t, ti.Instance.Refund("team/alice", 1000))
+	ti.AssertWindowStatus(t, "team/alice", 0, "1000000:0")
+	ti.AssertWindowStatus(t, "team", 20, "1000000:20")
+}
@@ -0,0 +1,104 @@
+// Package gollprometheus exposes the runtime statistics
+// of a goll load limiter as Prometheus metrics.
+//
+// It lives in a separate module so that the core library
+// does not depend on the Prometheus client.
+package gollprometheus
+
+import (
+	"github.com/fabiofenoglio/goll"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const metricsNamespace = "goll"
+
+type limiterCollector struct {
+	limiter goll.StandaloneLoadLimiter
+
+	windowTotalDesc *prometheus.Desc
+	maxLoadDesc     *prometheus.Desc
+	utilizationDesc *prometheus.Desc
+	acceptedDesc    *prometheus.Desc
+	rejectedDesc    *prometheus.Desc
+}
+
+// NewPrometheusCollector builds a prometheus.Collector that reports,
+// for every tenant currently known to the given limiter,
+// the active window load, the max allowed load, the utilization ratio
+// and the number of accepted and rejected submissions.
+//
+// tenantKeyLabel is the name of the label holding the tenant key.
+//
+// Statistics are collected via StatsAll at scrape time,
+// so they only include the state held by the local instance.
+func NewPrometheusCollector(limiter goll.StandaloneLoadLimiter, tenantKeyLabel string) prometheus.Collector {
+	if tenantKeyLabel == "" {
+		tenantKeyLabel = "tenant"
+	}
+	labels := []string{tenantKeyLabel}
+
+	return &limiterCollector{
+		limiter: limiter,
+		windowTotalDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(metricsNamespace, "", "window_total"),
+			"Total load currently active in the window, in absolute units.",
+			labels, nil,
+		),
+		maxLoadDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(metricsNamespace, "", "max_load"),
+			"Max load currently allowed, including any active temporary boost.",
+			labels, nil,
+		),
+		utilizationDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(metricsNamespace, "", "utilization"),
+			"Ratio between the active load and the max allowed load.",
+			labels, nil,
+		),
+		acceptedDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(metricsNamespace, "", "accepted_total"),
+			"Number of submissions accepted over the lifetime of the tenant.",
+			labels, nil,
+		),
+		rejectedDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(metricsNamespace, "", "rejected_total"),
+			"Number of submissions rejected over the lifetime of the tenant.",
+			labels, nil,
+		),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *limiterCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.windowTotalDesc
+	ch <- c.maxLoadDesc
+	ch <- c.utilizationDesc
+	ch <- c.acceptedDesc
+	ch <- c.rejectedDesc
+}
+
+// Collect implements prometheus.Collector.
+func (c *limiterCollector) Collect(ch chan<- prometheus.Metric) {
+	stats, err := c.limiter.StatsAll()
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(c.windowTotalDesc, err)
+		return
+	}
+
+	for tenantKey, tenantStats := range stats {
+		ch <- prometheus.MustNewConstMetric(
+			c.windowTotalDesc, prometheus.GaugeValue, float64(tenantStats.WindowTotal), tenantKey,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			c.maxLoadDesc, prometheus.GaugeValue, float64(tenantStats.MaxLoad), tenantKey,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			c.utilizationDesc, prometheus.GaugeValue, tenantStats.Utilization(), tenantKey,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			c.acceptedDesc, prometheus.CounterValue, float64(tenantStats.AcceptedCount), tenantKey,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			c.rejectedDesc, prometheus.CounterValue, float64(tenantStats.RejectedCount), tenantKey,
+		)
+	}
+}
@@ -0,0 +1,62 @@
+package gollprometheus
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fabiofenoglio/goll"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrometheusCollector(t *testing.T) {
+	now := time.Unix(1000, 0)
+
+	limiter, err := goll.New(&goll.Config{
+		MaxLoad:           100,
+		WindowSize:        10 * time.Second,
+		WindowSegmentSize: time.Second,
+		TimeFunc: func() time.Time {
+			return now
+		},
+	})
+	assert.Nil(t, err)
+
+	res, err := limiter.Submit("a", 25)
+	assert.Nil(t, err)
+	assert.True(t, res.Accepted)
+	res, err = limiter.Submit("b", 50)
+	assert.Nil(t, err)
+	assert.True(t, res.Accepted)
+	res, err = limiter.Submit("b", 60)
+	assert.Nil(t, err)
+	assert.False(t, res.Accepted)
+
+	collector := NewPrometheusCollector(limiter, "tenant_key")
+
+	expected := `
+# HELP goll_accepted_total Number of submissions accepted over the lifetime of the tenant.
+# TYPE goll_accepted_total counter
+goll_accepted_total{tenant_key="a"} 1
+goll_accepted_total{tenant_key="b"} 1
+# HELP goll_max_load Max load currently allowed, including any active temporary boost.
+# TYPE goll_max_load gauge
+goll_max_load{tenant_key="a"} 100
+goll_max_load{tenant_key="b"} 100
+# HELP goll_rejected_total Number of submissions rejected over the lifetime of the tenant.
+# TYPE goll_rejected_total counter
+goll_rejected_total{tenant_key="a"} 0
+goll_rejected_total{tenant_key="b"} 1
+# HELP goll_utilization Ratio between the active load and the max allowed load.
+# TYPE goll_utilization gauge
+goll_utilization{tenant_key="a"} 0.25
+goll_utilization{tenant_key="b"} 0.5
+# HELP goll_window_total Total load currently active in the window, in absolute units.
+# TYPE goll_window_total gauge
+goll_window_total{tenant_key="a"} 25
+goll_window_total{tenant_key="b"} 50
+`
+
+	assert.Nil(t, testutil.CollectAndCompare(collector, strings.NewReader(expected)))
+}
@@ -0,0 +1,254 @@
+package goll
+
+import (
+	"errors"
+)
+
+// Reservation holds the result of a load reservation obtained via Reserve.
+//
+// If the reservation was accepted, it should be settled
+// by calling either Commit or Cancel exactly once.
+type Reservation struct {
+	SubmitResult
+
+	state *reservationState
+}
+
+type reservationState struct {
+	limiter     *loadLimiterDefaultImpl
+	tenantKey   string
+	allocations []reservedSegment
+	load        uint64
+	settled     bool
+
+	// the parent charged together with the tenant, if any
+	hasParent         bool
+	parentKey         string
+	parentAllocations []reservedSegment
+}
+
+// reservedSegment holds the share of a reservation
+// allocated to a segment of the window.
+type reservedSegment struct {
+	StartTime uint64
+	Load      uint64
+}
+
+// Commit settles the reservation with the actual load,
+// adding or refunding the difference from the estimated one.
+func (r Reservation) Commit(actual uint64) error {
+	if r.state == nil {
+		return errors.New("cannot settle a reservation that was not accepted")
+	}
+	return r.state.limiter.settleReservation(r.state, actual)
+}
+
+// Cancel settles the reservation refunding all of the estimated load.
+func (r Reservation) Cancel() error {
+	if r.state == nil {
+		return errors.New("cannot settle a reservation that was not accepted")
+	}
+	return r.state.limiter.settleReservation(r.state, 0)
+}
+
+// Reserve asks for the estimated load to be accepted, like Submit does.
+//
+// If accepted, the returned reservation should later be settled
+// with Commit, once the actual load is known, or with Cancel.
+func (instance *loadLimiterDefaultImpl) Reserve(tenantKey string, estimated uint64) (Reservation, error) {
+	out, transition, err := instance.reserveLocked(tenantKey, estimated)
+	if err == nil {
+		instance.Hooks.notify(tenantKey, instance.quantizeLoad(estimated), out.SubmitResult, transition)
+	}
+	return out, err
+}
+
+func (instance *loadLimiterDefaultImpl) reserveLocked(tenantKey string, estimated uint64) (Reservation, overloadTransition, error) {
+	t := instance.currentTime()
+
+	parentKey, hasParent, unlock := instance.lockTenantAndParent(tenantKey)
+	defer unlock()
+
+	if instance.closed {
+		return Reservation{}, overloadUnchanged, ErrLimiterClosed
+	}
+	if err := instance.validateTenantAndParentKeys(tenantKey, parentKey, hasParent); err != nil {
+		return Reservation{}, overloadUnchanged, err
+	}
+
+	var out Reservation
+	var transition overloadTransition
+
+	txResult, err := instance.runParentSyncTransaction(func() {
+		req := instance.buildLoadRequest(t, tenantKey, estimated)
+		wasOverBefore := req.TenantData.WasOver
+		defer func() {
+			transition = overloadTransitionOf(wasOverBefore, req.TenantData.WasOver)
+		}()
+
+		// both the tenants are probed before changing any of them
+		accepted := instance.probe(req)
+
+		var parentReq *submitRequest
+		parentAccepted := true
+		if hasParent {
+			parentReq = instance.buildLoadRequest(t, parentKey, estimated)
+			parentAccepted = instance.probe(parentReq)
+		}
+
+		if accepted && parentAccepted {
+			instance.acceptLoad(req)
+			state := &reservationState{
+				limiter:     instance,
+				tenantKey:   tenantKey,
+				allocations: instance.acceptedAllocations(req),
+				load:        req.RequestedLoad,
+			}
+			if hasParent {
+				instance.acceptLoad(parentReq)
+				state.hasParent = true
+				state.parentKey = parentKey
+				state.parentAllocations = instance.acceptedAllocations(parentReq)
+			}
+			out = Reservation{
+				SubmitResult: SubmitResult{
+					Accepted: true,
+				},
+				state: state,
+			}
+			return
+		}
+
+		var rejection, parentRejection *SubmitResult
+		if !accepted {
+			rejection = instance.rejectLoad(req)
+		}
+		if !parentAccepted {
+			parentRejection = instance.rejectLoad(parentReq)
+		}
+		out = Reservation{
+			SubmitResult: combineRejections(rejection, parentRejection),
+		}
+	}, tenantKey, parentKey, hasParent, false)
+
+	if err != nil {
+		return Reservation{}, overloadUnchanged, err
+	}
+
+	out.SyncWarnings = txResult.Warnings
+
+	return out, transition, nil
+}
+
+func (instance *loadLimiterDefaultImpl) settleReservation(reservation *reservationState, actual uint64) error {
+	t := instance.currentTime()
+
+	var unlock func()
+	if reservation.hasParent {
+		unlock = instance.lockTenantWithParent(reservation.tenantKey, reservation.parentKey)
+	} else {
+		unlock = instance.lockTenant(reservation.tenantKey)
+	}
+	defer unlock()
+
+	if instance.closed {
+		return ErrLimiterClosed
+	}
+	if reservation.settled {
+		return errors.New("the reservation was already settled")
+	}
+
+	_, err := instance.runParentSyncTransaction(func() {
+		quantized := instance.quantizeLoad(actual)
+
+		req := instance.buildLoadRequest(t, reservation.tenantKey, 0)
+		instance.adjustReservedLoad(req, reservation.allocations, reservation.load, quantized)
+
+		if reservation.hasParent {
+			parentReq := instance.buildLoadRequest(t, reservation.parentKey, 0)
+			instance.adjustReservedLoad(parentReq, reservation.parentAllocations, reservation.load, quantized)
+		}
+	}, reservation.tenantKey, reservation.parentKey, reservation.hasParent, false)
+
+	if err != nil {
+		return err
+	}
+
+	reservation.settled = true
+	return nil
+}
+
+// acceptedAllocations returns how acceptLoad allocated the load of the given request
+// over the segments, starting from the most recent one.
+func (instance *loadLimiterDefaultImpl) acceptedAllocations(req *submitRequest) []reservedSegment {
+	if instance.Config.AcceptanceSpreadSegments <= 1 {
+		return []reservedSegment{{
+			StartTime: req.RequestSegmentStartTime,
+			Load:      req.RequestedLoad,
+		}}
+	}
+
+	distribution := splitOverSegments(req.RequestedLoad, instance.Config.AcceptanceSpreadSegments, PenaltyDistributionEven)
+	out := make([]reservedSegment, len(distribution))
+	for i, load := range distribution {
+		out[i] = reservedSegment{
+			StartTime: req.RequestSegmentStartTime - uint64(i)*instance.Config.WindowSegmentSize,
+			Load:      load,
+		}
+	}
+	return out
+}
+
+// adjustReservedLoad applies the difference between the actual and the reserved load.
+// Extra load is accepted as any other load, penalty capping included,
+// while refunds are taken from the accepted load of the segments the reservation was allocated to,
+// starting from the most recent one, as long as they are still in the window.
+// Penalties are never refunded.
+func (instance *loadLimiterDefaultImpl) adjustReservedLoad(req *submitRequest, allocations []reservedSegment, reserved uint64, actual uint64) {
+	instance.rotateWindow(req)
+
+	tenant := req.TenantData
+
+	if actual > reserved {
+		instance.addAcceptedLoad(req, actual-reserved)
+		return
+	}
+
+	refund := reserved - actual
+	if refund == 0 {
+		return
+	}
+
+	segments := make(map[uint64]*windowSegment, tenant.WindowQueue.Len())
+	for i := 0; i < tenant.WindowQueue.Len(); i++ {
+		segment := tenant.WindowQueue.At(i).(*windowSegment)
+		segments[segment.StartTime] = segment
+	}
+
+	refunded := uint64(0)
+	for _, allocation := range allocations {
+		if refund == 0 {
+			break
+		}
+		segment, inWindow := segments[allocation.StartTime]
+		if !inWindow {
+			continue
+		}
+		amount := allocation.Load
+		if amount > refund {
+			amount = refund
+		}
+		refund -= amount
+
+		// the segment could have been trimmed by penalty capping
+		removed := segment.removeAccepted(amount)
+		tenant.WindowTotal -= removed
+		refunded += removed
+	}
+
+	if refunded == 0 {
+		instance.Logger.Debug("reserved load already slid out of the window, nothing to refund")
+		return
+	}
+	instance.markDirty(req)
+}
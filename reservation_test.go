@@ -0,0 +1,127 @@
+package goll
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReservationCommit(t *testing.T) {
+	ti := buildDefaultInstance(t)
+
+	reservation, err := ti.Instance.Reserve(defaultTestTenantKey, 30)
+	assert.Nil(t, err)
+	assert.True(t, reservation.Accepted)
+	ti.AssertWindowStatus(t, defaultTestTenantKey, 30, "1000000:30")
+
+	// the actual load was lower than estimated
+	ti.TimeTravel(1000)
+	assert.Nil(t, reservation.Commit(20))
+	ti.AssertWindowStatus(t, defaultTestTenantKey, 20, "1001000:0", "1000000:20")
+
+	// settling twice is not allowed
+	assert.NotNil(t, reservation.Commit(20))
+	assert.NotNil(t, reservation.Cancel())
+
+	// the actual load was higher than estimated
+	reservation, err = ti.Instance.Reserve(defaultTestTenantKey, 10)
+	assert.Nil(t, err)
+	ti.TimeTravel(1000)
+	assert.Nil(t, reservation.Commit(25))
+	ti.AssertWindowStatus(t, defaultTestTenantKey, 45, "1002000:15", "1001000:10", "1000000:20")
+}
+
+func TestReservationCancel(t *testing.T) {
+	ti := buildDefaultInstance(t)
+
+	reservation, err := ti.Instance.Reserve(defaultTestTenantKey, 80)
+	assert.Nil(t, err)
+	assert.True(t, reservation.Accepted)
+	assert.False(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 30)).Accepted)
+
+	assert.Nil(t, reservation.Cancel())
+	ti.AssertWindowStatus(t, defaultTestTenantKey, 0, "1000000:0")
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 30)).Accepted)
+
+	// refunds for load already out of the window are ignored
+	reservation, err = ti.Instance.Reserve(defaultTestTenantKey, 10)
+	assert.Nil(t, err)
+	ti.TimeTravel(10000)
+	assert.Nil(t, reservation.Cancel())
+	ti.AssertWindowStatus(t, defaultTestTenantKey, 0, "1010000:0")
+}
+
+func TestReservationWithAcceptanceSpread(t *testing.T) {
+	ti := buildInstance(t, func(config *Config) {
+		config.AcceptanceSpreadSegments = 4
+	})
+
+	reservation, err := ti.Instance.Reserve(defaultTestTenantKey, 80)
+	assert.Nil(t, err)
+	assert.True(t, reservation.Accepted)
+	ti.AssertWindowStatus(t, defaultTestTenantKey, 80, "1000000:20", "999000:20", "998000:20", "997000:20")
+
+	// the whole estimated load is refunded from all the segments
+	assert.Nil(t, reservation.Cancel())
+	ti.AssertWindowStatus(t, defaultTestTenantKey, 0, "1000000:0", "999000:0", "998000:0", "997000:0")
+
+	// partial refunds are taken starting from the most recent segment
+	reservation, err = ti.Instance.Reserve(defaultTestTenantKey, 80)
+	assert.Nil(t, err)
+	assert.Nil(t, reservation.Commit(30))
+	ti.AssertWindowStatus(t, defaultTestTenantKey, 30, "1000000:0", "999000:0", "998000:10", "997000:20")
+
+	// only the segments still in the window are refunded
+	reservation, err = ti.Instance.Reserve(defaultTestTenantKey, 40)
+	assert.Nil(t, err)
+	ti.TimeTravel(7000)
+	assert.Nil(t, reservation.Cancel())
+	ti.AssertWindowStatus(t, defaultTestTenantKey, 10, "1007000:0", "1000000:0", "999000:0", "998000:10")
+}
+
+func TestReservationRejected(t *testing.T) {
+	ti := buildDefaultInstance(t)
+
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 90)).Accepted)
+
+	reservation, err := ti.Instance.Reserve(defaultTestTenantKey, 20)
+	assert.Nil(t, err)
+	assert.False(t, reservation.Accepted)
+	assert.True(t, reservation.RetryInAvailable)
+
+	assert.NotNil(t, reservation.Commit(20))
+	assert.NotNil(t, reservation.Cancel())
+	ti.AssertWindowStatus(t, defaultTestTenantKey, 90, "1000000:90")
+}
+
+func TestReservationCommitAppliesCapping(t *testing.T) {
+	ti := buildDefaultInstance(t)
+
+	reservation, err := ti.Instance.Reserve(defaultTestTenantKey, 90)
+	assert.Nil(t, err)
+	assert.True(t, reservation.Accepted)
+
+	// the extra load never pushes the window above the penalty cap
+	assert.Nil(t, reservation.Commit(200))
+	ti.AssertWindowStatus(t, defaultTestTenantKey, 150, "1000000:150")
+}
+
+func TestReservationRefundKeepsPenalties(t *testing.T) {
+	ti := buildInstance(t, func(config *Config) {
+		config.OverstepPenaltyFactor = 0.2
+	})
+
+	reservation, err := ti.Instance.Reserve(defaultTestTenantKey, 90)
+	assert.Nil(t, err)
+	assert.True(t, reservation.Accepted)
+	assert.False(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 20)).Accepted)
+	ti.AssertWindowStatus(t, defaultTestTenantKey, 110, "1000000:110")
+
+	// part of the reserved load was already refunded:
+	// cancelling the reservation must not take the rest from the penalty
+	assert.Nil(t, ti.Instance.Refund(defaultTestTenantKey, 50))
+	ti.AssertWindowStatus(t, defaultTestTenantKey, 60, "1000000:60")
+	assert.Nil(t, reservation.Cancel())
+	ti.AssertWindowStatus(t, defaultTestTenantKey, 20, "1000000:20")
+	assert.Equal(t, uint64(20), ti.Instance.getTenant(defaultTestTenantKey).WindowQueue.Front().(*windowSegment).PenaltyValue)
+}
@@ -0,0 +1,83 @@
+package goll
+
+import (
+	"time"
+)
+
+const (
+	// advisedRequestsPerSegment is the average number of requests
+	// a segment should hold: finer segments would be mostly empty
+	// and only add overhead, coarser ones would make the window less smooth.
+	advisedRequestsPerSegment = 5
+
+	// advisedMinSegments and advisedMaxSegments bound
+	// the number of segments resulting from the advice.
+	advisedMinSegments = 5
+	advisedMaxSegments = 100
+)
+
+// trackInterarrival updates the interarrival statistics of the tenant
+// with the submission of the given request.
+func (instance *loadLimiterDefaultImpl) trackInterarrival(req *submitRequest) {
+	tenant := req.TenantData
+
+	if tenant.LastSubmittedAt > 0 && req.RequestedTimestamp > tenant.LastSubmittedAt {
+		tenant.IntervalsSum = saturatingAdd(tenant.IntervalsSum, req.RequestedTimestamp-tenant.LastSubmittedAt)
+		tenant.IntervalsCount++
+	}
+	if req.RequestedTimestamp > tenant.LastSubmittedAt {
+		tenant.LastSubmittedAt = req.RequestedTimestamp
+	}
+}
+
+// AdvisedSegmentSize recommends a WindowSegmentSize based on the
+// interval between the submissions observed so far for each tenant,
+// so that each segment holds a few requests on average.
+//
+// The advice divides the WindowSize evenly. The configured WindowSegmentSize
+// is returned when no interval was observed yet or with AlgorithmFixedWindow.
+//
+// It is purely advisory: the configuration in use is not changed.
+func (instance *loadLimiterDefaultImpl) AdvisedSegmentSize() time.Duration {
+	instance.Lock.Lock()
+	defer instance.Lock.Unlock()
+
+	windowSize := int64(instance.Config.WindowSize)
+	current := time.Duration(instance.Config.WindowSegmentSize) * time.Millisecond
+
+	if instance.Config.Algorithm == AlgorithmFixedWindow {
+		return current
+	}
+
+	sum := uint64(0)
+	count := uint64(0)
+	for _, tenant := range instance.TenantData {
+		sum = saturatingAdd(sum, tenant.IntervalsSum)
+		count = saturatingAdd(count, tenant.IntervalsCount)
+	}
+	if count == 0 {
+		return current
+	}
+
+	advised := int64(sum / count * advisedRequestsPerSegment)
+
+	if lower := windowSize / advisedMaxSegments; advised < lower {
+		advised = lower
+	}
+	if upper := windowSize / advisedMinSegments; advised > upper {
+		advised = upper
+	}
+	if advised < 1 {
+		advised = 1
+	}
+
+	advised = roundSegmentSize(windowSize, advised, SegmentRoundingDown)
+
+	logDebugw(instance.Logger, "computed advised segment size",
+		"observedIntervals", count,
+		"averageInterval", time.Duration(sum/count)*time.Millisecond,
+		"advised", time.Duration(advised)*time.Millisecond,
+	)
+
+	return time.Duration(advised) * time.Millisecond
+}
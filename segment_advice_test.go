@@ -0,0 +1,60 @@
+package goll
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdvisedSegmentSize(t *testing.T) {
+	ti := buildDefaultInstance(t)
+
+	// nothing observed yet, the configured size is returned
+	assert.Equal(t, time.Second, ti.Instance.AdvisedSegmentSize())
+
+	// probes are not submissions
+	for i := 0; i < 5; i++ {
+		_, _ = ti.Instance.Probe(defaultTestTenantKey, 1)
+		ti.TimeTravel(10)
+	}
+	assert.Equal(t, time.Second, ti.Instance.AdvisedSegmentSize())
+
+	// a submission every 100 ms
+	for i := 0; i < 20; i++ {
+		_, _ = ti.Instance.Submit(defaultTestTenantKey, 1)
+		ti.TimeTravel(100)
+	}
+	assert.Equal(t, 500*time.Millisecond, ti.Instance.AdvisedSegmentSize())
+
+	// the configuration in use is not changed
+	assert.Equal(t, time.Second, ti.Instance.EffectiveConfig().WindowSegmentSize)
+}
+
+func TestAdvisedSegmentSizeIsBounded(t *testing.T) {
+	ti := buildDefaultInstance(t)
+
+	// sparse submissions are bounded to 5 segments
+	for i := 0; i < 5; i++ {
+		_, _ = ti.Instance.Submit(defaultTestTenantKey, 1)
+		ti.TimeTravel(3000)
+	}
+	assert.Equal(t, 2*time.Second, ti.Instance.AdvisedSegmentSize())
+
+	// dense submissions from many tenants are bounded to 100 segments
+	ti = buildDefaultInstance(t)
+	for i := 0; i < 50; i++ {
+		_, _ = ti.Instance.Submit("a", 1)
+		_, _ = ti.Instance.Submit("b", 1)
+		ti.TimeTravel(1)
+	}
+	assert.Equal(t, 100*time.Millisecond, ti.Instance.AdvisedSegmentSize())
+
+	// the advice of 350 ms is rounded to divide the window evenly
+	ti = buildDefaultInstance(t)
+	for i := 0; i < 10; i++ {
+		_, _ = ti.Instance.Submit(defaultTestTenantKey, 1)
+		ti.TimeTravel(70)
+	}
+	assert.Equal(t, 400*time.Millisecond, ti.Instance.AdvisedSegmentSize())
+}
@@ -0,0 +1,605 @@
+package goll
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Serialized statuses are plain strings made of tokens separated by slashes,
+// starting with the format version.
+//
+// The v2 format is self-describing: every token after the version
+// is a key=value pair, so that fields can be added over time.
+// Unknown keys are ignored and missing keys fall back to their zero value,
+// allowing instances running different releases to share a remote store.
+//
+//	v2/ver=5/total=20/over=0/seg=1001000:15,1000000:5/acc=8/rej=2/max=50/pen=1001000:3
+//
+// Segment values hold the whole load of the segment, including penalties.
+// The optional pen key lists the penalty portion of the segments holding some,
+// so that releases not aware of it still read the correct segment loads.
+//
+// The legacy v1 format is positional and is still accepted when restoring:
+//
+//	v1/5/20/0/1001000:15,1000000:5[/8/2]
+//
+// The compact format is recognized by the c1: prefix, followed by
+// varint-packed binary data encoded as unpadded URL-safe base64
+// so that it never contains the separators used by the other formats.
+const (
+	serializationCompactPrefix = "c1:"
+
+	serializationTokenSeparator   = "/"
+	serializationKeyValueSep      = "="
+	serializationSegmentSeparator = ","
+
+	serializationKeyVersion         = "ver"
+	serializationKeyWindowTotal     = "total"
+	serializationKeyWasOver         = "over"
+	serializationKeySegments        = "seg"
+	serializationKeyAcceptedCount   = "acc"
+	serializationKeyRejectedCount   = "rej"
+	serializationKeyMaxLoadOverride = "max"
+	serializationKeyPenalties       = "pen"
+
+	// serializedSegmentsSlack is the number of segments over NumSegments
+	// tolerated in a serialized status, as a window being rotated
+	// may briefly hold more segments than its size.
+	serializedSegmentsSlack = 2
+)
+
+func (instance *loadLimiterDefaultImpl) serializeStatus(tenantKey string, tenant *loadLimiterDefaultImplTenantData) string {
+	if instance.Config.SerializationFormat == SerializationCompact {
+		return serializeStatusCompact(tenant)
+	}
+	return serializeStatusText(tenant)
+}
+
+func serializeStatusText(tenant *loadLimiterDefaultImplTenantData) string {
+	sb := strings.Builder{}
+
+	sb.WriteString("v2")
+	writeSerializedToken(&sb, serializationKeyVersion, tenant.Version)
+	writeSerializedToken(&sb, serializationKeyWindowTotal, tenant.WindowTotal)
+	if tenant.WasOver {
+		writeSerializedToken(&sb, serializationKeyWasOver, 1)
+	} else {
+		writeSerializedToken(&sb, serializationKeyWasOver, 0)
+	}
+	writeSerializedToken(&sb, serializationKeySegments, serializeSegments(tenant))
+	writeSerializedToken(&sb, serializationKeyAcceptedCount, tenant.AcceptedCount)
+	writeSerializedToken(&sb, serializationKeyRejectedCount, tenant.RejectedCount)
+	if tenant.MaxLoadOverride > 0 {
+		writeSerializedToken(&sb, serializationKeyMaxLoadOverride, tenant.MaxLoadOverride)
+	}
+	if penalties := serializePenalties(tenant); penalties != "" {
+		writeSerializedToken(&sb, serializationKeyPenalties, penalties)
+	}
+
+	return sb.String()
+}
+
+func writeSerializedToken(sb *strings.Builder, key string, value interface{}) {
+	fmt.Fprintf(sb, "%s%s%s%v", serializationTokenSeparator, key, serializationKeyValueSep, value)
+}
+
+func serializeSegments(tenant *loadLimiterDefaultImplTenantData) string {
+	qLen := tenant.WindowQueue.Len()
+
+	segstr := ""
+	for i := 0; i < qLen; i++ {
+		seg := tenant.WindowQueue.At(i).(*windowSegment)
+		segstr += fmt.Sprintf("%d:%d,", seg.StartTime, seg.total())
+	}
+	if qLen > 0 {
+		segstr = strings.TrimRight(segstr, serializationSegmentSeparator)
+	}
+
+	return segstr
+}
+
+// serializePenalties lists the penalty load of the segments holding some,
+// in the same format as the segments.
+func serializePenalties(tenant *loadLimiterDefaultImplTenantData) string {
+	parts := make([]string, 0)
+	for i := 0; i < tenant.WindowQueue.Len(); i++ {
+		seg := tenant.WindowQueue.At(i).(*windowSegment)
+		if seg.PenaltyValue > 0 {
+			parts = append(parts, fmt.Sprintf("%d:%d", seg.StartTime, seg.PenaltyValue))
+		}
+	}
+	return strings.Join(parts, serializationSegmentSeparator)
+}
+
+// serializedStatus holds the data parsed from a serialized tenant status.
+type serializedStatus struct {
+	Version     uint64
+	WindowTotal uint64
+	WasOver     bool
+
+	// Segments are ordered from the most recent to the oldest one,
+	// matching the order of the window queue.
+	// The penalty load is split from the accepted load when known.
+	Segments []windowSegment
+
+	// AcceptedCount and RejectedCount are optional
+	// and default to zero when missing.
+	AcceptedCount uint64
+	RejectedCount uint64
+
+	// MaxLoadOverride is 0 when the status does not carry an override.
+	MaxLoadOverride uint64
+}
+
+func parseSerializedStatus(serialized string) (*serializedStatus, error) {
+	if strings.HasPrefix(serialized, serializationCompactPrefix) {
+		return parseSerializedStatusCompact(strings.TrimPrefix(serialized, serializationCompactPrefix))
+	}
+
+	splitted := strings.Split(serialized, serializationTokenSeparator)
+	tokenLen := len(splitted)
+	if tokenLen < 1 {
+		return nil, errors.New("not enough tokens")
+	}
+
+	serializationVersion := splitted[0]
+	switch serializationVersion {
+	case "v1":
+		return parseSerializedStatusV1(splitted)
+	case "v2":
+		return parseSerializedStatusV2(splitted)
+	default:
+		return nil, fmt.Errorf("invalid serialization version %v", serializationVersion)
+	}
+}
+
+func parseSerializedStatusV1(splitted []string) (*serializedStatus, error) {
+	tokenLen := len(splitted)
+
+	// the trailing counters were added later and are optional
+	if tokenLen != 5 && tokenLen != 7 {
+		return nil, errors.New("invalid number of tokens for v1 format")
+	}
+
+	version := splitted[1]
+	versionRaw, err := strconv.Atoi(version)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse version: %w", err)
+	}
+
+	windowTotalRaw, err := strconv.Atoi(splitted[2])
+	if err != nil {
+		return nil, fmt.Errorf("could not parse windowTotal: %w", err)
+	}
+
+	out := serializedStatus{
+		Version:     uint64(versionRaw),
+		WindowTotal: uint64(windowTotalRaw),
+		WasOver:     splitted[3] == "1",
+	}
+
+	if tokenLen == 7 {
+		acceptedCount, err := strconv.ParseUint(splitted[5], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse accepted count: %w", err)
+		}
+		rejectedCount, err := strconv.ParseUint(splitted[6], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse rejected count: %w", err)
+		}
+		out.AcceptedCount = acceptedCount
+		out.RejectedCount = rejectedCount
+	}
+
+	out.Segments, err = parseSerializedSegments(splitted[4])
+	if err != nil {
+		return nil, err
+	}
+
+	return &out, nil
+}
+
+func parseSerializedStatusV2(splitted []string) (*serializedStatus, error) {
+	out := serializedStatus{}
+	versionFound := false
+	var penalties []windowSegment
+
+	for _, token := range splitted[1:] {
+		sepIndex := strings.Index(token, serializationKeyValueSep)
+		if sepIndex < 0 {
+			return nil, fmt.Errorf("invalid token %q for v2 format", token)
+		}
+		key, value := token[:sepIndex], token[sepIndex+1:]
+
+		var err error
+		switch key {
+		case serializationKeyVersion:
+			out.Version, err = strconv.ParseUint(value, 10, 64)
+			versionFound = true
+		case serializationKeyWindowTotal:
+			out.WindowTotal, err = strconv.ParseUint(value, 10, 64)
+		case serializationKeyWasOver:
+			out.WasOver = value == "1"
+		case serializationKeySegments:
+			out.Segments, err = parseSerializedSegments(value)
+		case serializationKeyAcceptedCount:
+			out.AcceptedCount, err = strconv.ParseUint(value, 10, 64)
+		case serializationKeyRejectedCount:
+			out.RejectedCount, err = strconv.ParseUint(value, 10, 64)
+		case serializationKeyMaxLoadOverride:
+			out.MaxLoadOverride, err = strconv.ParseUint(value, 10, 64)
+		case serializationKeyPenalties:
+			penalties, err = parseSerializedSegments(value)
+		default:
+			// written by a newer release, safe to skip
+			continue
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("could not parse %v: %w", key, err)
+		}
+	}
+
+	if !versionFound {
+		return nil, errors.New("missing version for v2 format")
+	}
+
+	// split the penalty portion from the segment values
+	for _, penalty := range penalties {
+		for i := range out.Segments {
+			segment := &out.Segments[i]
+			if segment.StartTime != penalty.StartTime {
+				continue
+			}
+			split := penalty.Value
+			if split > segment.Value {
+				split = segment.Value
+			}
+			segment.Value -= split
+			segment.PenaltyValue = split
+			break
+		}
+	}
+
+	return &out, nil
+}
+
+func parseSerializedSegments(raw string) ([]windowSegment, error) {
+	if raw == "" {
+		return nil, nil
+	}
+
+	splittedSegments := strings.Split(raw, serializationSegmentSeparator)
+	out := make([]windowSegment, len(splittedSegments))
+
+	for i, rawSegment := range splittedSegments {
+		splittedSegment := strings.Split(rawSegment, ":")
+		if len(splittedSegment) != 2 {
+			return nil, fmt.Errorf("invalid format for segment #%d", i)
+		}
+
+		remoteStartTime, err := strconv.Atoi(splittedSegment[0])
+		if err != nil {
+			return nil, fmt.Errorf("could not parse start time for segment %d: %w", i, err)
+		}
+		remoteValue, err := strconv.Atoi(splittedSegment[1])
+		if err != nil {
+			return nil, fmt.Errorf("could not parse value for segment %d: %w", i, err)
+		}
+
+		out[i] = windowSegment{
+			StartTime: uint64(remoteStartTime),
+			Value:     uint64(remoteValue),
+		}
+	}
+
+	return out, nil
+}
+
+const (
+	compactFlagWasOver = 1 << iota
+	compactFlagMaxLoadOverride
+	compactFlagPenalties
+)
+
+// serializeStatusCompact writes the status as a sequence of uvarints:
+// version, window total, flags, accepted and rejected counts,
+// the optional max load override, the number of segments and
+// the segments themselves. Segment start times are delta-encoded
+// against the previous (more recent) segment.
+//
+// When some segment holds penalties, the penalty load of every segment
+// is appended at the end, where releases not aware of it ignore it.
+func serializeStatusCompact(tenant *loadLimiterDefaultImplTenantData) string {
+	qLen := tenant.WindowQueue.Len()
+	buf := make([]byte, 0, 16+4*qLen)
+
+	flags := uint64(0)
+	if tenant.WasOver {
+		flags |= compactFlagWasOver
+	}
+	if tenant.MaxLoadOverride > 0 {
+		flags |= compactFlagMaxLoadOverride
+	}
+	hasPenalties := false
+	for i := 0; i < qLen; i++ {
+		if tenant.WindowQueue.At(i).(*windowSegment).PenaltyValue > 0 {
+			hasPenalties = true
+			flags |= compactFlagPenalties
+			break
+		}
+	}
+
+	buf = appendUvarint(buf, tenant.Version)
+	buf = appendUvarint(buf, tenant.WindowTotal)
+	buf = appendUvarint(buf, flags)
+	buf = appendUvarint(buf, tenant.AcceptedCount)
+	buf = appendUvarint(buf, tenant.RejectedCount)
+	if tenant.MaxLoadOverride > 0 {
+		buf = appendUvarint(buf, tenant.MaxLoadOverride)
+	}
+
+	buf = appendUvarint(buf, uint64(qLen))
+	previousStartTime := uint64(0)
+	for i := 0; i < qLen; i++ {
+		seg := tenant.WindowQueue.At(i).(*windowSegment)
+		if i == 0 {
+			buf = appendUvarint(buf, seg.StartTime)
+		} else {
+			buf = appendUvarint(buf, previousStartTime-seg.StartTime)
+		}
+		buf = appendUvarint(buf, seg.total())
+		previousStartTime = seg.StartTime
+	}
+
+	if hasPenalties {
+		for i := 0; i < qLen; i++ {
+			buf = appendUvarint(buf, tenant.WindowQueue.At(i).(*windowSegment).PenaltyValue)
+		}
+	}
+
+	return serializationCompactPrefix + base64.RawURLEncoding.EncodeToString(buf)
+}
+
+func appendUvarint(buf []byte, v uint64) []byte {
+	var scratch [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(scratch[:], v)
+	return append(buf, scratch[:n]...)
+}
+
+func parseSerializedStatusCompact(encoded string) (*serializedStatus, error) {
+	buf, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode compact format: %w", err)
+	}
+
+	reader := bytes.NewReader(buf)
+	next := func(field string) (uint64, error) {
+		v, err := binary.ReadUvarint(reader)
+		if err != nil {
+			return 0, fmt.Errorf("could not read %v: %w", field, err)
+		}
+		return v, nil
+	}
+
+	out := serializedStatus{}
+	var flags, numSegments uint64
+
+	if out.Version, err = next("version"); err != nil {
+		return nil, err
+	}
+	if out.WindowTotal, err = next("windowTotal"); err != nil {
+		return nil, err
+	}
+	if flags, err = next("flags"); err != nil {
+		return nil, err
+	}
+	out.WasOver = flags&compactFlagWasOver != 0
+	if out.AcceptedCount, err = next("accepted count"); err != nil {
+		return nil, err
+	}
+	if out.RejectedCount, err = next("rejected count"); err != nil {
+		return nil, err
+	}
+	if flags&compactFlagMaxLoadOverride != 0 {
+		if out.MaxLoadOverride, err = next("max load override"); err != nil {
+			return nil, err
+		}
+	}
+
+	if numSegments, err = next("number of segments"); err != nil {
+		return nil, err
+	}
+	// every segment takes at least two bytes
+	if numSegments > uint64(reader.Len()/2) {
+		return nil, fmt.Errorf("invalid number of segments %d for compact format", numSegments)
+	}
+
+	if numSegments > 0 {
+		out.Segments = make([]windowSegment, numSegments)
+	}
+	previousStartTime := uint64(0)
+	for i := range out.Segments {
+		startTime, err := next(fmt.Sprintf("start time for segment %d", i))
+		if err != nil {
+			return nil, err
+		}
+		if i > 0 {
+			startTime = previousStartTime - startTime
+		}
+		value, err := next(fmt.Sprintf("value for segment %d", i))
+		if err != nil {
+			return nil, err
+		}
+		out.Segments[i] = windowSegment{
+			StartTime: startTime,
+			Value:     value,
+		}
+		previousStartTime = startTime
+	}
+
+	if flags&compactFlagPenalties != 0 {
+		for i := range out.Segments {
+			segment := &out.Segments[i]
+			penalty, err := next(fmt.Sprintf("penalty for segment %d", i))
+			if err != nil {
+				return nil, err
+			}
+			if penalty > segment.Value {
+				penalty = segment.Value
+			}
+			segment.Value -= penalty
+			segment.PenaltyValue = penalty
+		}
+	}
+
+	return &out, nil
+}
+
+func (instance *loadLimiterDefaultImpl) restoreSerializedStatus(serialized string, tenant *loadLimiterDefaultImplTenantData) error {
+	parsed, err := parseSerializedStatus(serialized)
+	if err != nil {
+		return err
+	}
+	if err := instance.checkSerializedSegments(parsed); err != nil {
+		return err
+	}
+
+	remoteVersion := parsed.Version
+
+	if tenant.Version == remoteVersion {
+		instance.Logger.Debug("instance version is up to date with serialized data, nothing to do")
+		return nil
+	} else if remoteVersion < tenant.Version {
+		// something bad happened: the remote store lost some writes
+		switch instance.Config.OnStaleRemote {
+		case StaleRemoteKeepLocal:
+			logWarnw(instance.Logger, "serialized instance version is older than current version, keeping the local status",
+				"remoteVersion", remoteVersion,
+				"version", tenant.Version,
+			)
+			return nil
+		case StaleRemoteAcceptRemote:
+			logWarnw(instance.Logger, "serialized instance version is older than current version, accepting the remote status",
+				"remoteVersion", remoteVersion,
+				"version", tenant.Version,
+			)
+		default:
+			return fmt.Errorf("serialized instance version %d is older than current version %d", remoteVersion, tenant.Version)
+		}
+	}
+
+	instance.Logger.Debug("instance version is not up to date with serialized data, hydrating state")
+
+	applySerializedStatus(parsed, tenant)
+	tenant.Version = remoteVersion
+
+	return nil
+}
+
+// checkSerializedSegments guards against statuses holding more segments
+// than a window could, as the remote store is not trusted
+// to hold consistent data and an enormous window would exhaust the memory.
+func (instance *loadLimiterDefaultImpl) checkSerializedSegments(parsed *serializedStatus) error {
+	maxSegments := instance.Config.NumSegments + serializedSegmentsSlack
+	if uint64(len(parsed.Segments)) > maxSegments {
+		return fmt.Errorf("serialized status holds %d segments, more than the maximum of %d", len(parsed.Segments), maxSegments)
+	}
+	return nil
+}
+
+// applySerializedStatus replaces the window of the tenant
+// with the parsed one, leaving the version untouched.
+func applySerializedStatus(parsed *serializedStatus, tenant *loadLimiterDefaultImplTenantData) {
+	q := tenant.WindowQueue
+	q.Clear()
+
+	for i := range parsed.Segments {
+		segment := parsed.Segments[i]
+		q.PushBack(&segment)
+	}
+
+	tenant.WindowTotal = parsed.WindowTotal
+	tenant.WasOver = parsed.WasOver
+	tenant.AcceptedCount = parsed.AcceptedCount
+	tenant.RejectedCount = parsed.RejectedCount
+
+	// overrides are set locally on each instance:
+	// a status written without one does not clear the local override.
+	if parsed.MaxLoadOverride > 0 {
+		tenant.MaxLoadOverride = parsed.MaxLoadOverride
+	}
+}
+
+// ExportTenantState returns the status of the given tenant
+// in the same format written to the SyncAdapter.
+//
+// The exported status can be restored with ImportTenantState,
+// for instance for backups or to migrate tenants between stores.
+func (instance *loadLimiterDefaultImpl) ExportTenantState(tenantKey string) (string, error) {
+	defer instance.lockTenant(tenantKey)()
+
+	if err := instance.validateTenantKey(tenantKey); err != nil {
+		return "", err
+	}
+
+	var out string
+
+	err := instance.withSyncTransaction(func() {
+		out = instance.serializeStatus(tenantKey, instance.getTenant(tenantKey))
+	}, syncTxOptions{
+		TenantKey: tenantKey,
+		ReadOnly:  true,
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	return out, nil
+}
+
+// ImportTenantState replaces the status of the given tenant
+// with one obtained from ExportTenantState or read from a SyncAdapter store,
+// propagating the change through the SyncAdapter if any.
+//
+// The version of the tenant is bumped past both the local and the imported one,
+// so that the imported status prevails even when it is older than the current one.
+func (instance *loadLimiterDefaultImpl) ImportTenantState(tenantKey string, serialized string) error {
+	parsed, err := parseSerializedStatus(serialized)
+	if err != nil {
+		return fmt.Errorf("could not parse serialized status: %w", err)
+	}
+	if err := instance.checkSerializedSegments(parsed); err != nil {
+		return err
+	}
+
+	defer instance.lockTenant(tenantKey)()
+
+	if instance.closed {
+		return ErrLimiterClosed
+	}
+	if err := instance.validateTenantKey(tenantKey); err != nil {
+		return err
+	}
+
+	return instance.withSyncTransaction(func() {
+		tenant := instance.getTenant(tenantKey)
+
+		version := tenant.Version
+		if parsed.Version > version {
+			version = parsed.Version
+		}
+
+		applySerializedStatus(parsed, tenant)
+		tenant.Version = version + 1
+	}, syncTxOptions{
+		TenantKey: tenantKey,
+		ReadOnly:  false,
+	})
+}
@@ -0,0 +1,320 @@
+package goll
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRestoreSerializedStatusV1(t *testing.T) {
+	ti := buildDefaultInstance(t)
+	tenant := ti.Instance.getTenant(defaultTestTenantKey)
+
+	err := ti.Instance.restoreSerializedStatus("v1/4/30/1/1001000:20,1000000:10", tenant)
+	assert.Nil(t, err)
+
+	assert.Equal(t, uint64(4), tenant.Version)
+	assert.True(t, tenant.WasOver)
+	assert.Equal(t, uint64(0), tenant.AcceptedCount)
+	assert.Equal(t, uint64(0), tenant.RejectedCount)
+	ti.AssertWindowStatus(t, defaultTestTenantKey, 30, "1001000:20", "1000000:10")
+
+	// v1 with trailing counters
+	err = ti.Instance.restoreSerializedStatus("v1/5/30/0/1001000:20,1000000:10/3/1", tenant)
+	assert.Nil(t, err)
+
+	assert.Equal(t, uint64(5), tenant.Version)
+	assert.False(t, tenant.WasOver)
+	assert.Equal(t, uint64(3), tenant.AcceptedCount)
+	assert.Equal(t, uint64(1), tenant.RejectedCount)
+}
+
+func TestSerializedStatusV2RoundTrip(t *testing.T) {
+	ti := buildDefaultInstance(t)
+
+	assert.Nil(t, ti.Instance.SetTenantMaxLoad(defaultTestTenantKey, 50))
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 30)).Accepted)
+	ti.TimeTravel(1000)
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 15)).Accepted)
+	assert.False(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 10)).Accepted)
+
+	source := ti.Instance.getTenant(defaultTestTenantKey)
+	serialized := ti.Instance.serializeStatus(defaultTestTenantKey, source)
+
+	assert.Equal(t, "v2/ver=6/total=45/over=1/seg=1001000:15,1000000:30/acc=2/rej=1/max=50", serialized)
+
+	other := buildDefaultInstance(t)
+	target := other.Instance.getTenant(defaultTestTenantKey)
+
+	assert.Nil(t, other.Instance.restoreSerializedStatus(serialized, target))
+
+	assert.Equal(t, source.Version, target.Version)
+	assert.Equal(t, source.WasOver, target.WasOver)
+	assert.Equal(t, uint64(2), target.AcceptedCount)
+	assert.Equal(t, uint64(1), target.RejectedCount)
+	assert.Equal(t, uint64(50), target.MaxLoadOverride)
+	other.AssertWindowStatus(t, defaultTestTenantKey, 45, "1001000:15", "1000000:30")
+}
+
+func TestSerializedStatusV2Compatibility(t *testing.T) {
+	// unknown keys are ignored and missing keys default to zero
+	parsed, err := parseSerializedStatus("v2/ver=7/future=whatever/total=12/seg=1000000:12")
+	assert.Nil(t, err)
+	assert.Equal(t, &serializedStatus{
+		Version:     7,
+		WindowTotal: 12,
+		Segments: []windowSegment{
+			{StartTime: 1000000, Value: 12},
+		},
+	}, parsed)
+
+	// a status without override does not clear the local one
+	ti := buildDefaultInstance(t)
+	assert.Nil(t, ti.Instance.SetTenantMaxLoad(defaultTestTenantKey, 50))
+	tenant := ti.Instance.getTenant(defaultTestTenantKey)
+
+	assert.Nil(t, ti.Instance.restoreSerializedStatus("v2/ver=7/total=12/seg=1000000:12", tenant))
+	assert.Equal(t, uint64(50), tenant.MaxLoadOverride)
+	ti.AssertWindowStatus(t, defaultTestTenantKey, 12, "1000000:12")
+
+	_, err = parseSerializedStatus("v2/total=12")
+	assert.NotNil(t, err)
+
+	_, err = parseSerializedStatus("v2/ver=AAA")
+	assert.NotNil(t, err)
+
+	_, err = parseSerializedStatus("v2/ver")
+	assert.NotNil(t, err)
+
+	_, err = parseSerializedStatus("v3/ver=1")
+	assert.NotNil(t, err)
+}
+
+func TestSerializedStatusCompactRoundTrip(t *testing.T) {
+	ti := buildInstance(t, func(config *Config) {
+		config.SerializationFormat = SerializationCompact
+	})
+
+	assert.Nil(t, ti.Instance.SetTenantMaxLoad(defaultTestTenantKey, 50))
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 30)).Accepted)
+	ti.TimeTravel(3000)
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 15)).Accepted)
+	assert.False(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 10)).Accepted)
+
+	source := ti.Instance.getTenant(defaultTestTenantKey)
+	serialized := ti.Instance.serializeStatus(defaultTestTenantKey, source)
+
+	assert.True(t, strings.HasPrefix(serialized, "c1:"))
+	assert.NotContains(t, serialized, "/")
+	assert.NotContains(t, serialized, ";")
+
+	// the format is detected regardless of the local configuration
+	other := buildDefaultInstance(t)
+	target := other.Instance.getTenant(defaultTestTenantKey)
+
+	assert.Nil(t, other.Instance.restoreSerializedStatus(serialized, target))
+
+	assert.Equal(t, source.Version, target.Version)
+	assert.True(t, target.WasOver)
+	assert.Equal(t, uint64(2), target.AcceptedCount)
+	assert.Equal(t, uint64(1), target.RejectedCount)
+	assert.Equal(t, uint64(50), target.MaxLoadOverride)
+	other.AssertWindowStatus(t, defaultTestTenantKey, 45, "1003000:15", "1000000:30")
+
+	// empty window
+	empty := ti.Instance.getTenant("empty")
+	parsed, err := parseSerializedStatus(ti.Instance.serializeStatus("empty", empty))
+	assert.Nil(t, err)
+	assert.Equal(t, &serializedStatus{Version: empty.Version}, parsed)
+
+	_, err = parseSerializedStatus("c1:!!!")
+	assert.NotNil(t, err)
+
+	// truncated payload
+	_, err = parseSerializedStatus(serialized[:len(serialized)-3])
+	assert.NotNil(t, err)
+}
+
+func TestSerializedStatusWithPenalties(t *testing.T) {
+	for _, format := range []SerializationFormat{SerializationText, SerializationCompact} {
+		ti := buildInstance(t, func(config *Config) {
+			config.OverstepPenaltyFactor = 0.2
+			config.SerializationFormat = format
+		})
+
+		assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 90)).Accepted)
+		ti.TimeTravel(1000)
+		assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 5)).Accepted)
+		assert.False(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 20)).Accepted)
+
+		source := ti.Instance.getTenant(defaultTestTenantKey)
+		serialized := ti.Instance.serializeStatus(defaultTestTenantKey, source)
+
+		if format == SerializationText {
+			assert.Equal(t, "v2/ver=6/total=115/over=1/seg=1001000:25,1000000:90/acc=2/rej=1/pen=1001000:20", serialized)
+		}
+
+		other := buildDefaultInstance(t)
+		target := other.Instance.getTenant(defaultTestTenantKey)
+		assert.Nil(t, other.Instance.restoreSerializedStatus(serialized, target))
+
+		other.AssertWindowStatus(t, defaultTestTenantKey, 115, "1001000:25", "1000000:90")
+		assert.Equal(t, windowSegment{StartTime: 1001000, Value: 5, PenaltyValue: 20}, *target.WindowQueue.At(0).(*windowSegment))
+		assert.Equal(t, windowSegment{StartTime: 1000000, Value: 90}, *target.WindowQueue.At(1).(*windowSegment))
+	}
+
+	// releases not aware of penalties read the whole segment load
+	parsed, err := parseSerializedStatus("v2/ver=6/total=115/seg=1001000:25,1000000:90")
+	assert.Nil(t, err)
+	assert.Equal(t, []windowSegment{
+		{StartTime: 1001000, Value: 25},
+		{StartTime: 1000000, Value: 90},
+	}, parsed.Segments)
+}
+
+func BenchmarkSerializedStatusSize(b *testing.B) {
+	for _, format := range []struct {
+		name   string
+		format SerializationFormat
+	}{
+		{"text", SerializationText},
+		{"compact", SerializationCompact},
+	} {
+		b.Run(format.name, func(b *testing.B) {
+			// 100ms segments over a 60s window
+			ti := buildInstance(nil, func(config *Config) {
+				config.MaxLoad = 1000000
+				config.WindowSize = time.Minute
+				config.WindowSegmentSize = 100 * time.Millisecond
+				config.SerializationFormat = format.format
+			})
+			for i := 0; i < 600; i++ {
+				_, _ = ti.Instance.Submit(defaultTestTenantKey, uint64(100+i))
+				ti.TimeTravel(100)
+			}
+			tenant := ti.Instance.getTenant(defaultTestTenantKey)
+
+			b.ResetTimer()
+
+			var serialized string
+			for i := 0; i < b.N; i++ {
+				serialized = ti.Instance.serializeStatus(defaultTestTenantKey, tenant)
+			}
+
+			b.ReportMetric(float64(len(serialized)), "bytes/status")
+		})
+	}
+}
+
+func TestExportImportTenantState(t *testing.T) {
+	ti := buildDefaultInstance(t)
+
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 30)).Accepted)
+	ti.TimeTravel(1000)
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 15)).Accepted)
+
+	exported, err := ti.Instance.ExportTenantState(defaultTestTenantKey)
+	assert.Nil(t, err)
+	assert.Equal(t, "v2/ver=5/total=45/over=0/seg=1001000:15,1000000:30/acc=2/rej=0", exported)
+
+	// the imported status prevails over a more recent local one
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 20)).Accepted)
+	versionBefore := ti.Instance.getTenant(defaultTestTenantKey).Version
+
+	assert.Nil(t, ti.Instance.ImportTenantState(defaultTestTenantKey, exported))
+	ti.AssertWindowStatus(t, defaultTestTenantKey, 45, "1001000:15", "1000000:30")
+	assert.Equal(t, versionBefore+1, ti.Instance.getTenant(defaultTestTenantKey).Version)
+
+	// the version is bumped past the imported one
+	assert.Nil(t, ti.Instance.ImportTenantState("other", exported))
+	ti.AssertWindowStatus(t, "other", 45, "1001000:15", "1000000:30")
+	assert.Equal(t, uint64(6), ti.Instance.getTenant("other").Version)
+
+	// invalid statuses leave the tenant untouched
+	err = ti.Instance.ImportTenantState(defaultTestTenantKey, "v9/whatever")
+	assert.NotNil(t, err)
+	ti.AssertWindowStatus(t, defaultTestTenantKey, 45, "1001000:15", "1000000:30")
+}
+
+func TestImportTenantStateWithSyncAdapter(t *testing.T) {
+	adapter := testSyncAdapter{}
+	adapter.Clear()
+
+	ti := buildInstance(t, func(config *Config) {
+		config.SyncAdapter = &adapter
+	})
+
+	assert.Nil(t, ti.Instance.ImportTenantState(defaultTestTenantKey, "v2/ver=7/total=10/over=0/seg=1000000:10"))
+
+	// the imported status is written to the remote store
+	assert.Equal(t, "v2/ver=8/total=10/over=0/seg=1000000:10/acc=0/rej=0", adapter.returning[defaultTestTenantKey])
+}
+
+func TestRestoreSerializedStatusWithTooManySegments(t *testing.T) {
+	ti := buildDefaultInstance(t)
+	tenant := ti.Instance.getTenant(defaultTestTenantKey)
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 30)).Accepted)
+
+	segments := func(n int) string {
+		parts := make([]string, n)
+		for i := range parts {
+			parts[i] = fmt.Sprintf("%d:1", 1000000-i*1000)
+		}
+		return strings.Join(parts, ",")
+	}
+
+	// the window holds 10 segments, a couple more are tolerated
+	assert.Nil(t, ti.Instance.restoreSerializedStatus("v2/ver=10/total=12/over=0/seg="+segments(12), tenant))
+	assert.Equal(t, 12, tenant.WindowQueue.Len())
+
+	huge := "v2/ver=20/total=1000/over=0/seg=" + segments(1000)
+
+	err := ti.Instance.restoreSerializedStatus(huge, tenant)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "holds 1000 segments, more than the maximum of 12")
+	assert.Equal(t, uint64(10), tenant.Version)
+	assert.Equal(t, 12, tenant.WindowQueue.Len())
+
+	assert.NotNil(t, ti.Instance.ImportTenantState("other", huge))
+
+	assert.Nil(t, ti.Instance.Restore(map[string]string{"other": huge}))
+	assert.Equal(t, []string{defaultTestTenantKey}, ti.Instance.ListTenants())
+}
+
+func TestRestoreStaleSerializedStatus(t *testing.T) {
+	stale := "v2/ver=2/total=10/over=0/seg=1000000:10"
+
+	ti := buildDefaultInstance(t)
+	tenant := ti.Instance.getTenant(defaultTestTenantKey)
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 30)).Accepted)
+	versionBefore := tenant.Version
+
+	// the default policy reports an error
+	err := ti.Instance.restoreSerializedStatus(stale, tenant)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "is older than current version")
+	ti.AssertWindowStatus(t, defaultTestTenantKey, 30, "1000000:30")
+
+	ti = buildInstance(t, func(config *Config) {
+		config.OnStaleRemote = StaleRemoteKeepLocal
+	})
+	tenant = ti.Instance.getTenant(defaultTestTenantKey)
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 30)).Accepted)
+
+	assert.Nil(t, ti.Instance.restoreSerializedStatus(stale, tenant))
+	ti.AssertWindowStatus(t, defaultTestTenantKey, 30, "1000000:30")
+	assert.Equal(t, versionBefore, tenant.Version)
+
+	ti = buildInstance(t, func(config *Config) {
+		config.OnStaleRemote = StaleRemoteAcceptRemote
+	})
+	tenant = ti.Instance.getTenant(defaultTestTenantKey)
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 30)).Accepted)
+
+	assert.Nil(t, ti.Instance.restoreSerializedStatus(stale, tenant))
+	ti.AssertWindowStatus(t, defaultTestTenantKey, 10, "1000000:10")
+	assert.Equal(t, uint64(2), tenant.Version)
+}
@@ -1,12 +1,14 @@
 package goll
 
 import (
+	"context"
+	"errors"
 	"strings"
 	"time"
 )
 
 type loadLimiterSingleTenantProxy struct {
-	proxied   *loadLimiterDefaultImpl
+	proxied   StandaloneLoadLimiter
 	tenantKey string
 }
 
@@ -19,18 +21,35 @@ var (
 	singleTenantDefaultKey = "$"
 )
 
-func (instance *loadLimiterDefaultImpl) ForTenant(tenantKey string) SingleTenantStandaloneLoadLimiter {
+// validateSingleTenantKey checks that the given key
+// can be used to build a single-tenant proxy.
+func validateSingleTenantKey(tenantKey string) error {
 	if strings.TrimSpace(tenantKey) == "" {
-		panic("tenant key must not be blank")
+		return errors.New("tenant key must not be blank")
 	}
 	if tenantKey == singleTenantDefaultKey {
-		panic("tenant key must not be the reserved identifier: " + singleTenantDefaultKey)
+		return errors.New("tenant key must not be the reserved identifier: " + singleTenantDefaultKey)
+	}
+	return nil
+}
+
+func (instance *loadLimiterDefaultImpl) ForTenant(tenantKey string) SingleTenantStandaloneLoadLimiter {
+	proxy, err := instance.ForTenantSafe(tenantKey)
+	if err != nil {
+		panic(err.Error())
+	}
+	return proxy
+}
+
+func (instance *loadLimiterDefaultImpl) ForTenantSafe(tenantKey string) (SingleTenantStandaloneLoadLimiter, error) {
+	if err := validateSingleTenantKey(tenantKey); err != nil {
+		return nil, err
 	}
 	proxy := loadLimiterSingleTenantProxy{
 		proxied:   instance,
 		tenantKey: tenantKey,
 	}
-	return &proxy
+	return &proxy, nil
 }
 
 func (instance *loadLimiterDefaultImpl) AsSingleTenant() SingleTenantStandaloneLoadLimiter {
@@ -41,6 +60,33 @@ func (instance *loadLimiterDefaultImpl) AsSingleTenant() SingleTenantStandaloneL
 	return &proxy
 }
 
+func (instance *tokenBucketLimiterImpl) ForTenant(tenantKey string) SingleTenantStandaloneLoadLimiter {
+	proxy, err := instance.ForTenantSafe(tenantKey)
+	if err != nil {
+		panic(err.Error())
+	}
+	return proxy
+}
+
+func (instance *tokenBucketLimiterImpl) ForTenantSafe(tenantKey string) (SingleTenantStandaloneLoadLimiter, error) {
+	if err := validateSingleTenantKey(tenantKey); err != nil {
+		return nil, err
+	}
+	proxy := loadLimiterSingleTenantProxy{
+		proxied:   instance,
+		tenantKey: tenantKey,
+	}
+	return &proxy, nil
+}
+
+func (instance *tokenBucketLimiterImpl) AsSingleTenant() SingleTenantStandaloneLoadLimiter {
+	proxy := loadLimiterSingleTenantProxy{
+		proxied:   instance,
+		tenantKey: singleTenantDefaultKey,
+	}
+	return &proxy
+}
+
 func (instance *loadLimiterSingleTenantProxy) Probe(load uint64) (bool, error) {
 	return instance.proxied.Probe(instance.tenantKey, load)
 }
@@ -57,6 +103,18 @@ func (instance *loadLimiterSingleTenantProxy) SubmitUntilWithDetails(load uint64
 	return instance.proxied.SubmitUntilWithDetails(instance.tenantKey, load, timeout)
 }
 
+func (instance *loadLimiterSingleTenantProxy) SubmitUntilCtx(ctx context.Context, load uint64, timeout time.Duration) SubmitUntilResult {
+	return instance.proxied.SubmitUntilCtx(ctx, instance.tenantKey, load, timeout)
+}
+
+func (instance *loadLimiterSingleTenantProxy) SubmitUntilWithOptions(load uint64, options SubmitUntilOptions) SubmitUntilResult {
+	return instance.proxied.SubmitUntilWithOptions(instance.tenantKey, load, options)
+}
+
+func (instance *loadLimiterSingleTenantProxy) SubmitUntilWithBackoff(load uint64, timeout time.Duration, backoff BackoffFunc) SubmitUntilResult {
+	return instance.proxied.SubmitUntilWithBackoff(instance.tenantKey, load, timeout, backoff)
+}
+
 func (instance *loadLimiterSingleTenantProxy) Stats() (RuntimeStatistics, error) {
 	return instance.proxied.Stats(instance.tenantKey)
 }
@@ -66,17 +124,22 @@ func (instance *loadLimiterSingleTenantProxy) IsComposite() bool {
 }
 
 func (instance *compositeLoadLimiterDefaultImpl) ForTenant(tenantKey string) SingleTenantCompositeLoadLimiter {
-	if strings.TrimSpace(tenantKey) == "" {
-		panic("tenant key must not be blank")
+	proxy, err := instance.ForTenantSafe(tenantKey)
+	if err != nil {
+		panic(err.Error())
 	}
-	if tenantKey == singleTenantDefaultKey {
-		panic("tenant key must not be the reserved identifier: " + singleTenantDefaultKey)
+	return proxy
+}
+
+func (instance *compositeLoadLimiterDefaultImpl) ForTenantSafe(tenantKey string) (SingleTenantCompositeLoadLimiter, error) {
+	if err := validateSingleTenantKey(tenantKey); err != nil {
+		return nil, err
 	}
 	proxy := compositeLoadLimiterSingleTenantProxy{
 		proxied:   instance,
 		tenantKey: tenantKey,
 	}
-	return &proxy
+	return &proxy, nil
 }
 
 func (instance *compositeLoadLimiterDefaultImpl) AsSingleTenant() SingleTenantCompositeLoadLimiter {
@@ -103,6 +166,18 @@ func (instance *compositeLoadLimiterSingleTenantProxy) SubmitUntilWithDetails(lo
 	return instance.proxied.SubmitUntilWithDetails(instance.tenantKey, load, timeout)
 }
 
+func (instance *compositeLoadLimiterSingleTenantProxy) SubmitUntilCtx(ctx context.Context, load uint64, timeout time.Duration) SubmitUntilResult {
+	return instance.proxied.SubmitUntilCtx(ctx, instance.tenantKey, load, timeout)
+}
+
+func (instance *compositeLoadLimiterSingleTenantProxy) SubmitUntilWithOptions(load uint64, options SubmitUntilOptions) SubmitUntilResult {
+	return instance.proxied.SubmitUntilWithOptions(instance.tenantKey, load, options)
+}
+
+func (instance *compositeLoadLimiterSingleTenantProxy) SubmitUntilWithBackoff(load uint64, timeout time.Duration, backoff BackoffFunc) SubmitUntilResult {
+	return instance.proxied.SubmitUntilWithBackoff(instance.tenantKey, load, timeout, backoff)
+}
+
 func (instance *compositeLoadLimiterSingleTenantProxy) Stats() (CompositeRuntimeStatistics, error) {
 	return instance.proxied.Stats(instance.tenantKey)
 }
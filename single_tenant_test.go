@@ -34,6 +34,34 @@ func TestSingleTenantConversionFailsWithInvalidTenantKeys(t *testing.T) {
 	})
 }
 
+func TestSingleTenantSafeConversion(t *testing.T) {
+
+	ti := buildDefaultInstance(t)
+	cti := buildDefaultCompositeInstance(t)
+
+	for _, tenantKey := range []string{"", "   ", singleTenantDefaultKey} {
+		proxy, err := ti.Instance.ForTenantSafe(tenantKey)
+		assert.NotNil(t, err)
+		assert.Nil(t, proxy)
+
+		compositeProxy, err := cti.Instance.ForTenantSafe(tenantKey)
+		assert.NotNil(t, err)
+		assert.Nil(t, compositeProxy)
+	}
+
+	_, err := ti.Instance.ForTenantSafe("")
+	assert.Equal(t, "tenant key must not be blank", err.Error())
+
+	proxy, err := ti.Instance.ForTenantSafe(defaultTestTenantKey)
+	assert.Nil(t, err)
+	assert.True(t, submitNoError(proxy.Submit(10)).Accepted)
+	ti.AssertWindowStatus(t, defaultTestTenantKey, 10, "1000000:10")
+
+	compositeProxy, err := cti.Instance.ForTenantSafe(defaultTestTenantKey)
+	assert.Nil(t, err)
+	assert.True(t, submitNoError(compositeProxy.Submit(10)).Accepted)
+}
+
 func TestSingleTenantSubmit(t *testing.T) {
 	ti := buildDefaultInstance(t)
 	instance := ti.Instance.AsSingleTenant()
@@ -114,8 +142,14 @@ func TestSingleTenantStats(t *testing.T) {
 	stats, err := instance.Stats()
 	assert.Nil(t, err)
 	assert.Equal(t, RuntimeStatistics{
-		WindowTotal:    uint64(10),
-		WindowSegments: []uint64{10},
+		WindowTotal:            uint64(10),
+		WindowSegments:         []uint64{10},
+		WindowSegmentPenalties: []uint64{0},
+		WindowSegmentTimes:     []uint64{1000000},
+		MaxLoad:                uint64(100),
+		MaxPenaltyCap:          uint64(150),
+		UtilizationPercent:     float64(10),
+		AcceptedCount:          uint64(1),
 	}, stats)
 
 	ti.TimeTravel(500) // goto 1000500
@@ -125,8 +159,14 @@ func TestSingleTenantStats(t *testing.T) {
 	stats, err = instance.Stats()
 	assert.Nil(t, err)
 	assert.Equal(t, RuntimeStatistics{
-		WindowTotal:    uint64(20),
-		WindowSegments: []uint64{20},
+		WindowTotal:            uint64(20),
+		WindowSegments:         []uint64{20},
+		WindowSegmentPenalties: []uint64{0},
+		WindowSegmentTimes:     []uint64{1000000},
+		MaxLoad:                uint64(100),
+		MaxPenaltyCap:          uint64(150),
+		UtilizationPercent:     float64(20),
+		AcceptedCount:          uint64(2),
 	}, stats)
 
 	ti.TimeTravel(500) // goto 1001000
@@ -136,8 +176,14 @@ func TestSingleTenantStats(t *testing.T) {
 	stats, err = instance.Stats()
 	assert.Nil(t, err)
 	assert.Equal(t, RuntimeStatistics{
-		WindowTotal:    uint64(50),
-		WindowSegments: []uint64{30, 20},
+		WindowTotal:            uint64(50),
+		WindowSegments:         []uint64{30, 20},
+		WindowSegmentPenalties: []uint64{0, 0},
+		WindowSegmentTimes:     []uint64{1001000, 1000000},
+		MaxLoad:                uint64(100),
+		MaxPenaltyCap:          uint64(150),
+		UtilizationPercent:     float64(50),
+		AcceptedCount:          uint64(3),
 	}, stats)
 
 	ti.TimeTravel(999) // goto 1001999
@@ -163,8 +209,14 @@ func TestSingleTenantStats(t *testing.T) {
 	stats, err = instance.Stats()
 	assert.Nil(t, err)
 	assert.Equal(t, RuntimeStatistics{
-		WindowTotal:    uint64(0),
-		WindowSegments: []uint64{0, 0, 0},
+		WindowTotal:            uint64(0),
+		WindowSegments:         []uint64{0, 0, 0},
+		WindowSegmentPenalties: []uint64{0, 0, 0},
+		WindowSegmentTimes:     []uint64{1011000, 1010000, 1002000},
+		MaxLoad:                uint64(100),
+		MaxPenaltyCap:          uint64(150),
+		UtilizationPercent:     float64(0),
+		AcceptedCount:          uint64(4),
 	}, stats)
 
 }
@@ -0,0 +1,162 @@
+package goll
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Snapshot returns the serialized status of every tenant
+// held by the local instance, indexed by tenant key.
+//
+// The statuses use the same format written to the SyncAdapter
+// and can be restored with Restore, for instance
+// to persist the limiter across restarts without a SyncAdapter.
+func (instance *loadLimiterDefaultImpl) Snapshot() (map[string]string, error) {
+	instance.Lock.Lock()
+	defer instance.Lock.Unlock()
+
+	if instance.closed {
+		return nil, ErrLimiterClosed
+	}
+
+	out := make(map[string]string, len(instance.TenantData))
+	for _, tenantKey := range instance.listTenants() {
+		out[tenantKey] = instance.serializeStatus(tenantKey, instance.getTenant(tenantKey))
+	}
+
+	return out, nil
+}
+
+// Restore rebuilds the state of the tenants from a map
+// obtained via Snapshot, replacing their current state.
+//
+// Entries that can't be parsed or have an invalid tenant key are logged and skipped.
+// Tenants missing from the map are left untouched.
+func (instance *loadLimiterDefaultImpl) Restore(snapshot map[string]string) error {
+	instance.Lock.Lock()
+	defer instance.Lock.Unlock()
+
+	if instance.closed {
+		return ErrLimiterClosed
+	}
+
+	for tenantKey, serialized := range snapshot {
+		if err := instance.validateTenantKey(tenantKey); err != nil {
+			logWarnw(instance.Logger, "skipping invalid tenant key on restore",
+				"tenantKey", tenantKey,
+				"error", err,
+			)
+			continue
+		}
+
+		parsed, err := parseSerializedStatus(serialized)
+		if err == nil {
+			err = instance.checkSerializedSegments(parsed)
+		}
+		if err != nil {
+			logWarnw(instance.Logger, "skipping tenant with invalid serialized status on restore",
+				"tenantKey", tenantKey,
+				"error", err,
+			)
+			continue
+		}
+
+		instance.restoreTenant(tenantKey, parsed)
+	}
+
+	return nil
+}
+
+// restoreTenant replaces the state of the given tenant,
+// including its version, with the parsed one.
+func (instance *loadLimiterDefaultImpl) restoreTenant(tenantKey string, parsed *serializedStatus) {
+	tenant := instance.getTenant(tenantKey)
+	applySerializedStatus(parsed, tenant)
+	tenant.Version = parsed.Version
+}
+
+// Snapshot returns the serialized status of every tenant
+// held by the local instance, indexed by tenant key.
+//
+// Each status joins the ones of the composed limiters
+// with the same format written to the SyncAdapter.
+func (instance *compositeLoadLimiterDefaultImpl) Snapshot() (map[string]string, error) {
+	instance.Lock.Lock()
+	defer instance.Lock.Unlock()
+
+	if instance.closed {
+		return nil, ErrLimiterClosed
+	}
+
+	tenantKeys := instance.listTenants()
+
+	out := make(map[string]string, len(tenantKeys))
+	for _, tenantKey := range tenantKeys {
+		out[tenantKey] = instance.serializeStatus(tenantKey)
+	}
+
+	return out, nil
+}
+
+// Restore rebuilds the state of the tenants from a map
+// obtained via Snapshot, replacing their current state.
+//
+// Entries that can't be parsed or have an invalid tenant key are logged and skipped.
+// Tenants missing from the map are left untouched.
+func (instance *compositeLoadLimiterDefaultImpl) Restore(snapshot map[string]string) error {
+	instance.Lock.Lock()
+	defer instance.Lock.Unlock()
+
+	if instance.closed {
+		return ErrLimiterClosed
+	}
+
+	for tenantKey, serialized := range snapshot {
+		if err := instance.validateTenantKey(tenantKey); err != nil {
+			logWarnw(instance.Logger, "skipping invalid tenant key on restore",
+				"tenantKey", tenantKey,
+				"error", err,
+			)
+			continue
+		}
+
+		parsed, err := instance.parseSerializedStatus(serialized)
+		if err != nil {
+			logWarnw(instance.Logger, "skipping tenant with invalid serialized status on restore",
+				"tenantKey", tenantKey,
+				"error", err,
+			)
+			continue
+		}
+
+		for i, limiter := range instance.Limiters {
+			limiter.restoreTenant(instance.limiterTenantKey(i, tenantKey), parsed[i])
+		}
+	}
+
+	return nil
+}
+
+// parseSerializedStatus parses the joined status of all the composed limiters,
+// failing if any of them is invalid.
+func (instance *compositeLoadLimiterDefaultImpl) parseSerializedStatus(serialized string) ([]*serializedStatus, error) {
+	statusSplit := strings.Split(serialized, ";")
+	if len(statusSplit) != len(instance.Limiters) {
+		return nil, errors.New("invalid number of sublimiters")
+	}
+
+	out := make([]*serializedStatus, len(statusSplit))
+	for i, status := range statusSplit {
+		parsed, err := parseSerializedStatus(status)
+		if err == nil {
+			err = instance.Limiters[i].checkSerializedSegments(parsed)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid status for limiter at index %d: %w", i, err)
+		}
+		out[i] = parsed
+	}
+
+	return out, nil
+}
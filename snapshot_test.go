@@ -0,0 +1,75 @@
+package goll
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnapshotRestore(t *testing.T) {
+	ti := buildDefaultInstance(t)
+
+	assert.True(t, submitNoError(ti.Instance.Submit("a", 30)).Accepted)
+	ti.TimeTravel(1000)
+	assert.True(t, submitNoError(ti.Instance.Submit("a", 15)).Accepted)
+	assert.True(t, submitNoError(ti.Instance.Submit("b", 7)).Accepted)
+
+	snapshot, err := ti.Instance.Snapshot()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(snapshot))
+
+	// invalid entries are skipped
+	snapshot["invalid"] = "v9/whatever"
+
+	restored := buildDefaultInstance(t)
+	restored.TimeSet(ti.CurrentTime)
+	assert.Nil(t, restored.Instance.Restore(snapshot))
+
+	assert.ElementsMatch(t, []string{"a", "b"}, restored.Instance.ListTenants())
+	restored.AssertWindowStatus(t, "a", 45, "1001000:15", "1000000:30")
+	restored.AssertWindowStatus(t, "b", 7, "1001000:7")
+	assert.Equal(t, ti.Instance.getTenant("a").Version, restored.Instance.getTenant("a").Version)
+
+	// the restored limiter keeps working from the restored state
+	assert.True(t, submitNoError(restored.Instance.Submit("a", 55)).Accepted)
+	assert.False(t, submitNoError(restored.Instance.Submit("a", 1)).Accepted)
+
+	assert.Nil(t, restored.Instance.Close())
+	_, err = restored.Instance.Snapshot()
+	assert.ErrorIs(t, err, ErrLimiterClosed)
+	assert.ErrorIs(t, restored.Instance.Restore(snapshot), ErrLimiterClosed)
+}
+
+func TestCompositeSnapshotRestore(t *testing.T) {
+	configurer := func(config *CompositeConfig) {
+		config.Limiters[1].Global = true
+	}
+	ti := buildCompositeInstance(t, configurer)
+
+	assert.True(t, submitNoError(ti.Instance.Submit("a", 5)).Accepted)
+	assert.True(t, submitNoError(ti.Instance.Submit("b", 7)).Accepted)
+
+	snapshot, err := ti.Instance.Snapshot()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(snapshot))
+	assert.Equal(t, 2, len(strings.Split(snapshot["a"], ";")))
+
+	// entries with an invalid sublimiter status are skipped entirely
+	snapshot["invalid"] = snapshot["a"] + ";v9/whatever"
+
+	restored := buildCompositeInstance(t, configurer)
+	assert.Nil(t, restored.Instance.Restore(snapshot))
+
+	assert.ElementsMatch(t, []string{"a", "b"}, restored.Instance.ListTenants())
+
+	stats, err := restored.Instance.Stats("a")
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(5), stats.LimitersStats[0].WindowTotal)
+	// the global limiter holds the load of all the tenants
+	assert.Equal(t, uint64(12), stats.LimitersStats[1].WindowTotal)
+
+	stats, err = restored.Instance.Stats("b")
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(7), stats.LimitersStats[0].WindowTotal)
+}
@@ -1,8 +1,11 @@
 package goll
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"math"
+	"sync/atomic"
 	"time"
 )
 
@@ -14,10 +17,24 @@ import (
 // the RetryInAvailable field will be true and the RetryIn field
 // will be the amount the client is required to wait
 // before resubmitting a request for the same load.
+//
+// If the requested load is over the effective MaxLoad
+// the request could never be accepted: the PermanentlyRejected field
+// will be true and the client should stop retrying.
+//
+// When the request is rejected by a composite limiter,
+// the RejectedBy field holds the indices of the composed limiters
+// that rejected it, in the same order they were configured.
 type SubmitResult struct {
-	Accepted         bool
-	RetryInAvailable bool
-	RetryIn          time.Duration
+	Accepted            bool
+	RetryInAvailable    bool
+	RetryIn             time.Duration
+	PermanentlyRejected bool
+	RejectedBy          []int
+
+	// SyncWarnings holds the synchronization errors
+	// that were tolerated because StrictSync is disabled.
+	SyncWarnings []error
 }
 
 // SubmitUntilResult holds the result of a load request
@@ -39,9 +56,44 @@ type SubmitUntilResult struct {
 	Error          error
 }
 
+// SubmitUntilOptions holds the options for a load request
+// automatically handled and optionally retried via SubmitUntilWithOptions.
+type SubmitUntilOptions struct {
+	// Timeout is the maximum amount of time to wait for the load to be accepted.
+	Timeout time.Duration
+
+	// MaxAttempts, when provided, is the maximum number of submissions
+	// to be attempted before failing with a LoadRequestTimeout error,
+	// even if the Timeout was not reached yet.
+	// Zero means unlimited attempts.
+	MaxAttempts uint64
+
+	// Backoff, when provided, computes the time to wait before each retry
+	// from the RetryIn of the rejection, for instance adding an extra wait
+	// to reduce the contention. Waits shorter than RetryIn are raised to RetryIn.
+	Backoff BackoffFunc
+}
+
+// BackoffFunc computes the time to wait before a retry,
+// given the number of attempts made so far and the RetryIn of the last rejection.
+type BackoffFunc func(attempt uint64, retryIn time.Duration) time.Duration
+
+// retryWait returns the time to wait before the next attempt.
+func (options SubmitUntilOptions) retryWait(attempt uint64, retryIn time.Duration) time.Duration {
+	if options.Backoff == nil {
+		return retryIn
+	}
+	if wait := options.Backoff(attempt, retryIn); wait > retryIn {
+		return wait
+	}
+	return retryIn
+}
+
 func (s *SubmitResult) String() string {
 	if s.Accepted {
 		return "LoadRequestSubmitResult[Accepted]"
+	} else if s.PermanentlyRejected {
+		return "LoadRequestSubmitResult[Rejected, Permanently]"
 	} else if s.RetryInAvailable {
 		return fmt.Sprintf("LoadRequestSubmitResult[Rejected, RetryIn: %v ms]", s.RetryIn.Milliseconds())
 	} else {
@@ -56,67 +108,679 @@ type submitRequest struct {
 	RequestedLoad           uint64
 	RequestedTimestamp      uint64
 	RequestSegmentStartTime uint64
+
+	// DryRun marks requests evaluated on a throwaway copy of the tenant data,
+	// for which no hook should be called.
+	DryRun bool
 }
 
 func (instance *loadLimiterDefaultImpl) buildLoadRequest(timestamp time.Time, tenantKey string, load uint64) *submitRequest {
 	t := uint64(timestamp.UnixMilli())
 
+	tenant := instance.getTenant(tenantKey)
+	if t > tenant.LastAccess {
+		tenant.LastAccess = t
+	}
+
+	return &submitRequest{
+		TenantKey:               tenantKey,
+		TenantData:              tenant,
+		RequestedLoad:           instance.quantizeLoad(load),
+		RequestedTimestamp:      t,
+		RequestSegmentStartTime: instance.locateSegmentStartTime(t),
+	}
+}
+
+// buildDetachedLoadRequest builds a request working on a throwaway copy of the tenant data,
+// or on an empty one if the tenant has no state yet,
+// so that evaluating it never changes the limiter state, the last access time included.
+func (instance *loadLimiterDefaultImpl) buildDetachedLoadRequest(timestamp time.Time, tenantKey string, load uint64) *submitRequest {
+	t := uint64(timestamp.UnixMilli())
+
+	var tenant *loadLimiterDefaultImplTenantData
+	if existing, exists := instance.lookupTenant(tenantKey); exists {
+		tenant = instance.detachedTenantCopy(existing)
+	} else {
+		tenant = instance.newTenantData()
+	}
+
 	return &submitRequest{
 		TenantKey:               tenantKey,
-		TenantData:              instance.getTenant(tenantKey),
-		RequestedLoad:           load,
+		TenantData:              tenant,
+		RequestedLoad:           instance.quantizeLoad(load),
 		RequestedTimestamp:      t,
 		RequestSegmentStartTime: instance.locateSegmentStartTime(t),
+		DryRun:                  true,
 	}
 }
 
+// quantizeLoad rounds the given load up
+// to the nearest multiple of the configured LoadQuantum.
+func (instance *loadLimiterDefaultImpl) quantizeLoad(load uint64) uint64 {
+	quantum := instance.Config.LoadQuantum
+	if quantum <= 1 {
+		return load
+	}
+	remainder := load % quantum
+	if remainder == 0 {
+		return load
+	}
+	if load > math.MaxUint64-(quantum-remainder) {
+		// would overflow. such a load would be rejected anyway.
+		return math.MaxUint64
+	}
+	return load + quantum - remainder
+}
+
 // Probe checks if the given load would be allowed right now.
 // it is a readonly method that does not modify the current window data.
 func (instance *loadLimiterDefaultImpl) Probe(tenantKey string, load uint64) (bool, error) {
+	if err := instance.validateTenantKey(tenantKey); err != nil {
+		return false, err
+	}
+
 	t := instance.currentTime()
 
-	instance.Lock.Lock()
-	defer instance.Lock.Unlock()
+	if result, ok, err := instance.probeShared(t, tenantKey, load); ok {
+		return result, err
+	}
+
+	return instance.probeExclusive(t, tenantKey, load)
+}
+
+// probeShared evaluates the given load holding only the read lock,
+// allowing concurrent probes.
+// It returns ok = false when the exclusive lock is required,
+// that is when the tenant is synchronized, has a parent, does not exist yet
+// or its window needs to be rotated.
+func (instance *loadLimiterDefaultImpl) probeShared(t time.Time, tenantKey string, load uint64) (result bool, ok bool, err error) {
+	if instance.syncAdapterFor(tenantKey) != nil {
+		return false, false, nil
+	}
+	if _, hasParent := instance.parentTenantKey(tenantKey); hasParent {
+		return false, false, nil
+	}
+
+	defer instance.rlockTenant(tenantKey)()
+
+	if instance.closed {
+		return false, true, ErrLimiterClosed
+	}
+
+	tenant, exists := instance.lookupTenant(tenantKey)
+	if !exists {
+		return false, false, nil
+	}
+
+	timestamp := uint64(t.UnixMilli())
+	req := &submitRequest{
+		TenantKey:               tenantKey,
+		TenantData:              tenant,
+		RequestedLoad:           instance.quantizeLoad(load),
+		RequestedTimestamp:      timestamp,
+		RequestSegmentStartTime: instance.locateSegmentStartTime(timestamp),
+	}
+
+	if instance.rotationNeeded(req) {
+		return false, false, nil
+	}
+
+	// other readers may be updating the access time concurrently
+	for {
+		lastAccess := atomic.LoadUint64(&tenant.LastAccess)
+		if timestamp <= lastAccess || atomic.CompareAndSwapUint64(&tenant.LastAccess, lastAccess, timestamp) {
+			break
+		}
+	}
+
+	if instance.drainingFor(req) > 0 {
+		return false, true, nil
+	}
+
+	totalWouldBe := instance.aggregateLoad(tenant, req.RequestSegmentStartTime, 0, req.RequestedLoad)
+
+	return totalWouldBe <= instance.maxLoad(req), true, nil
+}
+
+func (instance *loadLimiterDefaultImpl) probeExclusive(t time.Time, tenantKey string, load uint64) (bool, error) {
+	parentKey, hasParent, unlock := instance.lockTenantAndParent(tenantKey)
+	defer unlock()
+
+	if instance.closed {
+		return false, ErrLimiterClosed
+	}
+	if err := instance.validateTenantAndParentKeys(tenantKey, parentKey, hasParent); err != nil {
+		return false, err
+	}
 
 	var result bool
 
-	err := instance.withSyncTransaction(func() {
+	_, err := instance.runParentSyncTransaction(func() {
 		req := instance.buildLoadRequest(t, tenantKey, load)
 
 		result = instance.probe(req)
+		if result && hasParent {
+			result = instance.probe(instance.buildLoadRequest(t, parentKey, load))
+		}
+	}, tenantKey, parentKey, hasParent, true)
+
+	if err != nil {
+		return false, err
+	}
+
+	return result, nil
+}
+
+// ProbeReadOnly checks if the given load would be allowed right now
+// like Probe does, but evaluates it against the window as it is,
+// without rotating it: the segments that would slide out of the window
+// are excluded from the total instead of being removed.
+//
+// The tenant state is never changed, not even its last access time,
+// so it never causes a write to the SyncAdapter.
+func (instance *loadLimiterDefaultImpl) ProbeReadOnly(tenantKey string, load uint64) (bool, error) {
+	if err := instance.validateTenantKey(tenantKey); err != nil {
+		return false, err
+	}
+
+	t := instance.currentTime()
+
+	_, hasParent := instance.parentTenantKey(tenantKey)
+
+	if !hasParent && instance.syncAdapterFor(tenantKey) == nil {
+		defer instance.rlockTenant(tenantKey)()
+
+		if instance.closed {
+			return false, ErrLimiterClosed
+		}
+		return instance.probeAsIs(t, tenantKey, load), nil
+	}
+
+	// the remote status has to be restored under the exclusive lock
+	parentKey, hasParent, unlock := instance.lockTenantAndParent(tenantKey)
+	defer unlock()
+
+	if instance.closed {
+		return false, ErrLimiterClosed
+	}
+	if err := instance.validateTenantAndParentKeys(tenantKey, parentKey, hasParent); err != nil {
+		return false, err
+	}
+
+	var result bool
+
+	_, err := instance.runParentSyncTransaction(func() {
+		result = instance.probeAsIs(t, tenantKey, load)
+		if result && hasParent {
+			result = instance.probeAsIs(t, parentKey, load)
+		}
+	}, tenantKey, parentKey, hasParent, true)
+
+	if err != nil {
+		return false, err
+	}
+
+	return result, nil
+}
+
+// probeAsIs evaluates the given load without rotating the window
+// nor creating any tenant state.
+func (instance *loadLimiterDefaultImpl) probeAsIs(t time.Time, tenantKey string, load uint64) bool {
+	tenant, exists := instance.lookupTenant(tenantKey)
+	if !exists {
+		// a tenant without state holds an empty window
+		tenant = &loadLimiterDefaultImplTenantData{}
+	}
+
+	timestamp := uint64(t.UnixMilli())
+	req := &submitRequest{
+		TenantKey:               tenantKey,
+		TenantData:              tenant,
+		RequestedLoad:           instance.quantizeLoad(load),
+		RequestedTimestamp:      timestamp,
+		RequestSegmentStartTime: instance.locateSegmentStartTime(timestamp),
+	}
+
+	if instance.drainingFor(req) > 0 {
+		return false
+	}
+
+	return instance.aggregateLoadAsIs(req) <= instance.maxLoad(req)
+}
+
+// ProbeMany checks which of the given loads would be allowed right now,
+// returning the results in the same order of the loads.
+// All the loads are evaluated independently against the same instant.
+// it is a readonly method that does not modify the current window data.
+func (instance *loadLimiterDefaultImpl) ProbeMany(tenantKey string, loads []uint64) ([]bool, error) {
+	if len(loads) == 0 {
+		return nil, errors.New("ProbeMany requires at least one load")
+	}
+
+	t := instance.currentTime()
+
+	parentKey, hasParent, unlock := instance.lockTenantAndParent(tenantKey)
+	defer unlock()
+
+	if instance.closed {
+		return nil, ErrLimiterClosed
+	}
+	if err := instance.validateTenantAndParentKeys(tenantKey, parentKey, hasParent); err != nil {
+		return nil, err
+	}
+
+	var out []bool
+
+	_, err := instance.runParentSyncTransaction(func() {
+		out = instance.probeManyOn(t, tenantKey, loads)
+
+		// the loads are charged to the parent too
+		if hasParent {
+			for i, fits := range instance.probeManyOn(t, parentKey, loads) {
+				out[i] = out[i] && fits
+			}
+		}
+	}, tenantKey, parentKey, hasParent, true)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// probeManyOn evaluates the given loads against the window of the given tenant,
+// returning the outcomes in the same order of the loads.
+func (instance *loadLimiterDefaultImpl) probeManyOn(t time.Time, tenantKey string, loads []uint64) []bool {
+	out := make([]bool, len(loads))
+
+	req := instance.buildLoadRequest(t, tenantKey, 0)
+
+	// the window is rotated once for all the loads
+	instance.rotateWindow(req)
+	if instance.drainingFor(req) > 0 {
+		return out
+	}
+
+	maxLoad := instance.maxLoad(req)
+	for i, load := range loads {
+		totalWouldBe := instance.aggregateLoad(req.TenantData, req.RequestSegmentStartTime, 0, instance.quantizeLoad(load))
+		out[i] = totalWouldBe <= maxLoad
+	}
+	return out
+}
+
+// ProbeWithDetails checks if the given load would be allowed right now,
+// returning the same details that a Submit would return.
+// it is a readonly method that does not modify the current window data
+// and never applies penalties.
+func (instance *loadLimiterDefaultImpl) ProbeWithDetails(tenantKey string, load uint64) (SubmitResult, error) {
+	t := instance.currentTime()
+
+	parentKey, hasParent, unlock := instance.lockTenantAndParent(tenantKey)
+	defer unlock()
+
+	if instance.closed {
+		return SubmitResult{}, ErrLimiterClosed
+	}
+	if err := instance.validateTenantAndParentKeys(tenantKey, parentKey, hasParent); err != nil {
+		return SubmitResult{}, err
+	}
+
+	var res SubmitResult
+
+	_, err := instance.runParentSyncTransaction(func() {
+		rejection := instance.probeDetached(t, tenantKey, load)
+
+		// the load is charged to the parent too
+		var parentRejection *SubmitResult
+		if hasParent {
+			parentRejection = instance.probeDetached(t, parentKey, load)
+		}
+
+		if rejection == nil && parentRejection == nil {
+			res = SubmitResult{
+				Accepted: true,
+			}
+			return
+		}
+		res = combineRejections(rejection, parentRejection)
+	}, tenantKey, parentKey, hasParent, true)
+
+	if err != nil {
+		return SubmitResult{}, err
+	}
+
+	return res, nil
+}
+
+// probeDetached evaluates the given load without applying penalties,
+// returning nil if it would be accepted or the details of the rejection otherwise.
+func (instance *loadLimiterDefaultImpl) probeDetached(t time.Time, tenantKey string, load uint64) *SubmitResult {
+	req := instance.buildLoadRequest(t, tenantKey, load)
+
+	// work on a throwaway copy so that window rotation
+	// does not change the limiter state.
+	req.TenantData = instance.detachedTenantCopy(req.TenantData)
+
+	if instance.probe(req) {
+		return nil
+	}
+
+	res := &SubmitResult{
+		Accepted:            false,
+		PermanentlyRejected: req.RequestedLoad > instance.maxLoad(req),
+	}
+	if !res.PermanentlyRejected && !instance.Config.SkipRetryInComputing {
+		if retryIn, err := instance.computeRetryIn(req); err == nil {
+			res.RetryInAvailable = true
+			res.RetryIn = retryIn
+		}
+	}
+	return res
+}
+
+// TimeToAvailable returns how long the caller would have to wait
+// before the given load gets accepted, without submitting anything.
+// A zero duration is returned if the load would be accepted right now.
+func (instance *loadLimiterDefaultImpl) TimeToAvailable(tenantKey string, load uint64) (time.Duration, error) {
+	if instance.Config.SkipRetryInComputing {
+		return 0, errors.New("TimeToAvailable is not supported when SkipRetryInComputing is enabled")
+	}
+
+	return instance.timeToAvailableAt(instance.currentTime(), tenantKey, load)
+}
+
+// NextAvailableAt returns the earliest time at which the given load
+// would be accepted, without submitting anything.
+// The current time is returned if the load would be accepted right now.
+func (instance *loadLimiterDefaultImpl) NextAvailableAt(tenantKey string, load uint64) (time.Time, error) {
+	if instance.Config.SkipRetryInComputing {
+		return time.Time{}, errors.New("NextAvailableAt is not supported when SkipRetryInComputing is enabled")
+	}
+
+	t := instance.currentTime()
+
+	result, err := instance.timeToAvailableAt(t, tenantKey, load)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return t.Add(result), nil
+}
+
+// timeToAvailableAt computes how long the caller would have to wait,
+// starting from the given time, before the given load gets accepted.
+func (instance *loadLimiterDefaultImpl) timeToAvailableAt(t time.Time, tenantKey string, load uint64) (time.Duration, error) {
+	defer instance.lockTenant(tenantKey)()
+
+	if instance.closed {
+		return 0, ErrLimiterClosed
+	}
+	if err := instance.validateTenantKey(tenantKey); err != nil {
+		return 0, err
+	}
+
+	var result time.Duration
+	var resultErr error
+
+	err := instance.withSyncTransaction(func() {
+		req := instance.buildLoadRequest(t, tenantKey, load)
+
+		if instance.probe(req) {
+			return
+		}
+		// the actual time is returned regardless of MaxRetryIn
+		result, resultErr = instance.timeToAvailable(req)
 	}, syncTxOptions{
 		TenantKey: tenantKey,
 		ReadOnly:  true,
 	})
 
 	if err != nil {
-		return false, err
+		return 0, err
+	}
+
+	return result, resultErr
+}
+
+// RemainingCapacity returns how much load the tenant could submit right now,
+// that is MaxLoad minus the current load in the window, clamped at zero.
+// it is a readonly method that does not modify the current window data.
+func (instance *loadLimiterDefaultImpl) RemainingCapacity(tenantKey string) (uint64, error) {
+	t := instance.currentTime()
+
+	parentKey, hasParent, unlock := instance.lockTenantAndParent(tenantKey)
+	defer unlock()
+
+	if instance.closed {
+		return 0, ErrLimiterClosed
+	}
+	if err := instance.validateTenantAndParentKeys(tenantKey, parentKey, hasParent); err != nil {
+		return 0, err
+	}
+
+	var result uint64
+
+	_, err := instance.runParentSyncTransaction(func() {
+		result = instance.remainingCapacity(t, tenantKey)
+
+		// the load is charged to the parent too
+		if hasParent {
+			if parentRemaining := instance.remainingCapacity(t, parentKey); parentRemaining < result {
+				result = parentRemaining
+			}
+		}
+	}, tenantKey, parentKey, hasParent, true)
+
+	if err != nil {
+		return 0, err
 	}
 
 	return result, nil
 }
 
+// remainingCapacity computes the remaining capacity of the tenant
+// on a throwaway copy so that window rotation does not change the limiter state.
+func (instance *loadLimiterDefaultImpl) remainingCapacity(t time.Time, tenantKey string) uint64 {
+	req := instance.buildLoadRequest(t, tenantKey, 0)
+	req.TenantData = instance.detachedTenantCopy(req.TenantData)
+
+	instance.rotateWindow(req)
+
+	if instance.drainingFor(req) > 0 {
+		return 0
+	}
+
+	current := instance.aggregateLoad(req.TenantData, req.RequestSegmentStartTime, 0, 0)
+	maxLoad := instance.maxLoad(req)
+	if current >= maxLoad {
+		return 0
+	}
+	return maxLoad - current
+}
+
+// CurrentRate returns the average load rate of the tenant over the window,
+// that is the load held by the window divided by the WindowSize in seconds.
+// Penalties are included, as they count towards the max load.
+// it is a readonly method that does not modify the current window data,
+// nor creates any state or updates the last access time of the tenant.
+func (instance *loadLimiterDefaultImpl) CurrentRate(tenantKey string) (float64, error) {
+	t := instance.currentTime()
+
+	defer instance.lockTenant(tenantKey)()
+
+	if instance.closed {
+		return 0, ErrLimiterClosed
+	}
+	if err := instance.validateTenantKey(tenantKey); err != nil {
+		return 0, err
+	}
+
+	var result float64
+
+	tenant := instance.lookupTenantOrEmpty(tenantKey)
+
+	err := instance.withSyncTransaction(func() {
+		result = instance.tenantRate(t, tenantKey, tenant)
+	}, syncTxOptions{
+		TenantKey:  tenantKey,
+		TenantData: tenant,
+		ReadOnly:   true,
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	return result, nil
+}
+
+// currentRate computes the load rate of the tenant,
+// returning zero for tenants with no state.
+func (instance *loadLimiterDefaultImpl) currentRate(t time.Time, tenantKey string) float64 {
+	tenant, exists := instance.lookupTenant(tenantKey)
+	if !exists {
+		return 0
+	}
+	return instance.tenantRate(t, tenantKey, tenant)
+}
+
+// tenantRate computes the load rate of the given tenant data
+// on a throwaway copy so that window rotation does not change the limiter state.
+func (instance *loadLimiterDefaultImpl) tenantRate(t time.Time, tenantKey string, tenant *loadLimiterDefaultImplTenantData) float64 {
+	timestamp := uint64(t.UnixMilli())
+	req := &submitRequest{
+		TenantKey:               tenantKey,
+		TenantData:              instance.detachedTenantCopy(tenant),
+		RequestedTimestamp:      timestamp,
+		RequestSegmentStartTime: instance.locateSegmentStartTime(timestamp),
+	}
+
+	instance.rotateWindow(req)
+
+	return float64(req.TenantData.WindowTotal) / (float64(instance.Config.WindowSize) / 1000.0)
+}
+
+// WindowBounds returns the time range covered by the current window of the tenant,
+// from the start of its oldest segment to the end of the most recent one.
+// it is a readonly method that does not modify the current window data.
+func (instance *loadLimiterDefaultImpl) WindowBounds(tenantKey string) (time.Time, time.Time, error) {
+	t := instance.currentTime()
+
+	defer instance.lockTenant(tenantKey)()
+
+	if instance.closed {
+		return time.Time{}, time.Time{}, ErrLimiterClosed
+	}
+	if err := instance.validateTenantKey(tenantKey); err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+
+	var start, end time.Time
+
+	err := instance.withSyncTransaction(func() {
+		start, end = instance.windowBounds(t, tenantKey)
+	}, syncTxOptions{
+		TenantKey: tenantKey,
+		ReadOnly:  true,
+	})
+
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+
+	return start, end, nil
+}
+
+// windowBounds computes the bounds of the window of the tenant
+// on a throwaway copy so that window rotation does not change the limiter state.
+func (instance *loadLimiterDefaultImpl) windowBounds(t time.Time, tenantKey string) (time.Time, time.Time) {
+	req := instance.buildLoadRequest(t, tenantKey, 0)
+	req.TenantData = instance.detachedTenantCopy(req.TenantData)
+
+	instance.rotateWindow(req)
+
+	// the front segment could differ from the requested one
+	// when the clock went backwards.
+	frontStartTime := req.RequestSegmentStartTime
+	if queue := req.TenantData.WindowQueue; queue.Len() > 0 {
+		frontStartTime = queue.Front().(*windowSegment).StartTime
+	}
+
+	end := frontStartTime + instance.Config.WindowSegmentSize
+	start := end - instance.Config.WindowSize
+
+	return time.UnixMilli(int64(start)), time.UnixMilli(int64(end))
+}
+
 func (instance *loadLimiterDefaultImpl) probe(req *submitRequest) bool {
 	instance.rotateWindow(req)
 
-	totalWouldBe := req.TenantData.WindowTotal + req.RequestedLoad
+	if instance.drainingFor(req) > 0 {
+		return false
+	}
+
+	totalWouldBe := instance.aggregateLoad(req.TenantData, req.RequestSegmentStartTime, 0, req.RequestedLoad)
 
-	return totalWouldBe <= instance.Config.MaxLoad
+	return totalWouldBe <= instance.maxLoad(req)
 }
 
 // Submit asks for the given load to be accepted.
 // The result object contains an Accepted property
 // together with RetryIn information when available.
 func (instance *loadLimiterDefaultImpl) Submit(tenantKey string, load uint64) (SubmitResult, error) {
-	t := instance.currentTime()
+	res, transition, err := instance.submitLocked(instance.currentTime(), tenantKey, load)
+	if err == nil {
+		instance.Hooks.notify(tenantKey, instance.quantizeLoad(load), res, transition)
+	}
+	return res, err
+}
+
+// SubmitAt asks for the given load to be accepted like Submit does,
+// evaluating it at the given time instead of the current one.
+//
+// It is an advanced API meant for replaying historical load
+// against the limiter, for offline analysis or testing,
+// and the times should be submitted in chronological order.
+// A time older than the most recent segment of the tenant
+// is handled like a clock going backwards: the load is accounted
+// to the most recent segment.
+func (instance *loadLimiterDefaultImpl) SubmitAt(tenantKey string, load uint64, at time.Time) (SubmitResult, error) {
+	if at.UnixMilli() <= 0 {
+		return SubmitResult{}, fmt.Errorf("SubmitAt requires a time after the Unix epoch (given: %v)", at)
+	}
+
+	res, transition, err := instance.submitLocked(at, tenantKey, load)
+	if err == nil {
+		instance.Hooks.notify(tenantKey, instance.quantizeLoad(load), res, transition)
+	}
+	return res, err
+}
 
-	instance.Lock.Lock()
-	defer instance.Lock.Unlock()
+func (instance *loadLimiterDefaultImpl) submitLocked(t time.Time, tenantKey string, load uint64) (SubmitResult, overloadTransition, error) {
+	if parentKey, ok := instance.parentTenantKey(tenantKey); ok {
+		return instance.submitWithParentLocked(t, tenantKey, parentKey, load)
+	}
+
+	defer instance.lockTenant(tenantKey)()
+
+	if instance.closed {
+		return SubmitResult{}, overloadUnchanged, ErrLimiterClosed
+	}
+	if err := instance.validateTenantKey(tenantKey); err != nil {
+		return SubmitResult{}, overloadUnchanged, err
+	}
 
 	var res SubmitResult
+	var transition overloadTransition
 
-	err := instance.withSyncTransaction(func() {
+	txResult, err := instance.runSyncTransaction(func() {
 		req := instance.buildLoadRequest(t, tenantKey, load)
+		wasOverBefore := req.TenantData.WasOver
+		defer func() {
+			transition = overloadTransitionOf(wasOverBefore, req.TenantData.WasOver)
+		}()
 
 		if instance.probe(req) {
 			instance.acceptLoad(req)
@@ -134,38 +798,200 @@ func (instance *loadLimiterDefaultImpl) Submit(tenantKey string, load uint64) (S
 	})
 
 	if err != nil {
-		return res, err
+		return SubmitResult{}, overloadUnchanged, err
 	}
 
-	return res, nil
+	res.SyncWarnings = txResult.Warnings
+
+	return res, transition, nil
+}
+
+// SubmitBatch asks for all the given loads to be accepted at once.
+//
+// The batch is accepted only if the combined load fits,
+// otherwise the whole batch is rejected and RetryIn is computed for the total.
+func (instance *loadLimiterDefaultImpl) SubmitBatch(tenantKey string, loads []uint64) (SubmitResult, error) {
+	if len(loads) == 0 {
+		return SubmitResult{}, errors.New("SubmitBatch requires at least one load")
+	}
+
+	total := uint64(0)
+	for _, load := range loads {
+		// each load is accounted for separately
+		load = instance.quantizeLoad(load)
+		if total > math.MaxUint64-load {
+			return SubmitResult{}, errors.New("the combined load of the batch is too large")
+		}
+		total += load
+	}
+
+	// a single submission guarantees atomicity for the whole batch
+	return instance.Submit(tenantKey, total)
+}
+
+// SubmitCost asks for the load computed by the configured CostFunc
+// for the given request descriptor to be accepted.
+func (instance *loadLimiterDefaultImpl) SubmitCost(tenantKey string, meta interface{}) (SubmitResult, error) {
+	if instance.CostFunc == nil {
+		return SubmitResult{}, errors.New("SubmitCost requires a CostFunc to be configured")
+	}
+
+	return instance.Submit(tenantKey, instance.CostFunc(meta))
+}
+
+// Refund gives back the given load to the tenant,
+// removing it from the window starting from the most recent segments.
+//
+// Only accepted load is refunded: the penalties are left in the window,
+// so refunding more than the accepted load removes all of it
+// but keeps the penalties.
+//
+// When the tenant has a parent, the load refunded to the tenant
+// is given back to the parent as well.
+func (instance *loadLimiterDefaultImpl) Refund(tenantKey string, load uint64) error {
+	t := instance.currentTime()
+
+	parentKey, hasParent, unlock := instance.lockTenantAndParent(tenantKey)
+	defer unlock()
+
+	if instance.closed {
+		return ErrLimiterClosed
+	}
+	if err := instance.validateTenantAndParentKeys(tenantKey, parentKey, hasParent); err != nil {
+		return err
+	}
+
+	_, err := instance.runParentSyncTransaction(func() {
+		refunded := instance.refundMostRecent(t, tenantKey, load)
+
+		if hasParent && refunded > 0 {
+			instance.refundMostRecent(t, parentKey, refunded)
+		}
+	}, tenantKey, parentKey, hasParent, false)
+
+	return err
+}
+
+// refundMostRecent removes the given load from the most recent segments
+// of the given tenant, returning the amount actually removed.
+func (instance *loadLimiterDefaultImpl) refundMostRecent(t time.Time, tenantKey string, load uint64) uint64 {
+	req := instance.buildLoadRequest(t, tenantKey, 0)
+	instance.rotateWindow(req)
+
+	refunded := instance.removeFromMostRecentSegments(req, load)
+	if refunded > 0 {
+		instance.markDirty(req)
+	}
+	return refunded
 }
 
 func (instance *loadLimiterDefaultImpl) acceptLoad(req *submitRequest) {
 	tenant := req.TenantData
 
-	currentSegment := tenant.WindowQueue.Front().(*windowSegment)
-
+	if tenant.WasOver {
+		tenant.RecoveredAt = req.RequestedTimestamp
+	}
 	tenant.WasOver = false
+	tenant.AcceptedCount++
+	instance.trackInterarrival(req)
+	instance.pruneExpiredBoosts(tenant, req.RequestedTimestamp)
+
+	instance.addAcceptedLoad(req, req.RequestedLoad)
+}
 
-	tenant.WindowTotal += req.RequestedLoad
-	currentSegment.Value += req.RequestedLoad
+// addAcceptedLoad adds the given amount to the window as accepted load,
+// spreading it according to AcceptanceSpreadSegments
+// and keeping the window within the max penalty cap.
+func (instance *loadLimiterDefaultImpl) addAcceptedLoad(req *submitRequest, amount uint64) {
+	tenant := req.TenantData
+
+	if instance.Config.AcceptanceSpreadSegments > 1 {
+		instance.distributeLoad(req, amount, instance.Config.AcceptanceSpreadSegments, false)
+	} else {
+		currentSegment := tenant.WindowQueue.Front().(*windowSegment)
+
+		tenant.WindowTotal = saturatingAdd(tenant.WindowTotal, amount)
+		currentSegment.Value = saturatingAdd(currentSegment.Value, amount)
+	}
 
 	instance.applyCapping(req)
 	instance.markDirty(req)
 }
 
+// logRejection logs a rejected load when LogRejections is enabled.
+func (instance *loadLimiterDefaultImpl) logRejection(msg string, keysAndValues ...interface{}) {
+	if instance.Config.LogRejections {
+		logDebugw(instance.Logger, msg, keysAndValues...)
+	}
+}
+
 func (instance *loadLimiterDefaultImpl) rejectLoad(req *submitRequest) *SubmitResult {
 	tenant := req.TenantData
 
 	someAdded := false
 	dirty := false
 
+	// the counter alone does not mark the tenant as dirty:
+	// it is synchronized along with the next change of the window.
+	tenant.RejectedCount++
+	instance.trackInterarrival(req)
+
+	if req.RequestedLoad > instance.maxLoad(req) {
+		// the load will never fit in the window:
+		// there is no point in penalizing it or in switching to overload status.
+		instance.logRejection("load permanently rejected",
+			"tenantKey", req.TenantKey,
+			"load", req.RequestedLoad,
+			"maxLoad", instance.maxLoad(req),
+		)
+
+		return &SubmitResult{
+			Accepted:            false,
+			PermanentlyRejected: true,
+		}
+	}
+
+	if instance.drainingFor(req) > 0 {
+		// no new load is admitted while draining:
+		// the rejection is not the client's fault.
+		instance.logRejection("load rejected while draining",
+			"tenantKey", req.TenantKey,
+			"load", req.RequestedLoad,
+		)
+
+		res := &SubmitResult{
+			Accepted: false,
+		}
+		if !instance.Config.SkipRetryInComputing {
+			if retryIn, err := instance.computeRetryIn(req); err == nil {
+				res.RetryInAvailable = true
+				res.RetryIn = retryIn
+			}
+		}
+		return res
+	}
+
+	instance.logRejection("load rejected",
+		"tenantKey", req.TenantKey,
+		"load", req.RequestedLoad,
+		"windowTotal", tenant.WindowTotal,
+		"version", tenant.Version,
+	)
+
+	warmingUp := instance.inWarmup(req)
+
 	if !tenant.WasOver {
 		// instance was not overloaded, this request is the first to overstep
-		if instance.Config.ApplyOverstepPenalty {
+		if instance.inRecoveryGrace(req) {
+			// the tenant has just recovered from overload:
+			// the lighter request overhead penalty is applied instead.
+			if !warmingUp && instance.applyRequestOverheadPenalty(req) {
+				someAdded = true
+			}
+		} else if instance.Config.ApplyOverstepPenalty && !warmingUp {
 			instance.distributePenalty(
 				req,
-				instance.Config.AbsoluteOverstepPenalty,
+				instance.overstepPenalty(instance.maxLoad(req)),
 				instance.Config.OverstepPenaltySegmentSpan,
 			)
 			someAdded = true
@@ -177,17 +1003,9 @@ func (instance *loadLimiterDefaultImpl) rejectLoad(req *submitRequest) *SubmitRe
 
 	} else {
 		// request submitted when instance was already overloaded
-		if instance.Config.ApplyRequestOverheadPenalty {
-			penalty := math.Round(instance.Config.RequestOverheadPenaltyFactor * float64(req.RequestedLoad))
-			if penalty >= 1.0 {
-				instance.distributePenalty(
-					req,
-					uint64(penalty),
-					instance.Config.RequestOverheadPenaltySegmentSpan,
-				)
-				someAdded = true
-				dirty = true
-			}
+		if !warmingUp && instance.applyRequestOverheadPenalty(req) {
+			someAdded = true
+			dirty = true
 		}
 	}
 
@@ -214,6 +1032,50 @@ func (instance *loadLimiterDefaultImpl) rejectLoad(req *submitRequest) *SubmitRe
 	}
 }
 
+// applyRequestOverheadPenalty charges the request overhead penalty
+// for the rejected request, if enabled, returning true if some penalty was added.
+func (instance *loadLimiterDefaultImpl) applyRequestOverheadPenalty(req *submitRequest) bool {
+	if !instance.Config.ApplyRequestOverheadPenalty {
+		return false
+	}
+	penalty := math.Round(instance.Config.RequestOverheadPenaltyFactor * float64(req.RequestedLoad))
+	if penalty < 1.0 {
+		return false
+	}
+	instance.distributePenalty(
+		req,
+		saturatingFloatToUint(penalty),
+		instance.Config.RequestOverheadPenaltySegmentSpan,
+	)
+	return true
+}
+
+// inWarmup checks if the tenant is still in the warm-up period
+// during which no penalties are applied.
+func (instance *loadLimiterDefaultImpl) inWarmup(req *submitRequest) bool {
+	tenant := req.TenantData
+
+	if instance.Config.WarmupDuration > 0 &&
+		req.RequestedTimestamp < saturatingAdd(tenant.CreatedAt, instance.Config.WarmupDuration) {
+		return true
+	}
+	if instance.Config.WarmupRequests > 0 &&
+		saturatingAdd(tenant.AcceptedCount, tenant.RejectedCount) <= instance.Config.WarmupRequests {
+		return true
+	}
+	return false
+}
+
+// inRecoveryGrace checks if the tenant has recently recovered from overload
+// and is still in the grace period during which no overstep penalty is applied.
+func (instance *loadLimiterDefaultImpl) inRecoveryGrace(req *submitRequest) bool {
+	tenant := req.TenantData
+
+	return instance.Config.GracePeriodAfterRecovery > 0 &&
+		tenant.RecoveredAt > 0 &&
+		req.RequestedTimestamp < saturatingAdd(tenant.RecoveredAt, instance.Config.GracePeriodAfterRecovery)
+}
+
 // SubmitUntil asks for the given load to be accepted and,
 // in case of rejection, automatically handles retries and delays.
 // In case of acceptance a nil value is returned.
@@ -225,7 +1087,7 @@ func (instance *loadLimiterDefaultImpl) rejectLoad(req *submitRequest) *SubmitRe
 // gollLoadRequestSubmissionTimeout / goll.LoadRequestRejected
 // types if you need additional info.
 func (instance *loadLimiterDefaultImpl) SubmitUntil(tenantKey string, load uint64, timeout time.Duration) error {
-	res := instance.submitUntil(tenantKey, load, timeout)
+	res := instance.submitUntil(context.Background(), tenantKey, load, timeout)
 	return res.Error
 }
 
@@ -243,10 +1105,46 @@ func (instance *loadLimiterDefaultImpl) SubmitUntil(tenantKey string, load uint6
 // gollLoadRequestSubmissionTimeout / goll.LoadRequestRejected
 // types if you need additional info.
 func (instance *loadLimiterDefaultImpl) SubmitUntilWithDetails(tenantKey string, load uint64, timeout time.Duration) SubmitUntilResult {
-	return instance.submitUntil(tenantKey, load, timeout)
+	return instance.submitUntil(context.Background(), tenantKey, load, timeout)
+}
+
+// SubmitUntilCtx works like SubmitUntilWithDetails
+// but stops waiting as soon as the given context is cancelled.
+//
+// In case of cancellation the Error field of the output object
+// wraps the context error and can be checked with errors.Is
+// against context.Canceled or context.DeadlineExceeded.
+func (instance *loadLimiterDefaultImpl) SubmitUntilCtx(ctx context.Context, tenantKey string, load uint64, timeout time.Duration) SubmitUntilResult {
+	return instance.submitUntil(ctx, tenantKey, load, timeout)
+}
+
+// SubmitUntilWithOptions works like SubmitUntilWithDetails
+// but accepts additional options, like a maximum number of attempts
+// to be made regardless of the timeout.
+//
+// When the attempts are exhausted the Error field of the output object
+// is a LoadRequestTimeout with AttemptsExhausted set to true.
+func (instance *loadLimiterDefaultImpl) SubmitUntilWithOptions(tenantKey string, load uint64, options SubmitUntilOptions) SubmitUntilResult {
+	return instance.submitUntilWithOptions(context.Background(), tenantKey, load, options)
+}
+
+// SubmitUntilWithBackoff works like SubmitUntilWithDetails
+// but waits before each retry for the time computed by the given BackoffFunc.
+// The timeout is still honored.
+func (instance *loadLimiterDefaultImpl) SubmitUntilWithBackoff(tenantKey string, load uint64, timeout time.Duration, backoff BackoffFunc) SubmitUntilResult {
+	return instance.submitUntilWithOptions(context.Background(), tenantKey, load, SubmitUntilOptions{
+		Timeout: timeout,
+		Backoff: backoff,
+	})
+}
+
+func (instance *loadLimiterDefaultImpl) submitUntil(ctx context.Context, tenantKey string, load uint64, timeout time.Duration) SubmitUntilResult {
+	return instance.submitUntilWithOptions(ctx, tenantKey, load, SubmitUntilOptions{
+		Timeout: timeout,
+	})
 }
 
-func (instance *loadLimiterDefaultImpl) submitUntil(tenantKey string, load uint64, timeout time.Duration) SubmitUntilResult {
+func (instance *loadLimiterDefaultImpl) submitUntilWithOptions(ctx context.Context, tenantKey string, load uint64, options SubmitUntilOptions) SubmitUntilResult {
 
 	t := instance.currentTime()
 
@@ -256,7 +1154,7 @@ func (instance *loadLimiterDefaultImpl) submitUntil(tenantKey string, load uint6
 		Error:          nil,
 	}
 
-	if timeout < 0 {
+	if options.Timeout < 0 {
 		instance.Logger.Warning("submit of task failed because of invalid timeout")
 		out.Error = &LoadRequestRejected{
 			Reason: "invalid timeout",
@@ -264,7 +1162,7 @@ func (instance *loadLimiterDefaultImpl) submitUntil(tenantKey string, load uint6
 		return out
 	}
 
-	timeoutAt := t.Add(timeout)
+	timeoutAt := t.Add(options.Timeout)
 
 	for {
 		out.AttemptsNumber++
@@ -279,6 +1177,14 @@ func (instance *loadLimiterDefaultImpl) submitUntil(tenantKey string, load uint6
 			break
 		}
 
+		if submitResult.PermanentlyRejected {
+			instance.Logger.Warning("submit of task failed and will never be allowed")
+			out.Error = &LoadRequestRejected{
+				Reason: "excessive requested load",
+			}
+			break
+		}
+
 		if instance.Config.SkipRetryInComputing {
 			instance.Logger.Warning("submit of task failed and retry is not supported")
 			out.Error = &LoadRequestRejected{
@@ -295,22 +1201,109 @@ func (instance *loadLimiterDefaultImpl) submitUntil(tenantKey string, load uint6
 			break
 		}
 
-		if instance.currentTime().Add(submitResult.RetryIn).After(timeoutAt) {
+		if options.MaxAttempts > 0 && out.AttemptsNumber >= options.MaxAttempts {
+			instance.Logger.Warning("submit of task failed and attempts were exhausted")
+			out.Error = &LoadRequestTimeout{
+				WaitedFor:         out.WaitedFor,
+				AttemptsNumber:    out.AttemptsNumber,
+				AttemptsExhausted: true,
+			}
+			break
+		}
+
+		waitFor := options.retryWait(out.AttemptsNumber, submitResult.RetryIn)
+		if instance.currentTime().Add(waitFor).After(timeoutAt) {
 			instance.Logger.Warning("submit of task failed and retrying timed out")
 			out.Error = &LoadRequestTimeout{
-				WaitedFor:      out.WaitedFor,
-				AttemptsNumber: out.AttemptsNumber,
+				WaitedFor:       out.WaitedFor,
+				AttemptsNumber:  out.AttemptsNumber,
+				WouldHaveWaited: waitFor,
 			}
 			break
 		}
 
-		waitFor := submitResult.RetryIn
 		instance.Logger.Debug(fmt.Sprintf("submit of task was rejected, waiting %v ms and retrying", waitFor.Milliseconds()))
-		instance.sleep(waitFor)
-		out.WaitedFor += waitFor
+		if interrupted := waitForRetry(ctx, instance.currentTime, instance.sleepCtx, waitFor, &out); interrupted {
+			instance.Logger.Warning("submit of task was interrupted while waiting")
+			break
+		}
 
 		instance.Logger.Debug("submit of task will now be reattempted")
 	}
 
 	return out
 }
+
+// waitForRetry sleeps for the given amount of time before a retry,
+// keeping track of the time waited in the output object.
+//
+// If the context gets cancelled while waiting, the output object Error
+// is set to the wrapped context error and true is returned.
+func waitForRetry(
+	ctx context.Context,
+	timeFunc func() time.Time,
+	sleepFunc func(context.Context, time.Duration) error,
+	waitFor time.Duration,
+	out *SubmitUntilResult,
+) bool {
+	startedAt := timeFunc()
+
+	err := sleepFunc(ctx, waitFor)
+	if err == nil {
+		out.WaitedFor += waitFor
+		return false
+	}
+
+	waited := timeFunc().Sub(startedAt)
+	if waited > waitFor {
+		waited = waitFor
+	} else if waited < 0 {
+		waited = 0
+	}
+	out.WaitedFor += waited
+	out.Error = fmt.Errorf("submit interrupted while waiting for retry: %w", err)
+	return true
+}
+
+// sleepWithContext waits for the given duration,
+// returning early with the context error if the context gets cancelled.
+//
+// When no custom sleepFunc is provided a timer is used,
+// otherwise the sleepFunc is run in a separate goroutine
+// that outlives the call if the context gets cancelled first.
+func sleepWithContext(ctx context.Context, d time.Duration, sleepFunc func(d time.Duration)) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if sleepFunc == nil {
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+
+		select {
+		case <-timer.C:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	if ctx.Done() == nil {
+		// the context can never be cancelled
+		sleepFunc(d)
+		return nil
+	}
+
+	done := make(chan struct{})
+	go func() {
+		sleepFunc(d)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -1,7 +1,10 @@
 package goll
 
 import (
+	"context"
 	"fmt"
+	"math"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -71,6 +74,59 @@ func BenchmarkSubmit50pc(b *testing.B) {
 	}
 }
 
+func BenchmarkSubmit50pcFixedWindow(b *testing.B) {
+	ti := buildInstance(nil, func(config *Config) {
+		config.WindowSegmentSize = 0
+		config.Algorithm = AlgorithmFixedWindow
+	})
+	instance := ti.Instance
+
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		submitNoError(instance.Submit(defaultTestTenantKey, 2))
+		ti.TimeTravel(100)
+	}
+}
+
+func BenchmarkSubmit50pcSlidingWindow(b *testing.B) {
+	ti := buildDefaultInstance(nil)
+	instance := ti.Instance
+
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		submitNoError(instance.Submit(defaultTestTenantKey, 2))
+		ti.TimeTravel(100)
+	}
+}
+
+// BenchmarkSubmitNewTenants shows the allocations
+// for creating the window of a new tenant at different queue capacities.
+func BenchmarkSubmitNewTenants(b *testing.B) {
+	for _, capacity := range []uint64{16, 0, 1024} {
+		name := fmt.Sprintf("capacity=%d", capacity)
+		if capacity == 0 {
+			name = "capacity=default"
+		}
+
+		b.Run(name, func(b *testing.B) {
+			ti := buildInstance(nil, func(config *Config) {
+				// 100 segments
+				config.WindowSegmentSize = defaultSegmentSize / 10
+				config.WindowQueueInitialCapacity = capacity
+			})
+			instance := ti.Instance
+
+			b.ReportAllocs()
+
+			for i := 0; i < b.N; i++ {
+				submitNoError(instance.Submit(strconv.Itoa(i), 2))
+			}
+		})
+	}
+}
+
 func BenchmarkSubmitAllAccepted(b *testing.B) {
 	ti := buildInstance(nil, func(config *Config) {
 		config.MaxLoad *= 10
@@ -123,13 +179,33 @@ func BenchmarkSubmitAllRejected(b *testing.B) {
 	}
 }
 
+func TestSubmitAt(t *testing.T) {
+	ti := buildDefaultInstance(t)
+
+	// the loads are evaluated at the given times
+	assert.True(t, submitNoError(ti.Instance.SubmitAt(defaultTestTenantKey, 60, time.UnixMilli(2000000))).Accepted)
+	res := submitNoError(ti.Instance.SubmitAt(defaultTestTenantKey, 60, time.UnixMilli(2001000)))
+	assert.False(t, res.Accepted)
+	assert.Equal(t, 9*time.Second, res.RetryIn)
+	assert.True(t, submitNoError(ti.Instance.SubmitAt(defaultTestTenantKey, 60, time.UnixMilli(2010500))).Accepted)
+	ti.AssertWindowStatus(t, defaultTestTenantKey, 60, "2010000:60", "2001000:0")
+	assert.Equal(t, uint64(1000000), ti.CurrentTime)
+
+	// older times are accounted to the most recent segment
+	assert.True(t, submitNoError(ti.Instance.SubmitAt(defaultTestTenantKey, 10, time.UnixMilli(1500000))).Accepted)
+	ti.AssertWindowStatus(t, defaultTestTenantKey, 70, "2010000:70", "2001000:0")
+
+	_, err := ti.Instance.SubmitAt(defaultTestTenantKey, 1, time.Time{})
+	assert.NotNil(t, err)
+}
+
 func TestSubmitUntil(t *testing.T) {
 	ti := buildDefaultInstance(t)
 	applyMultiWindowConstantLoadDistribution(t, ti, defaultTestTenantKey, 8)
 
 	// load not available, timeout 1ms. We expect to timeout with an ErrLoadRequestTimeout
 	// but WaitedFor should be 0 (should not wait when it would be pointless to)
-	res := ti.Instance.submitUntil(defaultTestTenantKey, 40, time.Duration(1)*time.Millisecond)
+	res := ti.Instance.submitUntil(context.Background(), defaultTestTenantKey, 40, time.Duration(1)*time.Millisecond)
 
 	assert.NotNil(t, res.Error)
 	assert.ErrorIs(t, res.Error, ErrLoadRequestTimeout)
@@ -137,24 +213,259 @@ func TestSubmitUntil(t *testing.T) {
 	assert.Equal(t, uint64(1), res.AttemptsNumber)
 	assert.Equal(t, time.Duration(0), res.WaitedFor)
 
+	// the wait that did not fit in the timeout is reported
+	var timeoutErr *LoadRequestTimeout
+	assert.ErrorAs(t, res.Error, &timeoutErr)
+	assert.Equal(t, int64(3000), timeoutErr.WouldHaveWaited.Milliseconds())
+
 	// goto 1019200
 	ti.TimeTravel(200)
 
 	// 20 currently available, asking for 40, 8 in each segment.
 	// to free up three segments we have to wait 800 + 1000 + 1000 ms
-	res = ti.Instance.submitUntil(defaultTestTenantKey, 40, time.Duration(10000)*time.Millisecond)
+	res = ti.Instance.submitUntil(context.Background(), defaultTestTenantKey, 40, time.Duration(10000)*time.Millisecond)
 
 	assert.Nil(t, res.Error)
 	assert.Equal(t, uint64(2), res.AttemptsNumber)
 	assert.Equal(t, int64(2800), res.WaitedFor.Milliseconds())
 }
 
+func TestSubmitUntilWithMaxRetryIn(t *testing.T) {
+	ti := buildInstance(t, func(config *Config) {
+		config.MaxRetryIn = time.Second
+	})
+	applyMultiWindowConstantLoadDistribution(t, ti, defaultTestTenantKey, 8)
+
+	// goto 1019200
+	ti.TimeTravel(200)
+
+	// 2800 ms are required but the advertised RetryIn is capped
+	rejected := submitNoError(ti.Instance.Submit(defaultTestTenantKey, 40))
+	assert.False(t, rejected.Accepted)
+	assert.True(t, rejected.RetryInAvailable)
+	assert.Equal(t, time.Second, rejected.RetryIn)
+
+	// TimeToAvailable is not capped
+	available, err := ti.Instance.TimeToAvailable(defaultTestTenantKey, 40)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2800), available.Milliseconds())
+
+	// the capped retries fail until the timeout expires
+	res := ti.Instance.submitUntil(context.Background(), defaultTestTenantKey, 40, time.Duration(2500)*time.Millisecond)
+
+	assert.ErrorIs(t, res.Error, ErrLoadRequestTimeout)
+	assert.Equal(t, uint64(3), res.AttemptsNumber)
+	assert.Equal(t, int64(2000), res.WaitedFor.Milliseconds())
+
+	ti = buildInstance(t, func(config *Config) {
+		config.MaxRetryIn = time.Second
+	})
+	applyMultiWindowConstantLoadDistribution(t, ti, defaultTestTenantKey, 8)
+	ti.TimeTravel(200)
+
+	// the load gets accepted after some more attempts
+	res = ti.Instance.submitUntil(context.Background(), defaultTestTenantKey, 40, time.Duration(10000)*time.Millisecond)
+
+	assert.Nil(t, res.Error)
+	assert.Equal(t, uint64(4), res.AttemptsNumber)
+	assert.Equal(t, int64(2800), res.WaitedFor.Milliseconds())
+}
+
+func TestSubmitUntilWithRetryInJitter(t *testing.T) {
+	ti := buildInstance(t, func(config *Config) {
+		config.RetryInJitterFactor = 0.2
+	})
+	applyMultiWindowConstantLoadDistribution(t, ti, defaultTestTenantKey, 8)
+
+	// goto 1019200
+	ti.TimeTravel(200)
+
+	// the jittered wait is never shorter than the 2800 ms required
+	res := ti.Instance.submitUntil(context.Background(), defaultTestTenantKey, 40, time.Duration(10000)*time.Millisecond)
+
+	assert.Nil(t, res.Error)
+	assert.Equal(t, uint64(2), res.AttemptsNumber)
+	assert.GreaterOrEqual(t, res.WaitedFor.Milliseconds(), int64(2800))
+	assert.LessOrEqual(t, res.WaitedFor.Milliseconds(), int64(3360))
+}
+
+func TestSubmitUntilWithRetryInGranularity(t *testing.T) {
+	ti := buildInstance(t, func(config *Config) {
+		config.RetryInGranularity = time.Second
+	})
+	applyMultiWindowConstantLoadDistribution(t, ti, defaultTestTenantKey, 8)
+
+	// goto 1019200
+	ti.TimeTravel(200)
+
+	// 2800 ms are required, rounded up to the next second
+	rejected := submitNoError(ti.Instance.Submit(defaultTestTenantKey, 40))
+	assert.False(t, rejected.Accepted)
+	assert.True(t, rejected.RetryInAvailable)
+	assert.Equal(t, 3*time.Second, rejected.RetryIn)
+
+	// TimeToAvailable is not rounded
+	available, err := ti.Instance.TimeToAvailable(defaultTestTenantKey, 40)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2800), available.Milliseconds())
+
+	res := ti.Instance.submitUntil(context.Background(), defaultTestTenantKey, 40, time.Duration(10000)*time.Millisecond)
+
+	assert.Nil(t, res.Error)
+	assert.Equal(t, uint64(2), res.AttemptsNumber)
+	assert.Equal(t, int64(3000), res.WaitedFor.Milliseconds())
+
+	// exact multiples are not rounded
+	ti = buildInstance(t, func(config *Config) {
+		config.RetryInGranularity = 100 * time.Millisecond
+	})
+	applyMultiWindowConstantLoadDistribution(t, ti, defaultTestTenantKey, 8)
+	ti.TimeTravel(200)
+
+	assert.Equal(t, 2800*time.Millisecond, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 40)).RetryIn)
+}
+
+func TestSubmitUntilWithBackoff(t *testing.T) {
+	ti := buildDefaultInstance(t)
+	applyMultiWindowConstantLoadDistribution(t, ti, defaultTestTenantKey, 8)
+
+	// goto 1019200
+	ti.TimeTravel(200)
+
+	var attempts []uint64
+	extraWait := func(attempt uint64, retryIn time.Duration) time.Duration {
+		attempts = append(attempts, attempt)
+		return retryIn + 500*time.Millisecond
+	}
+
+	// the extra wait would go over the timeout
+	res := ti.Instance.SubmitUntilWithBackoff(defaultTestTenantKey, 40, 3*time.Second, extraWait)
+	assert.ErrorIs(t, res.Error, ErrLoadRequestTimeout)
+	assert.Equal(t, uint64(1), res.AttemptsNumber)
+	var timeoutErr *LoadRequestTimeout
+	assert.ErrorAs(t, res.Error, &timeoutErr)
+	assert.Equal(t, int64(3300), timeoutErr.WouldHaveWaited.Milliseconds())
+
+	res = ti.Instance.SubmitUntilWithBackoff(defaultTestTenantKey, 40, 10*time.Second, extraWait)
+	assert.Nil(t, res.Error)
+	assert.Equal(t, uint64(2), res.AttemptsNumber)
+	assert.Equal(t, int64(3300), res.WaitedFor.Milliseconds())
+	assert.Equal(t, []uint64{1, 1}, attempts)
+
+	// waits shorter than RetryIn are not allowed
+	ti = buildDefaultInstance(t)
+	applyMultiWindowConstantLoadDistribution(t, ti, defaultTestTenantKey, 8)
+	ti.TimeTravel(200)
+
+	res = ti.Instance.SubmitUntilWithBackoff(defaultTestTenantKey, 40, 10*time.Second, func(attempt uint64, retryIn time.Duration) time.Duration {
+		return 0
+	})
+	assert.Nil(t, res.Error)
+	assert.Equal(t, uint64(2), res.AttemptsNumber)
+	assert.Equal(t, int64(2800), res.WaitedFor.Milliseconds())
+}
+
+func TestSubmitUntilWithMaxAttempts(t *testing.T) {
+	ti := buildInstance(t, func(config *Config) {
+		config.MaxRetryIn = time.Second
+	})
+	applyMultiWindowConstantLoadDistribution(t, ti, defaultTestTenantKey, 8)
+
+	// goto 1019200
+	ti.TimeTravel(200)
+
+	// the capped retries would succeed within the timeout
+	// but the attempts are exhausted first
+	res := ti.Instance.SubmitUntilWithOptions(defaultTestTenantKey, 40, SubmitUntilOptions{
+		Timeout:     10 * time.Second,
+		MaxAttempts: 2,
+	})
+
+	assert.ErrorIs(t, res.Error, ErrLoadRequestTimeout)
+	assert.Contains(t, res.Error.Error(), "exhausting 2 attempts")
+	var timeoutErr *LoadRequestTimeout
+	assert.ErrorAs(t, res.Error, &timeoutErr)
+	assert.True(t, timeoutErr.AttemptsExhausted)
+	assert.Equal(t, uint64(2), res.AttemptsNumber)
+	assert.Equal(t, int64(1000), res.WaitedFor.Milliseconds())
+
+	// the timeout still applies
+	res = ti.Instance.SubmitUntilWithOptions(defaultTestTenantKey, 40, SubmitUntilOptions{
+		Timeout:     500 * time.Millisecond,
+		MaxAttempts: 5,
+	})
+
+	assert.ErrorIs(t, res.Error, ErrLoadRequestTimeout)
+	assert.Contains(t, res.Error.Error(), "timed out")
+	assert.Equal(t, uint64(1), res.AttemptsNumber)
+
+	// zero means unlimited attempts
+	res = ti.Instance.SubmitUntilWithOptions(defaultTestTenantKey, 40, SubmitUntilOptions{
+		Timeout: 10 * time.Second,
+	})
+
+	assert.Nil(t, res.Error)
+	assert.Equal(t, uint64(3), res.AttemptsNumber)
+	assert.Equal(t, int64(1800), res.WaitedFor.Milliseconds())
+}
+
+func TestSubmitUntilCtx(t *testing.T) {
+	ti := buildDefaultInstance(t)
+	applyMultiWindowConstantLoadDistribution(t, ti, defaultTestTenantKey, 8)
+
+	// goto 1019200
+	ti.TimeTravel(200)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	release := make(chan struct{})
+	defer close(release)
+
+	// the context gets cancelled after waiting for 1000 of the required 2800 ms
+	ti.Instance.SleepFunc = func(d time.Duration) {
+		ti.TimeTravel(1000)
+		cancel()
+		<-release
+	}
+
+	res := ti.Instance.SubmitUntilCtx(ctx, defaultTestTenantKey, 40, time.Duration(10000)*time.Millisecond)
+
+	assert.NotNil(t, res.Error)
+	assert.ErrorIs(t, res.Error, context.Canceled)
+	assert.Equal(t, uint64(1), res.AttemptsNumber)
+	assert.Equal(t, int64(1000), res.WaitedFor.Milliseconds())
+
+	// an already cancelled context is still attempted once but never waits
+	res = ti.Instance.SubmitUntilCtx(ctx, defaultTestTenantKey, 40, time.Duration(10000)*time.Millisecond)
+
+	assert.ErrorIs(t, res.Error, context.Canceled)
+	assert.Equal(t, uint64(1), res.AttemptsNumber)
+	assert.Equal(t, time.Duration(0), res.WaitedFor)
+}
+
+func TestSubmitUntilCtxWithTimer(t *testing.T) {
+	ti := buildDefaultInstance(t)
+	applyMultiWindowConstantLoadDistribution(t, ti, defaultTestTenantKey, 8)
+
+	// use the default timer-based sleep
+	ti.Instance.SleepFunc = nil
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	startedAt := time.Now()
+	res := ti.Instance.SubmitUntilCtx(ctx, defaultTestTenantKey, 40, time.Duration(10000)*time.Millisecond)
+
+	assert.ErrorIs(t, res.Error, context.DeadlineExceeded)
+	assert.Equal(t, uint64(1), res.AttemptsNumber)
+	assert.True(t, time.Since(startedAt) < time.Second)
+}
+
 func TestSubmitUntilExcessiveLoad(t *testing.T) {
 	ti := buildDefaultInstance(t)
 
 	// passing a negative duration should return a ErrLoadRequestRejected
 	// without even attempting
-	res := ti.Instance.submitUntil(defaultTestTenantKey, 5000000, time.Duration(1)*time.Second)
+	res := ti.Instance.submitUntil(context.Background(), defaultTestTenantKey, 5000000, time.Duration(1)*time.Second)
 
 	assert.NotNil(t, res.Error)
 	assert.ErrorIs(t, res.Error, ErrLoadRequestRejected)
@@ -164,7 +475,7 @@ func TestSubmitUntilExcessiveLoad(t *testing.T) {
 
 	ti = buildDefaultInstance(t)
 	applyMultiWindowConstantLoadDistribution(t, ti, defaultTestTenantKey, 8)
-	res = ti.Instance.submitUntil(defaultTestTenantKey, 5000000, time.Duration(1)*time.Second)
+	res = ti.Instance.submitUntil(context.Background(), defaultTestTenantKey, 5000000, time.Duration(1)*time.Second)
 
 	assert.NotNil(t, res.Error)
 	assert.ErrorIs(t, res.Error, ErrLoadRequestRejected)
@@ -178,7 +489,7 @@ func TestSubmitUntilInvalidTimeout(t *testing.T) {
 
 	// passing a negative duration should return a ErrLoadRequestRejected
 	// without even attempting
-	res := ti.Instance.submitUntil(defaultTestTenantKey, 5, time.Duration(-1)*time.Second)
+	res := ti.Instance.submitUntil(context.Background(), defaultTestTenantKey, 5, time.Duration(-1)*time.Second)
 
 	assert.NotNil(t, res.Error)
 	assert.ErrorIs(t, res.Error, ErrLoadRequestRejected)
@@ -188,7 +499,7 @@ func TestSubmitUntilInvalidTimeout(t *testing.T) {
 
 	ti = buildDefaultInstance(t)
 	applyMultiWindowConstantLoadDistribution(t, ti, defaultTestTenantKey, 8)
-	res = ti.Instance.submitUntil(defaultTestTenantKey, 5, time.Duration(-1)*time.Second)
+	res = ti.Instance.submitUntil(context.Background(), defaultTestTenantKey, 5, time.Duration(-1)*time.Second)
 
 	assert.NotNil(t, res.Error)
 	assert.ErrorIs(t, res.Error, ErrLoadRequestRejected)
@@ -219,6 +530,66 @@ func TestProbe(t *testing.T) {
 	ti.AssertWindowStatus(t, defaultTestTenantKey, 0, "1030000:0")
 }
 
+func TestProbeSharedLock(t *testing.T) {
+	ti := buildDefaultInstance(t)
+
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 10)).Accepted)
+
+	// probes and stats can proceed while another reader holds the lock
+	ti.Instance.Lock.RLock()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		assert.True(t, noErrors(ti.Instance.Probe(defaultTestTenantKey, 90)).(bool))
+		assert.False(t, noErrors(ti.Instance.Probe(defaultTestTenantKey, 91)).(bool))
+		stats, err := ti.Instance.Stats(defaultTestTenantKey)
+		assert.Nil(t, err)
+		assert.Equal(t, uint64(10), stats.WindowTotal)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("read-only operations should not wait for other readers")
+	}
+	ti.Instance.Lock.RUnlock()
+
+	// when the window has to be rotated the exclusive lock is taken
+	ti.TimeTravel(1000)
+	req := ti.InternalRequest(defaultTestTenantKey, 0)
+	assert.True(t, ti.Instance.rotationNeeded(req))
+	_, ok, _ := ti.Instance.probeShared(ti.Instance.currentTime(), defaultTestTenantKey, 1)
+	assert.False(t, ok)
+
+	assert.True(t, noErrors(ti.Instance.Probe(defaultTestTenantKey, 90)).(bool))
+	assert.False(t, ti.Instance.rotationNeeded(req))
+	ti.AssertWindowStatus(t, defaultTestTenantKey, 10, "1001000:0", "1000000:10")
+}
+
+func BenchmarkProbeParallel(b *testing.B) {
+	ti := buildDefaultInstance(nil)
+	_, _ = ti.Instance.Submit(defaultTestTenantKey, 10)
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			_, _ = ti.Instance.Probe(defaultTestTenantKey, 1)
+		}
+	})
+}
+
+func BenchmarkProbeParallelExclusive(b *testing.B) {
+	ti := buildDefaultInstance(nil)
+	_, _ = ti.Instance.Submit(defaultTestTenantKey, 10)
+	t := ti.Instance.currentTime()
+
+	// same as BenchmarkProbeParallel, forcing the exclusive lock
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			_, _ = ti.Instance.probeExclusive(t, defaultTestTenantKey, 1)
+		}
+	})
+}
+
 func TestStats(t *testing.T) {
 	ti := buildDefaultInstance(t)
 
@@ -231,8 +602,14 @@ func TestStats(t *testing.T) {
 	stats, err := ti.Instance.Stats(defaultTestTenantKey)
 	assert.Nil(t, err)
 	assert.Equal(t, RuntimeStatistics{
-		WindowTotal:    uint64(10),
-		WindowSegments: []uint64{10},
+		WindowTotal:            uint64(10),
+		WindowSegments:         []uint64{10},
+		WindowSegmentPenalties: []uint64{0},
+		WindowSegmentTimes:     []uint64{1000000},
+		MaxLoad:                uint64(100),
+		MaxPenaltyCap:          uint64(150),
+		UtilizationPercent:     float64(10),
+		AcceptedCount:          uint64(1),
 	}, stats)
 
 	ti.TimeTravel(500) // goto 1000500
@@ -242,8 +619,14 @@ func TestStats(t *testing.T) {
 	stats, err = ti.Instance.Stats(defaultTestTenantKey)
 	assert.Nil(t, err)
 	assert.Equal(t, RuntimeStatistics{
-		WindowTotal:    uint64(20),
-		WindowSegments: []uint64{20},
+		WindowTotal:            uint64(20),
+		WindowSegments:         []uint64{20},
+		WindowSegmentPenalties: []uint64{0},
+		WindowSegmentTimes:     []uint64{1000000},
+		MaxLoad:                uint64(100),
+		MaxPenaltyCap:          uint64(150),
+		UtilizationPercent:     float64(20),
+		AcceptedCount:          uint64(2),
 	}, stats)
 
 	ti.TimeTravel(500) // goto 1001000
@@ -253,8 +636,14 @@ func TestStats(t *testing.T) {
 	stats, err = ti.Instance.Stats(defaultTestTenantKey)
 	assert.Nil(t, err)
 	assert.Equal(t, RuntimeStatistics{
-		WindowTotal:    uint64(50),
-		WindowSegments: []uint64{30, 20},
+		WindowTotal:            uint64(50),
+		WindowSegments:         []uint64{30, 20},
+		WindowSegmentPenalties: []uint64{0, 0},
+		WindowSegmentTimes:     []uint64{1001000, 1000000},
+		MaxLoad:                uint64(100),
+		MaxPenaltyCap:          uint64(150),
+		UtilizationPercent:     float64(50),
+		AcceptedCount:          uint64(3),
 	}, stats)
 
 	ti.TimeTravel(999) // goto 1001999
@@ -280,8 +669,699 @@ func TestStats(t *testing.T) {
 	stats, err = ti.Instance.Stats(defaultTestTenantKey)
 	assert.Nil(t, err)
 	assert.Equal(t, RuntimeStatistics{
-		WindowTotal:    uint64(0),
-		WindowSegments: []uint64{0, 0, 0},
+		WindowTotal:            uint64(0),
+		WindowSegments:         []uint64{0, 0, 0},
+		WindowSegmentPenalties: []uint64{0, 0, 0},
+		WindowSegmentTimes:     []uint64{1011000, 1010000, 1002000},
+		MaxLoad:                uint64(100),
+		MaxPenaltyCap:          uint64(150),
+		UtilizationPercent:     float64(0),
+		AcceptedCount:          uint64(4),
 	}, stats)
 
 }
+
+func TestQuantizeLoad(t *testing.T) {
+	ti := buildInstance(t, func(config *Config) {
+		config.LoadQuantum = 10
+	})
+
+	assert.Equal(t, uint64(0), ti.Instance.quantizeLoad(0))
+	assert.Equal(t, uint64(10), ti.Instance.quantizeLoad(1))
+	assert.Equal(t, uint64(10), ti.Instance.quantizeLoad(9))
+	assert.Equal(t, uint64(10), ti.Instance.quantizeLoad(10))
+	assert.Equal(t, uint64(20), ti.Instance.quantizeLoad(11))
+	assert.Equal(t, uint64(math.MaxUint64), ti.Instance.quantizeLoad(math.MaxUint64-1))
+
+	// without a quantum loads are left untouched
+	ti = buildDefaultInstance(t)
+	assert.Equal(t, uint64(1), ti.Instance.quantizeLoad(1))
+	assert.Equal(t, uint64(11), ti.Instance.quantizeLoad(11))
+}
+
+func TestSubmitWithLoadQuantum(t *testing.T) {
+	ti := buildInstance(t, func(config *Config) {
+		config.LoadQuantum = 10
+	})
+
+	// each small request is charged a full quantum
+	for i := 0; i < 9; i++ {
+		assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 1)).Accepted)
+	}
+	ti.AssertWindowStatus(t, defaultTestTenantKey, 90, "1000000:90")
+
+	assert.True(t, noErrors(ti.Instance.Probe(defaultTestTenantKey, 10)).(bool))
+	assert.False(t, noErrors(ti.Instance.Probe(defaultTestTenantKey, 11)).(bool))
+
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 3)).Accepted)
+	ti.AssertWindowStatus(t, defaultTestTenantKey, 100, "1000000:100")
+
+	assert.False(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 1)).Accepted)
+}
+
+func TestListTenants(t *testing.T) {
+	ti := buildDefaultInstance(t)
+
+	assert.Equal(t, []string{}, ti.Instance.ListTenants())
+
+	_, _ = ti.Instance.Submit("first", 1)
+	_, _ = ti.Instance.Probe("second", 1)
+	_, _ = ti.Instance.Submit("first", 1)
+
+	tenants := ti.Instance.ListTenants()
+	assert.ElementsMatch(t, []string{"first", "second"}, tenants)
+
+	// the returned slice is a copy
+	tenants[0] = "changed"
+	assert.ElementsMatch(t, []string{"first", "second"}, ti.Instance.ListTenants())
+}
+
+func TestPrewarmTenants(t *testing.T) {
+	ti := buildDefaultInstance(t)
+
+	ti.Instance.PrewarmTenants("first", "second")
+	assert.ElementsMatch(t, []string{"first", "second"}, ti.Instance.ListTenants())
+	assert.Equal(t, 0, ti.Instance.getTenant("first").WindowQueue.Len())
+
+	assert.True(t, submitNoError(ti.Instance.Submit("first", 30)).Accepted)
+
+	// tenants already holding some state are not affected
+	ti.Instance.PrewarmTenants("first")
+	ti.AssertWindowStatus(t, "first", 30, "1000000:30")
+}
+
+func TestEvictTenant(t *testing.T) {
+	ti := buildDefaultInstance(t)
+
+	assert.False(t, ti.Instance.EvictTenant(defaultTestTenantKey))
+
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 100)).Accepted)
+	assert.False(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 1)).Accepted)
+	assert.True(t, submitNoError(ti.Instance.Submit("other", 10)).Accepted)
+
+	assert.True(t, ti.Instance.EvictTenant(defaultTestTenantKey))
+	assert.False(t, ti.Instance.EvictTenant(defaultTestTenantKey))
+	assert.ElementsMatch(t, []string{"other"}, ti.Instance.ListTenants())
+
+	// a new request starts from a fresh state
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 5)).Accepted)
+	ti.AssertWindowStatus(t, defaultTestTenantKey, 5, "1000000:5")
+	assert.False(t, ti.Instance.getTenant(defaultTestTenantKey).WasOver)
+
+	// other tenants are not affected
+	ti.AssertWindowStatus(t, "other", 10, "1000000:10")
+}
+
+func TestSubmitOnClosedLimiter(t *testing.T) {
+	ti := buildDefaultInstance(t)
+
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 1)).Accepted)
+	assert.Nil(t, ti.Instance.Close())
+
+	_, err := ti.Instance.Probe(defaultTestTenantKey, 1)
+	assert.ErrorIs(t, err, ErrLimiterClosed)
+
+	res, err := ti.Instance.Submit(defaultTestTenantKey, 1)
+	assert.ErrorIs(t, err, ErrLimiterClosed)
+	assert.False(t, res.Accepted)
+
+	err = ti.Instance.SubmitUntil(defaultTestTenantKey, 1, time.Second)
+	assert.ErrorIs(t, err, ErrLimiterClosed)
+}
+
+func TestResetTenant(t *testing.T) {
+	ti := buildDefaultInstance(t)
+
+	// no-op for unknown tenants
+	assert.Nil(t, ti.Instance.ResetTenant(defaultTestTenantKey))
+	assert.Equal(t, []string{}, ti.Instance.ListTenants())
+
+	applySingleWindowLoadDistribution(t, ti, defaultTestTenantKey)
+	assert.False(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 50)).Accepted)
+	assert.True(t, ti.Instance.getTenant(defaultTestTenantKey).WasOver)
+	versionBefore := ti.Instance.getTenant(defaultTestTenantKey).Version
+
+	assert.Nil(t, ti.Instance.ResetTenant(defaultTestTenantKey))
+
+	ti.AssertWindowStatus(t, defaultTestTenantKey, 0)
+	assert.False(t, ti.Instance.getTenant(defaultTestTenantKey).WasOver)
+	assert.Equal(t, versionBefore+1, ti.Instance.getTenant(defaultTestTenantKey).Version)
+
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 100)).Accepted)
+	ti.AssertWindowStatus(t, defaultTestTenantKey, 100, "1009000:100")
+}
+
+func TestIsOverloaded(t *testing.T) {
+	ti := buildDefaultInstance(t)
+
+	// unknown tenants are not overloaded
+	assert.False(t, noErrors(ti.Instance.IsOverloaded(defaultTestTenantKey)).(bool))
+
+	applySingleWindowLoadDistribution(t, ti, defaultTestTenantKey)
+	assert.False(t, noErrors(ti.Instance.IsOverloaded(defaultTestTenantKey)).(bool))
+
+	assert.False(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 50)).Accepted)
+	assert.True(t, noErrors(ti.Instance.IsOverloaded(defaultTestTenantKey)).(bool))
+	assert.False(t, noErrors(ti.Instance.IsOverloaded("other")).(bool))
+
+	// the overload status is cleared by the next accepted request
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 1)).Accepted)
+	assert.False(t, noErrors(ti.Instance.IsOverloaded(defaultTestTenantKey)).(bool))
+}
+
+func TestStatsAll(t *testing.T) {
+	ti := buildDefaultInstance(t)
+
+	all, err := ti.Instance.StatsAll()
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]RuntimeStatistics{}, all)
+
+	assert.True(t, submitNoError(ti.Instance.Submit("first", 10)).Accepted)
+	ti.TimeTravel(1000)
+	assert.True(t, submitNoError(ti.Instance.Submit("first", 20)).Accepted)
+	assert.True(t, submitNoError(ti.Instance.Submit("second", 50)).Accepted)
+
+	all, err = ti.Instance.StatsAll()
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]RuntimeStatistics{
+		"first": {
+			WindowTotal:            uint64(30),
+			WindowSegments:         []uint64{20, 10},
+			WindowSegmentPenalties: []uint64{0, 0},
+			WindowSegmentTimes:     []uint64{1001000, 1000000},
+			MaxLoad:                uint64(100),
+			MaxPenaltyCap:          uint64(150),
+			UtilizationPercent:     float64(30),
+			AcceptedCount:          uint64(2),
+		},
+		"second": {
+			WindowTotal:            uint64(50),
+			WindowSegments:         []uint64{50},
+			WindowSegmentPenalties: []uint64{0},
+			WindowSegmentTimes:     []uint64{1001000},
+			MaxLoad:                uint64(100),
+			MaxPenaltyCap:          uint64(150),
+			UtilizationPercent:     float64(50),
+			AcceptedCount:          uint64(1),
+		},
+	}, all)
+}
+
+func TestStatsUtilization(t *testing.T) {
+	ti := buildInstance(t, func(config *Config) {
+		config.OverstepPenaltyFactor = 0.2
+	})
+
+	stats, err := ti.Instance.Stats(defaultTestTenantKey)
+	assert.Nil(t, err)
+	assert.Equal(t, float64(0), stats.Utilization())
+
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 80)).Accepted)
+	stats, err = ti.Instance.Stats(defaultTestTenantKey)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(100), stats.MaxLoad)
+	assert.Equal(t, 0.8, stats.Utilization())
+
+	// penalties can push the utilization above 1.0
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 20)).Accepted)
+	assert.False(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 1)).Accepted)
+	stats, err = ti.Instance.Stats(defaultTestTenantKey)
+	assert.Nil(t, err)
+	assert.Equal(t, 1.2, stats.Utilization())
+	assert.Equal(t, uint64(150), stats.MaxPenaltyCap)
+
+	// lowering the max load does not push the utilization above the penalty cap
+	assert.Nil(t, ti.Instance.SetMaxLoad(50))
+	stats, err = ti.Instance.Stats(defaultTestTenantKey)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(120), stats.WindowTotal)
+	assert.Equal(t, uint64(75), stats.MaxPenaltyCap)
+	assert.Equal(t, 1.5, stats.Utilization())
+
+	assert.Equal(t, float64(0), RuntimeStatistics{}.Utilization())
+	assert.Equal(t, 2.0, RuntimeStatistics{WindowTotal: 200, MaxLoad: 100}.Utilization())
+}
+
+func TestTimeToAvailable(t *testing.T) {
+	ti := buildDefaultInstance(t)
+	applyMultiWindowConstantLoadDistribution(t, ti, defaultTestTenantKey, 8)
+
+	// goto 1019200
+	ti.TimeTravel(200)
+
+	// 20 currently available
+	assert.Equal(t, time.Duration(0), noErrors(ti.Instance.TimeToAvailable(defaultTestTenantKey, 20)))
+
+	// to free up three segments we have to wait 800 + 1000 + 1000 ms
+	versionBefore := ti.Instance.getTenant(defaultTestTenantKey).Version
+	assert.Equal(t, 2800*time.Millisecond, noErrors(ti.Instance.TimeToAvailable(defaultTestTenantKey, 40)))
+
+	// nothing was submitted and no penalty was applied
+	assert.Equal(t, versionBefore, ti.Instance.getTenant(defaultTestTenantKey).Version)
+	assert.False(t, ti.Instance.getTenant(defaultTestTenantKey).WasOver)
+
+	_, err := ti.Instance.TimeToAvailable(defaultTestTenantKey, 101)
+	assert.NotNil(t, err)
+
+	ti = buildInstance(t, func(config *Config) {
+		config.SkipRetryInComputing = true
+	})
+	_, err = ti.Instance.TimeToAvailable(defaultTestTenantKey, 1)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "SkipRetryInComputing")
+}
+
+func TestNextAvailableAt(t *testing.T) {
+	ti := buildInstance(t, func(config *Config) {
+		config.MaxRetryIn = time.Second
+	})
+	applyMultiWindowConstantLoadDistribution(t, ti, defaultTestTenantKey, 8)
+
+	// goto 1019200
+	ti.TimeTravel(200)
+
+	assert.Equal(t, time.UnixMilli(1019200), noErrors(ti.Instance.NextAvailableAt(defaultTestTenantKey, 20)))
+
+	// the actual time is returned regardless of MaxRetryIn
+	assert.Equal(t, time.UnixMilli(1022000), noErrors(ti.Instance.NextAvailableAt(defaultTestTenantKey, 40)))
+
+	_, err := ti.Instance.NextAvailableAt(defaultTestTenantKey, 101)
+	assert.NotNil(t, err)
+
+	ti = buildInstance(t, func(config *Config) {
+		config.SkipRetryInComputing = true
+	})
+	_, err = ti.Instance.NextAvailableAt(defaultTestTenantKey, 1)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "SkipRetryInComputing")
+}
+
+func TestRemainingCapacity(t *testing.T) {
+	ti := buildDefaultInstance(t)
+
+	assert.Equal(t, uint64(100), noErrors(ti.Instance.RemainingCapacity(defaultTestTenantKey)))
+
+	applyMultiWindowConstantLoadDistribution(t, ti, defaultTestTenantKey, 8)
+
+	// goto 1019200
+	ti.TimeTravel(200)
+	assert.Equal(t, uint64(20), noErrors(ti.Instance.RemainingCapacity(defaultTestTenantKey)))
+
+	// goto 1020000, computed after the rotation without changing the window
+	ti.TimeTravel(800)
+	versionBefore := ti.Instance.getTenant(defaultTestTenantKey).Version
+	assert.Equal(t, uint64(28), noErrors(ti.Instance.RemainingCapacity(defaultTestTenantKey)))
+	assert.Equal(t, versionBefore, ti.Instance.getTenant(defaultTestTenantKey).Version)
+	assert.Equal(t, uint64(80), ti.Instance.getTenant(defaultTestTenantKey).WindowTotal)
+
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 28)).Accepted)
+	assert.Equal(t, uint64(0), noErrors(ti.Instance.RemainingCapacity(defaultTestTenantKey)))
+
+	// clamped at zero when the window holds penalties over MaxLoad
+	ti = buildInstance(t, func(config *Config) {
+		config.OverstepPenaltyFactor = 0.5
+		config.MaxPenaltyCapFactor = 1.0
+	})
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 90)).Accepted)
+	assert.False(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 20)).Accepted)
+	assert.True(t, ti.Instance.getTenant(defaultTestTenantKey).WindowTotal > 100)
+	assert.Equal(t, uint64(0), noErrors(ti.Instance.RemainingCapacity(defaultTestTenantKey)))
+}
+
+func TestCurrentRate(t *testing.T) {
+	ti := buildDefaultInstance(t)
+
+	// no state is created for a missing tenant
+	assert.Equal(t, 0.0, noErrors(ti.Instance.CurrentRate(defaultTestTenantKey)))
+	assert.Equal(t, []string{}, ti.Instance.ListTenants())
+
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 50)).Accepted)
+	assert.Equal(t, 5.0, noErrors(ti.Instance.CurrentRate(defaultTestTenantKey)))
+
+	// goto 1005000
+	ti.TimeTravel(5000)
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 25)).Accepted)
+	assert.Equal(t, 7.5, noErrors(ti.Instance.CurrentRate(defaultTestTenantKey)))
+
+	// goto 1010000, computed after the rotation without changing the window
+	ti.TimeTravel(5000)
+	assert.Equal(t, 2.5, noErrors(ti.Instance.CurrentRate(defaultTestTenantKey)))
+	assert.Equal(t, uint64(75), ti.Instance.getTenant(defaultTestTenantKey).WindowTotal)
+	assert.Equal(t, uint64(1005000), ti.Instance.getTenant(defaultTestTenantKey).LastAccess)
+
+	_, err := ti.Instance.CurrentRate("a;b")
+	assert.NotNil(t, err)
+}
+
+func TestCurrentRateWithSyncAdapter(t *testing.T) {
+	adapter := NewInMemorySyncAdapter()
+
+	first := buildInstance(t, func(c *Config) {
+		c.SyncAdapter = adapter
+	})
+	second := buildInstance(t, func(c *Config) {
+		c.SyncAdapter = adapter
+	})
+
+	assert.True(t, submitNoError(first.Instance.Submit(defaultTestTenantKey, 50)).Accepted)
+
+	// the remote status is used without creating local state
+	assert.Equal(t, 5.0, noErrors(second.Instance.CurrentRate(defaultTestTenantKey)))
+	assert.Equal(t, []string{}, second.Instance.ListTenants())
+}
+
+func TestWindowBounds(t *testing.T) {
+	ti := buildDefaultInstance(t)
+
+	start, end, err := ti.Instance.WindowBounds(defaultTestTenantKey)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(991000), start.UnixMilli())
+	assert.Equal(t, int64(1001000), end.UnixMilli())
+
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 10)).Accepted)
+
+	// goto 1001500, computed after the rotation without changing the window
+	ti.TimeTravel(1500)
+	versionBefore := ti.Instance.getTenant(defaultTestTenantKey).Version
+	start, end, err = ti.Instance.WindowBounds(defaultTestTenantKey)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(992000), start.UnixMilli())
+	assert.Equal(t, int64(1002000), end.UnixMilli())
+	assert.Equal(t, versionBefore, ti.Instance.getTenant(defaultTestTenantKey).Version)
+	ti.AssertWindowStatus(t, defaultTestTenantKey, 10, "1000000:10")
+
+	// a fixed window spans a single segment
+	ti = buildInstance(t, func(config *Config) {
+		config.WindowSegmentSize = 0
+		config.Algorithm = AlgorithmFixedWindow
+	})
+	ti.TimeTravel(2500)
+	start, end, err = ti.Instance.WindowBounds(defaultTestTenantKey)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1000000), start.UnixMilli())
+	assert.Equal(t, int64(1010000), end.UnixMilli())
+
+	_, _, err = ti.Instance.WindowBounds("a;b")
+	assert.NotNil(t, err)
+}
+
+func TestProbeReadOnly(t *testing.T) {
+	ti := buildDefaultInstance(t)
+	applyMultiWindowConstantLoadDistribution(t, ti, defaultTestTenantKey, 8)
+
+	// goto 1020000, rotation would be required
+	ti.TimeTravel(1000)
+
+	tenant := ti.Instance.getTenant(defaultTestTenantKey)
+	versionBefore := tenant.Version
+	lastAccessBefore := tenant.LastAccess
+	segmentsBefore := tenant.WindowQueue.Len()
+
+	// the oldest segment is excluded without being removed
+	assert.True(t, noErrors(ti.Instance.ProbeReadOnly(defaultTestTenantKey, 28)).(bool))
+	assert.False(t, noErrors(ti.Instance.ProbeReadOnly(defaultTestTenantKey, 29)).(bool))
+
+	assert.Equal(t, versionBefore, tenant.Version)
+	assert.Equal(t, lastAccessBefore, tenant.LastAccess)
+	assert.Equal(t, segmentsBefore, tenant.WindowQueue.Len())
+	assert.Equal(t, uint64(80), tenant.WindowTotal)
+
+	// same outcome as Probe
+	assert.True(t, noErrors(ti.Instance.Probe(defaultTestTenantKey, 28)).(bool))
+	assert.False(t, noErrors(ti.Instance.Probe(defaultTestTenantKey, 29)).(bool))
+
+	// no state is created for unknown tenants
+	assert.True(t, noErrors(ti.Instance.ProbeReadOnly("other", 100)).(bool))
+	assert.False(t, noErrors(ti.Instance.ProbeReadOnly("other", 101)).(bool))
+	assert.NotContains(t, ti.Instance.ListTenants(), "other")
+
+	_, err := ti.Instance.ProbeReadOnly("a;b", 1)
+	assert.NotNil(t, err)
+}
+
+func TestProbeMany(t *testing.T) {
+	ti := buildDefaultInstance(t)
+	applyMultiWindowConstantLoadDistribution(t, ti, defaultTestTenantKey, 8)
+
+	// goto 1019200, rotation would be required for 1020000
+	ti.TimeTravel(200)
+
+	versionBefore := ti.Instance.getTenant(defaultTestTenantKey).Version
+
+	res, err := ti.Instance.ProbeMany(defaultTestTenantKey, []uint64{40, 10, 20, 21, 101})
+	assert.Nil(t, err)
+	assert.Equal(t, []bool{false, true, true, false, false}, res)
+
+	// the results match the single probes
+	for i, load := range []uint64{40, 10, 20, 21, 101} {
+		accepted, err := ti.Instance.Probe(defaultTestTenantKey, load)
+		assert.Nil(t, err)
+		assert.Equal(t, res[i], accepted)
+	}
+
+	assert.Equal(t, versionBefore, ti.Instance.getTenant(defaultTestTenantKey).Version)
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 20)).Accepted)
+
+	_, err = ti.Instance.ProbeMany(defaultTestTenantKey, nil)
+	assert.NotNil(t, err)
+}
+
+func TestProbeWithDetails(t *testing.T) {
+	ti := buildInstance(t, func(config *Config) {
+		config.OverstepPenaltyFactor = 0.2
+		config.RequestOverheadPenaltyFactor = 1.0
+	})
+	applyMultiWindowConstantLoadDistribution(t, ti, defaultTestTenantKey, 8)
+
+	// goto 1019200, rotation would be required for 1020000
+	ti.TimeTravel(200)
+
+	res, err := ti.Instance.ProbeWithDetails(defaultTestTenantKey, 20)
+	assert.Nil(t, err)
+	assert.Equal(t, SubmitResult{Accepted: true}, res)
+
+	versionBefore := ti.Instance.getTenant(defaultTestTenantKey).Version
+	res, err = ti.Instance.ProbeWithDetails(defaultTestTenantKey, 40)
+	assert.Nil(t, err)
+	assert.Equal(t, SubmitResult{
+		Accepted:         false,
+		RetryInAvailable: true,
+		RetryIn:          2800 * time.Millisecond,
+	}, res)
+
+	// probing again does not apply penalties
+	res, err = ti.Instance.ProbeWithDetails(defaultTestTenantKey, 40)
+	assert.Nil(t, err)
+	assert.Equal(t, 2800*time.Millisecond, res.RetryIn)
+
+	// a load that will never fit has no RetryIn
+	res, err = ti.Instance.ProbeWithDetails(defaultTestTenantKey, 101)
+	assert.Nil(t, err)
+	assert.False(t, res.Accepted)
+	assert.False(t, res.RetryInAvailable)
+
+	// move to a time requiring rotation
+	ti.TimeTravel(800)
+	res, err = ti.Instance.ProbeWithDetails(defaultTestTenantKey, 28)
+	assert.Nil(t, err)
+	assert.True(t, res.Accepted)
+
+	tenant := ti.Instance.getTenant(defaultTestTenantKey)
+	assert.Equal(t, versionBefore, tenant.Version)
+	assert.False(t, tenant.WasOver)
+	assert.Equal(t, uint64(80), tenant.WindowTotal)
+	assert.Equal(t, uint64(1019000), tenant.WindowQueue.Front().(*windowSegment).StartTime)
+}
+
+func TestSubmitCost(t *testing.T) {
+	costs := map[string]uint64{
+		"GET /items":  1,
+		"POST /items": 10,
+		"GET /report": 50,
+	}
+
+	ti := buildInstance(t, func(config *Config) {
+		config.CostFunc = func(meta interface{}) uint64 {
+			return costs[meta.(string)]
+		}
+	})
+
+	assert.True(t, submitNoError(ti.Instance.SubmitCost(defaultTestTenantKey, "GET /report")).Accepted)
+	assert.True(t, submitNoError(ti.Instance.SubmitCost(defaultTestTenantKey, "POST /items")).Accepted)
+	assert.True(t, submitNoError(ti.Instance.SubmitCost(defaultTestTenantKey, "GET /items")).Accepted)
+	ti.AssertWindowStatus(t, defaultTestTenantKey, 61, "1000000:61")
+
+	assert.False(t, submitNoError(ti.Instance.SubmitCost(defaultTestTenantKey, "GET /report")).Accepted)
+
+	ti = buildDefaultInstance(t)
+	_, err := ti.Instance.SubmitCost(defaultTestTenantKey, "GET /items")
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "CostFunc")
+}
+
+func TestRefund(t *testing.T) {
+	ti := buildDefaultInstance(t)
+
+	applySingleWindowLoadDistribution(t, ti, defaultTestTenantKey)
+	versionBefore := ti.Instance.getTenant(defaultTestTenantKey).Version
+
+	assert.Nil(t, ti.Instance.Refund(defaultTestTenantKey, 20))
+	ti.AssertWindowStatus(
+		t,
+		defaultTestTenantKey,
+		52,
+		"1009000:0",
+		"1008000:0",
+		"1005000:9",
+		"1004000:8",
+		"1002000:20",
+		"1001000:10",
+		"1000000:5",
+	)
+	assert.True(t, ti.Instance.getTenant(defaultTestTenantKey).Version > versionBefore)
+
+	// refunding more than the active load clamps to zero
+	assert.Nil(t, ti.Instance.Refund(defaultTestTenantKey, 1000))
+	assert.Equal(t, uint64(0), ti.Instance.getTenant(defaultTestTenantKey).WindowTotal)
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 100)).Accepted)
+}
+
+func TestRefundKeepsPenalties(t *testing.T) {
+	ti := buildInstance(t, func(config *Config) {
+		config.OverstepPenaltyFactor = 0.2
+	})
+
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 90)).Accepted)
+	assert.False(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 20)).Accepted)
+	ti.AssertWindowStatus(t, defaultTestTenantKey, 110, "1000000:110")
+
+	// refunding more than the accepted load leaves the penalty in place
+	assert.Nil(t, ti.Instance.Refund(defaultTestTenantKey, 1000))
+	ti.AssertWindowStatus(t, defaultTestTenantKey, 20, "1000000:20")
+	assert.Equal(t, uint64(20), ti.Instance.getTenant(defaultTestTenantKey).WindowQueue.Front().(*windowSegment).PenaltyValue)
+}
+
+func TestSubmitBatch(t *testing.T) {
+	ti := buildDefaultInstance(t)
+	applyMultiWindowConstantLoadDistribution(t, ti, defaultTestTenantKey, 8)
+
+	// goto 1019200, 20 currently available
+	ti.TimeTravel(200)
+
+	res := submitNoError(ti.Instance.SubmitBatch(defaultTestTenantKey, []uint64{5, 10, 10}))
+	assert.False(t, res.Accepted)
+	assert.True(t, res.RetryInAvailable)
+	assert.Equal(t, int64(800), res.RetryIn.Milliseconds())
+
+	// no partial state was applied
+	assert.Equal(t, uint64(80), ti.Instance.getTenant(defaultTestTenantKey).WindowTotal)
+
+	res = submitNoError(ti.Instance.SubmitBatch(defaultTestTenantKey, []uint64{5, 10, 5}))
+	assert.True(t, res.Accepted)
+	assert.Equal(t, uint64(100), ti.Instance.getTenant(defaultTestTenantKey).WindowTotal)
+
+	_, err := ti.Instance.SubmitBatch(defaultTestTenantKey, []uint64{})
+	assert.NotNil(t, err)
+
+	_, err = ti.Instance.SubmitBatch(defaultTestTenantKey, []uint64{math.MaxUint64, 1})
+	assert.NotNil(t, err)
+}
+
+func TestSubmitBatchWithLoadQuantum(t *testing.T) {
+	ti := buildInstance(t, func(config *Config) {
+		config.LoadQuantum = 10
+	})
+
+	// each load is rounded up separately
+	assert.True(t, submitNoError(ti.Instance.SubmitBatch(defaultTestTenantKey, []uint64{1, 1, 1})).Accepted)
+	ti.AssertWindowStatus(t, defaultTestTenantKey, 30, "1000000:30")
+}
+
+func TestSubmissionCounters(t *testing.T) {
+	ti := buildDefaultInstance(t)
+
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 60)).Accepted)
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 30)).Accepted)
+	assert.False(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 20)).Accepted)
+	assert.False(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 20)).Accepted)
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 10)).Accepted)
+
+	stats, err := ti.Instance.Stats(defaultTestTenantKey)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(3), stats.AcceptedCount)
+	assert.Equal(t, uint64(2), stats.RejectedCount)
+
+	// probing does not count as a submission
+	_, _ = ti.Instance.Probe(defaultTestTenantKey, 50)
+
+	stats, err = ti.Instance.Stats(defaultTestTenantKey)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(3), stats.AcceptedCount)
+	assert.Equal(t, uint64(2), stats.RejectedCount)
+}
+
+func TestSubmitNearMaxLoadDoesNotOverflow(t *testing.T) {
+	ti := buildDefaultInstance(t)
+
+	res := submitNoError(ti.Instance.Submit(defaultTestTenantKey, math.MaxUint64))
+	assert.False(t, res.Accepted)
+	assert.False(t, res.RetryInAvailable)
+	ti.AssertWindowStatus(t, defaultTestTenantKey, 0, "1000000:0")
+
+	ti = buildInstance(t, func(config *Config) {
+		config.MaxLoad = math.MaxUint64 - 10
+		config.OverstepPenaltyFactor = 1.0
+	})
+
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, math.MaxUint64-20)).Accepted)
+
+	// the sum would wrap around to a small value and be accepted
+	res = submitNoError(ti.Instance.Submit(defaultTestTenantKey, 50))
+	assert.False(t, res.Accepted)
+	assert.True(t, res.RetryInAvailable)
+
+	// the penalty saturates the window instead of wrapping around
+	tenant := ti.Instance.getTenant(defaultTestTenantKey)
+	assert.Equal(t, uint64(math.MaxUint64), tenant.WindowTotal)
+	assert.Equal(t, uint64(math.MaxUint64), tenant.WindowQueue.Front().(*windowSegment).total())
+
+	res = submitNoError(ti.Instance.Submit(defaultTestTenantKey, 1))
+	assert.False(t, res.Accepted)
+	assert.Equal(t, uint64(math.MaxUint64), ti.Instance.getTenant(defaultTestTenantKey).WindowTotal)
+}
+
+func TestSubmitPermanentlyRejected(t *testing.T) {
+	ti := buildInstance(t, func(config *Config) {
+		config.OverstepPenaltyFactor = 0.5
+		config.RequestOverheadPenaltyFactor = 0.5
+	})
+
+	// a load over MaxLoad is never penalized
+	res := submitNoError(ti.Instance.Submit(defaultTestTenantKey, 101))
+	assert.False(t, res.Accepted)
+	assert.True(t, res.PermanentlyRejected)
+	assert.False(t, res.RetryInAvailable)
+	assert.False(t, noErrors(ti.Instance.IsOverloaded(defaultTestTenantKey)).(bool))
+	ti.AssertWindowStatus(t, defaultTestTenantKey, 0, "1000000:0")
+
+	details := submitNoError(ti.Instance.ProbeWithDetails(defaultTestTenantKey, 101))
+	assert.True(t, details.PermanentlyRejected)
+	assert.False(t, details.RetryInAvailable)
+
+	// a temporarily full window is not a permanent rejection
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 90)).Accepted)
+	res = submitNoError(ti.Instance.Submit(defaultTestTenantKey, 20))
+	assert.False(t, res.Accepted)
+	assert.False(t, res.PermanentlyRejected)
+	assert.True(t, res.RetryInAvailable)
+
+	// not even while overloaded
+	windowTotal := ti.Instance.getTenant(defaultTestTenantKey).WindowTotal
+	res = submitNoError(ti.Instance.Submit(defaultTestTenantKey, 200))
+	assert.True(t, res.PermanentlyRejected)
+	assert.Equal(t, windowTotal, ti.Instance.getTenant(defaultTestTenantKey).WindowTotal)
+
+	stats, err := ti.Instance.Stats(defaultTestTenantKey)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(3), stats.RejectedCount)
+}
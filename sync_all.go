@@ -0,0 +1,257 @@
+package goll
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// BatchSyncAdapter can be optionally implemented by a SyncAdapter
+// to fetch and write the status of many tenants in a single round trip.
+//
+// It is used by SyncAll: adapters not implementing it
+// are called once per tenant.
+type BatchSyncAdapter interface {
+	SyncAdapter
+
+	// FetchAll reads the status of the given tenants.
+	// Tenants with no status on the store can be omitted from the result.
+	FetchAll(ctx context.Context, tenantKeys []string) (map[string]string, error)
+
+	// WriteAll writes the status of the given tenants.
+	WriteAll(ctx context.Context, serializedData map[string]string) error
+}
+
+// fetchStatuses reads the status of the given tenants from the adapter,
+// in a single call if the adapter implements BatchSyncAdapter.
+func fetchStatuses(ctx context.Context, adapter SyncAdapter, tenantKeys []string) (map[string]string, error) {
+	if batch, ok := adapter.(BatchSyncAdapter); ok {
+		return batch.FetchAll(ctx, tenantKeys)
+	}
+
+	out := make(map[string]string, len(tenantKeys))
+	for _, tenantKey := range tenantKeys {
+		status, err := adapter.Fetch(ctx, tenantKey)
+		if err != nil {
+			return nil, err
+		}
+		out[tenantKey] = status
+	}
+	return out, nil
+}
+
+// writeStatuses writes the status of the given tenants to the adapter,
+// in a single call if the adapter implements BatchSyncAdapter.
+func writeStatuses(ctx context.Context, adapter SyncAdapter, serializedData map[string]string) error {
+	if len(serializedData) == 0 {
+		return nil
+	}
+	if batch, ok := adapter.(BatchSyncAdapter); ok {
+		return batch.WriteAll(ctx, serializedData)
+	}
+
+	for tenantKey, status := range serializedData {
+		if err := adapter.Write(ctx, tenantKey, status); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// syncGroup holds the tenants synchronized against the same adapter.
+type syncGroup struct {
+	adapter    SyncAdapter
+	tenantKeys []string
+}
+
+// groupBySyncAdapter groups the given tenants by the adapter they are synchronized with,
+// skipping the tenants that are not synchronized at all.
+//
+// The tenants are sorted so that instances locking many of them
+// always acquire the locks in the same order.
+func groupBySyncAdapter(tenantKeys []string, adapterFor func(tenantKey string) SyncAdapter) []*syncGroup {
+	sort.Strings(tenantKeys)
+
+	groups := make([]*syncGroup, 0)
+	byAdapter := make(map[SyncAdapter]*syncGroup)
+
+	for _, tenantKey := range tenantKeys {
+		adapter := adapterFor(tenantKey)
+		if adapter == nil {
+			continue
+		}
+		group, exists := byAdapter[adapter]
+		if !exists {
+			group = &syncGroup{adapter: adapter}
+			byAdapter[adapter] = group
+			groups = append(groups, group)
+		}
+		group.tenantKeys = append(group.tenantKeys, tenantKey)
+	}
+
+	return groups
+}
+
+// syncGroupWith locks all the tenants in the group, fetches their status
+// and passes it to the reconcile function, then writes back the statuses
+// it returns before releasing the locks.
+func syncGroupWith(
+	ctx context.Context, l Logger, group *syncGroup,
+	reconcile func(statuses map[string]string) (map[string]string, error),
+) (written map[string]string, err error) {
+	adapter := group.adapter
+
+	locked := make([]string, 0, len(group.tenantKeys))
+	defer func() {
+		for _, tenantKey := range locked {
+			if rerr := adapter.Unlock(ctx, tenantKey); rerr != nil {
+				logInfow(l, "[sync all] could not release lock", "tenantKey", tenantKey, "error", rerr)
+			}
+		}
+	}()
+
+	for _, tenantKey := range group.tenantKeys {
+		if err := adapter.Lock(ctx, tenantKey); err != nil {
+			return nil, fmt.Errorf("error acquiring lock: %v", err.Error())
+		}
+		locked = append(locked, tenantKey)
+	}
+
+	statuses, err := fetchStatuses(ctx, adapter, group.tenantKeys)
+	if err != nil {
+		return nil, &SyncFailed{Operation: "fetch", Cause: err}
+	}
+
+	toWrite, rerr := reconcile(statuses)
+
+	if werr := writeStatuses(ctx, adapter, toWrite); werr != nil {
+		return nil, &SyncFailed{Operation: "write", Cause: werr}
+	}
+
+	logInfow(l, "[sync all] synchronized tenants", "fetched", len(statuses), "written", len(toWrite))
+	return toWrite, rerr
+}
+
+// SyncAll synchronizes all the tenants known to the local instance
+// with the remote store in as few adapter calls as possible.
+//
+// The remote status is restored for every tenant,
+// while the local status is written for the tenants with pending write-backs
+// and for the ones with no status on the remote store.
+// If the SyncAdapter implements BatchSyncAdapter
+// all the statuses are fetched and written with a single call.
+//
+// It does nothing when the limiter has no SyncAdapter.
+func (instance *loadLimiterDefaultImpl) SyncAll(ctx context.Context) error {
+	instance.Lock.Lock()
+	defer instance.Lock.Unlock()
+
+	if instance.closed {
+		return ErrLimiterClosed
+	}
+
+	var firstErr error
+
+	for _, group := range groupBySyncAdapter(instance.listTenants(), instance.syncAdapterFor) {
+		written, err := syncGroupWith(ctx, instance.Logger, group, func(statuses map[string]string) (map[string]string, error) {
+			var restoreErr error
+			toWrite := make(map[string]string)
+
+			for _, tenantKey := range group.tenantKeys {
+				tenant := instance.TenantData[tenantKey]
+
+				status := statuses[tenantKey]
+				if status == "" || instance.hasPendingWriteBack(tenantKey) {
+					// the local state is ahead of the remote one
+					toWrite[tenantKey] = instance.serializeStatus(tenantKey, tenant)
+					continue
+				}
+
+				if err := instance.restoreSerializedStatus(status, tenant); err != nil && restoreErr == nil {
+					restoreErr = &SyncFailed{Operation: "restore", Cause: err}
+				}
+			}
+
+			return toWrite, restoreErr
+		})
+
+		for tenantKey := range written {
+			delete(instance.pendingWriteBacks, tenantKey)
+		}
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
+
+// SyncAll synchronizes all the tenants known to the local instance
+// with the remote store in as few adapter calls as possible.
+//
+// The remote status is restored for every tenant,
+// while the local status is written for the tenants
+// with no status on the remote store.
+// If the SyncAdapter implements BatchSyncAdapter
+// all the statuses are fetched and written with a single call.
+//
+// It does nothing when the limiter has no SyncAdapter.
+func (instance *compositeLoadLimiterDefaultImpl) SyncAll(ctx context.Context) error {
+	instance.Lock.Lock()
+	defer instance.Lock.Unlock()
+
+	if instance.closed {
+		return ErrLimiterClosed
+	}
+
+	var firstErr error
+
+	for _, group := range groupBySyncAdapter(instance.listTenants(), instance.syncAdapterFor) {
+		_, err := syncGroupWith(ctx, instance.Logger, group, func(statuses map[string]string) (map[string]string, error) {
+			var restoreErr error
+			toWrite := make(map[string]string)
+
+			for _, tenantKey := range group.tenantKeys {
+				status := statuses[tenantKey]
+				if status == "" {
+					toWrite[tenantKey] = instance.serializeStatus(tenantKey)
+					continue
+				}
+
+				statusSplit := strings.Split(status, ";")
+				if len(statusSplit) != len(instance.Limiters) {
+					if restoreErr == nil {
+						restoreErr = &SyncFailed{Operation: "restore", Cause: errors.New("invalid number of sublimiters")}
+					}
+					continue
+				}
+				for i, limiter := range instance.Limiters {
+					err := limiter.restoreSerializedStatus(statusSplit[i], limiter.getTenant(tenantKey))
+					if err != nil && restoreErr == nil {
+						restoreErr = &SyncFailed{Operation: "restore", Cause: err}
+					}
+				}
+			}
+
+			return toWrite, restoreErr
+		})
+
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
+
+// SyncAll does nothing: the token bucket limiter does not support synchronization.
+func (instance *tokenBucketLimiterImpl) SyncAll(ctx context.Context) error {
+	return nil
+}
+
+// Ping always returns nil: the token bucket limiter does not support synchronization.
+func (instance *tokenBucketLimiterImpl) Ping(ctx context.Context) error {
+	return nil
+}
@@ -0,0 +1,199 @@
+package goll
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type batchTestSyncAdapter struct {
+	testSyncAdapter
+}
+
+func (c *batchTestSyncAdapter) FetchAll(arg context.Context, tenantKeys []string) (map[string]string, error) {
+	c.collector = append(c.collector, "FETCHALL "+strings.Join(tenantKeys, ","))
+	out := make(map[string]string)
+	for _, tenantKey := range tenantKeys {
+		out[tenantKey] = c.returning[tenantKey]
+	}
+	return out, nil
+}
+
+func (c *batchTestSyncAdapter) WriteAll(arg context.Context, serializedData map[string]string) error {
+	tenantKeys := make([]string, 0, len(serializedData))
+	for tenantKey, s := range serializedData {
+		tenantKeys = append(tenantKeys, tenantKey)
+		c.returning[tenantKey] = s
+	}
+	sort.Strings(tenantKeys)
+	c.collector = append(c.collector, "WRITEALL "+strings.Join(tenantKeys, ","))
+	return nil
+}
+
+func TestSyncAll(t *testing.T) {
+	adapter := testSyncAdapter{}
+	adapter.Clear()
+
+	ci := buildInstance(t, func(c *Config) {
+		c.SyncAdapter = &adapter
+	})
+
+	_, _ = ci.Instance.Submit("a", 5)
+	_, _ = ci.Instance.Submit("b", 7)
+
+	// simulate update from another client for the first tenant
+	// and a store that lost the status of the second one
+	adapter.Clear()
+	adapter.returning["a"] = "v1/10/15/0/1000000:15"
+
+	assert.Nil(t, ci.Instance.SyncAll(context.Background()))
+
+	assert.Equal(t, []string{
+		"LOCK a",
+		"LOCK b",
+		"FETCH a",
+		"FETCH b",
+		"WRITE b v2/ver=3/total=7/over=0/seg=1000000:7/acc=1/rej=0",
+		"UNLOCK a",
+		"UNLOCK b",
+	}, adapter.collector)
+
+	ci.AssertWindowStatus(t, "a", 15, "1000000:15")
+	ci.AssertWindowStatus(t, "b", 7, "1000000:7")
+}
+
+func TestSyncAllWithBatchAdapter(t *testing.T) {
+	adapter := batchTestSyncAdapter{}
+	adapter.Clear()
+
+	ci := buildInstance(t, func(c *Config) {
+		c.SyncAdapter = &adapter
+	})
+
+	_, _ = ci.Instance.Submit("a", 5)
+	_, _ = ci.Instance.Submit("b", 7)
+	_, _ = ci.Instance.Submit("c", 9)
+
+	adapter.Clear()
+	adapter.returning["b"] = "v1/10/15/0/1000000:15"
+
+	assert.Nil(t, ci.Instance.SyncAll(context.Background()))
+
+	assert.Equal(t, []string{
+		"LOCK a",
+		"LOCK b",
+		"LOCK c",
+		"FETCHALL a,b,c",
+		"WRITEALL a,c",
+		"UNLOCK a",
+		"UNLOCK b",
+		"UNLOCK c",
+	}, adapter.collector)
+
+	ci.AssertWindowStatus(t, "b", 15, "1000000:15")
+	assert.Equal(t, "v2/ver=3/total=9/over=0/seg=1000000:9/acc=1/rej=0", adapter.returning["c"])
+}
+
+func TestSyncAllWithAsyncWriteBack(t *testing.T) {
+	adapter := testSyncAdapter{}
+	adapter.Clear()
+
+	ci := buildInstance(t, func(c *Config) {
+		c.SyncAdapter = &adapter
+		c.AsyncWriteBack = true
+		c.WriteBackInterval = time.Hour
+	})
+	defer ci.Instance.Close()
+
+	_, _ = ci.Instance.Submit(defaultTestTenantKey, 5)
+	assert.True(t, ci.Instance.hasPendingWriteBack(defaultTestTenantKey))
+
+	// the pending changes are written even if the store holds an older status
+	adapter.Clear()
+	adapter.returning[defaultTestTenantKey] = "v1/1/0/0/"
+
+	assert.Nil(t, ci.Instance.SyncAll(context.Background()))
+
+	assert.Equal(t, []string{
+		"LOCK test",
+		"FETCH test",
+		"WRITE test v2/ver=3/total=5/over=0/seg=1000000:5/acc=1/rej=0",
+		"UNLOCK test",
+	}, adapter.collector)
+	assert.False(t, ci.Instance.hasPendingWriteBack(defaultTestTenantKey))
+}
+
+func TestSyncAllErrors(t *testing.T) {
+	adapter := testSyncAdapter{}
+	adapter.Clear()
+
+	ci := buildInstance(t, func(c *Config) {
+		c.SyncAdapter = &adapter
+	})
+
+	_, _ = ci.Instance.Submit("a", 5)
+	_, _ = ci.Instance.Submit("b", 7)
+
+	// locks acquired before the failure are released
+	adapter.Clear()
+	adapter.LockMock = func(ctx context.Context, tenantKey string) error {
+		if tenantKey == "b" {
+			return errors.New("lock failed")
+		}
+		return nil
+	}
+
+	err := ci.Instance.SyncAll(context.Background())
+	assert.NotNil(t, err)
+	assert.Equal(t, []string{
+		"LOCK a",
+		"LOCK b",
+		"UNLOCK a",
+	}, adapter.collector)
+
+	adapter.Clear()
+	adapter.FetchStatusMock = func(ctx context.Context, tenantKey string) (string, error) {
+		return "", errors.New("fetch failed")
+	}
+
+	err = ci.Instance.SyncAll(context.Background())
+	assert.ErrorIs(t, err, &SyncFailed{})
+	assert.Contains(t, err.Error(), "could not fetch status")
+
+	// no-op without a SyncAdapter
+	assert.Nil(t, buildDefaultInstance(t).Instance.SyncAll(context.Background()))
+}
+
+func TestSyncAllComposite(t *testing.T) {
+	adapter := batchTestSyncAdapter{}
+	adapter.Clear()
+
+	ci := buildCompositeInstance(t, func(c *CompositeConfig) {
+		c.SyncAdapter = &adapter
+	})
+
+	_, _ = ci.Instance.Submit("a", 5)
+	_, _ = ci.Instance.Submit("b", 7)
+
+	adapter.Clear()
+	adapter.returning["a"] = "v1/10/15/0/1000000:15;v1/10/15/0/1000000:15"
+
+	assert.Nil(t, ci.Instance.SyncAll(context.Background()))
+
+	assert.Equal(t, []string{
+		"LOCK a",
+		"LOCK b",
+		"FETCHALL a,b",
+		"WRITEALL b",
+		"UNLOCK a",
+		"UNLOCK b",
+	}, adapter.collector)
+
+	ci.AssertWindowStatus(t, "a", []uint64{15, 15}, "0:1000000:15, 1:1000000:15")
+	assert.Equal(t, "v2/ver=3/total=7/over=0/seg=1000000:7/acc=1/rej=0;v2/ver=3/total=7/over=0/seg=1000000:7/acc=1/rej=0", adapter.returning["b"])
+}
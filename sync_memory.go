@@ -0,0 +1,87 @@
+package goll
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// inMemorySyncAdapter is a SyncAdapter holding the statuses
+// in memory, with a mutual exclusion lock for each key.
+type inMemorySyncAdapter struct {
+	mutex sync.Mutex
+
+	// locks holds a semaphore for each key,
+	// full when the key is locked.
+	locks    map[string]chan struct{}
+	statuses map[string]string
+}
+
+// NewInMemorySyncAdapter returns a SyncAdapter that keeps
+// the statuses in memory.
+//
+// It is meant for tests and for synchronizing multiple limiters
+// living in the same process: share the same adapter among them
+// to experiment with the clustering semantics without an external store.
+func NewInMemorySyncAdapter() SyncAdapter {
+	return &inMemorySyncAdapter{
+		locks:    make(map[string]chan struct{}),
+		statuses: make(map[string]string),
+	}
+}
+
+func (a *inMemorySyncAdapter) lockFor(tenantKey string) chan struct{} {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	lock, exists := a.locks[tenantKey]
+	if !exists {
+		lock = make(chan struct{}, 1)
+		a.locks[tenantKey] = lock
+	}
+	return lock
+}
+
+// Lock acquires the lock for the given key, waiting until it is released
+// or until the given context is cancelled.
+func (a *inMemorySyncAdapter) Lock(ctx context.Context, tenantKey string) error {
+	lock := a.lockFor(tenantKey)
+
+	select {
+	case lock <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Fetch returns the status held for the given key,
+// or an empty string if none was written yet.
+func (a *inMemorySyncAdapter) Fetch(ctx context.Context, tenantKey string) (string, error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	return a.statuses[tenantKey], nil
+}
+
+// Write stores the status for the given key.
+func (a *inMemorySyncAdapter) Write(ctx context.Context, tenantKey string, serializedData string) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.statuses[tenantKey] = serializedData
+	return nil
+}
+
+// Unlock releases the lock for the given key.
+// It returns an error if the key was not locked.
+func (a *inMemorySyncAdapter) Unlock(ctx context.Context, tenantKey string) error {
+	lock := a.lockFor(tenantKey)
+
+	select {
+	case <-lock:
+		return nil
+	default:
+		return fmt.Errorf("key %v is not locked", tenantKey)
+	}
+}
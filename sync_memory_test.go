@@ -0,0 +1,72 @@
+package goll
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInMemorySyncAdapter(t *testing.T) {
+	adapter := NewInMemorySyncAdapter()
+
+	first := buildInstance(t, func(c *Config) {
+		c.SyncAdapter = adapter
+	})
+	second := buildInstance(t, func(c *Config) {
+		c.SyncAdapter = adapter
+	})
+
+	assert.True(t, submitNoError(first.Instance.Submit(defaultTestTenantKey, 60)).Accepted)
+
+	// the second instance sees the load accepted by the first one
+	assert.False(t, submitNoError(second.Instance.Submit(defaultTestTenantKey, 50)).Accepted)
+	assert.True(t, submitNoError(second.Instance.Submit(defaultTestTenantKey, 40)).Accepted)
+	assert.False(t, submitNoError(first.Instance.Submit(defaultTestTenantKey, 1)).Accepted)
+
+	second.AssertWindowStatus(t, defaultTestTenantKey, 100, "1000000:100")
+}
+
+func TestInMemorySyncAdapterLock(t *testing.T) {
+	adapter := NewInMemorySyncAdapter()
+	ctx := context.Background()
+
+	assert.Nil(t, adapter.Lock(ctx, "a"))
+
+	// other keys are not affected
+	assert.Nil(t, adapter.Lock(ctx, "b"))
+	assert.Nil(t, adapter.Unlock(ctx, "b"))
+
+	// the lock is not reentrant
+	timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, adapter.Lock(timeoutCtx, "a"), context.DeadlineExceeded)
+
+	assert.Nil(t, adapter.Unlock(ctx, "a"))
+	assert.NotNil(t, adapter.Unlock(ctx, "a"))
+}
+
+func TestInMemorySyncAdapterMutualExclusion(t *testing.T) {
+	adapter := NewInMemorySyncAdapter()
+	ctx := context.Background()
+
+	counter := 0
+	wg := sync.WaitGroup{}
+
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.Nil(t, adapter.Lock(ctx, "key"))
+			value := counter
+			time.Sleep(time.Microsecond)
+			counter = value + 1
+			assert.Nil(t, adapter.Unlock(ctx, "key"))
+		}()
+	}
+
+	wg.Wait()
+	assert.Equal(t, 50, counter)
+}
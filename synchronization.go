@@ -4,8 +4,9 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"strconv"
+	"io"
 	"strings"
+	"time"
 )
 
 type SyncAdapter interface {
@@ -15,28 +16,203 @@ type SyncAdapter interface {
 	Unlock(ctx context.Context, tenantKey string) error
 }
 
+// closeSyncAdapter closes the given adapter if it implements io.Closer.
+func closeSyncAdapter(adapter SyncAdapter) error {
+	if closer, ok := adapter.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			return fmt.Errorf("error closing sync adapter: %w", err)
+		}
+	}
+	return nil
+}
+
 type syncTxOptions struct {
 	TenantKey  string
 	TenantData *loadLimiterDefaultImplTenantData
 	ReadOnly   bool
 }
 
-// TODO return info on sync transaction to caller
-// to propagate non-blocking errors
-/*
+// syncTxResult holds information about a completed sync transaction,
+// allowing to propagate non-blocking errors to the caller.
 type syncTxResult struct {
-	...
+	// Warnings holds the errors that were tolerated
+	// because StrictSync is disabled.
+	Warnings []error
+
+	// WriteVerified is set when the status was written
+	// and verified to be held by the remote store.
+	WriteVerified bool
+}
+
+// tolerate records a non-blocking synchronization error.
+// It returns the error to be returned to the caller when StrictSync is enabled.
+func (r *syncTxResult) tolerate(l Logger, strict bool, err *SyncFailed) error {
+	if strict {
+		return err
+	}
+	l.Error(err.Error())
+	r.Warnings = append(r.Warnings, err)
+	return nil
+}
+
+// defaultSyncHealthCheckKey is the key used by Ping
+// when no SyncHealthCheckKey is configured.
+const defaultSyncHealthCheckKey = "goll-healthcheck"
+
+// pingSyncAdapter checks that the given adapter is reachable
+// by locking and unlocking the given key.
+func pingSyncAdapter(ctx context.Context, adapter SyncAdapter, healthCheckKey string) error {
+	if adapter == nil {
+		return nil
+	}
+
+	if err := adapter.Lock(ctx, healthCheckKey); err != nil {
+		return fmt.Errorf("error acquiring lock: %w", err)
+	}
+	if err := adapter.Unlock(ctx, healthCheckKey); err != nil {
+		return fmt.Errorf("error releasing lock: %w", err)
+	}
+	return nil
+}
+
+// minSyncLockAttemptTimeout is the minimum time
+// a single attempt of acquiring the lock is given.
+const minSyncLockAttemptTimeout = 10 * time.Millisecond
+
+// acquireSyncLock locks the given key on the adapter,
+// retrying every retryInterval until the timeout elapses.
+// A single attempt is made when the timeout is zero.
+//
+// Each attempt gets a context expiring with the remaining time,
+// so that adapters blocking on Lock respect the timeout as well.
+func acquireSyncLock(
+	ctx context.Context, adapter SyncAdapter, tenantKey string,
+	timeout time.Duration, retryInterval time.Duration,
+	timeFunc func() time.Time, sleepFunc func(d time.Duration),
+) error {
+	if timeout <= 0 {
+		return adapter.Lock(ctx, tenantKey)
+	}
+
+	started := timeFunc()
+	attempts := uint64(0)
+
+	for {
+		attempts++
+
+		// the last attempt, made when the timeout is about to elapse,
+		// still gets a chance to acquire a free lock
+		remaining := timeout - timeFunc().Sub(started)
+		if remaining < minSyncLockAttemptTimeout {
+			remaining = minSyncLockAttemptTimeout
+		}
+
+		attemptCtx, cancel := context.WithTimeout(ctx, remaining)
+		err := adapter.Lock(attemptCtx, tenantKey)
+		expired := attemptCtx.Err() != nil && ctx.Err() == nil
+		cancel()
+		if err == nil {
+			return nil
+		}
+
+		waited := timeFunc().Sub(started)
+		if waited >= timeout || expired {
+			return &SyncLockTimeout{
+				AttemptsNumber: attempts,
+				WaitedFor:      waited,
+				Cause:          err,
+			}
+		}
+
+		wait := retryInterval
+		if remaining := timeout - waited; wait > remaining {
+			wait = remaining
+		}
+		if serr := sleepWithContext(ctx, wait, sleepFunc); serr != nil {
+			return serr
+		}
+	}
+}
+
+// syncTimer measures the time spent on the SyncAdapter calls
+// of a sync transaction.
+//
+// When not enabled it does not read the clock at all.
+type syncTimer struct {
+	enabled bool
+
+	LockWait time.Duration
+	Fetch    time.Duration
+	Write    time.Duration
+}
+
+func (s *syncTimer) now() time.Time {
+	if !s.enabled {
+		return time.Time{}
+	}
+	return time.Now()
 }
-*/
+
+func (s *syncTimer) since(started time.Time) time.Duration {
+	if !s.enabled {
+		return 0
+	}
+	return time.Since(started)
+}
+
+// report passes the measured timings to the given hook, if enabled.
+func (s *syncTimer) report(hook func(tenantKey string, lockWait time.Duration, fetch time.Duration, write time.Duration), tenantKey string) {
+	if s.enabled {
+		hook(tenantKey, s.LockWait, s.Fetch, s.Write)
+	}
+}
+
+// syncAdapterFor returns the SyncAdapter to be used for the given tenant,
+// or nil if the tenant should not be synchronized.
+func (instance *loadLimiterDefaultImpl) syncAdapterFor(tenantKey string) SyncAdapter {
+	if instance.SyncAdapterSelector != nil {
+		if adapter := instance.SyncAdapterSelector(tenantKey); adapter != nil {
+			return adapter
+		}
+	}
+	return instance.SyncAdapter
+}
+
+// Ping checks that the SyncAdapter is reachable
+// by locking and unlocking the SyncHealthCheckKey.
+//
+// It returns nil when the limiter has no SyncAdapter.
+func (instance *loadLimiterDefaultImpl) Ping(ctx context.Context) error {
+	instance.Lock.RLock()
+	closed := instance.closed
+	instance.Lock.RUnlock()
+
+	if closed {
+		return ErrLimiterClosed
+	}
+
+	healthCheckKey := instance.SyncHealthCheckKey
+	if healthCheckKey == "" {
+		healthCheckKey = defaultSyncHealthCheckKey
+	}
+	return pingSyncAdapter(ctx, instance.syncAdapterFor(healthCheckKey), healthCheckKey)
+}
+
 func (instance *loadLimiterDefaultImpl) withSyncTransaction(task func(), txOptions syncTxOptions) error {
-	if instance.SyncAdapter == nil {
+	_, err := instance.runSyncTransaction(task, txOptions)
+	return err
+}
+
+func (instance *loadLimiterDefaultImpl) runSyncTransaction(task func(), txOptions syncTxOptions) (out syncTxResult, err error) {
+	adapter := instance.syncAdapterFor(txOptions.TenantKey)
+	if adapter == nil {
 		task()
-		return nil
+		return out, nil
 	}
 
 	if txOptions.TenantData == nil {
 		if txOptions.TenantKey == "" {
-			return errors.New("no tenant data available for sync transaction")
+			return out, errors.New("no tenant data available for sync transaction")
 		}
 		txOptions.TenantData = instance.getTenant(txOptions.TenantKey)
 	}
@@ -44,144 +220,292 @@ func (instance *loadLimiterDefaultImpl) withSyncTransaction(task func(), txOptio
 	tenantKey := txOptions.TenantKey
 	tenant := txOptions.TenantData
 	l := instance.Logger
-	adapter := instance.SyncAdapter
+	strict := instance.StrictSync
+	async := instance.Config.AsyncWriteBack
+
+	if async && instance.hasPendingWriteBack(tenantKey) {
+		// the local state is ahead of the remote one
+		// until the next write-back, no need to fetch it.
+		task()
+		return out, nil
+	}
 
 	adapterContext := context.Background()
 
-	logPrefix := fmt.Sprintf("[sync tx %s] ", tenantKey)
+	timer := syncTimer{enabled: instance.OnSyncMetrics != nil}
+	defer timer.report(instance.OnSyncMetrics, tenantKey)
 
-	l.Info(logPrefix + "acquiring lock")
+	logInfow(l, "[sync tx] acquiring lock", "tenantKey", tenantKey)
 
-	err := adapter.Lock(adapterContext, tenantKey)
+	started := timer.now()
+	err = acquireSyncLock(adapterContext, adapter, tenantKey,
+		instance.Config.SyncLockTimeout, instance.Config.SyncLockRetryInterval,
+		instance.currentTime, instance.SleepFunc)
+	timer.LockWait = timer.since(started)
 
 	if err != nil {
-		return fmt.Errorf("error acquiring lock: %v", err.Error())
+		return out, fmt.Errorf("error acquiring lock: %w", err)
 	}
-	l.Info(logPrefix + "lock acquired")
+	logInfow(l, "[sync tx] lock acquired", "tenantKey", tenantKey)
 
 	defer func() {
-		l.Info(logPrefix + "releasing lock")
+		logInfow(l, "[sync tx] releasing lock", "tenantKey", tenantKey)
 		rerr := adapter.Unlock(adapterContext, tenantKey)
 		if rerr != nil {
-			l.Info(fmt.Sprintf(logPrefix+"could not release lock: %v", rerr.Error()))
+			logInfow(l, "[sync tx] could not release lock", "tenantKey", tenantKey, "error", rerr)
+			out.Warnings = append(out.Warnings, fmt.Errorf("could not release lock: %w", rerr))
 		} else {
-			l.Info(logPrefix + "lock released")
+			logInfow(l, "[sync tx] lock released", "tenantKey", tenantKey)
 		}
 	}()
 
-	l.Info(logPrefix + "fetching status")
-	status, err := adapter.Fetch(adapterContext, tenantKey)
-	if err != nil {
-		// TODO how do we handle this?
-		// should block the whole flow?
-		l.Error(fmt.Sprintf("could not fetch status: %v", err.Error()))
+	logInfow(l, "[sync tx] fetching status", "tenantKey", tenantKey)
+	started = timer.now()
+	status, ferr := adapter.Fetch(adapterContext, tenantKey)
+	timer.Fetch = timer.since(started)
+	if ferr != nil {
+		if err = out.tolerate(l, strict, &SyncFailed{Operation: "fetch", Cause: ferr}); err != nil {
+			return out, err
+		}
 	} else {
-		l.Info(logPrefix + "fetched status")
+		logInfow(l, "[sync tx] fetched status", "tenantKey", tenantKey)
 
 		if status == "" {
-			l.Warning(logPrefix + "no status on remote store, skipping status check")
+			logWarnw(l, "[sync tx] no status on remote store, skipping status check", "tenantKey", tenantKey)
 		} else {
-			err = instance.restoreSerializedStatus(status, tenant)
-			if err != nil {
-				instance.Logger.Error(fmt.Sprintf("error restoring status from remote store: %s", err.Error()))
-				// TODO how do we handle this?
-				// should not block the whole flow.
+			rerr := instance.restoreSerializedStatus(status, tenant)
+			if rerr != nil {
+				if err = out.tolerate(l, strict, &SyncFailed{Operation: "restore", Cause: rerr}); err != nil {
+					return out, err
+				}
 			}
 		}
 	}
 
 	versionBefore := tenant.Version
 
-	l.Info(logPrefix + "executing task")
+	// in strict mode a failed write rolls back the changes
+	// so that the local state never gets ahead of the remote one.
+	var rollback *loadLimiterDefaultImplTenantData
+	if strict && !async && !txOptions.ReadOnly {
+		rollback = instance.detachedTenantCopy(tenant)
+	}
+
+	logInfow(l, "[sync tx] executing task", "tenantKey", tenantKey, "version", versionBefore)
 	task()
 
 	changed := tenant.Version > versionBefore
 	if txOptions.ReadOnly {
 		if changed {
-			l.Warning("sync transaction should have been readonly but changed version. skipping status write but something's off here")
+			logWarnw(l, "[sync tx] transaction should have been readonly but changed version. skipping status write but something's off here", "tenantKey", tenantKey)
 		}
+	} else if changed && async {
+		logInfow(l, "[sync tx] scheduling status write-back", "tenantKey", tenantKey, "version", tenant.Version)
+		instance.markPendingWriteBack(tenantKey)
 	} else if changed {
-		l.Info(fmt.Sprintf(logPrefix + "writing updated status to remote store"))
+		logInfow(l, "[sync tx] writing updated status to remote store", "tenantKey", tenantKey, "version", tenant.Version)
 		status = instance.serializeStatus(tenantKey, tenant)
 
-		err = adapter.Write(adapterContext, tenantKey, status)
-		if err != nil {
-			instance.Logger.Error(fmt.Sprintf("could not write status: %v", err.Error()))
-			// TODO how do we handle this?
-			// should not block the whole flow.
+		started = timer.now()
+		werr := adapter.Write(adapterContext, tenantKey, status)
+		timer.Write = timer.since(started)
+
+		var failure *SyncFailed
+		if werr != nil {
+			failure = &SyncFailed{Operation: "write", Cause: werr}
+		} else if instance.VerifyWrites {
+			logInfow(l, "[sync tx] verifying written status", "tenantKey", tenantKey, "version", tenant.Version)
+
+			started = timer.now()
+			verr := instance.verifyWrite(adapterContext, adapter, tenantKey, tenant)
+			timer.Fetch += timer.since(started)
+			if verr != nil {
+				failure = &SyncFailed{Operation: "verify", Cause: verr}
+			} else {
+				out.WriteVerified = true
+			}
+		}
+
+		if failure != nil {
+			if err = out.tolerate(l, strict, failure); err != nil {
+				*tenant = *rollback
+				return out, err
+			}
 		}
 	} else {
-		l.Info(logPrefix + "task did not change status, skipping writeback")
+		logInfow(l, "[sync tx] task did not change status, skipping writeback", "tenantKey", tenantKey)
+	}
+
+	logInfow(l, "[sync tx] end", "tenantKey", tenantKey)
+	return out, nil
+}
+
+// verifyWrite checks that the remote store holds
+// the current version of the given tenant.
+func (instance *loadLimiterDefaultImpl) verifyWrite(ctx context.Context, adapter SyncAdapter, tenantKey string, tenant *loadLimiterDefaultImplTenantData) error {
+	status, err := adapter.Fetch(ctx, tenantKey)
+	if err != nil {
+		return err
+	}
+	if status == "" {
+		return errors.New("no status on remote store after write")
 	}
 
-	l.Info(logPrefix + "end")
+	parsed, err := parseSerializedStatus(status)
+	if err != nil {
+		return err
+	}
+	if parsed.Version != tenant.Version {
+		return fmt.Errorf("remote store holds version %d instead of %d", parsed.Version, tenant.Version)
+	}
+	return nil
+}
+
+// serializeStatus joins the status of the given tenant
+// in all the composed limiters.
+func (instance *compositeLoadLimiterDefaultImpl) serializeStatus(tenantKey string) string {
+	limitersStatus := make([]string, len(instance.Limiters))
+	for i, limiter := range instance.Limiters {
+		limiterTenantKey := instance.limiterTenantKey(i, tenantKey)
+		limitersStatus[i] = limiter.serializeStatus(limiterTenantKey, limiter.getTenant(limiterTenantKey))
+	}
+	return strings.Join(limitersStatus, ";")
+}
+
+// syncAdapterFor returns the SyncAdapter to be used for the given tenant,
+// or nil if the tenant should not be synchronized.
+func (instance *compositeLoadLimiterDefaultImpl) syncAdapterFor(tenantKey string) SyncAdapter {
+	if instance.SyncAdapterSelector != nil {
+		if adapter := instance.SyncAdapterSelector(tenantKey); adapter != nil {
+			return adapter
+		}
+	}
+	return instance.SyncAdapter
+}
+
+// Ping checks that the SyncAdapter is reachable
+// by locking and unlocking the SyncHealthCheckKey.
+//
+// It returns nil when the limiter has no SyncAdapter.
+func (instance *compositeLoadLimiterDefaultImpl) Ping(ctx context.Context) error {
+	instance.Lock.Lock()
+	closed := instance.closed
+	instance.Lock.Unlock()
+
+	if closed {
+		return ErrLimiterClosed
+	}
+
+	healthCheckKey := instance.SyncHealthCheckKey
+	if healthCheckKey == "" {
+		healthCheckKey = defaultSyncHealthCheckKey
+	}
+	return pingSyncAdapter(ctx, instance.syncAdapterFor(healthCheckKey), healthCheckKey)
+}
+
+// verifyWrite checks that the remote store holds
+// the current version of the given tenant for all the composed limiters.
+func (instance *compositeLoadLimiterDefaultImpl) verifyWrite(ctx context.Context, adapter SyncAdapter, tenantKey string) error {
+	status, err := adapter.Fetch(ctx, tenantKey)
+	if err != nil {
+		return err
+	}
+	if status == "" {
+		return errors.New("no status on remote store after write")
+	}
+
+	parsed, err := instance.parseSerializedStatus(status)
+	if err != nil {
+		return err
+	}
+	for i, limiter := range instance.Limiters {
+		expected := limiter.getTenant(instance.limiterTenantKey(i, tenantKey)).Version
+		if parsed[i].Version != expected {
+			return fmt.Errorf("remote store holds version %d instead of %d for limiter %d", parsed[i].Version, expected, i)
+		}
+	}
 	return nil
 }
 
 func (instance *compositeLoadLimiterDefaultImpl) withSyncTransaction(task func(), txOptions syncTxOptions) error {
-	if instance.SyncAdapter == nil {
+	_, err := instance.runSyncTransaction(task, txOptions)
+	return err
+}
+
+func (instance *compositeLoadLimiterDefaultImpl) runSyncTransaction(task func(), txOptions syncTxOptions) (out syncTxResult, err error) {
+	adapter := instance.syncAdapterFor(txOptions.TenantKey)
+	if adapter == nil {
 		task()
-		return nil
+		return out, nil
 	}
 	if txOptions.TenantKey == "" {
-		return errors.New("no tenant data available for sync transaction")
+		return out, errors.New("no tenant data available for sync transaction")
 	}
 
 	tenantKey := txOptions.TenantKey
 
 	l := instance.Logger
-	adapter := instance.SyncAdapter
+	strict := instance.StrictSync
 
 	adapterContext := context.Background()
 
-	logPrefix := fmt.Sprintf("[sync tx %s] ", tenantKey)
+	timer := syncTimer{enabled: instance.OnSyncMetrics != nil}
+	defer timer.report(instance.OnSyncMetrics, tenantKey)
 
-	l.Info(logPrefix + "acquiring lock")
+	logInfow(l, "[sync tx] acquiring lock", "tenantKey", tenantKey)
 
-	err := adapter.Lock(adapterContext, tenantKey)
+	started := timer.now()
+	err = acquireSyncLock(adapterContext, adapter, tenantKey,
+		instance.Config.SyncLockTimeout, instance.Config.SyncLockRetryInterval,
+		instance.currentTime, instance.SleepFunc)
+	timer.LockWait = timer.since(started)
 
 	if err != nil {
-		return fmt.Errorf("error acquiring lock: %v", err.Error())
+		return out, fmt.Errorf("error acquiring lock: %w", err)
 	}
-	l.Info(logPrefix + "lock acquired")
+	logInfow(l, "[sync tx] lock acquired", "tenantKey", tenantKey)
 
 	defer func() {
-		l.Info(logPrefix + "releasing lock")
+		logInfow(l, "[sync tx] releasing lock", "tenantKey", tenantKey)
 		rerr := adapter.Unlock(adapterContext, tenantKey)
 		if rerr != nil {
-			l.Info(fmt.Sprintf(logPrefix+"could not release lock: %v", rerr.Error()))
+			logInfow(l, "[sync tx] could not release lock", "tenantKey", tenantKey, "error", rerr)
+			out.Warnings = append(out.Warnings, fmt.Errorf("could not release lock: %w", rerr))
 		} else {
-			l.Info(logPrefix + "lock released")
+			logInfow(l, "[sync tx] lock released", "tenantKey", tenantKey)
 		}
 	}()
 
 	numLimiters := len(instance.Limiters)
 
-	l.Info(logPrefix + "fetching status")
-	status, err := adapter.Fetch(adapterContext, tenantKey)
-	if err != nil {
-		// TODO how do we handle this?
-		// should block the whole flow?
-		l.Error(fmt.Sprintf("could not fetch status: %v", err.Error()))
+	logInfow(l, "[sync tx] fetching status", "tenantKey", tenantKey)
+	started = timer.now()
+	status, ferr := adapter.Fetch(adapterContext, tenantKey)
+	timer.Fetch = timer.since(started)
+	if ferr != nil {
+		if err = out.tolerate(l, strict, &SyncFailed{Operation: "fetch", Cause: ferr}); err != nil {
+			return out, err
+		}
 	} else {
-		l.Info(logPrefix + "fetched status")
+		logInfow(l, "[sync tx] fetched status", "tenantKey", tenantKey)
 
 		if status == "" {
-			l.Warning(logPrefix + "no status on remote store, skipping status check")
+			logWarnw(l, "[sync tx] no status on remote store, skipping status check", "tenantKey", tenantKey)
 		} else {
 			statusSplit := strings.Split(status, ";")
 			if len(statusSplit) != len(instance.Limiters) {
-				instance.Logger.Error("error restoring status from remote store: invalid number of sublimiters")
-				// TODO how do we handle this?
-				// should not block the whole flow.
+				rerr := errors.New("invalid number of sublimiters")
+				if err = out.tolerate(l, strict, &SyncFailed{Operation: "restore", Cause: rerr}); err != nil {
+					return out, err
+				}
 			} else {
 				for i, limiter := range instance.Limiters {
 					tenant := limiter.getTenant(tenantKey)
-					err = limiter.restoreSerializedStatus(statusSplit[i], tenant)
-					if err != nil {
-						instance.Logger.Error(fmt.Sprintf("error restoring status from remote store: %s", err.Error()))
-						// TODO how do we handle this?
-						// should not block the whole flow.
+					rerr := limiter.restoreSerializedStatus(statusSplit[i], tenant)
+					if rerr != nil {
+						if err = out.tolerate(l, strict, &SyncFailed{Operation: "restore", Cause: rerr}); err != nil {
+							return out, err
+						}
 					}
 				}
 			}
@@ -194,7 +518,17 @@ func (instance *compositeLoadLimiterDefaultImpl) withSyncTransaction(task func()
 		versionsBefore[i] = limiter.getTenant(tenantKey).Version
 	}
 
-	l.Info(logPrefix + "executing task")
+	// in strict mode a failed write rolls back the changes
+	// so that the local state never gets ahead of the remote one.
+	var rollback []*loadLimiterDefaultImplTenantData
+	if strict && !txOptions.ReadOnly {
+		rollback = make([]*loadLimiterDefaultImplTenantData, numLimiters)
+		for i, limiter := range instance.Limiters {
+			rollback[i] = limiter.detachedTenantCopy(limiter.getTenant(tenantKey))
+		}
+	}
+
+	logInfow(l, "[sync tx] executing task", "tenantKey", tenantKey)
 	task()
 
 	changed := false
@@ -207,131 +541,43 @@ func (instance *compositeLoadLimiterDefaultImpl) withSyncTransaction(task func()
 
 	if txOptions.ReadOnly {
 		if changed {
-			l.Warning("sync transaction should have been readonly but changed version. skipping status write but something's off here")
+			logWarnw(l, "[sync tx] transaction should have been readonly but changed version. skipping status write but something's off here", "tenantKey", tenantKey)
 		}
 	} else if changed {
-		l.Info(fmt.Sprintf(logPrefix + "writing updated status to remote store"))
-		// status = instance.serializeStatus()
-		limitersStatus := ""
-		for _, limiter := range instance.Limiters {
-			tenant := limiter.getTenant(tenantKey)
-			limitersStatus += (limiter.serializeStatus(tenantKey, tenant) + ";")
-		}
-		if numLimiters > 0 {
-			limitersStatus = strings.TrimRight(limitersStatus, ";")
+		logInfow(l, "[sync tx] writing updated status to remote store", "tenantKey", tenantKey)
+
+		started = timer.now()
+		werr := adapter.Write(adapterContext, tenantKey, instance.serializeStatus(tenantKey))
+		timer.Write = timer.since(started)
+
+		var failure *SyncFailed
+		if werr != nil {
+			failure = &SyncFailed{Operation: "write", Cause: werr}
+		} else if instance.VerifyWrites {
+			logInfow(l, "[sync tx] verifying written status", "tenantKey", tenantKey)
+
+			started = timer.now()
+			verr := instance.verifyWrite(adapterContext, adapter, tenantKey)
+			timer.Fetch += timer.since(started)
+			if verr != nil {
+				failure = &SyncFailed{Operation: "verify", Cause: verr}
+			} else {
+				out.WriteVerified = true
+			}
 		}
 
-		err = adapter.Write(adapterContext, tenantKey, limitersStatus)
-		if err != nil {
-			instance.Logger.Error(fmt.Sprintf("could not write status: %v", err.Error()))
-			// TODO how do we handle this?
-			// should not block the whole flow.
+		if failure != nil {
+			if err = out.tolerate(l, strict, failure); err != nil {
+				for i, limiter := range instance.Limiters {
+					*limiter.getTenant(tenantKey) = *rollback[i]
+				}
+				return out, err
+			}
 		}
 	} else {
-		l.Info(logPrefix + "task did not change status, skipping writeback")
-	}
-
-	l.Info(logPrefix + "end")
-	return nil
-}
-
-func (instance *loadLimiterDefaultImpl) serializeStatus(tenantKey string, tenant *loadLimiterDefaultImplTenantData) string {
-	out := fmt.Sprintf("v1/%d/%d/", tenant.Version, tenant.WindowTotal)
-	if tenant.WasOver {
-		out += "1"
-	} else {
-		out += "0"
-	}
-	out += "/"
-	qLen := tenant.WindowQueue.Len()
-
-	segstr := ""
-	for i := 0; i < qLen; i++ {
-		seg := tenant.WindowQueue.At(i).(*windowSegment)
-		segstr += fmt.Sprintf("%d:%d,", seg.StartTime, seg.Value)
-	}
-	if qLen > 0 {
-		segstr = strings.TrimRight(segstr, ",")
-	}
-	out += segstr
-
-	return out
-}
-
-func (instance *loadLimiterDefaultImpl) restoreSerializedStatus(serialized string, tenant *loadLimiterDefaultImplTenantData) error {
-	splitted := strings.Split(serialized, "/")
-	tokenLen := len(splitted)
-	if tokenLen < 1 {
-		return errors.New("not enough tokens")
-	}
-	serializationVersion := splitted[0]
-	if serializationVersion != "v1" {
-		return fmt.Errorf("invalid serialization version %v", serializationVersion)
-	}
-
-	if tokenLen != 5 {
-		return errors.New("invalid number of tokens for v1 format")
-	}
-
-	version := splitted[1]
-	versionRaw, err := strconv.Atoi(version)
-	if err != nil {
-		return fmt.Errorf("could not parse version: %w", err)
+		logInfow(l, "[sync tx] task did not change status, skipping writeback", "tenantKey", tenantKey)
 	}
-	remoteVersion := uint64(versionRaw)
 
-	if tenant.Version == remoteVersion {
-		instance.Logger.Debug("instance version is up to date with serialized data, nothing to do")
-		return nil
-	} else if remoteVersion < tenant.Version {
-		// something bad happened
-		return fmt.Errorf("serialized instance version %d is older than current version %d", remoteVersion, tenant.Version)
-	}
-
-	instance.Logger.Debug("instance version is not up to date with serialized data, hydrating state")
-
-	windowTotalRaw, err := strconv.Atoi(splitted[2])
-	if err != nil {
-		return fmt.Errorf("could not parse windowTotal: %w", err)
-	}
-
-	wasOver := false
-	if splitted[3] == "1" {
-		wasOver = true
-	}
-
-	// apply queue
-	splittedSegments := strings.Split(splitted[4], ",")
-	q := tenant.WindowQueue
-	rLen := len(splittedSegments)
-
-	q.Clear()
-
-	// iterate on the segments and make sure the data matches
-	for i := 0; i < rLen; i++ {
-		splittedSegment := strings.Split(splittedSegments[rLen-i-1], ":")
-		if len(splittedSegment) != 2 {
-			return fmt.Errorf("invalid format for segment #%d", i)
-		}
-
-		remoteStartTime, err := strconv.Atoi(splittedSegment[0])
-		if err != nil {
-			return fmt.Errorf("could not parse start time for segment %d: %w", i, err)
-		}
-		remoteValue, err := strconv.Atoi(splittedSegment[1])
-		if err != nil {
-			return fmt.Errorf("could not parse value for segment %d: %w", i, err)
-		}
-
-		q.PushFront(&windowSegment{
-			StartTime: uint64(remoteStartTime),
-			Value:     uint64(remoteValue),
-		})
-	}
-
-	tenant.WindowTotal = uint64(windowTotalRaw)
-	tenant.WasOver = wasOver
-	tenant.Version = remoteVersion
-
-	return nil
+	logInfow(l, "[sync tx] end", "tenantKey", tenantKey)
+	return out, nil
 }
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -89,7 +90,7 @@ func TestSyncAdapter(t *testing.T) {
 	assert.Equal(t, []string{
 		"LOCK test",
 		"FETCH test",
-		"WRITE test v1/3/5/0/1000000:5",
+		"WRITE test v2/ver=3/total=5/over=0/seg=1000000:5/acc=1/rej=0",
 		"UNLOCK test",
 	}, adapter.collector)
 
@@ -125,7 +126,7 @@ func TestSyncAdapter(t *testing.T) {
 	assert.Equal(t, []string{
 		"LOCK test",
 		"FETCH test",
-		"WRITE test v1/11/35/0/1002000:10,1001000:10,1000000:15",
+		"WRITE test v2/ver=11/total=35/over=0/seg=1002000:10,1001000:10,1000000:15/acc=1/rej=0",
 		"UNLOCK test",
 	}, adapter.collector)
 }
@@ -179,7 +180,7 @@ func TestSyncAdapterErrorOnUnlock(t *testing.T) {
 	assert.Equal(t, []string{
 		"LOCK test",
 		"FETCH test",
-		"WRITE test v1/3/1/0/1000000:1",
+		"WRITE test v2/ver=3/total=1/over=0/seg=1000000:1/acc=1/rej=0",
 		"UNLOCK test",
 	}, adapter.collector)
 
@@ -200,15 +201,20 @@ func TestSyncAdapterErrorOnFetch(t *testing.T) {
 		return "", errors.New("I could not")
 	}
 
-	_, err := ci.Instance.Submit(defaultTestTenantKey, 1)
+	res, err := ci.Instance.Submit(defaultTestTenantKey, 1)
 
 	assert.Nil(t, err)
+	assert.True(t, res.Accepted)
+
+	// the error is reported as a warning
+	assert.Equal(t, 1, len(res.SyncWarnings))
+	assert.ErrorIs(t, res.SyncWarnings[0], ErrSyncFailed)
 
 	// check that the sync adapter was called
 	assert.Equal(t, []string{
 		"LOCK test",
 		"FETCH test",
-		"WRITE test v1/3/1/0/1000000:1",
+		"WRITE test v2/ver=3/total=1/over=0/seg=1000000:1/acc=1/rej=0",
 		"UNLOCK test",
 	}, adapter.collector)
 
@@ -227,15 +233,20 @@ func TestSyncAdapterErrorOnStatusRestore(t *testing.T) {
 	// force error on Unlock on the mock adapter
 	adapter.returning[defaultTestTenantKey] = "v1/AAA/BBB"
 
-	_, err := ci.Instance.Submit(defaultTestTenantKey, 1)
+	res, err := ci.Instance.Submit(defaultTestTenantKey, 1)
 
 	assert.Nil(t, err)
+	assert.True(t, res.Accepted)
+
+	// the error is reported as a warning
+	assert.Equal(t, 1, len(res.SyncWarnings))
+	assert.ErrorIs(t, res.SyncWarnings[0], ErrSyncFailed)
 
 	// check that the sync adapter was called
 	assert.Equal(t, []string{
 		"LOCK test",
 		"FETCH test",
-		"WRITE test v1/3/1/0/1000000:1",
+		"WRITE test v2/ver=3/total=1/over=0/seg=1000000:1/acc=1/rej=0",
 		"UNLOCK test",
 	}, adapter.collector)
 
@@ -256,15 +267,20 @@ func TestSyncAdapterErrorOnStatusWrite(t *testing.T) {
 		return errors.New("I could not")
 	}
 
-	_, err := ci.Instance.Submit(defaultTestTenantKey, 1)
+	res, err := ci.Instance.Submit(defaultTestTenantKey, 1)
 
 	assert.Nil(t, err)
+	assert.True(t, res.Accepted)
+
+	// the error is reported as a warning
+	assert.Equal(t, 1, len(res.SyncWarnings))
+	assert.ErrorIs(t, res.SyncWarnings[0], ErrSyncFailed)
 
 	// check that the sync adapter was called
 	assert.Equal(t, []string{
 		"LOCK test",
 		"FETCH test",
-		"WRITE test v1/3/1/0/1000000:1",
+		"WRITE test v2/ver=3/total=1/over=0/seg=1000000:1/acc=1/rej=0",
 		"UNLOCK test",
 	}, adapter.collector)
 
@@ -299,7 +315,7 @@ func TestSyncAdapterComposite(t *testing.T) {
 	assert.Equal(t, []string{
 		"LOCK test",
 		"FETCH test",
-		"WRITE test v1/3/5/0/1000000:5;v1/3/5/0/1000000:5",
+		"WRITE test v2/ver=3/total=5/over=0/seg=1000000:5/acc=1/rej=0;v2/ver=3/total=5/over=0/seg=1000000:5/acc=1/rej=0",
 		"UNLOCK test",
 	}, adapter.collector)
 
@@ -338,7 +354,661 @@ func TestSyncAdapterComposite(t *testing.T) {
 	assert.Equal(t, []string{
 		"LOCK test",
 		"FETCH test",
-		"WRITE test v1/11/35/0/1002000:10,1001000:10,1000000:15;v1/11/11/0/1002000:6,1001900:2,1001800:3",
+		"WRITE test v2/ver=11/total=35/over=0/seg=1002000:10,1001000:10,1000000:15/acc=1/rej=0;v2/ver=11/total=11/over=0/seg=1002000:6,1001900:2,1001800:3/acc=1/rej=0",
+		"UNLOCK test",
+	}, adapter.collector)
+}
+
+func TestSyncAdapterSelector(t *testing.T) {
+	// provide two mock adapters, one for each shard
+	adapterA := testSyncAdapter{}
+	adapterA.Clear()
+	adapterB := testSyncAdapter{}
+	adapterB.Clear()
+
+	ci := buildInstance(t, func(c *Config) {
+		c.SyncAdapterSelector = func(tenantKey string) SyncAdapter {
+			switch tenantKey {
+			case "a":
+				return &adapterA
+			case "b":
+				return &adapterB
+			}
+			return nil
+		}
+	})
+
+	_, _ = ci.Instance.Submit("a", 5)
+	_, _ = ci.Instance.Submit("b", 7)
+	_, _ = ci.Instance.Submit("c", 9)
+
+	// check that each tenant was routed to its own adapter
+	assert.Equal(t, []string{
+		"LOCK a",
+		"FETCH a",
+		"WRITE a v2/ver=3/total=5/over=0/seg=1000000:5/acc=1/rej=0",
+		"UNLOCK a",
+	}, adapterA.collector)
+
+	assert.Equal(t, []string{
+		"LOCK b",
+		"FETCH b",
+		"WRITE b v2/ver=3/total=7/over=0/seg=1000000:7/acc=1/rej=0",
+		"UNLOCK b",
+	}, adapterB.collector)
+
+	// tenants not handled by the selector are not synchronized
+	ci.AssertWindowStatus(t, "c", 9, "1000000:9")
+}
+
+func TestSyncAdapterSelectorFallback(t *testing.T) {
+	adapter := testSyncAdapter{}
+	adapter.Clear()
+	selected := testSyncAdapter{}
+	selected.Clear()
+
+	ci := buildInstance(t, func(c *Config) {
+		c.SyncAdapter = &adapter
+		c.SyncAdapterSelector = func(tenantKey string) SyncAdapter {
+			if tenantKey == "selected" {
+				return &selected
+			}
+			return nil
+		}
+	})
+
+	_, _ = ci.Instance.Probe("selected", 1)
+	_, _ = ci.Instance.Probe(defaultTestTenantKey, 1)
+
+	assert.Equal(t, []string{
+		"LOCK selected",
+		"FETCH selected",
+		"UNLOCK selected",
+	}, selected.collector)
+
+	assert.Equal(t, []string{
+		"LOCK test",
+		"FETCH test",
+		"UNLOCK test",
+	}, adapter.collector)
+}
+
+func TestSyncAdapterSelectorComposite(t *testing.T) {
+	adapterA := testSyncAdapter{}
+	adapterA.Clear()
+	adapterB := testSyncAdapter{}
+	adapterB.Clear()
+
+	ci := buildCompositeInstance(t, func(c *CompositeConfig) {
+		c.SyncAdapterSelector = func(tenantKey string) SyncAdapter {
+			if tenantKey == "a" {
+				return &adapterA
+			}
+			return &adapterB
+		}
+	})
+
+	_, _ = ci.Instance.Submit("a", 5)
+	_, _ = ci.Instance.Submit("b", 5)
+
+	assert.Equal(t, []string{
+		"LOCK a",
+		"FETCH a",
+		"WRITE a v2/ver=3/total=5/over=0/seg=1000000:5/acc=1/rej=0;v2/ver=3/total=5/over=0/seg=1000000:5/acc=1/rej=0",
+		"UNLOCK a",
+	}, adapterA.collector)
+
+	assert.Equal(t, []string{
+		"LOCK b",
+		"FETCH b",
+		"WRITE b v2/ver=3/total=5/over=0/seg=1000000:5/acc=1/rej=0;v2/ver=3/total=5/over=0/seg=1000000:5/acc=1/rej=0",
+		"UNLOCK b",
+	}, adapterB.collector)
+}
+
+type closableTestSyncAdapter struct {
+	testSyncAdapter
+	closed int
+}
+
+func (c *closableTestSyncAdapter) Close() error {
+	c.closed++
+	return nil
+}
+
+func TestCloseWithSyncAdapter(t *testing.T) {
+	adapter := closableTestSyncAdapter{}
+	adapter.Clear()
+
+	ci := buildInstance(t, func(c *Config) {
+		c.SyncAdapter = &adapter
+	})
+
+	assert.Nil(t, ci.Instance.Close())
+	assert.Nil(t, ci.Instance.Close())
+	assert.Equal(t, 1, adapter.closed)
+
+	_, err := ci.Instance.Submit(defaultTestTenantKey, 1)
+	assert.ErrorIs(t, err, ErrLimiterClosed)
+
+	// the adapter is not used after closing
+	assert.Equal(t, 0, len(adapter.collector))
+}
+
+func TestCloseWithSyncAdapterComposite(t *testing.T) {
+	adapter := closableTestSyncAdapter{}
+	adapter.Clear()
+
+	ci := buildCompositeInstance(t, func(c *CompositeConfig) {
+		c.SyncAdapter = &adapter
+	})
+
+	assert.Nil(t, ci.Instance.Close())
+	assert.Nil(t, ci.Instance.Close())
+	assert.Equal(t, 1, adapter.closed)
+
+	_, err := ci.Instance.Probe(defaultTestTenantKey, 1)
+	assert.ErrorIs(t, err, ErrLimiterClosed)
+}
+
+func TestSyncAdapterResetTenant(t *testing.T) {
+	adapter := testSyncAdapter{}
+	adapter.Clear()
+
+	ci := buildInstance(t, func(c *Config) {
+		c.SyncAdapter = &adapter
+	})
+
+	// the remote store holds some state for a tenant unknown to this instance
+	adapter.returning[defaultTestTenantKey] = "v1/4/15/1/1000000:15"
+
+	assert.Nil(t, ci.Instance.ResetTenant(defaultTestTenantKey))
+
+	assert.Equal(t, []string{
+		"LOCK test",
+		"FETCH test",
+		"WRITE test v2/ver=5/total=0/over=0/seg=/acc=0/rej=0",
+		"UNLOCK test",
+	}, adapter.collector)
+
+	ci.AssertWindowStatus(t, defaultTestTenantKey, 0)
+}
+
+func TestSyncAdapterSubmissionCounters(t *testing.T) {
+	adapter := testSyncAdapter{}
+	adapter.Clear()
+
+	ci := buildInstance(t, func(c *Config) {
+		c.SyncAdapter = &adapter
+	})
+
+	// counters are restored from the remote status
+	adapter.returning[defaultTestTenantKey] = "v1/4/15/0/1000000:15/7/2"
+
+	assert.True(t, submitNoError(ci.Instance.Submit(defaultTestTenantKey, 5)).Accepted)
+
+	assert.Equal(t, []string{
+		"LOCK test",
+		"FETCH test",
+		"WRITE test v2/ver=5/total=20/over=0/seg=1000000:20/acc=8/rej=2",
+		"UNLOCK test",
+	}, adapter.collector)
+
+	stats, err := ci.Instance.Stats(defaultTestTenantKey)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(8), stats.AcceptedCount)
+	assert.Equal(t, uint64(2), stats.RejectedCount)
+
+	// statuses written before the counters were introduced are still accepted
+	adapter.Clear()
+	adapter.returning[defaultTestTenantKey] = "v1/10/20/0/1000000:20"
+
+	assert.True(t, submitNoError(ci.Instance.Submit(defaultTestTenantKey, 5)).Accepted)
+
+	stats, err = ci.Instance.Stats(defaultTestTenantKey)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(25), stats.WindowTotal)
+	assert.Equal(t, uint64(1), stats.AcceptedCount)
+	assert.Equal(t, uint64(0), stats.RejectedCount)
+}
+
+func TestStrictSyncErrorOnFetch(t *testing.T) {
+	adapter := testSyncAdapter{}
+	adapter.Clear()
+
+	ci := buildInstance(t, func(c *Config) {
+		c.SyncAdapter = &adapter
+		c.StrictSync = true
+	})
+
+	fetchErr := errors.New("I could not")
+	adapter.FetchStatusMock = func(sc context.Context, tk string) (string, error) {
+		return "", fetchErr
+	}
+
+	res, err := ci.Instance.Submit(defaultTestTenantKey, 1)
+
+	assert.NotNil(t, err)
+	assert.ErrorIs(t, err, ErrSyncFailed)
+	assert.ErrorIs(t, err, fetchErr)
+	assert.False(t, res.Accepted)
+
+	// the task is not executed
+	assert.Equal(t, []string{
+		"LOCK test",
+		"FETCH test",
+		"UNLOCK test",
+	}, adapter.collector)
+
+	ci.AssertWindowStatus(t, defaultTestTenantKey, 0)
+
+	// restore errors are blocking too
+	adapter.Clear()
+	adapter.returning[defaultTestTenantKey] = "v1/AAA/BBB"
+
+	_, err = ci.Instance.Submit(defaultTestTenantKey, 1)
+	assert.ErrorIs(t, err, ErrSyncFailed)
+
+	var syncErr *SyncFailed
+	assert.True(t, errors.As(err, &syncErr))
+	assert.Equal(t, "restore", syncErr.Operation)
+}
+
+func TestStrictSyncErrorOnStatusWrite(t *testing.T) {
+	adapter := testSyncAdapter{}
+	adapter.Clear()
+
+	ci := buildInstance(t, func(c *Config) {
+		c.SyncAdapter = &adapter
+		c.StrictSync = true
+	})
+
+	assert.True(t, submitNoError(ci.Instance.Submit(defaultTestTenantKey, 5)).Accepted)
+	versionBefore := ci.Instance.getTenant(defaultTestTenantKey).Version
+
+	adapter.WriteStatusMock = func(sc context.Context, tk string, s string) error {
+		return errors.New("I could not")
+	}
+
+	res, err := ci.Instance.Submit(defaultTestTenantKey, 1)
+
+	assert.ErrorIs(t, err, ErrSyncFailed)
+	assert.False(t, res.Accepted)
+
+	// local changes are rolled back
+	ci.AssertWindowStatus(t, defaultTestTenantKey, 5, "1000000:5")
+	assert.Equal(t, versionBefore, ci.Instance.getTenant(defaultTestTenantKey).Version)
+	assert.Equal(t, uint64(1), ci.Instance.getTenant(defaultTestTenantKey).AcceptedCount)
+
+	// the limiter keeps working once the store is reachable again
+	adapter.WriteStatusMock = nil
+
+	res, err = ci.Instance.Submit(defaultTestTenantKey, 1)
+	assert.Nil(t, err)
+	assert.True(t, res.Accepted)
+	assert.Nil(t, res.SyncWarnings)
+	ci.AssertWindowStatus(t, defaultTestTenantKey, 6, "1000000:6")
+}
+
+func TestStrictSyncComposite(t *testing.T) {
+	adapter := testSyncAdapter{}
+	adapter.Clear()
+
+	ci := buildCompositeInstance(t, func(c *CompositeConfig) {
+		c.SyncAdapter = &adapter
+		c.StrictSync = true
+	})
+
+	assert.True(t, submitNoError(ci.Instance.Submit(defaultTestTenantKey, 5)).Accepted)
+
+	adapter.WriteStatusMock = func(sc context.Context, tk string, s string) error {
+		return errors.New("I could not")
+	}
+
+	_, err := ci.Instance.Submit(defaultTestTenantKey, 1)
+	assert.ErrorIs(t, err, ErrSyncFailed)
+
+	ci.AssertWindowStatus(t, defaultTestTenantKey, 5, "0:1000000:5", "1:1000000:5")
+
+	// in best-effort mode the same error is reported as a warning
+	ci.Instance.StrictSync = false
+
+	res, err := ci.Instance.Submit(defaultTestTenantKey, 1)
+	assert.Nil(t, err)
+	assert.True(t, res.Accepted)
+	assert.Equal(t, 1, len(res.SyncWarnings))
+	assert.ErrorIs(t, res.SyncWarnings[0], ErrSyncFailed)
+}
+
+func TestSyncMetrics(t *testing.T) {
+	adapter := testSyncAdapter{}
+	adapter.Clear()
+	adapter.LockMock = func(context.Context, string) error {
+		time.Sleep(5 * time.Millisecond)
+		return nil
+	}
+	adapter.WriteStatusMock = func(context.Context, string, string) error {
+		time.Sleep(2 * time.Millisecond)
+		return nil
+	}
+
+	type syncMetrics struct {
+		tenantKey string
+		lockWait  time.Duration
+		fetch     time.Duration
+		write     time.Duration
+	}
+	var collected []syncMetrics
+
+	ci := buildInstance(t, func(c *Config) {
+		c.SyncAdapter = &adapter
+		c.OnSyncMetrics = func(tenantKey string, lockWait time.Duration, fetch time.Duration, write time.Duration) {
+			collected = append(collected, syncMetrics{tenantKey, lockWait, fetch, write})
+		}
+	})
+
+	_, _ = ci.Instance.Probe(defaultTestTenantKey, 1)
+	assert.Equal(t, 1, len(collected))
+	assert.Equal(t, defaultTestTenantKey, collected[0].tenantKey)
+	assert.True(t, collected[0].lockWait >= 5*time.Millisecond)
+	assert.Equal(t, time.Duration(0), collected[0].write)
+
+	_, _ = ci.Instance.Submit(defaultTestTenantKey, 5)
+	assert.Equal(t, 2, len(collected))
+	assert.True(t, collected[1].lockWait >= 5*time.Millisecond)
+	assert.True(t, collected[1].write >= 2*time.Millisecond)
+
+	// composed limiters can't specify the hook
+	_, err := NewComposite(&CompositeConfig{
+		Limiters: []Config{
+			{
+				MaxLoad:       100,
+				WindowSize:    time.Minute,
+				OnSyncMetrics: func(string, time.Duration, time.Duration, time.Duration) {},
+			},
+		},
+	})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "cannot specify OnSyncMetrics on a composed limiter")
+}
+
+func TestSyncMetricsComposite(t *testing.T) {
+	adapter := testSyncAdapter{}
+	adapter.Clear()
+
+	var writes []time.Duration
+
+	ci := buildCompositeInstance(t, func(c *CompositeConfig) {
+		c.SyncAdapter = &adapter
+		c.OnSyncMetrics = func(tenantKey string, lockWait time.Duration, fetch time.Duration, write time.Duration) {
+			writes = append(writes, write)
+		}
+	})
+
+	_, _ = ci.Instance.Probe(defaultTestTenantKey, 1)
+	_, _ = ci.Instance.Submit(defaultTestTenantKey, 5)
+	assert.Equal(t, 2, len(writes))
+	assert.Equal(t, time.Duration(0), writes[0])
+}
+
+func TestPing(t *testing.T) {
+	ci := buildDefaultInstance(t)
+	assert.Nil(t, ci.Instance.Ping(context.Background()))
+
+	adapter := testSyncAdapter{}
+	adapter.Clear()
+
+	ci = buildInstance(t, func(c *Config) {
+		c.SyncAdapter = &adapter
+	})
+
+	assert.Nil(t, ci.Instance.Ping(context.Background()))
+	assert.Equal(t, []string{
+		"LOCK goll-healthcheck",
+		"UNLOCK goll-healthcheck",
+	}, adapter.collector)
+
+	adapter.Clear()
+	adapter.LockMock = func(ctx context.Context, tenantKey string) error {
+		return errors.New("I could not")
+	}
+
+	err := ci.Instance.Ping(context.Background())
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "I could not")
+	assert.Equal(t, []string{
+		"LOCK goll-healthcheck",
+	}, adapter.collector)
+
+	assert.Nil(t, ci.Instance.Close())
+	assert.ErrorIs(t, ci.Instance.Ping(context.Background()), ErrLimiterClosed)
+}
+
+func TestPingComposite(t *testing.T) {
+	adapter := testSyncAdapter{}
+	adapter.Clear()
+
+	ci := buildCompositeInstance(t, func(c *CompositeConfig) {
+		c.SyncAdapter = &adapter
+		c.SyncHealthCheckKey = "health"
+	})
+
+	adapter.UnlockMock = func(ctx context.Context, tenantKey string) error {
+		return errors.New("I could not")
+	}
+
+	err := ci.Instance.Ping(context.Background())
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "error releasing lock")
+	assert.Equal(t, []string{
+		"LOCK health",
+		"UNLOCK health",
+	}, adapter.collector)
+
+	// no tenant gets created
+	assert.Equal(t, 0, len(ci.Instance.ListTenants()))
+}
+
+func TestProbeReadOnlyWithSync(t *testing.T) {
+	adapter := testSyncAdapter{}
+	adapter.Clear()
+
+	ci := buildInstance(t, func(c *Config) {
+		c.SyncAdapter = &adapter
+	})
+
+	assert.True(t, submitNoError(ci.Instance.Submit(defaultTestTenantKey, 95)).Accepted)
+	versionBefore := ci.Instance.getTenant(defaultTestTenantKey).Version
+
+	// the remote status is restored but the window is left as is
+	ci.TimeTravel(defaultWindowSize.Milliseconds())
+	adapter.collector = make([]string, 0)
+
+	assert.True(t, noErrors(ci.Instance.ProbeReadOnly(defaultTestTenantKey, 100)).(bool))
+	assert.Equal(t, []string{
+		"LOCK test",
+		"FETCH test",
 		"UNLOCK test",
 	}, adapter.collector)
+	assert.Equal(t, versionBefore, ci.Instance.getTenant(defaultTestTenantKey).Version)
+	assert.Equal(t, uint64(95), ci.Instance.getTenant(defaultTestTenantKey).WindowTotal)
+}
+
+func TestVerifyWrites(t *testing.T) {
+	adapter := testSyncAdapter{}
+	adapter.Clear()
+
+	ci := buildInstance(t, func(c *Config) {
+		c.SyncAdapter = &adapter
+		c.VerifyWrites = true
+	})
+
+	res, err := ci.Instance.Submit(defaultTestTenantKey, 5)
+	assert.Nil(t, err)
+	assert.True(t, res.Accepted)
+	assert.Nil(t, res.SyncWarnings)
+
+	assert.Equal(t, []string{
+		"LOCK test",
+		"FETCH test",
+		"WRITE test v2/ver=3/total=5/over=0/seg=1000000:5/acc=1/rej=0",
+		"FETCH test",
+		"UNLOCK test",
+	}, adapter.collector)
+
+	// the outcome is reported with the transaction result
+	txResult, err := ci.Instance.runSyncTransaction(func() {
+		ci.Instance.markDirty(ci.InternalRequest(defaultTestTenantKey, 1))
+	}, syncTxOptions{TenantKey: defaultTestTenantKey})
+	assert.Nil(t, err)
+	assert.True(t, txResult.WriteVerified)
+
+	// writes silently lost by the adapter are detected
+	adapter.WriteStatusMock = func(sc context.Context, tk string, s string) error {
+		return nil
+	}
+
+	res, err = ci.Instance.Submit(defaultTestTenantKey, 1)
+	assert.Nil(t, err)
+	assert.True(t, res.Accepted)
+	assert.Equal(t, 1, len(res.SyncWarnings))
+	assert.ErrorIs(t, res.SyncWarnings[0], ErrSyncFailed)
+	assert.Contains(t, res.SyncWarnings[0].Error(), "could not verify status")
+}
+
+func TestVerifyWritesStrict(t *testing.T) {
+	adapter := testSyncAdapter{}
+	adapter.Clear()
+
+	ci := buildInstance(t, func(c *Config) {
+		c.SyncAdapter = &adapter
+		c.StrictSync = true
+		c.VerifyWrites = true
+	})
+
+	assert.True(t, submitNoError(ci.Instance.Submit(defaultTestTenantKey, 5)).Accepted)
+	versionBefore := ci.Instance.getTenant(defaultTestTenantKey).Version
+
+	adapter.WriteStatusMock = func(sc context.Context, tk string, s string) error {
+		return nil
+	}
+
+	res, err := ci.Instance.Submit(defaultTestTenantKey, 1)
+	assert.ErrorIs(t, err, ErrSyncFailed)
+	assert.False(t, res.Accepted)
+
+	// local changes are rolled back
+	ci.AssertWindowStatus(t, defaultTestTenantKey, 5, "1000000:5")
+	assert.Equal(t, versionBefore, ci.Instance.getTenant(defaultTestTenantKey).Version)
+}
+
+func TestVerifyWritesComposite(t *testing.T) {
+	adapter := testSyncAdapter{}
+	adapter.Clear()
+
+	ci := buildCompositeInstance(t, func(c *CompositeConfig) {
+		c.SyncAdapter = &adapter
+		c.StrictSync = true
+		c.VerifyWrites = true
+	})
+
+	assert.True(t, submitNoError(ci.Instance.Submit(defaultTestTenantKey, 5)).Accepted)
+	assert.Equal(t, "FETCH test", adapter.collector[len(adapter.collector)-2])
+
+	adapter.WriteStatusMock = func(sc context.Context, tk string, s string) error {
+		return nil
+	}
+
+	res, err := ci.Instance.Submit(defaultTestTenantKey, 1)
+	assert.ErrorIs(t, err, ErrSyncFailed)
+	assert.False(t, res.Accepted)
+	ci.AssertWindowStatus(t, defaultTestTenantKey, 5, "0:1000000:5", "1:1000000:5")
+}
+
+func TestSyncLockTimeout(t *testing.T) {
+	adapter := testSyncAdapter{}
+	adapter.Clear()
+
+	ci := buildInstance(t, func(c *Config) {
+		c.SyncAdapter = &adapter
+		c.SyncLockTimeout = 500 * time.Millisecond
+		c.SyncLockRetryInterval = 200 * time.Millisecond
+	})
+
+	// the lock gets acquired at the third attempt
+	attempts := 0
+	adapter.LockMock = func(ctx context.Context, tenantKey string) error {
+		attempts++
+		if attempts < 3 {
+			return errors.New("contended")
+		}
+		return nil
+	}
+
+	res, err := ci.Instance.Submit(defaultTestTenantKey, 1)
+	assert.Nil(t, err)
+	assert.True(t, res.Accepted)
+	assert.Equal(t, 3, attempts)
+	ci.AssertCurrentTime(t, 1000400)
+
+	// the lock is never acquired
+	adapter.Clear()
+	adapter.LockMock = func(ctx context.Context, tenantKey string) error {
+		return errors.New("contended")
+	}
+
+	_, err = ci.Instance.Submit(defaultTestTenantKey, 1)
+	assert.ErrorIs(t, err, ErrSyncLockTimeout)
+	assert.Contains(t, err.Error(), "contended")
+	assert.Equal(t, []string{
+		"LOCK test",
+		"LOCK test",
+		"LOCK test",
+		"LOCK test",
+	}, adapter.collector)
+	ci.AssertCurrentTime(t, 1000900)
+
+	var timeoutErr *SyncLockTimeout
+	assert.True(t, errors.As(err, &timeoutErr))
+	assert.Equal(t, uint64(4), timeoutErr.AttemptsNumber)
+	assert.Equal(t, 500*time.Millisecond, timeoutErr.WaitedFor)
+}
+
+func TestSyncLockTimeoutWithBlockingAdapter(t *testing.T) {
+	adapter := NewInMemorySyncAdapter()
+
+	ci := buildInstance(t, func(c *Config) {
+		c.SyncAdapter = adapter
+		c.SyncLockTimeout = 50 * time.Millisecond
+	})
+
+	// the lock is held elsewhere: Lock blocks until its context expires
+	assert.Nil(t, adapter.Lock(context.Background(), defaultTestTenantKey))
+
+	_, err := ci.Instance.Submit(defaultTestTenantKey, 1)
+	assert.ErrorIs(t, err, ErrSyncLockTimeout)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	assert.Nil(t, adapter.Unlock(context.Background(), defaultTestTenantKey))
+	assert.True(t, submitNoError(ci.Instance.Submit(defaultTestTenantKey, 1)).Accepted)
+}
+
+func TestSyncLockTimeoutComposite(t *testing.T) {
+	adapter := testSyncAdapter{}
+	adapter.Clear()
+
+	ci := buildCompositeInstance(t, func(c *CompositeConfig) {
+		c.SyncAdapter = &adapter
+		c.SyncLockTimeout = time.Second
+	})
+
+	adapter.LockMock = func(ctx context.Context, tenantKey string) error {
+		return errors.New("contended")
+	}
+
+	_, err := ci.Instance.Submit(defaultTestTenantKey, 1)
+	assert.ErrorIs(t, err, ErrSyncLockTimeout)
+
+	// retried every 1/10 of the timeout by default
+	assert.Equal(t, 11, len(adapter.collector))
 }
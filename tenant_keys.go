@@ -0,0 +1,40 @@
+package goll
+
+import (
+	"fmt"
+	"strings"
+)
+
+// reservedTenantKeyCharacters are the separators used
+// by the synchronization layer: ";" joins the statuses of composed limiters
+// and ":" splits the fields of the serialized segments.
+const reservedTenantKeyCharacters = ";:"
+
+// defaultTenantKeyValidator is used when no TenantKeyValidator is configured.
+// It rejects the keys holding any of the reserved separators.
+func defaultTenantKeyValidator(tenantKey string) error {
+	if i := strings.IndexAny(tenantKey, reservedTenantKeyCharacters); i >= 0 {
+		return fmt.Errorf("tenant key should not contain the reserved character %q", tenantKey[i])
+	}
+	return nil
+}
+
+// checkTenantKey runs the given validator against the tenant key,
+// wrapping the error in ErrInvalidTenantKey.
+func checkTenantKey(validator func(tenantKey string) error, tenantKey string) error {
+	if validator == nil {
+		validator = defaultTenantKeyValidator
+	}
+	if err := validator(tenantKey); err != nil {
+		return fmt.Errorf("%w %q: %v", ErrInvalidTenantKey, tenantKey, err)
+	}
+	return nil
+}
+
+func (instance *loadLimiterDefaultImpl) validateTenantKey(tenantKey string) error {
+	return checkTenantKey(instance.TenantKeyValidator, tenantKey)
+}
+
+func (instance *compositeLoadLimiterDefaultImpl) validateTenantKey(tenantKey string) error {
+	return checkTenantKey(instance.TenantKeyValidator, tenantKey)
+}
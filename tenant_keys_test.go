@@ -0,0 +1,136 @@
+package goll
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefaultTenantKeyValidator(t *testing.T) {
+	ti := buildDefaultInstance(t)
+
+	for _, tenantKey := range []string{"a;b", "tenant:1"} {
+		_, err := ti.Instance.Submit(tenantKey, 1)
+		assert.ErrorIs(t, err, ErrInvalidTenantKey)
+
+		_, err = ti.Instance.Probe(tenantKey, 1)
+		assert.ErrorIs(t, err, ErrInvalidTenantKey)
+
+		_, err = ti.Instance.RemainingCapacity(tenantKey)
+		assert.ErrorIs(t, err, ErrInvalidTenantKey)
+	}
+
+	_, err := ti.Instance.Submit("a;b", 1)
+	assert.Equal(t, `invalid tenant key "a;b": tenant key should not contain the reserved character ';'`, err.Error())
+
+	// rejected keys don't hold any state
+	assert.Equal(t, []string{}, ti.Instance.ListTenants())
+
+	assert.True(t, submitNoError(ti.Instance.Submit("tenant-1", 1)).Accepted)
+	assert.True(t, submitNoError(ti.Instance.AsSingleTenant().Submit(1)).Accepted)
+}
+
+func TestTenantKeyValidationOnStateManagement(t *testing.T) {
+	ti := buildDefaultInstance(t)
+
+	exported, err := ti.Instance.ExportTenantState(defaultTestTenantKey)
+	assert.Nil(t, err)
+
+	for _, tenantKey := range []string{"a;b", "tenant:1"} {
+		assert.ErrorIs(t, ti.Instance.Refund(tenantKey, 1), ErrInvalidTenantKey)
+		assert.ErrorIs(t, ti.Instance.ImportTenantState(tenantKey, exported), ErrInvalidTenantKey)
+		assert.ErrorIs(t, ti.Instance.ResetTenant(tenantKey), ErrInvalidTenantKey)
+		assert.ErrorIs(t, ti.Instance.TruncateAfter(tenantKey, ti.Instance.currentTime()), ErrInvalidTenantKey)
+		assert.ErrorIs(t, ti.Instance.SetDraining(tenantKey, ti.Instance.currentTime().Add(time.Second)), ErrInvalidTenantKey)
+
+		_, err = ti.Instance.ExportTenantState(tenantKey)
+		assert.ErrorIs(t, err, ErrInvalidTenantKey)
+
+		_, err = ti.Instance.SnapshotTenant(tenantKey)
+		assert.ErrorIs(t, err, ErrInvalidTenantKey)
+
+		_, err = ti.Instance.CopyTenantState(tenantKey)
+		assert.ErrorIs(t, err, ErrInvalidTenantKey)
+
+		_, err = ti.Instance.Stats(tenantKey)
+		assert.ErrorIs(t, err, ErrInvalidTenantKey)
+
+		_, err = ti.Instance.IsOverloaded(tenantKey)
+		assert.ErrorIs(t, err, ErrInvalidTenantKey)
+
+		assert.ErrorIs(t, ti.Instance.SetTenantMaxLoad(tenantKey, 10), ErrInvalidTenantKey)
+		assert.ErrorIs(t, ti.Instance.GrantTemporaryBoost(tenantKey, 10, ti.Instance.currentTime().Add(time.Second)), ErrInvalidTenantKey)
+		assert.False(t, ti.Instance.EvictTenant(tenantKey))
+	}
+
+	// invalid keys are skipped
+	ti.Instance.PrewarmTenants("a;b", "tenant-1")
+	assert.Nil(t, ti.Instance.Restore(map[string]string{"tenant:1": exported}))
+
+	assert.ElementsMatch(t, []string{defaultTestTenantKey, "tenant-1"}, ti.Instance.ListTenants())
+}
+
+func TestCustomTenantKeyValidator(t *testing.T) {
+	ti := buildInstance(t, func(config *Config) {
+		config.TenantKeyValidator = func(tenantKey string) error {
+			if !strings.HasPrefix(tenantKey, "org-") {
+				return errors.New("tenant key should start with org-")
+			}
+			return nil
+		}
+	})
+
+	_, err := ti.Instance.Submit("other", 1)
+	assert.ErrorIs(t, err, ErrInvalidTenantKey)
+	assert.Contains(t, err.Error(), "should start with org-")
+
+	// the custom validator replaces the default one
+	assert.True(t, submitNoError(ti.Instance.Submit("org-a:b", 1)).Accepted)
+}
+
+func TestCompositeTenantKeyValidator(t *testing.T) {
+	ti := buildDefaultCompositeInstance(t)
+
+	_, err := ti.Instance.Submit("a;b", 1)
+	assert.ErrorIs(t, err, ErrInvalidTenantKey)
+
+	_, err = ti.Instance.Probe("a;b", 1)
+	assert.ErrorIs(t, err, ErrInvalidTenantKey)
+
+	_, err = ti.Instance.Stats("a;b")
+	assert.ErrorIs(t, err, ErrInvalidTenantKey)
+
+	_, err = ti.Instance.IsOverloaded("a;b")
+	assert.ErrorIs(t, err, ErrInvalidTenantKey)
+
+	assert.False(t, ti.Instance.EvictTenant("a;b"))
+
+	// rejected keys don't hold any state
+	assert.Equal(t, []string{}, ti.Instance.ListTenants())
+
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 1)).Accepted)
+
+	ti = buildCompositeInstance(t, func(config *CompositeConfig) {
+		config.TenantKeyValidator = func(tenantKey string) error {
+			return nil
+		}
+	})
+	assert.True(t, submitNoError(ti.Instance.Submit("a;b", 1)).Accepted)
+
+	_, err = NewComposite(&CompositeConfig{
+		Limiters: []Config{
+			{
+				MaxLoad:    100,
+				WindowSize: 10 * time.Second,
+				TenantKeyValidator: func(tenantKey string) error {
+					return nil
+				},
+			},
+		},
+	})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "cannot specify TenantKeyValidator on a composed limiter")
+}
@@ -0,0 +1,105 @@
+package goll
+
+import "sync"
+
+// numTenantLockShards is the number of locks the tenants are spread across.
+// Operations on tenants mapped to different shards run concurrently.
+const numTenantLockShards = 64
+
+// The locking is organized on three levels, always acquired in this order:
+//
+//   - instance.Lock is held in read mode by every operation on a single tenant
+//     and in write mode by the operations involving the whole limiter,
+//     like changing the configuration or iterating over all the tenants.
+//   - the tenant lock shard serializes the operations on the tenants it holds.
+//     Read-only operations on the local state only take it in read mode.
+//   - instance.tenantsLock is held briefly when accessing the TenantData
+//     and the pendingWriteBacks maps, which are shared by all the shards.
+//
+// A submission charged to a parent tenant (see ParentKeyFunc) needs
+// the shards of both the tenants: they are acquired in ascending index order,
+// so that two submissions locking the same pair of shards can't deadlock.
+// The locks on the remote store are then acquired for the tenant first
+// and for its parent next, which can't deadlock as long as
+// the hierarchy derived by ParentKeyFunc has no cycles.
+
+// tenantLockShardIndex returns the index of the shard holding the given tenant.
+func tenantLockShardIndex(tenantKey string) uint32 {
+	// inlined FNV-1a to avoid allocations
+	h := uint32(2166136261)
+	for i := 0; i < len(tenantKey); i++ {
+		h ^= uint32(tenantKey[i])
+		h *= 16777619
+	}
+	return h % numTenantLockShards
+}
+
+// tenantLockShard returns the lock guarding the given tenant.
+func (instance *loadLimiterDefaultImpl) tenantLockShard(tenantKey string) *sync.RWMutex {
+	return &instance.tenantLocks[tenantLockShardIndex(tenantKey)]
+}
+
+// lockTenant acquires the locks required to modify the given tenant,
+// returning the function releasing them.
+func (instance *loadLimiterDefaultImpl) lockTenant(tenantKey string) func() {
+	instance.Lock.RLock()
+	shard := instance.tenantLockShard(tenantKey)
+	shard.Lock()
+
+	return func() {
+		shard.Unlock()
+		instance.Lock.RUnlock()
+	}
+}
+
+// lockTenantWithParent acquires the locks required to modify
+// both the given tenant and its parent, returning the function releasing them.
+func (instance *loadLimiterDefaultImpl) lockTenantWithParent(tenantKey string, parentKey string) func() {
+	instance.Lock.RLock()
+	i, j := tenantLockShardIndex(tenantKey), tenantLockShardIndex(parentKey)
+
+	if i == j {
+		// both tenants are held by the same shard
+		shard := &instance.tenantLocks[i]
+		shard.Lock()
+		return func() {
+			shard.Unlock()
+			instance.Lock.RUnlock()
+		}
+	}
+
+	if j < i {
+		i, j = j, i
+	}
+	first, second := &instance.tenantLocks[i], &instance.tenantLocks[j]
+	first.Lock()
+	second.Lock()
+
+	return func() {
+		second.Unlock()
+		first.Unlock()
+		instance.Lock.RUnlock()
+	}
+}
+
+// rlockTenant acquires the locks required to read the local state
+// of the given tenant, returning the function releasing them.
+func (instance *loadLimiterDefaultImpl) rlockTenant(tenantKey string) func() {
+	instance.Lock.RLock()
+	shard := instance.tenantLockShard(tenantKey)
+	shard.RLock()
+
+	return func() {
+		shard.RUnlock()
+		instance.Lock.RUnlock()
+	}
+}
+
+// lookupTenant returns the data for the given tenant, if existing.
+func (instance *loadLimiterDefaultImpl) lookupTenant(tenantKey string) (*loadLimiterDefaultImplTenantData, bool) {
+	instance.tenantsLock.Lock()
+	defer instance.tenantsLock.Unlock()
+
+	tenant, exists := instance.TenantData[tenantKey]
+	return tenant, exists
+}
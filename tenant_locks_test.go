@@ -0,0 +1,120 @@
+package goll
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTenantLocksIndependent(t *testing.T) {
+	ti := buildDefaultInstance(t)
+
+	first, second := "first", "second"
+	assert.True(t, ti.Instance.tenantLockShard(first) != ti.Instance.tenantLockShard(second))
+	assert.True(t, ti.Instance.tenantLockShard(first) == ti.Instance.tenantLockShard(first))
+
+	// an operation in progress on a tenant does not block other tenants
+	release := ti.Instance.lockTenant(first)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		assert.True(t, submitNoError(ti.Instance.Submit(second, 10)).Accepted)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("operations on different tenants should not wait for each other")
+	}
+	release()
+
+	ti.AssertWindowStatus(t, second, 10, "1000000:10")
+	ti.AssertWindowStatus(t, first, 0)
+}
+
+func TestTenantLocksConcurrentSubmit(t *testing.T) {
+	ti := buildInstance(t, func(config *Config) {
+		config.MaxLoad = 1000000
+	})
+
+	numTenants := 16
+	numSubmissions := 200
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < numTenants; i++ {
+		tenantKey := fmt.Sprintf("tenant-%d", i)
+		for j := 0; j < 4; j++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for k := 0; k < numSubmissions; k++ {
+					_, _ = ti.Instance.Submit(tenantKey, 1)
+					_, _ = ti.Instance.Probe(tenantKey, 1)
+				}
+			}()
+		}
+	}
+
+	// instance-wide operations run concurrently with the submissions
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for k := 0; k < 20; k++ {
+			_, _ = ti.Instance.StatsAll()
+			_ = ti.Instance.ListTenants()
+		}
+	}()
+
+	wg.Wait()
+
+	assert.Equal(t, numTenants, len(ti.Instance.ListTenants()))
+	for i := 0; i < numTenants; i++ {
+		ti.AssertWindowStatus(t, fmt.Sprintf("tenant-%d", i), 4*numSubmissions, fmt.Sprintf("1000000:%d", 4*numSubmissions))
+	}
+}
+
+func BenchmarkSubmitMixedTenantsParallel(b *testing.B) {
+	ti := buildInstance(nil, func(config *Config) {
+		config.MaxLoad = 1 << 62
+	})
+
+	tenantKeys := make([]string, 64)
+	for i := range tenantKeys {
+		tenantKeys[i] = fmt.Sprintf("tenant-%d", i)
+	}
+
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			_, _ = ti.Instance.Submit(tenantKeys[i%len(tenantKeys)], 1)
+			i++
+		}
+	})
+}
+
+func BenchmarkSubmitMixedTenantsParallelSerialized(b *testing.B) {
+	ti := buildInstance(nil, func(config *Config) {
+		config.MaxLoad = 1 << 62
+	})
+
+	tenantKeys := make([]string, 64)
+	for i := range tenantKeys {
+		tenantKeys[i] = fmt.Sprintf("tenant-%d", i)
+	}
+
+	// same as BenchmarkSubmitMixedTenantsParallel,
+	// serializing all the submissions as with a single limiter-wide lock
+	lock := sync.Mutex{}
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			lock.Lock()
+			_, _ = ti.Instance.Submit(tenantKeys[i%len(tenantKeys)], 1)
+			lock.Unlock()
+			i++
+		}
+	})
+}
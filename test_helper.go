@@ -69,7 +69,7 @@ func (ti *testableInstance) HashSegments(tenantKey string) string {
 	for i := 0; i < tenant.WindowQueue.Len(); i++ {
 
 		el := tenant.WindowQueue.At(i).(*windowSegment)
-		out = out + fmt.Sprintf("%v:%v, ", el.StartTime, el.Value)
+		out = out + fmt.Sprintf("%v:%v, ", el.StartTime, el.total())
 	}
 	if len(out) > 0 {
 		out = strings.TrimRight(out, ", ")
@@ -237,7 +237,7 @@ func (ti *compositeTestableInstance) HashSegments(tenantKey string) string {
 		for i := 0; i < q.Len(); i++ {
 
 			el := q.At(i).(*windowSegment)
-			out = out + fmt.Sprintf("%d:%v:%v, ", limiterIndex, el.StartTime, el.Value)
+			out = out + fmt.Sprintf("%d:%v:%v, ", limiterIndex, el.StartTime, el.total())
 		}
 	}
 
@@ -323,6 +323,54 @@ func buildDefaultCompositeInstance(t *testing.T) *compositeTestableInstance {
 	return buildCompositeInstance(t, nil)
 }
 
+type tokenBucketTestableInstance struct {
+	Instance    *tokenBucketLimiterImpl
+	CurrentTime uint64
+}
+
+func (ti *tokenBucketTestableInstance) TimeTravel(diff int64) {
+	ti.CurrentTime = uint64(int64(ti.CurrentTime) + diff)
+}
+
+func buildTokenBucketInstance(t *testing.T, configurer func(config *TokenBucketConfig)) *tokenBucketTestableInstance {
+	ti := tokenBucketTestableInstance{
+		CurrentTime: 1000000,
+	}
+
+	timeFunc := func() time.Time {
+		return time.Unix(
+			int64(ti.CurrentTime)/int64(1000),
+			(int64(ti.CurrentTime)%int64(1000))*int64(1000000),
+		)
+	}
+
+	sleepFunc := func(d time.Duration) {
+		ti.CurrentTime = ti.CurrentTime + uint64(d.Milliseconds())
+	}
+
+	config := TokenBucketConfig{
+		Capacity:   defaultMaxLoad,
+		RefillRate: 10,
+		TimeFunc:   timeFunc,
+		SleepFunc:  sleepFunc,
+	}
+
+	if configurer != nil {
+		configurer(&config)
+	}
+
+	instance, err := NewTokenBucket(&config)
+
+	if t != nil {
+		assert.NotNil(t, instance)
+		assert.Nil(t, err)
+	}
+
+	ti.Instance = instance.(*tokenBucketLimiterImpl)
+
+	return &ti
+}
+
 func noErrors(args ...interface{}) interface{} {
 	for _, a := range args {
 		if a == nil {
@@ -0,0 +1,923 @@
+package goll
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tokensEpsilon absorbs the floating point errors
+// accumulated while refilling the buckets.
+const tokensEpsilon = 1e-9
+
+// tokenBucketLimiterImpl holds all the required
+// runtime data for a token bucket limiter
+// together with the parsed configuration.
+type tokenBucketLimiterImpl struct {
+	Logger Logger
+	Config *tokenBucketEffectiveConfig
+
+	// Time functions can be overridden for testing.
+	TimeFunc  func() time.Time
+	SleepFunc func(d time.Duration)
+
+	// CostFunc computes the load of a request descriptor for SubmitCost.
+	CostFunc func(meta interface{}) uint64
+
+	// a lock provides thread safety.
+	Lock sync.Mutex
+
+	// we keep all runtime data for tenants
+	// in a map indexed by tenant key
+	TenantData map[string]*tokenBucketTenantData
+
+	// drainUntil is the end of the draining of all the tenants,
+	// 0 if not draining.
+	drainUntil uint64
+
+	// closed is set when the limiter gets closed.
+	closed bool
+}
+
+type tokenBucketTenantData struct {
+	// Tokens holds the tokens available in the bucket
+	// at the time of the last refill.
+	Tokens float64
+
+	// LastRefill is the time of the last refill, in milliseconds.
+	LastRefill uint64
+
+	// CapacityOverride replaces the configured capacity if greater than 0.
+	CapacityOverride uint64
+
+	// Boosts holds the temporary capacity boosts granted to the tenant.
+	Boosts []tenantBoost
+
+	// DrainUntil is the end of the draining of the tenant, 0 if not draining.
+	DrainUntil uint64
+
+	// WasOver signals that the most recent request was rejected.
+	WasOver bool
+
+	// AcceptedCount and RejectedCount count the submissions
+	// over the lifetime of the tenant.
+	AcceptedCount uint64
+	RejectedCount uint64
+}
+
+// tokenBucketEffectiveConfig holds the validated and parsed configuration
+// that was obtained from the user-provided configuration.
+type tokenBucketEffectiveConfig struct {
+	// max tokens held by a bucket
+	Capacity uint64
+
+	// refill rate, as tokens per interval in milliseconds
+	RefillRate     uint64
+	RefillInterval uint64
+
+	// refill rate, precomputed
+	TokensPerMillisecond float64
+
+	// load units per 1.0 of fractional load
+	FloatLoadPrecision uint64
+}
+
+func (instance *tokenBucketLimiterImpl) currentTime() time.Time {
+	// hook time provider here to allow easier testing
+	return instance.TimeFunc()
+}
+
+func (instance *tokenBucketLimiterImpl) sleepCtx(ctx context.Context, d time.Duration) error {
+	return sleepWithContext(ctx, d, instance.SleepFunc)
+}
+
+func (instance *tokenBucketLimiterImpl) getTenant(tenantKey string, t uint64) *tokenBucketTenantData {
+	existing, exists := instance.TenantData[tenantKey]
+	if exists {
+		return existing
+	}
+
+	newTenantData := instance.newBucket(t)
+	instance.TenantData[tenantKey] = newTenantData
+	return newTenantData
+}
+
+// newBucket builds the bucket of a new tenant
+// without registering it in the limiter.
+func (instance *tokenBucketLimiterImpl) newBucket(t uint64) *tokenBucketTenantData {
+	// new buckets start full
+	return &tokenBucketTenantData{
+		Tokens:     float64(instance.Config.Capacity),
+		LastRefill: t,
+	}
+}
+
+// detachedBucket returns a copy of the bucket of the given tenant,
+// or a new one if the tenant has no bucket yet,
+// that can be refilled and evaluated without affecting the limiter state.
+func (instance *tokenBucketLimiterImpl) detachedBucket(tenantKey string, t uint64) *tokenBucketTenantData {
+	existing, exists := instance.TenantData[tenantKey]
+	if !exists {
+		return instance.newBucket(t)
+	}
+
+	out := *existing
+	if existing.Boosts != nil {
+		out.Boosts = append([]tenantBoost(nil), existing.Boosts...)
+	}
+	return &out
+}
+
+// capacity returns the capacity of the bucket for the given tenant,
+// including any active temporary boost.
+func (instance *tokenBucketLimiterImpl) capacity(tenant *tokenBucketTenantData, t uint64) uint64 {
+	out := instance.Config.Capacity
+	if tenant.CapacityOverride > 0 {
+		out = tenant.CapacityOverride
+	}
+	for _, boost := range tenant.Boosts {
+		if boost.Until > t {
+			out += boost.ExtraLoad
+		}
+	}
+	return out
+}
+
+// refill adds the tokens accrued since the last refill,
+// up to the bucket capacity.
+func (instance *tokenBucketLimiterImpl) refill(tenant *tokenBucketTenantData, t uint64) {
+	if t > tenant.LastRefill {
+		tenant.Tokens += float64(t-tenant.LastRefill) * instance.Config.TokensPerMillisecond
+		tenant.LastRefill = t
+	}
+
+	capacity := float64(instance.capacity(tenant, t))
+	if tenant.Tokens > capacity {
+		tenant.Tokens = capacity
+	}
+}
+
+// timeToAvailable computes how long it will take
+// for the bucket to hold the given amount of tokens.
+func (instance *tokenBucketLimiterImpl) timeToAvailable(tenant *tokenBucketTenantData, load uint64, t uint64) (time.Duration, error) {
+	capacity := instance.capacity(tenant, t)
+	if load > capacity {
+		return 0, fmt.Errorf("requested load of %v is over the bucket capacity of %v and will never be allowed", load, capacity)
+	}
+
+	retryIn := time.Duration(0)
+
+	missing := float64(load) - tenant.Tokens
+	if missing > tokensEpsilon {
+		millis := math.Ceil(missing/instance.Config.TokensPerMillisecond - tokensEpsilon)
+		retryIn = time.Duration(millis) * time.Millisecond
+	}
+
+	// no load is admitted before the end of the draining
+	if draining := instance.drainingFor(tenant, t); draining > retryIn {
+		return draining, nil
+	}
+	return retryIn, nil
+}
+
+// drainingFor returns how long the given tenant
+// is still draining, or zero if it is not.
+func (instance *tokenBucketLimiterImpl) drainingFor(tenant *tokenBucketTenantData, t uint64) time.Duration {
+	drainUntil := instance.drainUntil
+	if tenant.DrainUntil > drainUntil {
+		drainUntil = tenant.DrainUntil
+	}
+	if drainUntil <= t {
+		return 0
+	}
+	return time.Duration(drainUntil-t) * time.Millisecond
+}
+
+// evaluate refills the bucket and checks if the given load would be accepted,
+// filling the RetryIn information on rejection.
+func (instance *tokenBucketLimiterImpl) evaluate(tenant *tokenBucketTenantData, load uint64, t uint64) SubmitResult {
+	instance.refill(tenant, t)
+
+	if float64(load) <= tenant.Tokens+tokensEpsilon && instance.drainingFor(tenant, t) == 0 {
+		return SubmitResult{
+			Accepted: true,
+		}
+	}
+
+	res := SubmitResult{
+		Accepted:            false,
+		PermanentlyRejected: load > instance.capacity(tenant, t),
+	}
+	if retryIn, err := instance.timeToAvailable(tenant, load, t); err == nil {
+		res.RetryInAvailable = true
+		res.RetryIn = retryIn
+	}
+	return res
+}
+
+// Probe checks if the given load would be allowed right now.
+// it is a readonly method that does not consume any token.
+func (instance *tokenBucketLimiterImpl) Probe(tenantKey string, load uint64) (bool, error) {
+	res, err := instance.ProbeWithDetails(tenantKey, load)
+	return res.Accepted, err
+}
+
+// ProbeReadOnly checks if the given load would be allowed right now
+// like Probe does, but evaluates it against a copy of the bucket:
+// no bucket is created for unknown tenants and the stored one is never refilled.
+func (instance *tokenBucketLimiterImpl) ProbeReadOnly(tenantKey string, load uint64) (bool, error) {
+	t := uint64(instance.currentTime().UnixMilli())
+
+	instance.Lock.Lock()
+	defer instance.Lock.Unlock()
+
+	if instance.closed {
+		return false, ErrLimiterClosed
+	}
+
+	return instance.evaluate(instance.detachedBucket(tenantKey, t), load, t).Accepted, nil
+}
+
+// ProbeWithDetails works like Probe but also returns
+// the RetryIn information the caller would get on rejection.
+func (instance *tokenBucketLimiterImpl) ProbeWithDetails(tenantKey string, load uint64) (SubmitResult, error) {
+	t := uint64(instance.currentTime().UnixMilli())
+
+	instance.Lock.Lock()
+	defer instance.Lock.Unlock()
+
+	if instance.closed {
+		return SubmitResult{}, ErrLimiterClosed
+	}
+
+	return instance.evaluate(instance.getTenant(tenantKey, t), load, t), nil
+}
+
+// ProbeMany checks which of the given loads would be allowed right now,
+// returning the results in the same order of the loads.
+// it is a readonly method that does not consume any token.
+func (instance *tokenBucketLimiterImpl) ProbeMany(tenantKey string, loads []uint64) ([]bool, error) {
+	if len(loads) == 0 {
+		return nil, errors.New("ProbeMany requires at least one load")
+	}
+
+	t := uint64(instance.currentTime().UnixMilli())
+
+	instance.Lock.Lock()
+	defer instance.Lock.Unlock()
+
+	if instance.closed {
+		return nil, ErrLimiterClosed
+	}
+
+	tenant := instance.getTenant(tenantKey, t)
+
+	out := make([]bool, len(loads))
+	for i, load := range loads {
+		out[i] = instance.evaluate(tenant, load, t).Accepted
+	}
+	return out, nil
+}
+
+// Submit asks for the given load to be accepted,
+// consuming the corresponding tokens from the bucket.
+// The result object contains an Accepted property
+// together with RetryIn information when available.
+func (instance *tokenBucketLimiterImpl) Submit(tenantKey string, load uint64) (SubmitResult, error) {
+	t := uint64(instance.currentTime().UnixMilli())
+
+	instance.Lock.Lock()
+	defer instance.Lock.Unlock()
+
+	if instance.closed {
+		return SubmitResult{}, ErrLimiterClosed
+	}
+
+	tenant := instance.getTenant(tenantKey, t)
+	res := instance.evaluate(tenant, load, t)
+
+	if res.Accepted {
+		tenant.Tokens -= float64(load)
+		if tenant.Tokens < 0 {
+			tenant.Tokens = 0
+		}
+		tenant.WasOver = false
+		tenant.AcceptedCount++
+	} else {
+		tenant.WasOver = true
+		tenant.RejectedCount++
+	}
+
+	return res, nil
+}
+
+// SubmitBatch asks for all the given loads to be accepted at once.
+//
+// The batch is accepted only if the bucket holds enough tokens for the combined load,
+// otherwise the whole batch is rejected and RetryIn is computed for the total.
+func (instance *tokenBucketLimiterImpl) SubmitBatch(tenantKey string, loads []uint64) (SubmitResult, error) {
+	if len(loads) == 0 {
+		return SubmitResult{}, errors.New("SubmitBatch requires at least one load")
+	}
+
+	total := uint64(0)
+	for _, load := range loads {
+		if total > math.MaxUint64-load {
+			return SubmitResult{}, errors.New("the combined load of the batch is too large")
+		}
+		total += load
+	}
+
+	return instance.Submit(tenantKey, total)
+}
+
+// SubmitCost asks for the load computed by the configured CostFunc
+// for the given request descriptor to be accepted.
+func (instance *tokenBucketLimiterImpl) SubmitCost(tenantKey string, meta interface{}) (SubmitResult, error) {
+	if instance.CostFunc == nil {
+		return SubmitResult{}, errors.New("SubmitCost requires a CostFunc to be configured")
+	}
+
+	return instance.Submit(tenantKey, instance.CostFunc(meta))
+}
+
+// SubmitUntil asks for the given load to be accepted and,
+// in case of rejection, automatically handles retries and delays.
+// In case of acceptance a nil value is returned.
+// In case of timeout or other errors a non-nil error is returned.
+func (instance *tokenBucketLimiterImpl) SubmitUntil(tenantKey string, load uint64, timeout time.Duration) error {
+	return instance.submitUntil(context.Background(), tenantKey, load, timeout).Error
+}
+
+// SubmitUntilWithDetails works like SubmitUntil
+// but also returns the amount of time waited and the number of attempts.
+func (instance *tokenBucketLimiterImpl) SubmitUntilWithDetails(tenantKey string, load uint64, timeout time.Duration) SubmitUntilResult {
+	return instance.submitUntil(context.Background(), tenantKey, load, timeout)
+}
+
+// SubmitUntilCtx works like SubmitUntilWithDetails
+// but stops waiting as soon as the given context is cancelled.
+func (instance *tokenBucketLimiterImpl) SubmitUntilCtx(ctx context.Context, tenantKey string, load uint64, timeout time.Duration) SubmitUntilResult {
+	return instance.submitUntil(ctx, tenantKey, load, timeout)
+}
+
+// SubmitUntilWithOptions works like SubmitUntilWithDetails
+// but accepts additional options, like a maximum number of attempts
+// to be made regardless of the timeout.
+//
+// When the attempts are exhausted the Error field of the output object
+// is a LoadRequestTimeout with AttemptsExhausted set to true.
+func (instance *tokenBucketLimiterImpl) SubmitUntilWithOptions(tenantKey string, load uint64, options SubmitUntilOptions) SubmitUntilResult {
+	return instance.submitUntilWithOptions(context.Background(), tenantKey, load, options)
+}
+
+// SubmitUntilWithBackoff works like SubmitUntilWithDetails
+// but waits before each retry for the time computed by the given BackoffFunc.
+// The timeout is still honored.
+func (instance *tokenBucketLimiterImpl) SubmitUntilWithBackoff(tenantKey string, load uint64, timeout time.Duration, backoff BackoffFunc) SubmitUntilResult {
+	return instance.submitUntilWithOptions(context.Background(), tenantKey, load, SubmitUntilOptions{
+		Timeout: timeout,
+		Backoff: backoff,
+	})
+}
+
+func (instance *tokenBucketLimiterImpl) submitUntil(ctx context.Context, tenantKey string, load uint64, timeout time.Duration) SubmitUntilResult {
+	return instance.submitUntilWithOptions(ctx, tenantKey, load, SubmitUntilOptions{
+		Timeout: timeout,
+	})
+}
+
+func (instance *tokenBucketLimiterImpl) submitUntilWithOptions(ctx context.Context, tenantKey string, load uint64, options SubmitUntilOptions) SubmitUntilResult {
+
+	t := instance.currentTime()
+
+	out := SubmitUntilResult{
+		AttemptsNumber: 0,
+		WaitedFor:      0,
+		Error:          nil,
+	}
+
+	if options.Timeout < 0 {
+		instance.Logger.Warning("submit of task failed because of invalid timeout")
+		out.Error = &LoadRequestRejected{
+			Reason: "invalid timeout",
+		}
+		return out
+	}
+
+	timeoutAt := t.Add(options.Timeout)
+
+	for {
+		out.AttemptsNumber++
+		submitResult, err := instance.Submit(tenantKey, load)
+		if err != nil {
+			instance.Logger.Warning(fmt.Sprintf("submit of task failed: %s", err.Error()))
+			out.Error = fmt.Errorf("error submitting load request: %w", err)
+			break
+		}
+
+		if submitResult.Accepted {
+			break
+		}
+
+		if !submitResult.RetryInAvailable || submitResult.RetryIn <= 0 {
+			instance.Logger.Warning("submit of task failed and can't be retried")
+			out.Error = &LoadRequestRejected{
+				Reason: "excessive requested load",
+			}
+			break
+		}
+
+		if options.MaxAttempts > 0 && out.AttemptsNumber >= options.MaxAttempts {
+			instance.Logger.Warning("submit of task failed and attempts were exhausted")
+			out.Error = &LoadRequestTimeout{
+				WaitedFor:         out.WaitedFor,
+				AttemptsNumber:    out.AttemptsNumber,
+				AttemptsExhausted: true,
+			}
+			break
+		}
+
+		waitFor := options.retryWait(out.AttemptsNumber, submitResult.RetryIn)
+		if instance.currentTime().Add(waitFor).After(timeoutAt) {
+			instance.Logger.Warning("submit of task failed and retrying timed out")
+			out.Error = &LoadRequestTimeout{
+				WaitedFor:       out.WaitedFor,
+				AttemptsNumber:  out.AttemptsNumber,
+				WouldHaveWaited: waitFor,
+			}
+			break
+		}
+
+		instance.Logger.Debug(fmt.Sprintf("submit of task was rejected, waiting %v ms and retrying", waitFor.Milliseconds()))
+		if interrupted := waitForRetry(ctx, instance.currentTime, instance.sleepCtx, waitFor, &out); interrupted {
+			instance.Logger.Warning("submit of task was interrupted while waiting")
+			break
+		}
+
+		instance.Logger.Debug("submit of task will now be reattempted")
+	}
+
+	return out
+}
+
+// TimeToAvailable returns how long the caller would have to wait
+// before the bucket holds enough tokens for the given load.
+// A zero duration is returned if the load would be accepted right now.
+func (instance *tokenBucketLimiterImpl) TimeToAvailable(tenantKey string, load uint64) (time.Duration, error) {
+	t := uint64(instance.currentTime().UnixMilli())
+
+	instance.Lock.Lock()
+	defer instance.Lock.Unlock()
+
+	if instance.closed {
+		return 0, ErrLimiterClosed
+	}
+
+	tenant := instance.getTenant(tenantKey, t)
+	instance.refill(tenant, t)
+
+	return instance.timeToAvailable(tenant, load, t)
+}
+
+// NextAvailableAt returns the earliest time at which
+// the bucket holds enough tokens for the given load.
+// The current time is returned if the load would be accepted right now.
+func (instance *tokenBucketLimiterImpl) NextAvailableAt(tenantKey string, load uint64) (time.Time, error) {
+	now := instance.currentTime()
+	t := uint64(now.UnixMilli())
+
+	instance.Lock.Lock()
+	defer instance.Lock.Unlock()
+
+	if instance.closed {
+		return time.Time{}, ErrLimiterClosed
+	}
+
+	tenant := instance.getTenant(tenantKey, t)
+	instance.refill(tenant, t)
+
+	result, err := instance.timeToAvailable(tenant, load, t)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return now.Add(result), nil
+}
+
+// Refund gives back the given amount of tokens to the tenant,
+// up to the bucket capacity.
+func (instance *tokenBucketLimiterImpl) Refund(tenantKey string, load uint64) error {
+	t := uint64(instance.currentTime().UnixMilli())
+
+	instance.Lock.Lock()
+	defer instance.Lock.Unlock()
+
+	if instance.closed {
+		return ErrLimiterClosed
+	}
+
+	tenant := instance.getTenant(tenantKey, t)
+	tenant.Tokens += float64(load)
+	instance.refill(tenant, t)
+
+	return nil
+}
+
+// Stats returns runtime statistics for the bucket of the given tenant.
+//
+// WindowTotal holds the amount of consumed tokens, that is the capacity
+// minus the available tokens, and MaxLoad holds the bucket capacity.
+// WindowSegments is not populated.
+func (instance *tokenBucketLimiterImpl) Stats(tenantKey string) (RuntimeStatistics, error) {
+	t := uint64(instance.currentTime().UnixMilli())
+
+	instance.Lock.Lock()
+	defer instance.Lock.Unlock()
+
+	return instance.stats(instance.getTenant(tenantKey, t), t), nil
+}
+
+// StatsAll returns runtime statistics for all the tenants
+// currently holding a bucket, indexed by tenant key.
+func (instance *tokenBucketLimiterImpl) StatsAll() (map[string]RuntimeStatistics, error) {
+	t := uint64(instance.currentTime().UnixMilli())
+
+	instance.Lock.Lock()
+	defer instance.Lock.Unlock()
+
+	out := make(map[string]RuntimeStatistics, len(instance.TenantData))
+	for tenantKey, tenant := range instance.TenantData {
+		out[tenantKey] = instance.stats(tenant, t)
+	}
+
+	return out, nil
+}
+
+// RemainingCapacity returns the number of whole tokens
+// currently held in the bucket of the tenant.
+func (instance *tokenBucketLimiterImpl) RemainingCapacity(tenantKey string) (uint64, error) {
+	t := uint64(instance.currentTime().UnixMilli())
+
+	instance.Lock.Lock()
+	defer instance.Lock.Unlock()
+
+	if instance.closed {
+		return 0, ErrLimiterClosed
+	}
+
+	tenant := instance.getTenant(tenantKey, t)
+	instance.refill(tenant, t)
+
+	return uint64(math.Floor(tenant.Tokens + tokensEpsilon)), nil
+}
+
+// CanEverFit returns true if the given load
+// is not greater than the bucket capacity of the tenant.
+func (instance *tokenBucketLimiterImpl) CanEverFit(tenantKey string, load uint64) bool {
+	t := uint64(instance.currentTime().UnixMilli())
+
+	instance.Lock.Lock()
+	defer instance.Lock.Unlock()
+
+	capacity := instance.Config.Capacity
+	if tenant, exists := instance.TenantData[tenantKey]; exists {
+		capacity = instance.capacity(tenant, t)
+	}
+	return load <= capacity
+}
+
+// IsOverloaded returns true if the most recent request
+// of the tenant was rejected.
+func (instance *tokenBucketLimiterImpl) IsOverloaded(tenantKey string) (bool, error) {
+	t := uint64(instance.currentTime().UnixMilli())
+
+	instance.Lock.Lock()
+	defer instance.Lock.Unlock()
+
+	return instance.getTenant(tenantKey, t).WasOver, nil
+}
+
+func (instance *tokenBucketLimiterImpl) stats(tenant *tokenBucketTenantData, t uint64) RuntimeStatistics {
+	instance.refill(tenant, t)
+
+	capacity := instance.capacity(tenant, t)
+	consumed := uint64(math.Ceil(float64(capacity) - tenant.Tokens - tokensEpsilon))
+
+	return RuntimeStatistics{
+		WindowTotal:        consumed,
+		MaxLoad:            capacity,
+		UtilizationPercent: float64(consumed) * 100.0 / float64(capacity),
+		AcceptedCount:      tenant.AcceptedCount,
+		RejectedCount:      tenant.RejectedCount,
+	}
+}
+
+// GrantTemporaryBoost raises the bucket capacity for the given tenant
+// by extraLoad until the given time, then automatically reverts.
+//
+// The boost also adds extraLoad tokens to the bucket right away.
+func (instance *tokenBucketLimiterImpl) GrantTemporaryBoost(tenantKey string, extraLoad uint64, until time.Time) error {
+	now := instance.currentTime()
+
+	if extraLoad == 0 {
+		return errors.New("boost extraLoad should be greater than 0")
+	}
+	if !until.After(now) {
+		return errors.New("boost expiration should be in the future")
+	}
+
+	t := uint64(now.UnixMilli())
+
+	instance.Lock.Lock()
+	defer instance.Lock.Unlock()
+
+	tenant := instance.getTenant(tenantKey, t)
+	instance.refill(tenant, t)
+
+	active := tenant.Boosts[:0]
+	for _, boost := range tenant.Boosts {
+		if boost.Until > t {
+			active = append(active, boost)
+		}
+	}
+	tenant.Boosts = append(active, tenantBoost{
+		ExtraLoad: extraLoad,
+		Until:     uint64(until.UnixMilli()),
+	})
+	tenant.Tokens += float64(extraLoad)
+
+	return nil
+}
+
+// SetDraining stops admitting new load for the given tenant until the given time,
+// leaving the tokens in the bucket untouched. A zero time stops the draining.
+func (instance *tokenBucketLimiterImpl) SetDraining(tenantKey string, until time.Time) error {
+	now := instance.currentTime()
+
+	drainUntil, err := parseDrainEnd(now, until)
+	if err != nil {
+		return err
+	}
+
+	t := uint64(now.UnixMilli())
+
+	instance.Lock.Lock()
+	defer instance.Lock.Unlock()
+
+	instance.getTenant(tenantKey, t).DrainUntil = drainUntil
+	return nil
+}
+
+// SetDrainingAll stops admitting new load for all the tenants until the given time.
+// A zero time stops the draining.
+func (instance *tokenBucketLimiterImpl) SetDrainingAll(until time.Time) error {
+	drainUntil, err := parseDrainEnd(instance.currentTime(), until)
+	if err != nil {
+		return err
+	}
+
+	instance.Lock.Lock()
+	defer instance.Lock.Unlock()
+
+	instance.drainUntil = drainUntil
+	return nil
+}
+
+// AdvisedSegmentSize always returns zero
+// as the token bucket limiter has no window segments.
+func (instance *tokenBucketLimiterImpl) AdvisedSegmentSize() time.Duration {
+	return 0
+}
+
+// EffectiveConfig returns a read-only snapshot of the configuration in use.
+//
+// MaxLoad holds the bucket capacity, the window related fields are left zero.
+func (instance *tokenBucketLimiterImpl) EffectiveConfig() EffectiveConfig {
+	instance.Lock.Lock()
+	defer instance.Lock.Unlock()
+
+	return EffectiveConfig{
+		MaxLoad:            instance.Config.Capacity,
+		FloatLoadPrecision: instance.Config.FloatLoadPrecision,
+	}
+}
+
+// SetMaxLoad changes the capacity of all the buckets.
+//
+// Buckets holding more tokens than the new capacity are trimmed.
+func (instance *tokenBucketLimiterImpl) SetMaxLoad(newMax uint64) error {
+	if newMax <= 0 {
+		return fmt.Errorf("Capacity should be greater than 0 (given: %v)", newMax)
+	}
+
+	instance.Lock.Lock()
+	defer instance.Lock.Unlock()
+
+	instance.Config.Capacity = newMax
+
+	return nil
+}
+
+// SetTenantMaxLoad overrides the bucket capacity for the given tenant.
+func (instance *tokenBucketLimiterImpl) SetTenantMaxLoad(tenantKey string, maxLoad uint64) error {
+	if maxLoad <= 0 {
+		return fmt.Errorf("Capacity should be greater than 0 (given: %v)", maxLoad)
+	}
+
+	t := uint64(instance.currentTime().UnixMilli())
+
+	instance.Lock.Lock()
+	defer instance.Lock.Unlock()
+
+	tenant := instance.getTenant(tenantKey, t)
+	instance.refill(tenant, t)
+	tenant.CapacityOverride = maxLoad
+
+	return nil
+}
+
+// ClearTenantMaxLoad removes the capacity override for the given tenant,
+// restoring the configured capacity.
+func (instance *tokenBucketLimiterImpl) ClearTenantMaxLoad(tenantKey string) {
+	t := uint64(instance.currentTime().UnixMilli())
+
+	instance.Lock.Lock()
+	defer instance.Lock.Unlock()
+
+	if tenant, exists := instance.TenantData[tenantKey]; exists {
+		instance.refill(tenant, t)
+		tenant.CapacityOverride = 0
+	}
+}
+
+// ListTenants returns the keys of all the tenants
+// currently holding a bucket.
+func (instance *tokenBucketLimiterImpl) ListTenants() []string {
+	instance.Lock.Lock()
+	defer instance.Lock.Unlock()
+
+	out := make([]string, 0, len(instance.TenantData))
+	for tenantKey := range instance.TenantData {
+		out = append(out, tenantKey)
+	}
+	return out
+}
+
+// EvictTenant removes the bucket of the given tenant,
+// returning true if it existed.
+//
+// A subsequent request for the same tenant starts from a full bucket.
+func (instance *tokenBucketLimiterImpl) EvictTenant(tenantKey string) bool {
+	instance.Lock.Lock()
+	defer instance.Lock.Unlock()
+
+	_, exists := instance.TenantData[tenantKey]
+	delete(instance.TenantData, tenantKey)
+	return exists
+}
+
+// PrewarmTenants allocates the buckets of the given tenants in advance.
+// Tenants already holding a bucket are not affected.
+func (instance *tokenBucketLimiterImpl) PrewarmTenants(tenantKeys ...string) {
+	t := uint64(instance.currentTime().UnixMilli())
+
+	instance.Lock.Lock()
+	defer instance.Lock.Unlock()
+
+	for _, tenantKey := range tenantKeys {
+		instance.getTenant(tenantKey, t)
+	}
+}
+
+// ResetTenant refills the bucket of the given tenant.
+//
+// It does nothing for a tenant that has no bucket yet.
+func (instance *tokenBucketLimiterImpl) ResetTenant(tenantKey string) error {
+	t := uint64(instance.currentTime().UnixMilli())
+
+	instance.Lock.Lock()
+	defer instance.Lock.Unlock()
+
+	if tenant, exists := instance.TenantData[tenantKey]; exists {
+		tenant.Tokens = float64(instance.capacity(tenant, t))
+		tenant.LastRefill = t
+	}
+	return nil
+}
+
+// DumpState returns a human-readable report of the whole limiter state,
+// including the effective configuration and the bucket of every tenant.
+func (instance *tokenBucketLimiterImpl) DumpState() string {
+	now := instance.currentTime()
+	t := uint64(now.UnixMilli())
+
+	instance.Lock.Lock()
+	defer instance.Lock.Unlock()
+
+	sb := strings.Builder{}
+	fmt.Fprintf(&sb, "goll token bucket limiter state at %v\n", now.UTC().Format(time.RFC3339Nano))
+	fmt.Fprintf(&sb, "config: %+v\n", *instance.Config)
+
+	tenantKeys := make([]string, 0, len(instance.TenantData))
+	for tenantKey := range instance.TenantData {
+		tenantKeys = append(tenantKeys, tenantKey)
+	}
+	sort.Strings(tenantKeys)
+
+	fmt.Fprintf(&sb, "tenants: %d\n", len(tenantKeys))
+
+	for _, tenantKey := range tenantKeys {
+		tenant := instance.TenantData[tenantKey]
+		instance.refill(tenant, t)
+
+		fmt.Fprintf(&sb, "- tenant %q: tokens=%.3f capacity=%d\n",
+			tenantKey, tenant.Tokens, instance.capacity(tenant, t))
+	}
+
+	return sb.String()
+}
+
+// Flush does nothing: the token bucket limiter holds no pending changes.
+func (instance *tokenBucketLimiterImpl) Flush() error {
+	return nil
+}
+
+// Close releases the resources held by the limiter.
+// Further calls to Probe and Submit will return ErrLimiterClosed.
+func (instance *tokenBucketLimiterImpl) Close() error {
+	instance.Lock.Lock()
+	defer instance.Lock.Unlock()
+
+	instance.closed = true
+	return nil
+}
+
+// SnapshotTenant is not supported by the token bucket limiter.
+func (instance *tokenBucketLimiterImpl) SnapshotTenant(tenantKey string) (TenantSnapshot, error) {
+	return TenantSnapshot{}, errors.New("SnapshotTenant is not supported by the token bucket limiter")
+}
+
+// CopyTenantState is not supported by the token bucket limiter.
+func (instance *tokenBucketLimiterImpl) CopyTenantState(tenantKey string) (TenantStateCopy, error) {
+	return TenantStateCopy{}, errors.New("CopyTenantState is not supported by the token bucket limiter")
+}
+
+// ExportTenantState is not supported by the token bucket limiter.
+func (instance *tokenBucketLimiterImpl) ExportTenantState(tenantKey string) (string, error) {
+	return "", errors.New("ExportTenantState is not supported by the token bucket limiter")
+}
+
+// ImportTenantState is not supported by the token bucket limiter.
+func (instance *tokenBucketLimiterImpl) ImportTenantState(tenantKey string, serialized string) error {
+	return errors.New("ImportTenantState is not supported by the token bucket limiter")
+}
+
+// CurrentRate is not supported by the token bucket limiter, which has no window.
+func (instance *tokenBucketLimiterImpl) CurrentRate(tenantKey string) (float64, error) {
+	return 0, errors.New("CurrentRate is not supported by the token bucket limiter")
+}
+
+// WindowBounds is not supported by the token bucket limiter, which has no window.
+func (instance *tokenBucketLimiterImpl) WindowBounds(tenantKey string) (time.Time, time.Time, error) {
+	return time.Time{}, time.Time{}, errors.New("WindowBounds is not supported by the token bucket limiter")
+}
+
+// Snapshot is not supported by the token bucket limiter.
+func (instance *tokenBucketLimiterImpl) Snapshot() (map[string]string, error) {
+	return nil, errors.New("Snapshot is not supported by the token bucket limiter")
+}
+
+// Restore is not supported by the token bucket limiter.
+func (instance *tokenBucketLimiterImpl) Restore(snapshot map[string]string) error {
+	return errors.New("Restore is not supported by the token bucket limiter")
+}
+
+// SubmitDryRun is not supported by the token bucket limiter.
+func (instance *tokenBucketLimiterImpl) SubmitDryRun(tenantKey string, load uint64) (DryRunResult, error) {
+	return DryRunResult{}, errors.New("SubmitDryRun is not supported by the token bucket limiter")
+}
+
+// SubmitAt is not supported by the token bucket limiter.
+func (instance *tokenBucketLimiterImpl) SubmitAt(tenantKey string, load uint64, at time.Time) (SubmitResult, error) {
+	return SubmitResult{}, errors.New("SubmitAt is not supported by the token bucket limiter")
+}
+
+// Reserve is not supported by the token bucket limiter.
+func (instance *tokenBucketLimiterImpl) Reserve(tenantKey string, estimated uint64) (Reservation, error) {
+	return Reservation{}, errors.New("Reserve is not supported by the token bucket limiter")
+}
+
+// TruncateAfter is not supported by the token bucket limiter.
+func (instance *tokenBucketLimiterImpl) TruncateAfter(tenantKey string, cutoff time.Time) error {
+	return errors.New("TruncateAfter is not supported by the token bucket limiter")
+}
+
+func (instance *tokenBucketLimiterImpl) IsComposite() bool {
+	return false
+}
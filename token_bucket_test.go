@@ -0,0 +1,194 @@
+package goll
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenBucketImplementsStandaloneLoadLimiter(t *testing.T) {
+	ti := buildTokenBucketInstance(t, nil)
+
+	var asInterface StandaloneLoadLimiter = ti.Instance
+	assert.True(t, noErrors(asInterface.Probe(defaultTestTenantKey, 1)).(bool))
+	assert.False(t, asInterface.IsComposite())
+
+	single := asInterface.ForTenant(defaultTestTenantKey)
+	assert.True(t, submitNoError(single.Submit(10)).Accepted)
+}
+
+func TestTokenBucketSubmit(t *testing.T) {
+	// 100 tokens burst, refilled at 10 tokens per second
+	ti := buildTokenBucketInstance(t, nil)
+
+	// the bucket starts full
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 60)).Accepted)
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 40)).Accepted)
+
+	rejected := submitNoError(ti.Instance.Submit(defaultTestTenantKey, 5))
+	assert.False(t, rejected.Accepted)
+	assert.True(t, rejected.RetryInAvailable)
+	assert.Equal(t, 500*time.Millisecond, rejected.RetryIn)
+	assert.False(t, rejected.PermanentlyRejected)
+	assert.Equal(t, time.UnixMilli(1000500), noErrors(ti.Instance.NextAvailableAt(defaultTestTenantKey, 5)))
+
+	// tokens are refilled continuously
+	ti.TimeTravel(499)
+	assert.False(t, noErrors(ti.Instance.Probe(defaultTestTenantKey, 5)).(bool))
+	ti.TimeTravel(1)
+	assert.True(t, noErrors(ti.Instance.Probe(defaultTestTenantKey, 5)).(bool))
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 5)).Accepted)
+
+	// up to the capacity
+	ti.TimeTravel(60000)
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 100)).Accepted)
+	assert.False(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 1)).Accepted)
+	assert.True(t, noErrors(ti.Instance.IsOverloaded(defaultTestTenantKey)).(bool))
+	assert.Equal(t, uint64(0), noErrors(ti.Instance.RemainingCapacity(defaultTestTenantKey)))
+
+	// tenants get separate buckets
+	assert.True(t, submitNoError(ti.Instance.Submit("other", 100)).Accepted)
+
+	// a load over the capacity is never accepted
+	rejected = submitNoError(ti.Instance.Submit("other", 101))
+	assert.False(t, rejected.Accepted)
+	assert.False(t, rejected.RetryInAvailable)
+	assert.True(t, rejected.PermanentlyRejected)
+
+	stats, err := ti.Instance.Stats(defaultTestTenantKey)
+	assert.Nil(t, err)
+	assert.Equal(t, RuntimeStatistics{
+		WindowTotal:        uint64(100),
+		MaxLoad:            uint64(100),
+		UtilizationPercent: float64(100),
+		AcceptedCount:      uint64(4),
+		RejectedCount:      uint64(2),
+	}, stats)
+}
+
+func TestTokenBucketProbeMany(t *testing.T) {
+	ti := buildTokenBucketInstance(t, nil)
+
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 70)).Accepted)
+
+	res, err := ti.Instance.ProbeMany(defaultTestTenantKey, []uint64{30, 31, 5})
+	assert.Nil(t, err)
+	assert.Equal(t, []bool{true, false, true}, res)
+
+	// no token is consumed
+	assert.Equal(t, uint64(30), noErrors(ti.Instance.RemainingCapacity(defaultTestTenantKey)))
+}
+
+func TestTokenBucketProbeReadOnly(t *testing.T) {
+	ti := buildTokenBucketInstance(t, nil)
+
+	// no bucket is created for unknown tenants
+	assert.True(t, noErrors(ti.Instance.ProbeReadOnly(defaultTestTenantKey, 100)).(bool))
+	assert.False(t, noErrors(ti.Instance.ProbeReadOnly(defaultTestTenantKey, 101)).(bool))
+	assert.Equal(t, []string{}, ti.Instance.ListTenants())
+
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 100)).Accepted)
+
+	// the tokens accrued meanwhile are considered, but the stored bucket is not refilled
+	ti.TimeTravel(500)
+	assert.True(t, noErrors(ti.Instance.ProbeReadOnly(defaultTestTenantKey, 5)).(bool))
+	assert.False(t, noErrors(ti.Instance.ProbeReadOnly(defaultTestTenantKey, 6)).(bool))
+	bucket := ti.Instance.TenantData[defaultTestTenantKey]
+	assert.Equal(t, uint64(1000000), bucket.LastRefill)
+	assert.Equal(t, float64(0), bucket.Tokens)
+}
+
+func TestTokenBucketSubmitUntil(t *testing.T) {
+	ti := buildTokenBucketInstance(t, func(config *TokenBucketConfig) {
+		config.RefillRate = 1
+		config.RefillInterval = 100 * time.Millisecond
+	})
+
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 100)).Accepted)
+
+	available, err := ti.Instance.TimeToAvailable(defaultTestTenantKey, 15)
+	assert.Nil(t, err)
+	assert.Equal(t, 1500*time.Millisecond, available)
+
+	res := ti.Instance.SubmitUntilWithDetails(defaultTestTenantKey, 15, time.Second)
+	assert.ErrorIs(t, res.Error, ErrLoadRequestTimeout)
+	assert.Equal(t, time.Duration(0), res.WaitedFor)
+
+	res = ti.Instance.SubmitUntilCtx(context.Background(), defaultTestTenantKey, 15, 2*time.Second)
+	assert.Nil(t, res.Error)
+	assert.Equal(t, uint64(2), res.AttemptsNumber)
+	assert.Equal(t, 1500*time.Millisecond, res.WaitedFor)
+}
+
+func TestTokenBucketLimits(t *testing.T) {
+	ti := buildTokenBucketInstance(t, nil)
+
+	assert.True(t, ti.Instance.CanEverFit(defaultTestTenantKey, 100))
+	assert.Nil(t, ti.Instance.SetTenantMaxLoad(defaultTestTenantKey, 20))
+	assert.False(t, ti.Instance.CanEverFit(defaultTestTenantKey, 21))
+	assert.True(t, ti.Instance.CanEverFit("other", 100))
+	assert.False(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 21)).Accepted)
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 20)).Accepted)
+
+	// the boost raises the capacity and adds the tokens right away
+	assert.Nil(t, ti.Instance.GrantTemporaryBoost(defaultTestTenantKey, 10, time.UnixMilli(1005000)))
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 10)).Accepted)
+
+	ti.TimeTravel(10000)
+	stats, err := ti.Instance.Stats(defaultTestTenantKey)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(20), stats.MaxLoad)
+	assert.Equal(t, uint64(0), stats.WindowTotal)
+
+	// a larger capacity does not add tokens to the bucket
+	ti.Instance.ClearTenantMaxLoad(defaultTestTenantKey)
+	assert.Nil(t, ti.Instance.SetMaxLoad(50))
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 10)).Accepted)
+	stats, err = ti.Instance.Stats(defaultTestTenantKey)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(50), stats.MaxLoad)
+	assert.Equal(t, uint64(40), stats.WindowTotal)
+
+	// refunds and resets refill the bucket
+	assert.Nil(t, ti.Instance.Refund(defaultTestTenantKey, 5))
+	stats, _ = ti.Instance.Stats(defaultTestTenantKey)
+	assert.Equal(t, uint64(35), stats.WindowTotal)
+	assert.Nil(t, ti.Instance.ResetTenant(defaultTestTenantKey))
+	stats, _ = ti.Instance.Stats(defaultTestTenantKey)
+	assert.Equal(t, uint64(0), stats.WindowTotal)
+
+	assert.Equal(t, []string{defaultTestTenantKey}, ti.Instance.ListTenants())
+	assert.Contains(t, ti.Instance.DumpState(), "- tenant \"test\": tokens=50.000 capacity=50\n")
+	assert.True(t, ti.Instance.EvictTenant(defaultTestTenantKey))
+	assert.False(t, ti.Instance.EvictTenant(defaultTestTenantKey))
+}
+
+func TestTokenBucketUnsupportedOperations(t *testing.T) {
+	ti := buildTokenBucketInstance(t, nil)
+
+	_, err := ti.Instance.SnapshotTenant(defaultTestTenantKey)
+	assert.NotNil(t, err)
+	_, err = ti.Instance.CopyTenantState(defaultTestTenantKey)
+	assert.NotNil(t, err)
+	_, err = ti.Instance.ExportTenantState(defaultTestTenantKey)
+	assert.NotNil(t, err)
+	assert.NotNil(t, ti.Instance.ImportTenantState(defaultTestTenantKey, "v2/ver=1"))
+	_, err = ti.Instance.Snapshot()
+	assert.NotNil(t, err)
+	assert.NotNil(t, ti.Instance.Restore(map[string]string{}))
+	_, err = ti.Instance.Reserve(defaultTestTenantKey, 1)
+	assert.NotNil(t, err)
+	_, err = ti.Instance.SubmitAt(defaultTestTenantKey, 1, time.UnixMilli(1000000))
+	assert.NotNil(t, err)
+	_, _, err = ti.Instance.WindowBounds(defaultTestTenantKey)
+	assert.NotNil(t, err)
+	_, err = ti.Instance.CurrentRate(defaultTestTenantKey)
+	assert.NotNil(t, err)
+	assert.NotNil(t, ti.Instance.TruncateAfter(defaultTestTenantKey, time.UnixMilli(1000000)))
+
+	assert.Nil(t, ti.Instance.Close())
+	_, err = ti.Instance.Submit(defaultTestTenantKey, 1)
+	assert.ErrorIs(t, err, ErrLimiterClosed)
+}
@@ -1,37 +1,120 @@
 package goll
 
 import (
-	"errors"
 	"fmt"
+	"math"
 	"time"
 )
 
+// maxLoad returns the max load allowed for the request,
+// including any active temporary boost granted to the tenant.
+func (instance *loadLimiterDefaultImpl) maxLoad(req *submitRequest) uint64 {
+	return instance.tenantMaxLoad(req.TenantData, req.RequestedTimestamp)
+}
+
+// tenantMaxLoad returns the max load allowed for the tenant
+// at the given time.
+func (instance *loadLimiterDefaultImpl) tenantMaxLoad(tenant *loadLimiterDefaultImplTenantData, t uint64) uint64 {
+	out := instance.Config.MaxLoad
+	if tenant.MaxLoadOverride > 0 {
+		out = tenant.MaxLoadOverride
+	}
+	for _, boost := range tenant.Boosts {
+		if boost.Until > t {
+			out = saturatingAdd(out, boost.ExtraLoad)
+		}
+	}
+	return out
+}
+
+// maxPenaltyCap returns the absolute penalty cap
+// scaled from the given max load.
+func (instance *loadLimiterDefaultImpl) maxPenaltyCap(maxLoad uint64) uint64 {
+	if maxLoad == instance.Config.MaxLoad {
+		return instance.Config.AbsoluteMaxPenaltyCap
+	}
+	return saturatingFloatToUint(float64(maxLoad) * (1.0 + instance.Config.MaxPenaltyCapFactor))
+}
+
+// overstepPenalty returns the absolute overstep penalty
+// scaled from the given max load.
+func (instance *loadLimiterDefaultImpl) overstepPenalty(maxLoad uint64) uint64 {
+	if maxLoad == instance.Config.MaxLoad {
+		return instance.Config.AbsoluteOverstepPenalty
+	}
+	return saturatingFloatToUint(float64(maxLoad) * instance.Config.OverstepPenaltyFactor)
+}
+
+// clampBackwardTime handles the local clock going backwards.
+//
+// When the request is older than the front segment of the window
+// by more than one segment and the front segment was already reached
+// by the local clock, the system clock was most likely stepped back:
+// the request is clamped to the front segment so that the window data
+// stays consistent until the clock catches up.
+//
+// Future segments never reached by the local clock are left to rotateWindow,
+// which realigns the segments coming from instances with unsynced clocks.
+func (instance *loadLimiterDefaultImpl) clampBackwardTime(req *submitRequest) {
+	queue := req.TenantData.WindowQueue
+	if queue.Len() == 0 {
+		return
+	}
+
+	frontStartTime := queue.Front().(*windowSegment).StartTime
+	if req.RequestSegmentStartTime+instance.Config.WindowSegmentSize >= frontStartTime ||
+		req.TenantData.LastAccess < frontStartTime {
+		return
+	}
+
+	logWarnw(instance.Logger, "clock went backwards, clamping the request to the most recent segment",
+		"tenantKey", req.TenantKey,
+		"requestedTimestamp", req.RequestedTimestamp,
+		"segmentStartTime", frontStartTime,
+	)
+
+	req.RequestedTimestamp = frontStartTime
+	req.RequestSegmentStartTime = frontStartTime
+}
+
 func (instance *loadLimiterDefaultImpl) locateSegmentStartTime(t uint64) uint64 {
 
 	return (t / instance.Config.WindowSegmentSize) * instance.Config.WindowSegmentSize
 }
 
-func (instance *loadLimiterDefaultImpl) rotateWindow(req *submitRequest) {
-	tenant := req.TenantData
-
-	// compute the start time of the segment we should be in
-	expectedCurrentSegmentStartTime := req.RequestSegmentStartTime
-	queue := tenant.WindowQueue
-	queueSize := queue.Len()
-	// removeBefore := t - instance.Config.WindowSize
-	removeBefore := expectedCurrentSegmentStartTime - instance.Config.WindowSize
+// rotationNeeded checks if the window has to be rotated
+// before serving the given request.
+func (instance *loadLimiterDefaultImpl) rotationNeeded(req *submitRequest) bool {
+	queue := req.TenantData.WindowQueue
+	removeBefore := req.RequestSegmentStartTime - instance.Config.WindowSize
 
 	// window rotation is not needed if all the following conditions are met:
 	// - the queue is not empty
 	// - the front element has the correct startTime = expectedCurrentSegmentStartTime
 	// - the back element startTime is not <= removeBefore
-	if queueSize > 0 &&
-		queue.Front().(*windowSegment).StartTime == expectedCurrentSegmentStartTime &&
-		queue.Back().(*windowSegment).StartTime > removeBefore {
-		// no need to rotate
+	return queue.Len() == 0 ||
+		queue.Front().(*windowSegment).StartTime != req.RequestSegmentStartTime ||
+		queue.Back().(*windowSegment).StartTime <= removeBefore
+}
+
+func (instance *loadLimiterDefaultImpl) rotateWindow(req *submitRequest) {
+	instance.clampBackwardTime(req)
+
+	if !instance.rotationNeeded(req) {
 		return
 	}
 
+	tenant := req.TenantData
+
+	if instance.Config.Algorithm == AlgorithmFixedWindow && instance.resetFixedWindow(req) {
+		return
+	}
+
+	// compute the start time of the segment we should be in
+	expectedCurrentSegmentStartTime := req.RequestSegmentStartTime
+	queue := tenant.WindowQueue
+	queueSize := queue.Len()
+
 	dirty := false
 
 	// check if the front of the queue is FUTURE with respect
@@ -40,6 +123,7 @@ func (instance *loadLimiterDefaultImpl) rotateWindow(req *submitRequest) {
 	// with others on different machines with slightly
 	// unsynced clocks
 	removedLoadToRestore := uint64(0)
+	removedPenaltyToRestore := uint64(0)
 	if queueSize > 0 && queue.Front().(*windowSegment).StartTime > expectedCurrentSegmentStartTime {
 		instance.Logger.Warning(
 			"time mismatch on top of the window. " +
@@ -53,7 +137,8 @@ func (instance *loadLimiterDefaultImpl) rotateWindow(req *submitRequest) {
 				break
 			}
 			removedLoadToRestore += frontBucket.Value
-			tenant.WindowTotal -= frontBucket.Value
+			removedPenaltyToRestore += frontBucket.PenaltyValue
+			tenant.WindowTotal -= frontBucket.total()
 			queue.PopFront()
 			queueSize--
 
@@ -68,6 +153,11 @@ func (instance *loadLimiterDefaultImpl) rotateWindow(req *submitRequest) {
 	// assuming the previous front-most one was actually older.
 	// This is a reasonable assumption as long as times keep moving forward.
 	if queueSize == 0 || queue.Front().(*windowSegment).StartTime != expectedCurrentSegmentStartTime {
+		if queueSize > 0 && instance.Config.PenaltyDecayFactor > 0 {
+			elapsedSegments := (expectedCurrentSegmentStartTime - queue.Front().(*windowSegment).StartTime) / instance.Config.WindowSegmentSize
+			instance.decayPenalties(tenant, elapsedSegments)
+		}
+
 		queue.PushFront(&windowSegment{
 			StartTime: expectedCurrentSegmentStartTime,
 			Value:     0,
@@ -82,16 +172,15 @@ func (instance *loadLimiterDefaultImpl) rotateWindow(req *submitRequest) {
 		removeBefore := req.RequestedTimestamp - instance.Config.WindowSize
 		for queue.Len() > 0 && queue.Back().(*windowSegment).StartTime <= removeBefore {
 			removed := queue.PopBack().(*windowSegment)
-			if removed.Value != 0 {
-				tenant.WindowTotal -= removed.Value
-			}
+			tenant.WindowTotal -= removed.total()
 			dirty = true
 		}
 	}
 
 	// if load was removed for alignment, just add to the recent segment
-	if removedLoadToRestore > 0 {
-		instance.distributePenalty(req, removedLoadToRestore, 1)
+	if removedLoadToRestore > 0 || removedPenaltyToRestore > 0 {
+		instance.distributeLoad(req, removedLoadToRestore, 1, false)
+		instance.distributeLoad(req, removedPenaltyToRestore, 1, true)
 		dirty = true
 	}
 
@@ -100,6 +189,53 @@ func (instance *loadLimiterDefaultImpl) rotateWindow(req *submitRequest) {
 	}
 }
 
+// decayPenalties shrinks the penalty load held by the segments
+// by PenaltyDecayFactor for each of the given elapsed segments,
+// so that penalties expire faster than the regular load.
+//
+// The remaining penalty is rounded down, so that it always decays to zero.
+func (instance *loadLimiterDefaultImpl) decayPenalties(tenant *loadLimiterDefaultImplTenantData, elapsedSegments uint64) {
+	retained := math.Pow(1.0-instance.Config.PenaltyDecayFactor, float64(elapsedSegments))
+	queue := tenant.WindowQueue
+
+	for i := 0; i < queue.Len(); i++ {
+		segment := queue.At(i).(*windowSegment)
+		if segment.PenaltyValue == 0 {
+			continue
+		}
+		newPenalty := uint64(math.Floor(float64(segment.PenaltyValue) * retained))
+		tenant.WindowTotal -= segment.PenaltyValue - newPenalty
+		segment.PenaltyValue = newPenalty
+	}
+}
+
+// resetFixedWindow resets the single counter held in fixed window mode
+// when the request falls in a new window, reusing the existing segment.
+//
+// It returns false when the queue is not in the expected shape
+// (e.g. when loaded from a misaligned instance) and the regular rotation is required.
+func (instance *loadLimiterDefaultImpl) resetFixedWindow(req *submitRequest) bool {
+	tenant := req.TenantData
+	queue := tenant.WindowQueue
+
+	if queue.Len() != 1 {
+		return false
+	}
+
+	segment := queue.Front().(*windowSegment)
+	if segment.StartTime >= req.RequestSegmentStartTime {
+		return false
+	}
+
+	segment.StartTime = req.RequestSegmentStartTime
+	segment.Value = 0
+	segment.PenaltyValue = 0
+	tenant.WindowTotal = 0
+
+	instance.markDirty(req)
+	return true
+}
+
 // ensure that the N most recent segments exist,
 // optionally filling missing segments.
 //
@@ -160,114 +296,371 @@ func (instance *loadLimiterDefaultImpl) ensureLatestNSegments(req *submitRequest
 	}
 }
 
-// Compute the RetryIn time
+// computeRetryIn computes the RetryIn time to be returned on rejection,
+// extended by the jitter, rounded up to RetryInGranularity
+// and capped to MaxRetryIn when provided.
+func (instance *loadLimiterDefaultImpl) computeRetryIn(req *submitRequest) (time.Duration, error) {
+	retryIn, err := instance.timeToAvailable(req)
+	if err != nil {
+		return 0, err
+	}
+	retryIn = instance.applyRetryInJitter(retryIn)
+	if granularity := instance.Config.RetryInGranularity; granularity > 0 {
+		if remainder := retryIn % granularity; remainder != 0 {
+			retryIn += granularity - remainder
+		}
+	}
+	if instance.Config.MaxRetryIn > 0 && retryIn > instance.Config.MaxRetryIn {
+		retryIn = instance.Config.MaxRetryIn
+	}
+	return retryIn, nil
+}
+
+// applyRetryInJitter randomly increases the given RetryIn
+// by up to RetryInJitterFactor.
+func (instance *loadLimiterDefaultImpl) applyRetryInJitter(retryIn time.Duration) time.Duration {
+	if instance.jitterRand == nil || retryIn <= 0 {
+		return retryIn
+	}
+
+	instance.jitterLock.Lock()
+	r := instance.jitterRand.Float64()
+	instance.jitterLock.Unlock()
+
+	jitter := time.Duration(r * instance.Config.RetryInJitterFactor * float64(retryIn))
+
+	// keep the millisecond granularity of the computed RetryIn
+	return retryIn + jitter.Truncate(time.Millisecond)
+}
+
+// Compute the time to availability
 // by checking how many segments we need to remove
 // before having room for the required load
 // and how long it will take for those segments
 // to get outside of the lower window bound.
-func (instance *loadLimiterDefaultImpl) computeRetryIn(req *submitRequest) (time.Duration, error) {
-	if req.RequestedLoad > instance.Config.MaxLoad {
-		return 0, fmt.Errorf("requested load of %v is over max window load of %v and will never be allowed", req.RequestedLoad, instance.Config.MaxLoad)
+func (instance *loadLimiterDefaultImpl) timeToAvailable(req *submitRequest) (time.Duration, error) {
+	retryIn, err := instance.windowTimeToAvailable(req)
+	if err != nil {
+		return 0, err
+	}
+
+	// no load is admitted before the end of the draining
+	if draining := instance.drainingFor(req); draining > retryIn {
+		return draining, nil
+	}
+	return retryIn, nil
+}
+
+func (instance *loadLimiterDefaultImpl) windowTimeToAvailable(req *submitRequest) (time.Duration, error) {
+	maxLoad := instance.maxLoad(req)
+	if req.RequestedLoad > maxLoad {
+		return 0, fmt.Errorf("requested load of %v is over max window load of %v and will never be allowed", req.RequestedLoad, maxLoad)
+	}
+	if instance.Config.AggregationMode != AggregationSum {
+		return instance.projectRetryIn(req)
 	}
 	tenant := req.TenantData
 
-	toFree := int64(req.RequestedLoad) + int64(tenant.WindowTotal) - int64(instance.Config.MaxLoad)
+	required := saturatingAdd(req.RequestedLoad, tenant.WindowTotal)
 
-	if toFree <= 0 {
+	if required <= maxLoad {
 		return 0, nil
 	}
+	toFree := required - maxLoad
 
 	queue := tenant.WindowQueue
 	queueLen := queue.Len()
 	mostRecentSegmentRemovalTime := uint64(0)
 
 	for i := 0; i < queueLen && toFree > 0; i++ {
-		segment := queue.At(queueLen - i - 1).(*windowSegment)
-		if segment.Value > 0 {
-			toFree -= int64(segment.Value)
+		// guard against the queue shrinking while iterating.
+		// this should never happen while holding the lock.
+		index := queueLen - i - 1
+		if index < 0 || index >= queue.Len() {
+			break
+		}
+		segment := queue.At(index).(*windowSegment)
+		segmentTotal := segment.total()
+		if segmentTotal >= toFree {
+			toFree = 0
+		} else {
+			toFree -= segmentTotal
 		}
 		mostRecentSegmentRemovalTime = segment.StartTime
 	}
 
 	if mostRecentSegmentRemovalTime == 0 || toFree > 0 {
 		// this should never happen.
-		return 0, errors.New("could not compute RetryIn because of inconsistent queue data")
+		// log enough context to understand why it did.
+		logWarnw(instance.Logger, "could not compute RetryIn because of inconsistent queue data",
+			"tenantKey", req.TenantKey,
+			"load", req.RequestedLoad,
+			"windowTotal", tenant.WindowTotal,
+			"queueLength", queue.Len(),
+			"loadToFree", toFree,
+		)
+		return 0, fmt.Errorf("could not compute RetryIn because of inconsistent queue data: %w", ErrInconsistentState)
 	}
 
 	// compute the min time for which the segment starting at mostRecentSegmentRemovalTime will be removed
 	minSegmentAvailTime := mostRecentSegmentRemovalTime + instance.Config.WindowSize
 
 	if minSegmentAvailTime < req.RequestedTimestamp {
-		panic("inconsistent minSegmentAvailTime result from computing RetryIn (< load request time)")
+		logWarnw(instance.Logger, "could not compute RetryIn because a segment outside of the window is still held",
+			"tenantKey", req.TenantKey,
+			"segmentStartTime", mostRecentSegmentRemovalTime,
+			"requestTime", req.RequestedTimestamp,
+		)
+		return 0, fmt.Errorf("could not compute RetryIn because a segment outside of the window is still held: %w", ErrInconsistentState)
 	}
 
 	return time.Millisecond * time.Duration(minSegmentAvailTime-req.RequestedTimestamp), nil
 }
 
+// Compute the RetryIn time for the aggregation modes
+// other than AggregationSum, where freeing the oldest segments
+// is not enough to know when the load will fit.
+//
+// The window is projected forward one segment at a time,
+// dropping the segments that would slide out and
+// evaluating the requested load against a new, empty current segment.
+func (instance *loadLimiterDefaultImpl) projectRetryIn(req *submitRequest) (time.Duration, error) {
+	tenant := req.TenantData
+	segmentSize := instance.Config.WindowSegmentSize
+	maxLoad := instance.maxLoad(req)
+
+	if instance.aggregateLoad(tenant, req.RequestSegmentStartTime, 0, req.RequestedLoad) <= maxLoad {
+		return 0, nil
+	}
+
+	for i := uint64(1); i <= instance.Config.NumSegments; i++ {
+		projectedSegmentStartTime := req.RequestSegmentStartTime + i*segmentSize
+		removeBefore := projectedSegmentStartTime - instance.Config.WindowSize
+
+		projected := instance.aggregateLoad(tenant, projectedSegmentStartTime, removeBefore, req.RequestedLoad)
+		if projected <= maxLoad {
+			return time.Millisecond * time.Duration(projectedSegmentStartTime-req.RequestedTimestamp), nil
+		}
+	}
+
+	return 0, fmt.Errorf("requested load of %v would never fit in the window with the configured aggregation mode", req.RequestedLoad)
+}
+
+// aggregateLoad computes the effective load of the window
+// as seen from the segment starting at referenceTime,
+// adding the given load to that segment.
+//
+// Segments starting at or before removeBefore are ignored
+// as they are considered already out of the window.
+func (instance *loadLimiterDefaultImpl) aggregateLoad(
+	tenant *loadLimiterDefaultImplTenantData, referenceTime uint64, removeBefore uint64, additional uint64,
+) uint64 {
+	queue := tenant.WindowQueue
+	queueLen := queue.Len()
+
+	switch instance.Config.AggregationMode {
+	case AggregationMax:
+		max := additional
+		for i := 0; i < queueLen; i++ {
+			segment := queue.At(i).(*windowSegment)
+			if segment.StartTime <= removeBefore {
+				continue
+			}
+			value := segment.total()
+			if segment.StartTime == referenceTime {
+				value = saturatingAdd(value, additional)
+			}
+			if value > max {
+				max = value
+			}
+		}
+		return max
+
+	case AggregationWeightedAvg:
+		// each segment weighs from NumSegments (the current one)
+		// down to 1 (the oldest one still in the window).
+		numSegments := instance.Config.NumSegments
+		weighted := saturatingMul(additional, numSegments)
+		for i := 0; i < queueLen; i++ {
+			segment := queue.At(i).(*windowSegment)
+			if segment.StartTime <= removeBefore || segment.StartTime > referenceTime {
+				continue
+			}
+			age := (referenceTime - segment.StartTime) / instance.Config.WindowSegmentSize
+			if age >= numSegments {
+				continue
+			}
+			weighted = saturatingAdd(weighted, saturatingMul(segment.total(), numSegments-age))
+		}
+
+		// weights sum up to numSegments * (numSegments + 1) / 2,
+		// scaling by numSegments gives a value comparable to the window total.
+		return saturatingFloatToUint(math.Ceil(2.0 * float64(weighted) / float64(numSegments+1)))
+
+	default:
+		return saturatingAdd(tenant.WindowTotal, additional)
+	}
+}
+
+// aggregateLoadAsIs computes the load the window would hold after the rotation
+// required by the given request, including the requested load,
+// without rotating it.
+//
+// The segments that would slide out of the window are excluded.
+// Penalty decay is not applied, so the result may be slightly higher
+// than the one computed after an actual rotation.
+func (instance *loadLimiterDefaultImpl) aggregateLoadAsIs(req *submitRequest) uint64 {
+	tenant := req.TenantData
+	if tenant.WindowQueue == nil || tenant.WindowQueue.Len() == 0 {
+		return req.RequestedLoad
+	}
+
+	removeBefore := uint64(0)
+	if req.RequestSegmentStartTime > instance.Config.WindowSize {
+		removeBefore = req.RequestSegmentStartTime - instance.Config.WindowSize
+	}
+
+	if instance.Config.AggregationMode != AggregationSum {
+		return instance.aggregateLoad(tenant, req.RequestSegmentStartTime, removeBefore, req.RequestedLoad)
+	}
+
+	total := tenant.WindowTotal
+	for i := 0; i < tenant.WindowQueue.Len(); i++ {
+		segment := tenant.WindowQueue.At(i).(*windowSegment)
+		if segment.StartTime <= removeBefore {
+			total -= segment.total()
+		}
+	}
+	return saturatingAdd(total, req.RequestedLoad)
+}
+
+// distributePenalty adds the given penalty to the most recent segments,
+// tagging it as penalty load.
 func (instance *loadLimiterDefaultImpl) distributePenalty(req *submitRequest, amount uint64, numSegmentsMax uint64) {
+	instance.distributeLoad(req, amount, numSegmentsMax, true)
+}
+
+// distributeLoad spreads the given amount of load over the most recent segments.
+func (instance *loadLimiterDefaultImpl) distributeLoad(req *submitRequest, amount uint64, numSegmentsMax uint64, isPenalty bool) {
 	if amount <= 0 {
 		return
 	}
 	tenant := req.TenantData
 
+	strategy := PenaltyDistributionEven
+	if isPenalty {
+		strategy = instance.Config.PenaltyDistributionStrategy
+	}
+
+	segmentDistribution := splitOverSegments(amount, numSegmentsMax, strategy)
+	numSegmentsMax = uint64(len(segmentDistribution))
+
+	instance.ensureLatestNSegments(req, numSegmentsMax)
+	for i := uint64(0); i < numSegmentsMax; i++ {
+		sv := segmentDistribution[i]
+		segment := tenant.WindowQueue.At(int(i)).(*windowSegment)
+		if isPenalty {
+			segment.PenaltyValue = saturatingAdd(segment.PenaltyValue, sv)
+		} else {
+			segment.Value = saturatingAdd(segment.Value, sv)
+		}
+		tenant.WindowTotal = saturatingAdd(tenant.WindowTotal, sv)
+	}
+}
+
+// splitOverSegments splits the given amount over at most numSegments segments,
+// ordered from the most recent one, according to the given strategy.
+func splitOverSegments(amount uint64, numSegments uint64, strategy PenaltyDistributionStrategy) []uint64 {
+	if strategy == PenaltyDistributionEven {
+		/*
+			Even distribution samples:
+
+			* 1 over 3 segments: [1 0 0]
+			* 2 over 3 segments: [1 1 0]
+			* 3 over 3 segments: [1 1 1]
+			* 4 over 3 segments: [2 1 1]
+			* 5 over 3 segments: [2 2 1]
+			* ...
+			* 6 over 3 segments: [2 2 2]
+			* 11 over 3 segments: [4 4 3]
+			* ...
+		*/
+		amountPerSegment := amount / numSegments
+		if amountPerSegment < 1 {
+			numSegments = amount
+			amountPerSegment = 1
+		}
+
+		out := make([]uint64, numSegments)
+		for i := uint64(0); i < numSegments; i++ {
+			out[i] = amountPerSegment
+		}
+		rem := amount % numSegments
+		for i := uint64(0); i < rem; i++ {
+			out[i]++
+		}
+		return out
+	}
+
 	/*
-		Penalty distribution samples:
+		Linearly weighted distribution samples, front loaded:
 
-		* 1 over 3 segments: [1 0 0]
-		* 2 over 3 segments: [1 1 0]
-		* 3 over 3 segments: [1 1 1]
-		* 4 over 3 segments: [2 1 1]
-		* 5 over 3 segments: [2 2 1]
+		* 6 over 3 segments: [3 2 1]
+		* 7 over 3 segments: [4 2 1]
+		* 12 over 3 segments: [6 4 2]
 		* ...
-		* 6 over 3 segments: [2 2 2]
-		* 11 over 3 segments: [4 4 3]
+
+		and back loaded:
+
+		* 6 over 3 segments: [1 2 3]
+		* 7 over 3 segments: [1 2 4]
 		* ...
 	*/
-	amountPerSegment := amount / numSegmentsMax
-	if amountPerSegment < 1 {
-		numSegmentsMax = amount
-		amountPerSegment = 1
+	weight := func(i uint64) uint64 {
+		if strategy == PenaltyDistributionBackLoaded {
+			return i + 1
+		}
+		return numSegments - i
 	}
+	totalWeight := numSegments * (numSegments + 1) / 2
 
-	segmentDistribution := make([]uint64, numSegmentsMax)
-
-	for i := uint64(0); i < numSegmentsMax; i++ {
-		segmentDistribution[i] = amountPerSegment
+	out := make([]uint64, numSegments)
+	added := uint64(0)
+	for i := uint64(0); i < numSegments; i++ {
+		w := weight(i)
+		out[i] = amount/totalWeight*w + (amount%totalWeight)*w/totalWeight
+		added += out[i]
 	}
-	added := amountPerSegment * numSegmentsMax
-	rem := amount % numSegmentsMax
-	for i := uint64(0); i < rem; i++ {
-		segmentDistribution[i]++
+
+	// the rounding remainder goes to the heaviest segments
+	for i := uint64(0); added < amount; i++ {
+		if strategy == PenaltyDistributionBackLoaded {
+			out[numSegments-1-i]++
+		} else {
+			out[i]++
+		}
 		added++
 	}
 
-	instance.ensureLatestNSegments(req, numSegmentsMax)
-	for i := uint64(0); i < numSegmentsMax; i++ {
-		sv := segmentDistribution[i]
-		tenant.WindowQueue.At(int(i)).(*windowSegment).Value += sv
-		tenant.WindowTotal += sv
-	}
+	return out
 }
 
-func (instance *loadLimiterDefaultImpl) removeFromOldestSegments(req *submitRequest, amount uint64) {
+func (instance *loadLimiterDefaultImpl) removeFromOldestSegments(req *submitRequest, amount uint64) uint64 {
 	tenant := req.TenantData
+	removed := uint64(0)
 
 	// try to remove from the left
 	queue := tenant.WindowQueue
 	for queue.Len() > 0 && amount > 0 {
 		oldestSegment := queue.Back().(*windowSegment)
-		if oldestSegment.Value >= amount {
-			// can subtract all from this segment
-			oldestSegment.Value -= amount
-			tenant.WindowTotal -= amount
-			amount = 0
-		} else {
-			// subtract part from here
-			amount -= oldestSegment.Value
-			tenant.WindowTotal -= oldestSegment.Value
-			oldestSegment.Value = 0
-		}
-		if oldestSegment.Value <= 0 {
+
+		// the excess is removed from the penalties first
+		segmentRemoved := oldestSegment.remove(amount, true)
+		tenant.WindowTotal -= segmentRemoved
+		amount -= segmentRemoved
+		removed += segmentRemoved
+
+		if oldestSegment.total() <= 0 {
 			// segment is now empty, remove it
 			queue.PopBack()
 		}
@@ -285,16 +678,188 @@ func (instance *loadLimiterDefaultImpl) removeFromOldestSegments(req *submitRequ
 		// should never happen. just emit a warning
 		instance.Logger.Warning("cannot sub excess over max cap starting from oldest entries")
 	}
+
+	return removed
+}
+
+// removeFromMostRecentSegments subtracts the given amount of accepted load
+// starting from the most recent segments, never going below zero.
+// Penalties are never removed. The amount actually removed is returned.
+func (instance *loadLimiterDefaultImpl) removeFromMostRecentSegments(req *submitRequest, amount uint64) uint64 {
+	tenant := req.TenantData
+	queue := tenant.WindowQueue
+	removed := uint64(0)
+
+	for i := 0; i < queue.Len() && amount > 0; i++ {
+		segment := queue.At(i).(*windowSegment)
+		segmentRemoved := segment.removeAccepted(amount)
+		removed += segmentRemoved
+		amount -= segmentRemoved
+	}
+
+	tenant.WindowTotal -= removed
+	return removed
 }
 
+// applyCapping keeps the window load within the max penalty cap,
+// according to the configured PenaltyCapPolicy,
+// notifying OnPenaltyCapped unless the policy is PenaltyCapSilently.
 func (instance *loadLimiterDefaultImpl) applyCapping(req *submitRequest) {
 	if !instance.Config.ApplyPenaltyCapping {
 		return
 	}
+	maxCap := instance.maxPenaltyCap(instance.maxLoad(req))
+
+	var trimmed uint64
+	if instance.Config.PenaltyCapPolicy == PenaltyCapReject {
+		trimmed = instance.trimPenaltiesOverCap(req, maxCap)
+	} else {
+		trimmed = instance.trimOldestOverCap(req, maxCap)
+	}
+
+	if trimmed > 0 && !req.DryRun && instance.Config.PenaltyCapPolicy != PenaltyCapSilently && instance.OnPenaltyCapped != nil {
+		instance.OnPenaltyCapped(req.TenantKey, trimmed)
+	}
+}
+
+// trimOldestOverCap trims the load exceeding the given cap
+// starting from the oldest segments, returning the amount removed.
+func (instance *loadLimiterDefaultImpl) trimOldestOverCap(req *submitRequest, maxCap uint64) uint64 {
 	tenant := req.TenantData
+	trimmed := uint64(0)
+
+	switch instance.Config.AggregationMode {
+	case AggregationMax:
+		// the cap applies to every single segment
+		for i := 0; i < tenant.WindowQueue.Len(); i++ {
+			segment := tenant.WindowQueue.At(i).(*windowSegment)
+			if segment.total() > maxCap {
+				removed := segment.remove(segment.total()-maxCap, true)
+				tenant.WindowTotal -= removed
+				trimmed += removed
+			}
+		}
+
+	case AggregationWeightedAvg:
+		// trim the oldest segments until the weighted average fits the cap
+		queue := tenant.WindowQueue
+		numSegments := instance.Config.NumSegments
+		for queue.Len() > 0 {
+			aggregated := instance.aggregateLoad(tenant, req.RequestSegmentStartTime, 0, 0)
+			if aggregated <= maxCap {
+				break
+			}
+			oldestSegment := queue.Back().(*windowSegment)
+			age := (req.RequestSegmentStartTime - oldestSegment.StartTime) / instance.Config.WindowSegmentSize
+			toRemove := oldestSegment.total()
+			if age < numSegments {
+				// removing one unit from this segment lowers the aggregate
+				// by 2 * weight / (numSegments + 1)
+				weight := numSegments - age
+				needed := saturatingFloatToUint(math.Ceil(float64(saturatingMul(aggregated-maxCap, numSegments+1)) / float64(2*weight)))
+				if needed < toRemove {
+					toRemove = needed
+				}
+			}
+			removed := oldestSegment.remove(toRemove, true)
+			tenant.WindowTotal -= removed
+			trimmed += removed
+			if oldestSegment.total() == 0 {
+				if queue.Len() == 1 {
+					break
+				}
+				queue.PopBack()
+			}
+		}
 
-	if tenant.WindowTotal > instance.Config.AbsoluteMaxPenaltyCap {
-		overMaxCap := tenant.WindowTotal - instance.Config.AbsoluteMaxPenaltyCap
-		instance.removeFromOldestSegments(req, overMaxCap)
+	default:
+		if tenant.WindowTotal > maxCap {
+			overMaxCap := tenant.WindowTotal - maxCap
+			trimmed = instance.removeFromOldestSegments(req, overMaxCap)
+		}
 	}
+
+	return trimmed
+}
+
+// trimPenaltiesOverCap removes the penalties exceeding the given cap
+// starting from the most recent segments, so that the penalty that just
+// pushed the window over the cap is refused and the older load is preserved.
+// The amount removed is returned.
+func (instance *loadLimiterDefaultImpl) trimPenaltiesOverCap(req *submitRequest, maxCap uint64) uint64 {
+	tenant := req.TenantData
+	queue := tenant.WindowQueue
+	numSegments := instance.Config.NumSegments
+	trimmed := uint64(0)
+
+	for i := 0; i < queue.Len(); i++ {
+		segment := queue.At(i).(*windowSegment)
+
+		var excess uint64
+		switch instance.Config.AggregationMode {
+		case AggregationMax:
+			// the cap applies to every single segment
+			if segment.total() > maxCap {
+				excess = segment.total() - maxCap
+			}
+
+		case AggregationWeightedAvg:
+			aggregated := instance.aggregateLoad(tenant, req.RequestSegmentStartTime, 0, 0)
+			if aggregated <= maxCap {
+				return trimmed
+			}
+			if segment.StartTime > req.RequestSegmentStartTime {
+				continue
+			}
+			age := (req.RequestSegmentStartTime - segment.StartTime) / instance.Config.WindowSegmentSize
+			if age >= numSegments {
+				continue
+			}
+			// removing one unit from this segment lowers the aggregate
+			// by 2 * weight / (numSegments + 1)
+			weight := numSegments - age
+			excess = saturatingFloatToUint(math.Ceil(float64(saturatingMul(aggregated-maxCap, numSegments+1)) / float64(2*weight)))
+
+		default:
+			if tenant.WindowTotal <= maxCap {
+				return trimmed
+			}
+			excess = tenant.WindowTotal - maxCap
+		}
+
+		if excess > segment.PenaltyValue {
+			excess = segment.PenaltyValue
+		}
+		segment.PenaltyValue -= excess
+		tenant.WindowTotal -= excess
+		trimmed += excess
+	}
+
+	return trimmed
+}
+
+// truncateAfter removes all the segments starting at or after the given cutoff,
+// returning true if at least one segment was removed.
+func (instance *loadLimiterDefaultImpl) truncateAfter(req *submitRequest, cutoff uint64) bool {
+	instance.rotateWindow(req)
+
+	tenant := req.TenantData
+	queue := tenant.WindowQueue
+	removed := false
+
+	for queue.Len() > 0 {
+		frontSegment := queue.Front().(*windowSegment)
+		if frontSegment.StartTime < cutoff {
+			break
+		}
+		tenant.WindowTotal -= frontSegment.total()
+		queue.PopFront()
+		removed = true
+	}
+
+	if removed {
+		instance.markDirty(req)
+	}
+
+	return removed
 }
@@ -1,6 +1,7 @@
 package goll
 
 import (
+	"strings"
 	"testing"
 	"time"
 
@@ -321,6 +322,68 @@ func TestComputeRetryInCornerCases(t *testing.T) {
 	assert.Equal(t, 11*time.Second, res.RetryIn)
 }
 
+func TestComputeRetryInWithInconsistentQueue(t *testing.T) {
+	logger := &testLogger{}
+	ti := buildInstance(t, func(config *Config) {
+		config.Logger = logger
+	})
+
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 60)).Accepted)
+
+	// corrupt the window total so that it does not match the segments anymore
+	ti.Instance.getTenant(defaultTestTenantKey).WindowTotal = 190
+
+	_, err := ti.Instance.computeRetryIn(ti.InternalRequest(defaultTestTenantKey, 40))
+	assert.ErrorIs(t, err, ErrInconsistentState)
+	assert.Contains(t, err.Error(), "inconsistent queue data")
+
+	// the rejection is still handled, without RetryIn
+	rejected := submitNoError(ti.Instance.Submit(defaultTestTenantKey, 40))
+	assert.False(t, rejected.Accepted)
+	assert.False(t, rejected.RetryInAvailable)
+
+	// enough context should have been logged
+	found := false
+	for _, message := range logger.Messages {
+		if strings.Contains(message, "inconsistent queue data") {
+			found = true
+			assert.Contains(t, message, "windowTotal=190")
+			assert.Contains(t, message, "queueLength=1")
+			assert.Contains(t, message, "loadToFree=70")
+		}
+	}
+	assert.True(t, found)
+
+	// an empty queue with a non-zero window total should not panic either
+	ti.Instance.getTenant(defaultTestTenantKey).WindowQueue.Clear()
+	assert.NotPanics(t, func() {
+		_, err = ti.Instance.computeRetryIn(ti.InternalRequest(defaultTestTenantKey, 40))
+	})
+	assert.ErrorIs(t, err, ErrInconsistentState)
+}
+
+func TestComputeRetryInWithStaleSegment(t *testing.T) {
+	ti := buildDefaultInstance(t)
+
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 90)).Accepted)
+
+	// a request evaluated without rotating the window,
+	// so that the segment outside of the window is still held
+	ti.TimeTravel(20000)
+	req := ti.InternalRequest(defaultTestTenantKey, 20)
+
+	var err error
+	assert.NotPanics(t, func() {
+		_, err = ti.Instance.computeRetryIn(req)
+	})
+	assert.ErrorIs(t, err, ErrInconsistentState)
+
+	// the rejection path handles the error without propagating it
+	res := ti.Instance.rejectLoad(req)
+	assert.False(t, res.Accepted)
+	assert.False(t, res.RetryInAvailable)
+}
+
 func TestRemoveFromOldestSegments(t *testing.T) {
 	ti := buildDefaultInstance(t)
 
@@ -447,6 +510,56 @@ func TestDistributePenalty(t *testing.T) {
 	)
 }
 
+func TestSplitOverSegments(t *testing.T) {
+	assert.Equal(t, []uint64{4, 4, 3}, splitOverSegments(11, 3, PenaltyDistributionEven))
+	assert.Equal(t, []uint64{1, 1}, splitOverSegments(2, 3, PenaltyDistributionEven))
+
+	assert.Equal(t, []uint64{3, 2, 1}, splitOverSegments(6, 3, PenaltyDistributionFrontLoaded))
+	assert.Equal(t, []uint64{4, 2, 1}, splitOverSegments(7, 3, PenaltyDistributionFrontLoaded))
+	assert.Equal(t, []uint64{1, 0, 0}, splitOverSegments(1, 3, PenaltyDistributionFrontLoaded))
+
+	assert.Equal(t, []uint64{1, 2, 3}, splitOverSegments(6, 3, PenaltyDistributionBackLoaded))
+	assert.Equal(t, []uint64{1, 2, 4}, splitOverSegments(7, 3, PenaltyDistributionBackLoaded))
+	assert.Equal(t, []uint64{0, 0, 1}, splitOverSegments(1, 3, PenaltyDistributionBackLoaded))
+
+	// the whole amount is always distributed
+	for _, strategy := range []PenaltyDistributionStrategy{
+		PenaltyDistributionEven, PenaltyDistributionFrontLoaded, PenaltyDistributionBackLoaded,
+	} {
+		for amount := uint64(1); amount < 100; amount++ {
+			total := uint64(0)
+			for _, v := range splitOverSegments(amount, 7, strategy) {
+				total += v
+			}
+			assert.Equal(t, amount, total)
+		}
+	}
+}
+
+func TestDistributePenaltyWithStrategy(t *testing.T) {
+	ti := buildInstance(t, func(config *Config) {
+		config.PenaltyDistributionStrategy = PenaltyDistributionFrontLoaded
+	})
+	ti.TimeTravel(5000)
+
+	ti.Instance.distributePenalty(ti.InternalRequest(defaultTestTenantKey, 0), 12, 3)
+	ti.AssertWindowStatus(
+		t, defaultTestTenantKey, 12,
+		"1005000:6", "1004000:4", "1003000:2",
+	)
+
+	ti = buildInstance(t, func(config *Config) {
+		config.PenaltyDistributionStrategy = PenaltyDistributionBackLoaded
+	})
+	ti.TimeTravel(5000)
+
+	ti.Instance.distributePenalty(ti.InternalRequest(defaultTestTenantKey, 0), 12, 3)
+	ti.AssertWindowStatus(
+		t, defaultTestTenantKey, 12,
+		"1005000:2", "1004000:4", "1003000:6",
+	)
+}
+
 func TestApplyCapping(t *testing.T) {
 	ti := buildInstance(t, func(config *Config) {
 		config.MaxPenaltyCapFactor = 0.40  // 0.40 * 100 -> 40
@@ -460,6 +573,80 @@ func TestApplyCapping(t *testing.T) {
 	ti.AssertWindowStatus(t, defaultTestTenantKey, 140, "1000000:140")
 }
 
+// buildPenaltyCapInstance builds an instance with a low penalty cap
+// recording the OnPenaltyCapped notifications, if enabled.
+func buildPenaltyCapInstance(t *testing.T, policy PenaltyCapPolicy, withHook bool) (*testableInstance, *[]uint64) {
+	notified := []uint64{}
+	ti := buildInstance(t, func(config *Config) {
+		config.MaxPenaltyCapFactor = 0.40  // 0.40 * 100 -> 40
+		config.OverstepPenaltyFactor = 0.9 // 0.90 * 100 -> 90
+		config.PenaltyCapPolicy = policy
+		if withHook {
+			config.OnPenaltyCapped = func(tenantKey string, trimmed uint64) {
+				assert.Equal(t, defaultTestTenantKey, tenantKey)
+				notified = append(notified, trimmed)
+			}
+		}
+	})
+
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 60)).Accepted)
+	ti.TimeTravel(1000)
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 40)).Accepted)
+	assert.False(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 1)).Accepted)
+
+	return ti, &notified
+}
+
+func TestPenaltyCapDefaultPolicy(t *testing.T) {
+	// without a hook the excess is silently trimmed from the oldest segments
+	ti, notified := buildPenaltyCapInstance(t, PenaltyCapDefault, false)
+	ti.AssertWindowStatus(t, defaultTestTenantKey, 140, "1001000:130", "1000000:10")
+	assert.Equal(t, PenaltyCapSilently, ti.Instance.EffectiveConfig().PenaltyCapPolicy)
+	assert.Equal(t, []uint64{}, *notified)
+
+	// with a hook the trims are notified
+	ti, notified = buildPenaltyCapInstance(t, PenaltyCapDefault, true)
+	ti.AssertWindowStatus(t, defaultTestTenantKey, 140, "1001000:130", "1000000:10")
+	assert.Equal(t, PenaltyCapAndNotify, ti.Instance.EffectiveConfig().PenaltyCapPolicy)
+	assert.Equal(t, []uint64{50}, *notified)
+}
+
+func TestPenaltyCapSilentlyPolicy(t *testing.T) {
+	ti, notified := buildPenaltyCapInstance(t, PenaltyCapSilently, false)
+	ti.AssertWindowStatus(t, defaultTestTenantKey, 140, "1001000:130", "1000000:10")
+	assert.Equal(t, PenaltyCapSilently, ti.Instance.EffectiveConfig().PenaltyCapPolicy)
+	assert.Equal(t, []uint64{}, *notified)
+
+	_, err := New(&Config{
+		MaxLoad:          100,
+		WindowSize:       10 * time.Second,
+		PenaltyCapPolicy: PenaltyCapSilently,
+		OnPenaltyCapped:  func(tenantKey string, trimmed uint64) {},
+	})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "OnPenaltyCapped is never called with PenaltyCapSilently")
+}
+
+func TestPenaltyCapAndNotifyPolicy(t *testing.T) {
+	ti, notified := buildPenaltyCapInstance(t, PenaltyCapAndNotify, true)
+	ti.AssertWindowStatus(t, defaultTestTenantKey, 140, "1001000:130", "1000000:10")
+	assert.Equal(t, PenaltyCapAndNotify, ti.Instance.EffectiveConfig().PenaltyCapPolicy)
+	assert.Equal(t, []uint64{50}, *notified)
+}
+
+func TestPenaltyCapRejectPolicy(t *testing.T) {
+	// the penalty is only applied up to the cap and the refused part is notified
+	ti, notified := buildPenaltyCapInstance(t, PenaltyCapReject, true)
+	ti.AssertWindowStatus(t, defaultTestTenantKey, 140, "1001000:80", "1000000:60")
+	assert.Equal(t, PenaltyCapReject, ti.Instance.EffectiveConfig().PenaltyCapPolicy)
+	assert.Equal(t, []uint64{50}, *notified)
+
+	// the hook is optional
+	ti, notified = buildPenaltyCapInstance(t, PenaltyCapReject, false)
+	ti.AssertWindowStatus(t, defaultTestTenantKey, 140, "1001000:80", "1000000:60")
+	assert.Equal(t, []uint64{}, *notified)
+}
+
 func TestOverstepPenalty(t *testing.T) {
 	// with no distribution factor (only last segment)
 	ti := buildInstance(t, func(config *Config) {
@@ -628,6 +815,10 @@ func TestWindowRotationWithFutureSegments(t *testing.T) {
 
 	ti.TimeSet(1004500)
 
+	// the future segments were not reached by the local clock,
+	// as if they were loaded from an instance with an unsynced clock
+	ti.Instance.getTenant(defaultTestTenantKey).LastAccess = 1004500
+
 	ti.Instance.rotateWindow(ti.InternalRequest(defaultTestTenantKey, 1))
 	ti.AssertWindowStatus(
 		t, defaultTestTenantKey, 72,
@@ -636,3 +827,430 @@ func TestWindowRotationWithFutureSegments(t *testing.T) {
 	)
 
 }
+
+func TestWindowRotationWithClockGoingBackwards(t *testing.T) {
+	ti := buildDefaultInstance(t)
+
+	applySingleWindowLoadDistribution(t, ti, defaultTestTenantKey)
+	ti.AssertWindowStatus(
+		t, defaultTestTenantKey, 72,
+		"1008000:14", "1005000:15", "1004000:8", "1002000:20",
+		"1001000:10", "1000000:5",
+	)
+
+	// the clock is stepped back by a few segments:
+	// requests are clamped to the most recent segment
+	ti.TimeSet(1004500)
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 3)).Accepted)
+	ti.AssertWindowStatus(
+		t, defaultTestTenantKey, 75,
+		"1008000:17", "1005000:15", "1004000:8", "1002000:20",
+		"1001000:10", "1000000:5",
+	)
+
+	// even further back, beyond the window size
+	ti.TimeSet(990000)
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 5)).Accepted)
+	assert.False(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 50)).Accepted)
+	ti.AssertWindowStatus(
+		t, defaultTestTenantKey, 80,
+		"1008000:22", "1005000:15", "1004000:8", "1002000:20",
+		"1001000:10", "1000000:5",
+	)
+
+	// requests within the most recent segment are served as usual
+	ti.TimeSet(1008000)
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 1)).Accepted)
+	ti.AssertWindowStatus(t, defaultTestTenantKey, 81,
+		"1008000:23", "1005000:15", "1004000:8", "1002000:20",
+		"1001000:10", "1000000:5",
+	)
+
+	// the window rotates normally once the clock catches up
+	ti.TimeSet(1010500)
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 2)).Accepted)
+	ti.AssertWindowStatus(
+		t, defaultTestTenantKey, 78,
+		"1010000:2", "1008000:23", "1005000:15", "1004000:8",
+		"1002000:20", "1001000:10",
+	)
+}
+
+func TestFixedWindow(t *testing.T) {
+	ti := buildInstance(t, func(config *Config) {
+		config.WindowSegmentSize = 0
+		config.Algorithm = AlgorithmFixedWindow
+	})
+
+	// the window is aligned to 1000000 -> 1010000
+	ti.TimeTravel(2500)
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 60)).Accepted)
+	ti.TimeTravel(5000)
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 40)).Accepted)
+	ti.AssertWindowStatus(t, defaultTestTenantKey, 100, "1000000:100")
+
+	// RetryIn is the time until the counter is reset
+	rejected := submitNoError(ti.Instance.Submit(defaultTestTenantKey, 1))
+	assert.False(t, rejected.Accepted)
+	assert.True(t, rejected.RetryInAvailable)
+	assert.Equal(t, int64(2500), rejected.RetryIn.Milliseconds())
+
+	// the whole load is released at the window boundary
+	ti.TimeTravel(2500)
+	assert.True(t, noErrors(ti.Instance.Probe(defaultTestTenantKey, 100)).(bool))
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 30)).Accepted)
+	ti.AssertWindowStatus(t, defaultTestTenantKey, 30, "1010000:30")
+
+	// skipping several windows still resets the single counter
+	ti.TimeTravel(35000)
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 10)).Accepted)
+	ti.AssertWindowStatus(t, defaultTestTenantKey, 10, "1040000:10")
+}
+
+func TestFixedWindowWithOverstepPenalty(t *testing.T) {
+	ti := buildInstance(t, func(config *Config) {
+		config.WindowSegmentSize = 0
+		config.Algorithm = AlgorithmFixedWindow
+		config.OverstepPenaltyFactor = 0.2
+	})
+
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 90)).Accepted)
+	assert.False(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 20)).Accepted)
+
+	// the penalty is charged to the single counter and released with it
+	ti.AssertWindowStatus(t, defaultTestTenantKey, 110, "1000000:110")
+
+	ti.TimeTravel(10000)
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 20)).Accepted)
+	ti.AssertWindowStatus(t, defaultTestTenantKey, 20, "1010000:20")
+}
+
+func TestPenaltyDecay(t *testing.T) {
+	ti := buildInstance(t, func(config *Config) {
+		config.OverstepPenaltyFactor = 0.2
+		config.PenaltyDecayFactor = 0.5
+	})
+
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 90)).Accepted)
+	assert.False(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 20)).Accepted)
+	ti.AssertWindowStatus(t, defaultTestTenantKey, 110, "1000000:110")
+
+	stats, err := ti.Instance.Stats(defaultTestTenantKey)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(20), stats.WindowPenaltyTotal)
+	assert.Equal(t, []uint64{20}, stats.WindowSegmentPenalties)
+
+	// after two segments the penalty is down to a quarter,
+	// while the regular load is still in the window
+	ti.TimeTravel(2000)
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 5)).Accepted)
+	ti.AssertWindowStatus(t, defaultTestTenantKey, 100, "1002000:5", "1000000:95")
+
+	stats, err = ti.Instance.Stats(defaultTestTenantKey)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(5), stats.WindowPenaltyTotal)
+	assert.Equal(t, []uint64{0, 5}, stats.WindowSegmentPenalties)
+
+	// the penalty is rounded down and eventually disappears
+	ti.TimeTravel(3000)
+	assert.False(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 20)).Accepted)
+	ti.AssertWindowStatus(t, defaultTestTenantKey, 115, "1005000:20", "1002000:5", "1000000:90")
+
+	stats, err = ti.Instance.Stats(defaultTestTenantKey)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(20), stats.WindowPenaltyTotal)
+	assert.Equal(t, []uint64{20, 0, 0}, stats.WindowSegmentPenalties)
+}
+
+func TestPenaltyLoadIsHeldSeparately(t *testing.T) {
+	ti := buildInstance(t, func(config *Config) {
+		config.OverstepPenaltyFactor = 0.2
+		config.MaxPenaltyCapFactor = 0.1
+	})
+
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 95)).Accepted)
+	assert.False(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 10)).Accepted)
+
+	// the penalty of 20 is capped at 110, trimming the penalty load first
+	segment := ti.Instance.getTenant(defaultTestTenantKey).WindowQueue.Front().(*windowSegment)
+	assert.Equal(t, uint64(95), segment.Value)
+	assert.Equal(t, uint64(15), segment.PenaltyValue)
+	ti.AssertWindowStatus(t, defaultTestTenantKey, 110, "1000000:110")
+
+	// refunds are taken from the accepted load
+	assert.Nil(t, ti.Instance.Refund(defaultTestTenantKey, 50))
+	assert.Equal(t, uint64(45), segment.Value)
+	assert.Equal(t, uint64(15), segment.PenaltyValue)
+
+	stats, err := ti.Instance.Stats(defaultTestTenantKey)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(60), stats.WindowTotal)
+	assert.Equal(t, uint64(15), stats.WindowPenaltyTotal)
+	assert.Equal(t, []uint64{60}, stats.WindowSegments)
+	assert.Equal(t, []uint64{15}, stats.WindowSegmentPenalties)
+
+	copied, err := ti.Instance.CopyTenantState(defaultTestTenantKey)
+	assert.Nil(t, err)
+	assert.Equal(t, []SegmentState{{StartTime: 1000000, Value: 45, PenaltyValue: 15}}, copied.Segments)
+}
+
+func TestPenaltyDecayDoesNotAffectRegularLoad(t *testing.T) {
+	ti := buildInstance(t, func(config *Config) {
+		config.PenaltyDecayFactor = 1.0
+	})
+
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 60)).Accepted)
+	ti.TimeTravel(5000)
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 40)).Accepted)
+	ti.AssertWindowStatus(t, defaultTestTenantKey, 100, "1005000:40", "1000000:60")
+}
+
+func TestAggregationModeMax(t *testing.T) {
+	ti := buildInstance(t, func(config *Config) {
+		config.AggregationMode = AggregationMax
+	})
+
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 60)).Accepted)
+
+	// the current segment would go over the max load
+	rejected := submitNoError(ti.Instance.Submit(defaultTestTenantKey, 50))
+	assert.False(t, rejected.Accepted)
+	assert.True(t, rejected.RetryInAvailable)
+	assert.Equal(t, int64(1000), rejected.RetryIn.Milliseconds())
+
+	// a new segment is evaluated on its own even if the window total exceeds the max load
+	ti.TimeTravel(1000)
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 50)).Accepted)
+	ti.AssertWindowStatus(t, defaultTestTenantKey, 110, "1001000:50", "1000000:60")
+
+	// waiting for the next segment is enough for the load to fit
+	rejected = submitNoError(ti.Instance.Submit(defaultTestTenantKey, 60))
+	assert.False(t, rejected.Accepted)
+	assert.True(t, rejected.RetryInAvailable)
+	assert.Equal(t, int64(1000), rejected.RetryIn.Milliseconds())
+
+	// loads over the max load will never fit
+	rejected = submitNoError(ti.Instance.Submit(defaultTestTenantKey, 101))
+	assert.False(t, rejected.Accepted)
+	assert.False(t, rejected.RetryInAvailable)
+}
+
+func TestAggregationModeMaxCapping(t *testing.T) {
+	ti := buildInstance(t, func(config *Config) {
+		config.AggregationMode = AggregationMax
+		config.OverstepPenaltyFactor = 1.0
+		config.MaxPenaltyCapFactor = 0.2
+	})
+
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 90)).Accepted)
+	ti.TimeTravel(1000)
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 90)).Accepted)
+
+	// the overstep penalty is capped on the single segment
+	assert.False(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 20)).Accepted)
+	ti.AssertWindowStatus(t, defaultTestTenantKey, 210, "1001000:120", "1000000:90")
+}
+
+func TestAggregationModeWeightedAvg(t *testing.T) {
+	ti := buildInstance(t, func(config *Config) {
+		config.AggregationMode = AggregationWeightedAvg
+	})
+
+	// 50 in the current segment weighs as ~91
+	assert.True(t, noErrors(ti.Instance.Probe(defaultTestTenantKey, 50)).(bool))
+	assert.False(t, noErrors(ti.Instance.Probe(defaultTestTenantKey, 60)).(bool))
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 50)).Accepted)
+
+	// 60 in the current segment weighs as ~110
+	rejected := submitNoError(ti.Instance.Submit(defaultTestTenantKey, 10))
+	assert.False(t, rejected.Accepted)
+	assert.True(t, rejected.RetryInAvailable)
+	assert.Equal(t, int64(1000), rejected.RetryIn.Milliseconds())
+
+	// after a segment the older load weighs less
+	ti.TimeTravel(1000)
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 10)).Accepted)
+	ti.AssertWindowStatus(t, defaultTestTenantKey, 60, "1001000:10", "1000000:50")
+
+	// loads that would never fit
+	rejected = submitNoError(ti.Instance.Submit(defaultTestTenantKey, 60))
+	assert.False(t, rejected.Accepted)
+	assert.False(t, rejected.RetryInAvailable)
+}
+
+func TestTruncateAfter(t *testing.T) {
+	ti := buildDefaultInstance(t)
+
+	applySingleWindowLoadDistribution(t, ti, defaultTestTenantKey)
+	versionBefore := ti.Instance.getTenant(defaultTestTenantKey).Version
+
+	// cut in the middle of the window
+	cutoff := time.UnixMilli(1004000)
+	assert.Nil(t, ti.Instance.TruncateAfter(defaultTestTenantKey, cutoff))
+
+	ti.AssertWindowStatus(
+		t,
+		defaultTestTenantKey,
+		35,
+		"1002000:20",
+		"1001000:10",
+		"1000000:5",
+	)
+	assert.True(t, ti.Instance.getTenant(defaultTestTenantKey).Version > versionBefore)
+
+	// the window keeps working as usual
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 65)).Accepted)
+	ti.AssertWindowStatus(
+		t,
+		defaultTestTenantKey,
+		100,
+		"1009000:65",
+		"1002000:20",
+		"1001000:10",
+		"1000000:5",
+	)
+
+	// a cutoff in the future does not change anything
+	versionBefore = ti.Instance.getTenant(defaultTestTenantKey).Version
+	assert.Nil(t, ti.Instance.TruncateAfter(defaultTestTenantKey, time.UnixMilli(1010000)))
+	assert.Equal(t, versionBefore, ti.Instance.getTenant(defaultTestTenantKey).Version)
+
+	assert.Nil(t, ti.Instance.Close())
+	assert.ErrorIs(t, ti.Instance.TruncateAfter(defaultTestTenantKey, cutoff), ErrLimiterClosed)
+}
+
+func TestCompositeTruncateAfter(t *testing.T) {
+	ti := buildDefaultCompositeInstance(t)
+
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 5)).Accepted)
+	ti.TimeTravel(500)
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 7)).Accepted)
+	ti.AssertWindowStatus(t, defaultTestTenantKey, []uint64{12, 12}, "0:1000000:12", "1:1000500:7", "1:1000000:5")
+
+	assert.Nil(t, ti.Instance.TruncateAfter(defaultTestTenantKey, time.UnixMilli(1000500)))
+	ti.AssertWindowStatus(t, defaultTestTenantKey, []uint64{12, 5}, "0:1000000:12", "1:1000000:5")
+
+	assert.ErrorIs(t, ti.Instance.TruncateAfter("a;b", time.UnixMilli(1000500)), ErrInvalidTenantKey)
+
+	assert.Nil(t, ti.Instance.Close())
+	assert.ErrorIs(t, ti.Instance.TruncateAfter(defaultTestTenantKey, time.UnixMilli(1000500)), ErrLimiterClosed)
+}
+
+func TestComputeRetryInWithJitter(t *testing.T) {
+	ti := buildInstance(t, func(config *Config) {
+		config.RetryInJitterFactor = 0.5
+	})
+
+	applySingleWindowLoadDistribution(t, ti, defaultTestTenantKey)
+
+	// without jitter RetryIn for 29 would be 1000 ms
+	base := time.Second
+	seen := make(map[time.Duration]bool)
+
+	for i := 0; i < 1000; i++ {
+		retryIn, err := ti.Instance.computeRetryIn(ti.InternalRequest(defaultTestTenantKey, 29))
+		assert.Nil(t, err)
+		assert.GreaterOrEqual(t, retryIn, base)
+		assert.LessOrEqual(t, retryIn, time.Duration(float64(base)*1.5))
+		seen[retryIn] = true
+	}
+	assert.Greater(t, len(seen), 1)
+
+	// the actual time to availability is not affected
+	available, err := ti.Instance.TimeToAvailable(defaultTestTenantKey, 29)
+	assert.Nil(t, err)
+	assert.Equal(t, base, available)
+
+	// the jitter is applied before the cap
+	ti.Instance.Config.MaxRetryIn = base
+	for i := 0; i < 100; i++ {
+		retryIn, err := ti.Instance.computeRetryIn(ti.InternalRequest(defaultTestTenantKey, 29))
+		assert.Nil(t, err)
+		assert.Equal(t, base, retryIn)
+	}
+}
+
+func TestPenaltyWarmup(t *testing.T) {
+	ti := buildInstance(t, func(config *Config) {
+		config.OverstepPenaltyFactor = 0.2
+		config.RequestOverheadPenaltyFactor = 0.5
+		config.WarmupDuration = 3 * time.Second
+	})
+
+	// no penalties are applied during the warm-up
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 90)).Accepted)
+	assert.False(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 20)).Accepted)
+	assert.False(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 20)).Accepted)
+	ti.AssertWindowStatus(t, defaultTestTenantKey, 90, "1000000:90")
+	overloaded, err := ti.Instance.IsOverloaded(defaultTestTenantKey)
+	assert.Nil(t, err)
+	assert.True(t, overloaded)
+
+	// after the warm-up, penalties are applied as usual
+	ti.TimeTravel(3000)
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 5)).Accepted)
+	assert.False(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 20)).Accepted)
+	ti.AssertWindowStatus(t, defaultTestTenantKey, 115, "1003000:25", "1000000:90")
+}
+
+func TestPenaltyWarmupRequests(t *testing.T) {
+	ti := buildInstance(t, func(config *Config) {
+		config.OverstepPenaltyFactor = 0.2
+		config.WarmupRequests = 2
+	})
+
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 90)).Accepted)
+	assert.False(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 20)).Accepted)
+	ti.AssertWindowStatus(t, defaultTestTenantKey, 90, "1000000:90")
+
+	// the warm-up ends with the third request
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 5)).Accepted)
+	assert.False(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 20)).Accepted)
+	ti.AssertWindowStatus(t, defaultTestTenantKey, 115, "1000000:115")
+}
+
+func TestPenaltyGracePeriodAfterRecovery(t *testing.T) {
+	ti := buildInstance(t, func(config *Config) {
+		config.OverstepPenaltyFactor = 0.2
+		config.RequestOverheadPenaltyFactor = 0.5
+		config.GracePeriodAfterRecovery = 3 * time.Second
+	})
+
+	// a tenant that never recovered gets the overstep penalty
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 90)).Accepted)
+	assert.False(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 20)).Accepted)
+	ti.AssertWindowStatus(t, defaultTestTenantKey, 110, "1000000:110")
+
+	// right after recovering only the request overhead penalty is applied
+	ti.TimeTravel(10000)
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 5)).Accepted)
+	assert.False(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 96)).Accepted)
+	ti.AssertWindowStatus(t, defaultTestTenantKey, 53, "1010000:53")
+	assert.True(t, noErrors(ti.Instance.IsOverloaded(defaultTestTenantKey)).(bool))
+
+	// after the grace period the overstep penalty is applied as usual
+	ti.TimeTravel(10000)
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 5)).Accepted)
+	ti.TimeTravel(3000)
+	assert.False(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 96)).Accepted)
+	ti.AssertWindowStatus(t, defaultTestTenantKey, 25, "1023000:20", "1020000:5")
+}
+
+func TestAcceptanceSpreadSegments(t *testing.T) {
+	ti := buildInstance(t, func(config *Config) {
+		config.AcceptanceSpreadSegments = 4
+	})
+
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 10)).Accepted)
+	ti.AssertWindowStatus(t, defaultTestTenantKey, 10, "1000000:3", "999000:3", "998000:2", "997000:2")
+
+	ti.TimeTravel(2000)
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 2)).Accepted)
+	ti.AssertWindowStatus(t, defaultTestTenantKey, 12, "1002000:1", "1001000:1", "1000000:3", "999000:3", "998000:2", "997000:2")
+
+	// the older shares slide out earlier
+	res := submitNoError(ti.Instance.Submit(defaultTestTenantKey, 93))
+	assert.False(t, res.Accepted)
+	assert.True(t, res.RetryInAvailable)
+	assert.Equal(t, 7000*time.Millisecond, res.RetryIn)
+}
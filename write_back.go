@@ -0,0 +1,109 @@
+package goll
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// startWriteBackFlusher starts a background routine periodically
+// writing the pending changes to the remote store until Close is called.
+func (instance *loadLimiterDefaultImpl) startWriteBackFlusher() {
+	stop := make(chan struct{})
+	instance.stopFlusher = stop
+
+	ticker := time.NewTicker(instance.Config.WriteBackInterval)
+
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				instance.Lock.Lock()
+				if err := instance.flushWriteBacks(); err != nil {
+					instance.Logger.Error(fmt.Sprintf("could not write back pending changes: %v", err))
+				}
+				instance.Lock.Unlock()
+			}
+		}
+	}()
+}
+
+// Flush writes all the pending changes to the remote store
+// when the limiter was built with AsyncWriteBack = true.
+//
+// It does nothing otherwise. Tenants that could not be written
+// are kept pending and retried with the next write-back.
+func (instance *loadLimiterDefaultImpl) Flush() error {
+	instance.Lock.Lock()
+	defer instance.Lock.Unlock()
+
+	return instance.flushWriteBacks()
+}
+
+// markPendingWriteBack schedules the status of the given tenant
+// to be written with the next write-back.
+func (instance *loadLimiterDefaultImpl) markPendingWriteBack(tenantKey string) {
+	instance.tenantsLock.Lock()
+	defer instance.tenantsLock.Unlock()
+
+	if instance.pendingWriteBacks == nil {
+		instance.pendingWriteBacks = make(map[string]struct{})
+	}
+	instance.pendingWriteBacks[tenantKey] = struct{}{}
+}
+
+func (instance *loadLimiterDefaultImpl) hasPendingWriteBack(tenantKey string) bool {
+	instance.tenantsLock.Lock()
+	defer instance.tenantsLock.Unlock()
+
+	_, pending := instance.pendingWriteBacks[tenantKey]
+	return pending
+}
+
+// flushWriteBacks writes the status of every pending tenant,
+// returning the first error encountered.
+func (instance *loadLimiterDefaultImpl) flushWriteBacks() error {
+	var firstErr error
+
+	for tenantKey := range instance.pendingWriteBacks {
+		err := instance.writeBack(tenantKey)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		delete(instance.pendingWriteBacks, tenantKey)
+	}
+
+	return firstErr
+}
+
+func (instance *loadLimiterDefaultImpl) writeBack(tenantKey string) error {
+	adapter := instance.syncAdapterFor(tenantKey)
+	tenant, exists := instance.lookupTenant(tenantKey)
+	if adapter == nil || !exists {
+		// nothing left to write, ex. the tenant was evicted
+		return nil
+	}
+
+	adapterContext := context.Background()
+
+	if err := adapter.Lock(adapterContext, tenantKey); err != nil {
+		return fmt.Errorf("error acquiring lock: %v", err.Error())
+	}
+
+	werr := adapter.Write(adapterContext, tenantKey, instance.serializeStatus(tenantKey, tenant))
+
+	if rerr := adapter.Unlock(adapterContext, tenantKey); rerr != nil {
+		logInfow(instance.Logger, "[sync tx] could not release lock", "tenantKey", tenantKey, "error", rerr)
+	}
+
+	if werr != nil {
+		return &SyncFailed{Operation: "write", Cause: werr}
+	}
+	return nil
+}
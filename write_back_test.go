@@ -0,0 +1,119 @@
+package goll
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAsyncWriteBack(t *testing.T) {
+	adapter := testSyncAdapter{}
+	adapter.Clear()
+
+	ti := buildInstance(t, func(config *Config) {
+		config.SyncAdapter = &adapter
+		config.AsyncWriteBack = true
+		// keep the background routine from interfering with the test
+		config.WriteBackInterval = time.Hour
+	})
+	defer ti.Instance.Close()
+
+	adapter.returning[defaultTestTenantKey] = "v1/4/15/0/1000000:15"
+
+	// the first change fetches the remote status but does not write it
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 5)).Accepted)
+	assert.Equal(t, []string{
+		"LOCK test",
+		"FETCH test",
+		"UNLOCK test",
+	}, adapter.collector)
+
+	// further changes and reads only work on the local state
+	adapter.Clear()
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 10)).Accepted)
+	assert.True(t, noErrors(ti.Instance.Probe(defaultTestTenantKey, 10)).(bool))
+	assert.Equal(t, []string{}, adapter.collector)
+	ti.AssertWindowStatus(t, defaultTestTenantKey, 30, "1000000:30")
+
+	// changes are coalesced in a single write
+	assert.Nil(t, ti.Instance.Flush())
+	assert.Equal(t, []string{
+		"LOCK test",
+		"WRITE test v2/ver=6/total=30/over=0/seg=1000000:30/acc=2/rej=0",
+		"UNLOCK test",
+	}, adapter.collector)
+
+	// nothing left to write
+	adapter.collector = adapter.collector[:0]
+	assert.Nil(t, ti.Instance.Flush())
+	assert.Equal(t, []string{}, adapter.collector)
+
+	// after the write-back the remote status is fetched again
+	adapter.returning[defaultTestTenantKey] = "v2/ver=9/total=50/seg=1000000:50"
+	assert.False(t, noErrors(ti.Instance.Probe(defaultTestTenantKey, 60)).(bool))
+	assert.Equal(t, []string{
+		"LOCK test",
+		"FETCH test",
+		"UNLOCK test",
+	}, adapter.collector)
+	ti.AssertWindowStatus(t, defaultTestTenantKey, 50, "1000000:50")
+}
+
+func TestAsyncWriteBackErrors(t *testing.T) {
+	adapter := testSyncAdapter{}
+	adapter.Clear()
+
+	ti := buildInstance(t, func(config *Config) {
+		config.SyncAdapter = &adapter
+		config.AsyncWriteBack = true
+		config.WriteBackInterval = time.Hour
+	})
+
+	assert.True(t, submitNoError(ti.Instance.Submit(defaultTestTenantKey, 5)).Accepted)
+
+	adapter.WriteStatusMock = func(sc context.Context, tk string, s string) error {
+		return errors.New("I could not")
+	}
+
+	err := ti.Instance.Flush()
+	assert.ErrorIs(t, err, ErrSyncFailed)
+	assert.True(t, ti.Instance.hasPendingWriteBack(defaultTestTenantKey))
+
+	// pending changes are written on close
+	adapter.Clear()
+	assert.Nil(t, ti.Instance.Close())
+	assert.Equal(t, []string{
+		"LOCK test",
+		"WRITE test v2/ver=3/total=5/over=0/seg=1000000:5/acc=1/rej=0",
+		"UNLOCK test",
+	}, adapter.collector)
+	assert.False(t, ti.Instance.hasPendingWriteBack(defaultTestTenantKey))
+}
+
+func TestAsyncWriteBackRoutine(t *testing.T) {
+	adapter := testSyncAdapter{}
+	adapter.Clear()
+
+	instance, err := New(&Config{
+		MaxLoad:           100,
+		WindowSize:        time.Second,
+		SyncAdapter:       &adapter,
+		AsyncWriteBack:    true,
+		WriteBackInterval: 5 * time.Millisecond,
+	})
+	assert.Nil(t, err)
+	defer instance.Close()
+
+	impl := instance.(*loadLimiterDefaultImpl)
+
+	_, _ = instance.Submit(defaultTestTenantKey, 1)
+
+	assert.Eventually(t, func() bool {
+		impl.Lock.Lock()
+		defer impl.Lock.Unlock()
+		return adapter.returning[defaultTestTenantKey] != ""
+	}, time.Second, 5*time.Millisecond)
+}